@@ -0,0 +1,85 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// AppData is the first byte of every app data payload.
+const AppData = 0x50
+
+// The Append functions are the inverse of the parsers, they append the
+// payload of a message, including the app data byte, to dst and return the
+// extended buffer. Floats are written as float32, as the sensor sends them,
+// so they only round trip if they are float32 values.
+
+// AppendRespiration appends the payload of a respiration app message.
+func AppendRespiration(dst []byte, r Respiration) []byte {
+	dst = append(dst, AppData)
+	dst = binary.LittleEndian.AppendUint32(dst, r.Status)
+	dst = binary.LittleEndian.AppendUint32(dst, r.Counter)
+	dst = binary.LittleEndian.AppendUint32(dst, r.State)
+	dst = binary.LittleEndian.AppendUint32(dst, r.RPM)
+	dst = appendFloat32(dst, r.Distance)
+	dst = appendFloat32(dst, r.Movement)
+	return binary.LittleEndian.AppendUint32(dst, uint32(r.SignalQuality))
+}
+
+// AppendSleep appends the payload of a sleep app message.
+func AppendSleep(dst []byte, s Sleep) []byte {
+	dst = append(dst, AppData)
+	dst = binary.LittleEndian.AppendUint32(dst, s.Status)
+	dst = binary.LittleEndian.AppendUint32(dst, s.Counter)
+	dst = binary.LittleEndian.AppendUint32(dst, s.State)
+	dst = appendFloat32(dst, s.RPM)
+	dst = appendFloat32(dst, s.Distance)
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(s.SignalQuality))
+	dst = appendFloat32(dst, s.MovementSlow)
+	return appendFloat32(dst, s.MovementFast)
+}
+
+// AppendBaseBandAP appends the payload of a baseband amplitude and phase
+// message with samples in format. The bin count written is the number of
+// amplitudes, missing phases are written as zero.
+func AppendBaseBandAP(dst []byte, ap BaseBandAmpPhase, format Format) []byte {
+	return appendBaseBand(dst, ap.BaseBandHeader, ap.Amplitude, ap.Phase, format)
+}
+
+// AppendBaseBandIQ appends the payload of a baseband I and Q message with
+// samples in format. The bin count written is the number of I samples,
+// missing Q samples are written as zero.
+func AppendBaseBandIQ(dst []byte, iq BaseBandIQ, format Format) []byte {
+	return appendBaseBand(dst, iq.BaseBandHeader, iq.SigI, iq.SigQ, format)
+}
+
+func appendBaseBand(dst []byte, h BaseBandHeader, a, b []float64, format Format) []byte {
+	dst = append(dst, AppData)
+	dst = binary.LittleEndian.AppendUint32(dst, h.Status)
+	dst = binary.LittleEndian.AppendUint32(dst, h.Counter)
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(len(a)))
+	for _, f := range []float64{h.BinLength, h.SamplingFreq, h.CarrierFreq, h.RangeOffset} {
+		dst = appendFloat32(dst, f)
+	}
+	for _, s := range [][]float64{a, b} {
+		for i := range a {
+			var v float64
+			if i < len(s) {
+				v = s[i]
+			}
+			dst = binary.LittleEndian.AppendUint32(dst, EncodeSample(v, format))
+		}
+	}
+	return dst
+}
+
+// EncodeSample encodes a baseband sample as DecodeSample decodes it.
+func EncodeSample(v float64, format Format) uint32 {
+	if format == FormatInt {
+		return uint32(int32(math.Round(v / IntScale)))
+	}
+	return math.Float32bits(float32(v))
+}
+
+func appendFloat32(dst []byte, f float64) []byte {
+	return binary.LittleEndian.AppendUint32(dst, math.Float32bits(float32(f)))
+}
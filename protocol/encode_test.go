@@ -0,0 +1,63 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestAppendRespiration(t *testing.T) {
+	// the payload of TestParseRespiration
+	want := make([]byte, RespirationSize)
+	want[0] = 0x50
+	binary.LittleEndian.PutUint32(want[1:], 594935334)
+	binary.LittleEndian.PutUint32(want[5:], 7)
+	binary.LittleEndian.PutUint32(want[9:], 3)
+	binary.LittleEndian.PutUint32(want[13:], 14)
+	binary.LittleEndian.PutUint32(want[17:], math.Float32bits(0.75))
+	binary.LittleEndian.PutUint32(want[21:], math.Float32bits(-1.5))
+	binary.LittleEndian.PutUint32(want[25:], 9)
+
+	r := Respiration{Status: 594935334, Counter: 7, State: 3, RPM: 14, Distance: 0.75, SignalQuality: 9, Movement: -1.5}
+	b := AppendRespiration([]byte{0xff}, r)
+	if !bytes.Equal(b[1:], want) || b[0] != 0xff {
+		t.Errorf("Expected: %x, got %x\n", want, b[1:])
+	}
+}
+
+func TestAppendRoundTrip(t *testing.T) {
+	header := BaseBandHeader{Status: 0x0c, Counter: 9, Bins: 3, BinLength: 0.0514, SamplingFreq: 39e9, CarrierFreq: 7.29e9, RangeOffset: 0.2}
+	// round to float32 as the sensor sends them
+	for _, f := range []*float64{&header.BinLength, &header.SamplingFreq, &header.CarrierFreq, &header.RangeOffset} {
+		*f = float64(float32(*f))
+	}
+	resp := Respiration{Status: 594935334, Counter: 0x7e7d, State: 2, RPM: 17, Distance: 1.25, SignalQuality: 8, Movement: 0.5}
+	if got, err := ParseRespiration(AppendRespiration(nil, resp)); err != nil || got != resp {
+		t.Errorf("Expected: %+v, got %+v %v\n", resp, got, err)
+	}
+	sleep := Sleep{Status: 594911596, Counter: 3, State: 1, RPM: 12.5, Distance: 0.75, SignalQuality: 4, MovementSlow: 0.25, MovementFast: 3}
+	if got, err := ParseSleep(AppendSleep(nil, sleep)); err != nil || got != sleep {
+		t.Errorf("Expected: %+v, got %+v %v\n", sleep, got, err)
+	}
+	for _, format := range []Format{FormatFloat, FormatInt} {
+		iq := BaseBandIQ{header, []float64{1, -0.5, 0.25}, []float64{-2, 0, 0.125}}
+		got, err := ParseBaseBandIQ(AppendBaseBandIQ(nil, iq, format), format)
+		if err != nil || !reflect.DeepEqual(got, iq) {
+			t.Errorf("format %d Expected: %+v, got %+v %v\n", format, iq, got, err)
+		}
+		ap := BaseBandAmpPhase{header, []float64{2, 1, 0.5}, []float64{3, -3, 0}}
+		ap.Status = 0x0d
+		gotAP, err := ParseBaseBandAP(AppendBaseBandAP(nil, ap, format), format)
+		if err != nil || !reflect.DeepEqual(gotAP, ap) {
+			t.Errorf("format %d Expected: %+v, got %+v %v\n", format, ap, gotAP, err)
+		}
+	}
+	// the bin count is the number of samples
+	short := BaseBandIQ{BaseBandHeader: header, SigI: []float64{1}}
+	got, err := ParseBaseBandIQ(AppendBaseBandIQ(nil, short, FormatFloat), FormatFloat)
+	if err != nil || got.Bins != 1 || !reflect.DeepEqual(got.SigQ, []float64{0}) {
+		t.Errorf("Expected: 1 bin with a zero Q, got %+v %v\n", got, err)
+	}
+}
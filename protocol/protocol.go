@@ -0,0 +1,255 @@
+// Package protocol parses X2M200 application payloads. It has no side
+// effects, it does no IO, logging or timekeeping, so it can be used by tools
+// working on captured payloads. The xethru package delegates to it.
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Payload sizes
+const (
+	RespirationSize    = 29
+	SleepSize          = 33
+	BaseBandHeaderSize = 29
+)
+
+// Baseband message IDs, the Status of a baseband message. Its first byte,
+// the one after the app data byte, says which kind of message it is.
+const (
+	BaseBandAmpPhaseID = 0x0d
+	BaseBandIQID       = 0x0c
+)
+
+// Format is the encoding of the samples in baseband messages.
+type Format byte
+
+// Baseband sample formats, older X2M200 firmware sends signed 32 bit integers
+// instead of float32.
+const (
+	FormatFloat Format = iota
+	FormatInt
+)
+
+// IntScale converts legacy integer samples to the float scale.
+const IntScale = 1.0 / (1 << 16)
+
+// ErrParse is wrapped by every error returned while parsing a payload.
+var ErrParse = errors.New("parse error")
+
+// Parse errors
+var (
+	ErrRespirationLength = fmt.Errorf("%w: response does not contain enough bytes", ErrParse)
+	ErrSleepLength       = fmt.Errorf("%w: response does not contain enough bytes", ErrParse)
+	ErrAmpPhaseLength    = fmt.Errorf("%w: baseband data does contain enough bytes", ErrParse)
+	ErrAmpPhaseSamples   = fmt.Errorf("%w: baseband data does contain a full packet of data", ErrParse)
+	ErrIQLength          = fmt.Errorf("%w: baseband data does contain enough bytes", ErrParse)
+	ErrIQSamples         = fmt.Errorf("%w: baseband data does contain a full packet of data", ErrParse)
+	ErrFormatUnknown     = fmt.Errorf("%w: baseband data format is not recognised", ErrParse)
+	ErrInvalidSample     = fmt.Errorf("%w: baseband data contains a NaN or Inf sample, check the baseband format", ErrParse)
+)
+
+// LengthError is returned by the parsers when a payload is the wrong length.
+type LengthError struct {
+	Err  error
+	Want int
+	Got  int
+}
+
+func (e *LengthError) Error() string {
+	return fmt.Sprintf("%v: want %d bytes, got %d", e.Err, e.Want, e.Got)
+}
+
+// Unwrap returns Err.
+func (e *LengthError) Unwrap() error {
+	return e.Err
+}
+
+// Respiration is a respiration app message.
+type Respiration struct {
+	Status        uint32
+	Counter       uint32
+	State         uint32
+	RPM           uint32
+	Distance      float64
+	SignalQuality float64
+	Movement      float64
+}
+
+// Sleep is a sleep app message.
+type Sleep struct {
+	Status        uint32
+	Counter       uint32
+	State         uint32
+	RPM           float64
+	Distance      float64
+	SignalQuality float64
+	MovementSlow  float64
+	MovementFast  float64
+}
+
+// BaseBandHeader is the header shared by the baseband messages.
+type BaseBandHeader struct {
+	Status       uint32
+	Counter      uint32
+	Bins         uint32
+	BinLength    float64
+	SamplingFreq float64
+	CarrierFreq  float64
+	RangeOffset  float64
+}
+
+// BaseBandAmpPhase is a baseband amplitude and phase message.
+type BaseBandAmpPhase struct {
+	BaseBandHeader
+	Amplitude []float64
+	Phase     []float64
+}
+
+// BaseBandIQ is a baseband I and Q message.
+type BaseBandIQ struct {
+	BaseBandHeader
+	SigI []float64
+	SigQ []float64
+}
+
+// ParseRespiration parses a respiration app payload, including the app data
+// byte.
+func ParseRespiration(b []byte) (Respiration, error) {
+	if len(b) != RespirationSize {
+		return Respiration{}, &LengthError{Err: ErrRespirationLength, Want: RespirationSize, Got: len(b)}
+	}
+	return Respiration{
+		Status:        binary.LittleEndian.Uint32(b[1:5]),
+		Counter:       binary.LittleEndian.Uint32(b[5:9]),
+		State:         binary.LittleEndian.Uint32(b[9:13]),
+		RPM:           binary.LittleEndian.Uint32(b[13:17]),
+		Distance:      float32At(b, 17),
+		Movement:      float32At(b, 21),
+		SignalQuality: float64(binary.LittleEndian.Uint32(b[25:29])),
+	}, nil
+}
+
+// ParseSleep parses a sleep app payload, including the app data byte.
+func ParseSleep(b []byte) (Sleep, error) {
+	if len(b) != SleepSize {
+		return Sleep{}, &LengthError{Err: ErrSleepLength, Want: SleepSize, Got: len(b)}
+	}
+	return Sleep{
+		Status:        binary.LittleEndian.Uint32(b[1:5]),
+		Counter:       binary.LittleEndian.Uint32(b[5:9]),
+		State:         binary.LittleEndian.Uint32(b[9:13]),
+		RPM:           float32At(b, 13),
+		Distance:      float32At(b, 17),
+		SignalQuality: float64(binary.LittleEndian.Uint32(b[21:25])),
+		MovementSlow:  float32At(b, 25),
+		MovementFast:  float32At(b, 29),
+	}, nil
+}
+
+// parseBaseBandHeader parses the header of a baseband message, b must be at
+// least BaseBandHeaderSize long.
+func parseBaseBandHeader(b []byte) BaseBandHeader {
+	return BaseBandHeader{
+		Status:       binary.LittleEndian.Uint32(b[1:5]),
+		Counter:      binary.LittleEndian.Uint32(b[5:9]),
+		Bins:         binary.LittleEndian.Uint32(b[9:13]),
+		BinLength:    float32At(b, 13),
+		SamplingFreq: float32At(b, 17),
+		CarrierFreq:  float32At(b, 21),
+		RangeOffset:  float32At(b, 25),
+	}
+}
+
+// ParseBaseBandAP parses a baseband amplitude and phase payload, including the
+// app data byte. When the samples can not be parsed the header and any
+// samples parsed are returned with the error.
+func ParseBaseBandAP(b []byte, format Format) (BaseBandAmpPhase, error) {
+	var ap BaseBandAmpPhase
+	h, err := baseBandHeader(b, format, ErrAmpPhaseLength)
+	if err != nil {
+		return ap, err
+	}
+	ap.BaseBandHeader = h
+	if !hasSamples(b, h.Bins) {
+		return ap, &LengthError{Err: ErrAmpPhaseSamples, Want: BaseBandHeaderSize + 8*int(h.Bins), Got: len(b)}
+	}
+	ap.Amplitude, err = decodeSamples(b[BaseBandHeaderSize:], h.Bins, format)
+	if err != nil {
+		return ap, err
+	}
+	ap.Phase, err = decodeSamples(b[BaseBandHeaderSize+4*int(h.Bins):], h.Bins, format)
+	return ap, err
+}
+
+// ParseBaseBandIQ parses a baseband I and Q payload, including the app data
+// byte. When the samples can not be parsed the header and any samples parsed
+// are returned with the error.
+func ParseBaseBandIQ(b []byte, format Format) (BaseBandIQ, error) {
+	var iq BaseBandIQ
+	h, err := baseBandHeader(b, format, ErrIQLength)
+	if err != nil {
+		return iq, err
+	}
+	iq.BaseBandHeader = h
+	if !hasSamples(b, h.Bins) {
+		return iq, &LengthError{Err: ErrIQSamples, Want: BaseBandHeaderSize + 8*int(h.Bins), Got: len(b)}
+	}
+	iq.SigI, err = decodeSamples(b[BaseBandHeaderSize:], h.Bins, format)
+	if err != nil {
+		return iq, err
+	}
+	iq.SigQ, err = decodeSamples(b[BaseBandHeaderSize+4*int(h.Bins):], h.Bins, format)
+	return iq, err
+}
+
+func baseBandHeader(b []byte, format Format, short error) (BaseBandHeader, error) {
+	if format != FormatFloat && format != FormatInt {
+		return BaseBandHeader{}, ErrFormatUnknown
+	}
+	if len(b) < BaseBandHeaderSize {
+		return BaseBandHeader{}, &LengthError{Err: short, Want: BaseBandHeaderSize, Got: len(b)}
+	}
+	return parseBaseBandHeader(b), nil
+}
+
+// hasSamples reports whether b holds the header and two blocks of bins
+// samples, the sum is done in 64 bits so a corrupt bin count can not wrap.
+func hasSamples(b []byte, bins uint32) bool {
+	return uint64(len(b)) >= BaseBandHeaderSize+8*uint64(bins)
+}
+
+// decodeSamples decodes n samples from b, on error it returns the samples
+// decoded before the bad one.
+func decodeSamples(b []byte, n uint32, format Format) ([]float64, error) {
+	var s []float64
+	for i := 0; i < int(n); i++ {
+		v, err := DecodeSample(b[4*i:4*i+4], format)
+		if err != nil {
+			return s, err
+		}
+		s = append(s, v)
+	}
+	return s, nil
+}
+
+// DecodeSample decodes a 4 byte baseband sample. Float samples that are NaN or
+// Inf return ErrInvalidSample, as they are usually integer samples decoded
+// with the wrong format.
+func DecodeSample(b []byte, format Format) (float64, error) {
+	if format == FormatInt {
+		return float64(int32(binary.LittleEndian.Uint32(b))) * IntScale, nil
+	}
+	v := float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, ErrInvalidSample
+	}
+	return v, nil
+}
+
+func float32At(b []byte, i int) float64 {
+	return float64(math.Float32frombits(binary.LittleEndian.Uint32(b[i : i+4])))
+}
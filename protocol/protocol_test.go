@@ -0,0 +1,116 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestParseRespiration(t *testing.T) {
+	b := make([]byte, RespirationSize)
+	b[0] = 0x50
+	binary.LittleEndian.PutUint32(b[1:], 594935334)
+	binary.LittleEndian.PutUint32(b[5:], 7)
+	binary.LittleEndian.PutUint32(b[9:], 3)
+	binary.LittleEndian.PutUint32(b[13:], 14)
+	binary.LittleEndian.PutUint32(b[17:], math.Float32bits(0.75))
+	binary.LittleEndian.PutUint32(b[21:], math.Float32bits(-1.5))
+	binary.LittleEndian.PutUint32(b[25:], 9)
+
+	cases := []struct {
+		b    []byte
+		err  error
+		resp Respiration
+	}{
+		{b[:2], ErrRespirationLength, Respiration{}},
+		{b, nil, Respiration{Status: 594935334, Counter: 7, State: 3, RPM: 14, Distance: 0.75, SignalQuality: 9, Movement: -1.5}},
+	}
+	for n, c := range cases {
+		resp, err := ParseRespiration(c.b)
+		if !errors.Is(err, c.err) {
+			t.Errorf("test %d Expected: %v, got %v\n", n, c.err, err)
+		}
+		if resp != c.resp {
+			t.Errorf("test %d Expected: %#v, got %#v\n", n, c.resp, resp)
+		}
+	}
+}
+
+func TestParseBaseBandIQ(t *testing.T) {
+	// header with 2 bins, followed by I0 I1 Q0 Q1
+	b := make([]byte, BaseBandHeaderSize+16)
+	b[0], b[1] = 0x50, 0x0c
+	binary.LittleEndian.PutUint32(b[9:], 2)
+	binary.LittleEndian.PutUint32(b[13:], math.Float32bits(0.25))
+	floats := append([]byte(nil), b...)
+	ints := append([]byte(nil), b...)
+	for i, v := range []float32{1, -0.5, 3, 0.25} {
+		binary.LittleEndian.PutUint32(floats[BaseBandHeaderSize+4*i:], math.Float32bits(v))
+		binary.LittleEndian.PutUint32(ints[BaseBandHeaderSize+4*i:], uint32(int32(v*(1<<16))))
+	}
+	nan := append([]byte(nil), floats...)
+	binary.LittleEndian.PutUint32(nan[BaseBandHeaderSize+8:], math.Float32bits(float32(math.NaN())))
+
+	header := BaseBandHeader{Status: 0x0c, Bins: 2, BinLength: 0.25}
+	cases := []struct {
+		b      []byte
+		format Format
+		err    error
+		iq     BaseBandIQ
+	}{
+		{floats, FormatFloat, nil, BaseBandIQ{header, []float64{1, -0.5}, []float64{3, 0.25}}},
+		{ints, FormatInt, nil, BaseBandIQ{header, []float64{1, -0.5}, []float64{3, 0.25}}},
+		{floats, Format(9), ErrFormatUnknown, BaseBandIQ{}},
+		{floats[:3], FormatFloat, ErrIQLength, BaseBandIQ{}},
+		{floats[:BaseBandHeaderSize+4], FormatFloat, ErrIQSamples, BaseBandIQ{BaseBandHeader: header}},
+		{nan, FormatFloat, ErrInvalidSample, BaseBandIQ{header, []float64{1, -0.5}, nil}},
+	}
+	for n, c := range cases {
+		iq, err := ParseBaseBandIQ(c.b, c.format)
+		if !errors.Is(err, c.err) || !errors.Is(err, ErrParse) && c.err != nil {
+			t.Errorf("test %d Expected: %v, got %v\n", n, c.err, err)
+		}
+		if !reflect.DeepEqual(iq, c.iq) {
+			t.Errorf("test %d Expected: %#v, got %#v\n", n, c.iq, iq)
+		}
+	}
+
+	var lenErr *LengthError
+	if _, err := ParseBaseBandAP(floats[:3], FormatFloat); !errors.As(err, &lenErr) || lenErr.Want != BaseBandHeaderSize || lenErr.Got != 3 {
+		t.Errorf("Expected: length error want %d got 3, got %v\n", BaseBandHeaderSize, err)
+	}
+}
+
+func FuzzParsers(f *testing.F) {
+	f.Add(make([]byte, RespirationSize))
+	f.Add(make([]byte, SleepSize))
+	f.Add(make([]byte, BaseBandHeaderSize+8))
+	f.Add([]byte{0x50, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff})
+	f.Fuzz(func(t *testing.T, b []byte) {
+		// every list is decoded from the payload, so it can not be longer
+		bounded := func(name string, lists ...[]float64) {
+			var n int
+			for _, l := range lists {
+				n += len(l)
+			}
+			if 4*n > len(b) {
+				t.Errorf("%s Expected: at most %d values, got %d\n", name, len(b)/4, n)
+			}
+		}
+		ParseRespiration(b)
+		ParseSleep(b)
+		for _, format := range []Format{FormatFloat, FormatInt, 7} {
+			ap, _ := ParseBaseBandAP(b, format)
+			bounded("amplitude/phase", ap.Amplitude, ap.Phase)
+			iq, _ := ParseBaseBandIQ(b, format)
+			bounded("iq", iq.SigI, iq.SigQ)
+		}
+		pml, _ := ParsePresenceMovingList(b)
+		bounded("presence movinglist", pml.MovementSlow, pml.MovementFast, pml.Distance, pml.RCS, pml.Velocity)
+		ParsePresenceSingle(b)
+		d, _ := ParseData(b)
+		bounded("data", d.Float)
+	})
+}
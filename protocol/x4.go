@@ -0,0 +1,164 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// X4 module protocol message IDs and data types. X4 modules send the
+// respiration, sleep and baseband messages with the same layout as the
+// X2M200, and add presence messages and generic data responses. The IDs are
+// taken from the module communication protocol documentation and should be
+// checked against the module's firmware.
+const (
+	DataResponse = 0xa0 // XTS_SPR_DATA
+	DataByte     = 0x00 // XTS_SPRD_BYTE
+	DataFloat    = 0x01 // XTS_SPRD_FLOAT
+
+	PresenceSingleID     = 0x723bfa1e
+	PresenceMovingListID = 0x723bfa1f
+
+	PresenceSingleSize = 22
+	dataHeaderSize     = 14
+)
+
+// Parse errors for X4 messages
+var (
+	ErrPresenceSingleLength = fmt.Errorf("%w: presence single message does not contain enough bytes", ErrParse)
+	ErrPresenceListLength   = fmt.Errorf("%w: presence moving list message does not contain a full list", ErrParse)
+	ErrDataLength           = fmt.Errorf("%w: data response does not contain enough bytes", ErrParse)
+	ErrDataType             = fmt.Errorf("%w: data response type is not recognised", ErrParse)
+)
+
+// PresenceSingle is an X4M300 presence single message.
+type PresenceSingle struct {
+	Counter       uint32
+	State         uint32
+	Distance      float64
+	Direction     byte
+	SignalQuality uint32
+}
+
+// PresenceMovingList is an X4M300 presence moving list message, the movement
+// of each range interval followed by the detections.
+type PresenceMovingList struct {
+	Counter      uint32
+	State        uint32
+	MovementSlow []float64
+	MovementFast []float64
+	Distance     []float64
+	RCS          []float64 // radar cross section
+	Velocity     []float64
+}
+
+// Data is an X4 data response, Float is set for float data and Bytes for byte
+// data.
+type Data struct {
+	Type      byte
+	ContentID uint32
+	Info      uint32
+	Float     []float64
+	Bytes     []byte
+}
+
+// ParsePresenceSingle parses a presence single payload, including the app
+// data byte.
+func ParsePresenceSingle(b []byte) (PresenceSingle, error) {
+	if len(b) != PresenceSingleSize {
+		return PresenceSingle{}, &LengthError{Err: ErrPresenceSingleLength, Want: PresenceSingleSize, Got: len(b)}
+	}
+	return PresenceSingle{
+		Counter:       binary.LittleEndian.Uint32(b[5:9]),
+		State:         binary.LittleEndian.Uint32(b[9:13]),
+		Distance:      float32At(b, 13),
+		Direction:     b[17],
+		SignalQuality: binary.LittleEndian.Uint32(b[18:22]),
+	}, nil
+}
+
+// ParsePresenceMovingList parses a presence moving list payload, including
+// the app data byte.
+// <0x50> + <ID> + <Counter> + <State> + <Intervals(n)> + [Slow(n)] + [Fast(n)]
+// + <Detections(m)> + [Distance(m)] + [RCS(m)] + [Velocity(m)]
+func ParsePresenceMovingList(b []byte) (PresenceMovingList, error) {
+	l := listReader{b: b, off: 5}
+	p := PresenceMovingList{
+		Counter: l.uint32(),
+		State:   l.uint32(),
+	}
+	n := l.uint32()
+	p.MovementSlow = l.floats(n)
+	p.MovementFast = l.floats(n)
+	m := l.uint32()
+	p.Distance = l.floats(m)
+	p.RCS = l.floats(m)
+	p.Velocity = l.floats(m)
+	if l.short || l.off != len(b) {
+		return PresenceMovingList{}, &LengthError{Err: ErrPresenceListLength, Want: l.off, Got: len(b)}
+	}
+	return p, nil
+}
+
+// ParseData parses a data response.
+// <0xa0> + <Type> + <ContentID> + <Info> + <Length> + [Data(Length)]
+func ParseData(b []byte) (Data, error) {
+	if len(b) < dataHeaderSize {
+		return Data{}, &LengthError{Err: ErrDataLength, Want: dataHeaderSize, Got: len(b)}
+	}
+	d := Data{
+		Type:      b[1],
+		ContentID: binary.LittleEndian.Uint32(b[2:6]),
+		Info:      binary.LittleEndian.Uint32(b[6:10]),
+	}
+	n := int(binary.LittleEndian.Uint32(b[10:14]))
+	switch d.Type {
+	case DataFloat:
+		l := listReader{b: b, off: dataHeaderSize}
+		d.Float = l.floats(uint32(n))
+		if l.short || l.off != len(b) {
+			return Data{}, &LengthError{Err: ErrDataLength, Want: dataHeaderSize + 4*n, Got: len(b)}
+		}
+	case DataByte:
+		if len(b) != dataHeaderSize+n {
+			return Data{}, &LengthError{Err: ErrDataLength, Want: dataHeaderSize + n, Got: len(b)}
+		}
+		d.Bytes = append([]byte(nil), b[dataHeaderSize:]...)
+	default:
+		return Data{}, fmt.Errorf("%w: %#02x", ErrDataType, d.Type)
+	}
+	return d, nil
+}
+
+// listReader reads little endian fields, after running out of bytes it
+// returns zeros and sets short. off counts the bytes wanted so far.
+type listReader struct {
+	b     []byte
+	off   int
+	short bool
+}
+
+func (l *listReader) uint32() uint32 {
+	l.off += 4
+	if l.short || l.off > len(l.b) {
+		l.short = true
+		return 0
+	}
+	return binary.LittleEndian.Uint32(l.b[l.off-4 : l.off])
+}
+
+func (l *listReader) floats(n uint32) []float64 {
+	if l.short || uint64(n)*4 > uint64(len(l.b)-l.off) {
+		l.short = true
+		l.off += 4 * int(n)
+		return nil
+	}
+	if n == 0 {
+		return nil
+	}
+	f := make([]float64, n)
+	for i := range f {
+		f[i] = float32At(l.b, l.off)
+		l.off += 4
+	}
+	return f
+}
@@ -0,0 +1,118 @@
+package protocol
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+var (
+	presenceSingleFrame = []byte{
+		0x50, 0x1e, 0xfa, 0x3b, 0x72, // app data, presence single
+		0x0a, 0x00, 0x00, 0x00, // counter 10
+		0x01, 0x00, 0x00, 0x00, // presence
+		0x00, 0x00, 0xc0, 0x3f, // distance 1.5
+		0x01,                   // direction
+		0x05, 0x00, 0x00, 0x00, // signal quality 5
+	}
+	presenceMovingListFrame = []byte{
+		0x50, 0x1f, 0xfa, 0x3b, 0x72, // app data, presence moving list
+		0x02, 0x00, 0x00, 0x00, // counter 2
+		0x01, 0x00, 0x00, 0x00, // presence
+		0x02, 0x00, 0x00, 0x00, // 2 intervals
+		0x00, 0x00, 0x00, 0x3f, 0x00, 0x00, 0x80, 0x3e, // slow 0.5 0.25
+		0x00, 0x00, 0x80, 0x3f, 0x00, 0x00, 0x00, 0x00, // fast 1 0
+		0x01, 0x00, 0x00, 0x00, // 1 detection
+		0x00, 0x00, 0xc0, 0x3f, // distance 1.5
+		0x00, 0x00, 0x00, 0x40, // rcs 2
+		0x00, 0x00, 0x00, 0xbf, // velocity -0.5
+	}
+	dataFloatFrame = []byte{
+		0xa0, 0x01, // data, float
+		0x05, 0x00, 0x00, 0x00, // content id
+		0x07, 0x00, 0x00, 0x00, // info
+		0x02, 0x00, 0x00, 0x00, // 2 floats
+		0x00, 0x00, 0x80, 0x3f, 0x00, 0x00, 0x00, 0xc0, // 1 -2
+	}
+	dataByteFrame = []byte{
+		0xa0, 0x00, // data, byte
+		0x05, 0x00, 0x00, 0x00, // content id
+		0x00, 0x00, 0x00, 0x00, // info
+		0x03, 0x00, 0x00, 0x00, // 3 bytes
+		0x01, 0x02, 0x03,
+	}
+)
+
+func TestParsePresenceSingle(t *testing.T) {
+	cases := []struct {
+		b   []byte
+		err error
+		p   PresenceSingle
+	}{
+		{presenceSingleFrame, nil, PresenceSingle{Counter: 10, State: 1, Distance: 1.5, Direction: 1, SignalQuality: 5}},
+		{presenceSingleFrame[:21], ErrPresenceSingleLength, PresenceSingle{}},
+	}
+	for n, c := range cases {
+		p, err := ParsePresenceSingle(c.b)
+		if !errors.Is(err, c.err) {
+			t.Errorf("test %d Expected: %v, got %v\n", n, c.err, err)
+		}
+		if p != c.p {
+			t.Errorf("test %d Expected: %#v, got %#v\n", n, c.p, p)
+		}
+	}
+}
+
+func TestParsePresenceMovingList(t *testing.T) {
+	cases := []struct {
+		b   []byte
+		err error
+		p   PresenceMovingList
+	}{
+		{presenceMovingListFrame, nil, PresenceMovingList{
+			Counter:      2,
+			State:        1,
+			MovementSlow: []float64{0.5, 0.25},
+			MovementFast: []float64{1, 0},
+			Distance:     []float64{1.5},
+			RCS:          []float64{2},
+			Velocity:     []float64{-0.5},
+		}},
+		{presenceMovingListFrame[:len(presenceMovingListFrame)-1], ErrPresenceListLength, PresenceMovingList{}},
+		{append(append([]byte(nil), presenceMovingListFrame...), 0x00), ErrPresenceListLength, PresenceMovingList{}},
+		{presenceMovingListFrame[:7], ErrPresenceListLength, PresenceMovingList{}},
+	}
+	for n, c := range cases {
+		p, err := ParsePresenceMovingList(c.b)
+		if !errors.Is(err, c.err) {
+			t.Errorf("test %d Expected: %v, got %v\n", n, c.err, err)
+		}
+		if !reflect.DeepEqual(p, c.p) {
+			t.Errorf("test %d Expected: %#v, got %#v\n", n, c.p, p)
+		}
+	}
+}
+
+func TestParseData(t *testing.T) {
+	cases := []struct {
+		b   []byte
+		err error
+		d   Data
+	}{
+		{dataFloatFrame, nil, Data{Type: DataFloat, ContentID: 5, Info: 7, Float: []float64{1, -2}}},
+		{dataByteFrame, nil, Data{Type: DataByte, ContentID: 5, Bytes: []byte{1, 2, 3}}},
+		{dataFloatFrame[:len(dataFloatFrame)-2], ErrDataLength, Data{}},
+		{dataByteFrame[:len(dataByteFrame)-1], ErrDataLength, Data{}},
+		{dataByteFrame[:10], ErrDataLength, Data{}},
+		{[]byte{0xa0, 0x09, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, ErrDataType, Data{}},
+	}
+	for n, c := range cases {
+		d, err := ParseData(c.b)
+		if !errors.Is(err, c.err) {
+			t.Errorf("test %d Expected: %v, got %v\n", n, c.err, err)
+		}
+		if !reflect.DeepEqual(d, c.d) {
+			t.Errorf("test %d Expected: %#v, got %#v\n", n, c.d, d)
+		}
+	}
+}
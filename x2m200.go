@@ -20,42 +20,88 @@ package xethru
 import (
 	"bufio"
 	"errors"
+	"fmt"
 	"io"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type x2m200Frame struct {
-	w io.Writer
-	r *bufio.Reader
-	c io.Closer
-	// frameBuffer []byte
+	stats   frameCounters // first for 64 bit atomic alignment
+	w       io.Writer
+	wmu     sync.Mutex    // guards bw
+	bw      *bufio.Writer // nil if writes are not buffered
+	r       io.Reader
+	c       io.Closer
+	d       deadliner // nil if the transport has no deadlines
+	a       Assembler
+	resync  bool // skip bytes before a start byte without an error
+	chunk   []byte
+	trace   atomic.Value // TraceFunc
+	logger  atomic.Value // loggerBox
+	metrics atomic.Value // metricsBox
 }
 
-type protocolError byte
-
+// Error codes sent by the sensor in an error reply, only the documented
+// codes are named, others are reported as an unknown error.
+// <Start> + <XTS_SPR_ERROR> + <Code> + <CRC> + <End>
 const (
-	notReconsied protocolError = 0x01
-	crcFailed    protocolError = 0x02
-	invaidAppID  protocolError = 0x03
+	notReconsied = 0x01
+	crcFailed    = 0x02
+	invaidAppID  = 0x03
 )
 
 func (x *x2m200Frame) Close() error {
 	return x.c.Close()
 }
 
+// Write frames and escapes p and writes it to the underlying writer. As
+// required by io.Writer it returns len(p) on success, not the number of
+// framed bytes, and p is not modified.
 func (x *x2m200Frame) Write(p []byte) (n int, err error) {
+	x.wmu.Lock()
+	defer x.wmu.Unlock()
+	var frame []byte
+	if x.bw != nil {
+		// frame straight into the write buffer when it fits
+		frame = x.bw.AvailableBuffer()
+	}
+	frame = AppendFrame(frame, p)
+	if trace := x.tracer(); trace != nil {
+		trace(DirectionWrite, frame, time.Now())
+	}
+	if err := x.writeFrames(frame); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
 
-	p = append(p[:0], append([]byte{startByte}, p[0:]...)...)
-	crc := checksum(&p)
-	// not quite correct but works most of the time but need to ignor endByte that are not at end.
-	for k := 0; k < len(p); k++ {
-		if p[k] == endByte {
-			p = append(p[:k], append([]byte{escByte}, p[k:]...)...)
-			k++
+// writeFrames writes complete frames to the transport, flushing them if
+// writes are buffered so nothing is left waiting for the next write. x.wmu
+// must be held.
+func (x *x2m200Frame) writeFrames(frames []byte) error {
+	if x.bw == nil {
+		m, err := x.w.Write(frames)
+		atomic.AddUint64(&x.stats.bytesWritten, uint64(m))
+		if err != nil {
+			return err
 		}
+		if m != len(frames) {
+			return io.ErrShortWrite
+		}
+		return nil
+	}
+	x.bw.Write(frames)
+	err := x.bw.Flush()
+	atomic.AddUint64(&x.stats.bytesWritten, uint64(len(frames)-x.bw.Buffered()))
+	if err != nil {
+		// a bufio.Writer keeps failing after an error, start again so a
+		// timed out write does not break every later one
+		x.bw.Reset(x.w)
+		return err
 	}
-	p = append(p, crc)
-	p = append(p, endByte)
-	return x.w.Write(p)
+	return nil
 }
 
 // Flow Control bytes
@@ -67,129 +113,113 @@ const (
 	errorByte = 0x20
 )
 
+// Read returns the payload of the next frame. Bytes are buffered internally
+// so frames split across, or sharing, reads of the underlying reader are
+// handled. Bytes before a start byte are discarded and, unless the Framer
+// resyncs, see SetResync, a FramingError wrapping ErrPacketNoStartByte is
+// returned. A payload longer than b is cut short and an error wrapping
+// io.ErrShortBuffer returned with it, use ReadPayload to get it whole.
 func (x *x2m200Frame) Read(b []byte) (n int, err error) {
-	var s []byte
-	header, err := x.r.Peek(1)
+	p, err := x.ReadPayload()
 	if err != nil {
-		return 0, io.EOF
+		return 0, err
+	}
+	return copyPayload(b, p)
+}
+
+// copyPayload copies p into b, returning an error wrapping io.ErrShortBuffer
+// if b is too short to hold it.
+func copyPayload(b, p []byte) (int, error) {
+	n := copy(b, p)
+	if n < len(p) {
+		return n, fmt.Errorf("%w: payload of %d bytes read into %d", io.ErrShortBuffer, len(p), len(b))
 	}
-	if header[0] == startByte {
-		s, err = x.r.ReadBytes(endByte)
+	return n, nil
+}
+
+// ReadPayload is Read that returns the whole payload of the next frame,
+// however long, up to the assembler's MaxFrameSize. If the underlying reader
+// keeps returning nothing, and no error, it returns io.ErrNoProgress.
+func (x *x2m200Frame) ReadPayload() ([]byte, error) {
+	if x.a.onFrame == nil {
+		x.a.onFrame = x.traceRead
+		x.a.onDiscard = x.countDiscard
+	}
+	empty := 0
+	for {
+		if !x.resync && x.a.Buffered() > 0 && x.a.buf[0] != startByte {
+			err := &FramingError{Reason: ErrPacketNoStartByte, Offset: x.a.offset}
+			x.a.discardToStart()
+			x.countErr(err)
+			return nil, err
+		}
+		p, err := x.a.Next()
 		if err != nil {
-			return 0, err
+			x.countErr(err)
+			return nil, err
 		}
-		ok, p, verr := validator(s)
-		// log.Println(verr)
-		if ok && verr != nil {
-			// log.Println(verr)
-			return 0, verr
+		if p != nil {
+			atomic.AddUint64(&x.stats.framesOK, 1)
+			frameMetrics(x).Counter(MetricFrames, 1)
+			if err := protocolErr(p); err != nil {
+				return nil, err
+			}
+			return p, nil
 		}
 
-		for !ok {
-			// scan to next endByte
-			s2, err := x.r.ReadBytes(endByte)
-			if err != nil && verr != errPacketNotLongEnough {
-				return 0, verr
-			}
-			s = append(s, s2...)
-			ok, p, _ = validator(s)
+		if x.chunk == nil {
+			x.chunk = make([]byte, readChunkSize)
 		}
-		if ok {
-			n = copy(b, p)
-			return n, nil
+		m, err := x.r.Read(x.chunk)
+		atomic.AddUint64(&x.stats.bytesRead, uint64(m))
+		x.a.Write(x.chunk[:m])
+		if m == 0 && err != nil {
+			return nil, err
 		}
-	}
-	return 0, errPacketNoStartByte
-	// return 0, nil
-}
-
-func validator(b []byte) (bool, []byte, error) {
-	// var k []byte
-	// k = append(k, b...)
-
-	const (
-		wait = iota
-		startAfterStart
-		inMessage
-		afterEsc
-		done
-	)
-	var buf []byte
-	state := wait
-	for k, v := range b {
-		switch state {
-		case wait:
-			if v == startByte {
-				state = inMessage
-				buf = append(buf, v)
-			}
-		case inMessage:
-			if k == len(b)-1 {
-				state = done
-			} else if v == escByte {
-				state = afterEsc
-			} else {
-				state = inMessage
-				buf = append(buf, v)
-			}
-		case afterEsc:
-			if v == endByte && k == len(b)-1 {
-				return false, nil, errPacketNotLongEnough
-			}
-			state = inMessage
-			buf = append(buf, v)
+		if m > 0 {
+			empty = 0
+		} else if empty++; empty >= maxEmptyReads {
+			return nil, io.ErrNoProgress
 		}
 	}
-	var crcByte byte
-	n := len(buf)
-	crcByte, buf = buf[n-1], buf[:n-1]
-	n--
+}
 
-	crc := checksum(&buf)
+// readChunkSize is the size of reads from the underlying reader.
+const readChunkSize = 512
 
-	if crcByte != crc {
-		return false, nil, errPacketBadCRC
-	}
+// maxEmptyReads is how many reads in a row may return nothing before the
+// reader is taken to be broken, as bufio does.
+const maxEmptyReads = 100
 
-	buf = buf[:0+copy(buf[0:], buf[1:])]
-	n--
-
-	if n > 1 {
-		if buf[0] == errorByte {
-			pError := protocolError(buf[1])
-			switch pError {
-			case notReconsied:
-				return true, buf, errProtocolErrorNotReconsied
-			case crcFailed:
-				return true, buf, errProtocolErrorCRCfailed
-			case invaidAppID:
-				return true, buf, errProtocolErrorInvaidAppID
-			}
-		}
+// protocolErr returns a SensorError for an error reply payload, or nil.
+func protocolErr(p []byte) error {
+	if len(p) > 1 && p[0] == errorByte {
+		return &SensorError{Code: p[1]}
 	}
-	// log.Println("returning nil")
-	// log.Printf("%#0x\n", buf)
-	return true, buf, nil
+	return nil
 }
 
+// Framing errors, returned wrapped in a FramingError or CRCError.
 var (
-	errPacketNotLongEnough       = errors.New("not long enough")
-	errPacketNoStartByte         = errors.New("no startbyte")
-	errPacketBadCRC              = errors.New("failed checksum")
-	errProtocolErrorNotReconsied = errors.New("protocol error command not recognised")
-	errProtocolErrorCRCfailed    = errors.New("protocol error command bad crc")
-	errProtocolErrorInvaidAppID  = errors.New("protocol error invalid app id")
+	ErrPacketNotLongEnough   = errors.New("not long enough")
+	ErrPacketNoStartByte     = errors.New("no startbyte")
+	ErrPacketBadCRC          = errors.New("failed checksum")
+	ErrFrameTooLarge         = errors.New("frame too large")
+	ErrInvalidEscapeSequence = errors.New("invalid escape sequence")
+)
+
+// Errors reported by the sensor, use errors.Is to check for a particular code.
+var (
+	ErrProtocolNotRecognised = &SensorError{Code: notReconsied}
+	ErrProtocolCRCFailed     = &SensorError{Code: crcFailed}
+	ErrProtocolInvalidAppID  = &SensorError{Code: invaidAppID}
 )
 
 // Calculated by XOR’ing all bytes from <START> + [Data].
 // Note that the CRC is done after escape bytes is removed. This
 // means that CRC is also calculated before adding escape bytes.
 func checksum(p *[]byte) byte {
-	var crc byte
-	for _, b := range *p {
-		crc = crc ^ b
-	}
-	return crc
+	return ChecksumX2M200(*p)
 }
 
 var errChecksumInvalidPacketSTART = errors.New("invalid packet missing start")
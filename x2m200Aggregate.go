@@ -0,0 +1,171 @@
+package xethru
+
+import (
+	"context"
+	"time"
+)
+
+// Summary summarises the Respiration frames received in an Aggregator
+// window, for dashboards that do not want every frame. The RPM and movement
+// figures are of the frames that are Valid and not Settling, they are zero
+// if there were none.
+type Summary struct {
+	Start        time.Time // start of the window
+	End          time.Time // end of the window, Start plus the Aggregator's Window
+	Frames       int       // frames received in the window
+	ValidFrames  int       // frames the RPM and movement figures are of
+	Gap          bool      // no frames were received in the window
+	MinRPM       uint32
+	MeanRPM      float64
+	MaxRPM       uint32
+	MeanMovement float64
+	// States is the percentage of the window's frames in each state, with
+	// frames at a steady rate it is the percentage of time.
+	States map[respirationState]float64
+}
+
+// Aggregator summarises the Respiration frames read from a Run stream into
+// a Summary for each Window. Every window is summarised, a window with no
+// frames is a Gap. A Window of zero summarises nothing.
+type Aggregator struct {
+	Window time.Duration
+	// AlignToClock starts windows at multiples of Window, so one minute
+	// windows start on the minute, from when Run starts. Otherwise the first
+	// window starts with the first frame.
+	AlignToClock bool
+
+	start    time.Time // start of the current window, zero before the first
+	frames   int
+	valid    int
+	minRPM   uint32
+	maxRPM   uint32
+	sumRPM   float64
+	movement float64
+	states   map[respirationState]int
+	pending  []Summary
+}
+
+// NewAggregator returns an Aggregator of window long windows aligned to the
+// first frame.
+func NewAggregator(window time.Duration) *Aggregator {
+	return &Aggregator{Window: window}
+}
+
+// Run summarises the Respiration frames received on in, other values are
+// ignored, and sends a Summary on the returned channel as each window ends.
+// The channel is closed when in is closed or ctx is done, the window in
+// progress is not summarised.
+func (a *Aggregator) Run(ctx context.Context, in <-chan interface{}) <-chan Summary {
+	out := make(chan Summary)
+	go func() {
+		defer close(out)
+		if a.AlignToClock {
+			a.start = clock().Now().Truncate(a.Window)
+		}
+		var (
+			timer Timer
+			due   time.Time // when timer fires, zero if it is not running
+		)
+		defer func() {
+			if timer != nil {
+				timer.Stop()
+			}
+		}()
+		for {
+			var tick <-chan time.Time
+			if !a.start.IsZero() && a.Window > 0 {
+				if end := a.start.Add(a.Window); !end.Equal(due) {
+					if timer != nil {
+						timer.Stop()
+					}
+					timer, due = clock().NewTimer(end.Sub(clock().Now())), end
+				}
+				tick = timer.C()
+			}
+			select {
+			case v, ok := <-in:
+				if !ok {
+					return
+				}
+				if r, ok := v.(Respiration); ok {
+					a.frame(clock().Now(), r)
+				}
+			case <-tick:
+				due = time.Time{}
+				a.advance(clock().Now())
+			case <-ctx.Done():
+				return
+			}
+			for _, s := range a.pending {
+				select {
+				case out <- s:
+				case <-ctx.Done():
+					return
+				}
+			}
+			a.pending = a.pending[:0]
+		}
+	}()
+	return out
+}
+
+// frame adds a frame received at now.
+func (a *Aggregator) frame(now time.Time, r Respiration) {
+	if a.start.IsZero() {
+		a.start = now
+	}
+	a.advance(now)
+	a.frames++
+	if a.states == nil {
+		a.states = make(map[respirationState]int)
+	}
+	a.states[r.State]++
+	if !r.Valid || r.Settling {
+		return
+	}
+	if a.valid == 0 || r.RPM < a.minRPM {
+		a.minRPM = r.RPM
+	}
+	if r.RPM > a.maxRPM {
+		a.maxRPM = r.RPM
+	}
+	a.valid++
+	a.sumRPM += float64(r.RPM)
+	a.movement += r.Movement
+}
+
+// advance summarises the windows that have ended by now.
+func (a *Aggregator) advance(now time.Time) {
+	if a.start.IsZero() || a.Window <= 0 {
+		return
+	}
+	for end := a.start.Add(a.Window); !now.Before(end); end = a.start.Add(a.Window) {
+		a.pending = append(a.pending, a.summary(end))
+		a.start = end
+		a.frames, a.valid = 0, 0
+		a.minRPM, a.maxRPM = 0, 0
+		a.sumRPM, a.movement = 0, 0
+		a.states = nil
+	}
+}
+
+func (a *Aggregator) summary(end time.Time) Summary {
+	s := Summary{
+		Start:       a.start,
+		End:         end,
+		Frames:      a.frames,
+		ValidFrames: a.valid,
+		Gap:         a.frames == 0,
+		MinRPM:      a.minRPM,
+		MaxRPM:      a.maxRPM,
+		States:      make(map[respirationState]float64, len(a.states)),
+	}
+	if a.valid > 0 {
+		s.MeanRPM = a.sumRPM / float64(a.valid)
+		s.MeanMovement = a.movement / float64(a.valid)
+	}
+	for state, n := range a.states {
+		s.States[state] = 100 * float64(n) / float64(a.frames)
+	}
+	return s
+}
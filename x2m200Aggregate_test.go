@@ -0,0 +1,118 @@
+package xethru
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// runAggregator runs a on a fake clock, feed sends a value and returns once
+// it has been handled, next returns the next summary.
+func runAggregator(t *testing.T, a *Aggregator) (c *fakeClock, feed func(interface{}), next func() (Summary, bool), stop func()) {
+	c = useFakeClock(t)
+	in := make(chan interface{})
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	// collect the summaries so the aggregator never waits for the test
+	out := make(chan Summary, 100)
+	go func() {
+		defer close(out)
+		for s := range a.Run(ctx, in) {
+			out <- s
+		}
+	}()
+	feed = func(v interface{}) {
+		in <- v
+		// the aggregator has handled v once it takes the next value
+		in <- nil
+	}
+	next = func() (Summary, bool) {
+		t.Helper()
+		select {
+		case s, ok := <-out:
+			return s, ok
+		case <-time.After(2 * time.Second):
+			t.Fatal("timeout waiting for summary")
+		}
+		return Summary{}, false
+	}
+	return c, feed, next, func() { close(in) }
+}
+
+func TestAggregator(t *testing.T) {
+	c, feed, next, stop := runAggregator(t, NewAggregator(time.Minute))
+	start := time.Unix(0, fakeClockTime)
+	// scripted frames, seconds after the first
+	steps := []struct {
+		at int
+		r  Respiration
+	}{
+		{0, Respiration{State: breathing, RPM: 12, Movement: 1, Valid: true}},
+		{15, Respiration{State: breathing, RPM: 16, Movement: 3, Valid: true}},
+		{30, Respiration{State: movement, RPM: 30, Movement: 9, Valid: true, Settling: true}},
+		{45, Respiration{State: noMovement, RPM: 2, Valid: false}},
+		{60, Respiration{State: breathing, RPM: 10, Movement: 0.5, Valid: true}},
+	}
+	at := 0
+	for _, s := range steps {
+		c.Advance(time.Duration(s.at-at) * time.Second)
+		at = s.at
+		feed(s.r)
+		feed("not a respiration frame")
+	}
+	// no frames for two minutes, the second window ends and the third is empty
+	c.Advance(2 * time.Minute)
+
+	want := []Summary{
+		{
+			Start: start, End: start.Add(time.Minute), Frames: 4, ValidFrames: 2,
+			MinRPM: 12, MeanRPM: 14, MaxRPM: 16, MeanMovement: 2,
+			States: map[respirationState]float64{breathing: 50, movement: 25, noMovement: 25},
+		},
+		{
+			Start: start.Add(time.Minute), End: start.Add(2 * time.Minute), Frames: 1, ValidFrames: 1,
+			MinRPM: 10, MeanRPM: 10, MaxRPM: 10, MeanMovement: 0.5,
+			States: map[respirationState]float64{breathing: 100},
+		},
+		{
+			Start: start.Add(2 * time.Minute), End: start.Add(3 * time.Minute), Gap: true,
+			States: map[respirationState]float64{},
+		},
+	}
+	for n, w := range want {
+		got, ok := next()
+		if !ok || !reflect.DeepEqual(got, w) {
+			t.Errorf("test %d Expected: %+v, got %+v\n", n, w, got)
+		}
+	}
+	// the window in progress is not summarised
+	stop()
+	if got, ok := next(); ok {
+		t.Errorf("Expected: closed, got %+v\n", got)
+	}
+}
+
+func TestAggregatorAlignToClock(t *testing.T) {
+	a := NewAggregator(time.Minute)
+	a.AlignToClock = true
+	c, feed, next, stop := runAggregator(t, a)
+	defer stop()
+	now := time.Unix(0, fakeClockTime)
+	minute := now.Truncate(time.Minute)
+	if minute.Equal(now) {
+		t.Fatal("Expected: the fake clock part way through a minute")
+	}
+	feed(Respiration{State: breathing, RPM: 12, Valid: true})
+	c.Advance(minute.Add(time.Minute).Sub(now))
+	got, _ := next()
+	if !got.Start.Equal(minute) || !got.End.Equal(minute.Add(time.Minute)) || got.Frames != 1 || got.Gap {
+		t.Errorf("Expected: 1 frame from %v, got %+v\n", minute, got)
+	}
+	feed(nil)
+	c.Advance(time.Minute)
+	got, _ = next()
+	if !got.Start.Equal(minute.Add(time.Minute)) || !got.Gap {
+		t.Errorf("Expected: a gap from %v, got %+v\n", minute.Add(time.Minute), got)
+	}
+}
@@ -0,0 +1,301 @@
+package xethru
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Archive recording format
+// This is the library's own format for keeping frames on disk, it is not
+// the format of the vendor's Explorer tool, which it does not read or write.
+// An archive is a directory holding a meta file, ArchiveMetaFile, that lists
+// the data files, one per type of data. A data file is a series of records of
+// data type(uint32) + epoch(int64 unix ms) + size(uint32) + [payload]
+// all little endian, where the payload is the message's fields after its
+// status, floats as float32:
+// respiration: counter + state + rpm + distance + movement + signal quality
+// baseband: counter + bins + bin length + sampling frequency +
+// carrier frequency + range offset + [i or amplitude] + [q or phase]
+const (
+	// ArchiveMetaFile is the name of the meta file of an archive.
+	ArchiveMetaFile = "archive_meta.xml"
+
+	archiveVersion      = 1
+	archiveRecordHeader = 16
+	archiveRespSize     = 24
+	archiveBaseBandSize = 24
+
+	// maxArchiveRecord bounds the payload size read by ReadArchiveData
+	maxArchiveRecord = 1 << 24
+)
+
+// Archive data types, the app data byte of the message.
+const (
+	archiveRespiration      = respirationStartByte
+	archiveBaseBandIQ       = basebandIQStartByte
+	archiveBaseBandAmpPhase = basebandPhaseAmpltudeStartByte
+)
+
+// archiveFiles are the data file type names and file name prefixes.
+var archiveFiles = map[uint32]struct{ typ, prefix string }{
+	archiveRespiration:      {"respiration", "respiration"},
+	archiveBaseBandIQ:       {"basebandiq", "baseband_iq"},
+	archiveBaseBandAmpPhase: {"basebandampphase", "baseband_ap"},
+}
+
+// Archive errors
+var (
+	errArchiveType      = errors.New("unknown archive data type")
+	errArchiveTruncated = errors.New("archive data file is truncated")
+	errArchiveTooLarge  = errors.New("archive record too large")
+)
+
+// ArchiveMeta is the meta file of an archive.
+type ArchiveMeta struct {
+	XMLName   xml.Name      `xml:"archive"`
+	Version   int           `xml:"version"`
+	SessionID string        `xml:"session_id"`
+	Start     time.Time     `xml:"start_time"`
+	Files     []ArchiveFile `xml:"datafiles>datafile"`
+}
+
+// ArchiveFile is a data file listed in an ArchiveMeta.
+type ArchiveFile struct {
+	Type string `xml:"type"` // respiration, basebandiq or basebandampphase
+	Name string `xml:"file"` // relative to the recording directory
+}
+
+// ReadArchiveMeta reads the meta file of an archive.
+func ReadArchiveMeta(r io.Reader) (ArchiveMeta, error) {
+	var meta ArchiveMeta
+	if err := xml.NewDecoder(r).Decode(&meta); err != nil {
+		return ArchiveMeta{}, err
+	}
+	return meta, nil
+}
+
+// ReadArchiveData reads a data file of an archive and returns its frames,
+// Respiration, BaseBandIQ or BaseBandAmpPhase, with their time set from the
+// recorded epoch. Validity is not recorded, so every Respiration is Valid.
+func ReadArchiveData(r io.Reader) ([]interface{}, error) {
+	br := bufio.NewReader(r)
+	var frames []interface{}
+	header := make([]byte, archiveRecordHeader)
+	for {
+		if _, err := io.ReadFull(br, header); err != nil {
+			if err == io.EOF {
+				return frames, nil
+			}
+			return frames, errArchiveTruncated
+		}
+		kind := binary.LittleEndian.Uint32(header[0:4])
+		t := int64(binary.LittleEndian.Uint64(header[4:12])) * int64(time.Millisecond)
+		size := binary.LittleEndian.Uint32(header[12:16])
+		if size > maxArchiveRecord {
+			return frames, fmt.Errorf("%w: %d bytes", errArchiveTooLarge, size)
+		}
+		p := make([]byte, size)
+		if _, err := io.ReadFull(br, p); err != nil {
+			return frames, errArchiveTruncated
+		}
+		v, err := decodeArchive(kind, t, p)
+		if err != nil {
+			return frames, err
+		}
+		frames = append(frames, v)
+	}
+}
+
+func decodeArchive(kind uint32, t int64, p []byte) (interface{}, error) {
+	switch kind {
+	case archiveRespiration:
+		if len(p) != archiveRespSize {
+			return nil, &LengthError{Err: errArchiveTruncated, Want: archiveRespSize, Got: len(p)}
+		}
+		return Respiration{
+			Time:          t,
+			Status:        respApp,
+			Counter:       binary.LittleEndian.Uint32(p[0:4]),
+			State:         respirationState(binary.LittleEndian.Uint32(p[4:8])),
+			RPM:           binary.LittleEndian.Uint32(p[8:12]),
+			Distance:      float32At(p, 12),
+			Movement:      float32At(p, 16),
+			SignalQuality: float64(binary.LittleEndian.Uint32(p[20:24])),
+			Valid:         true,
+		}, nil
+	case archiveBaseBandIQ, archiveBaseBandAmpPhase:
+		if len(p) < archiveBaseBandSize {
+			return nil, &LengthError{Err: errArchiveTruncated, Want: archiveBaseBandSize, Got: len(p)}
+		}
+		h := BaseBandHeader{
+			Time:         t,
+			Counter:      binary.LittleEndian.Uint32(p[0:4]),
+			Bins:         binary.LittleEndian.Uint32(p[4:8]),
+			BinLength:    float32At(p, 8),
+			SamplingFreq: float32At(p, 12),
+			CarrierFreq:  float32At(p, 16),
+			RangeOffset:  float32At(p, 20),
+		}
+		want := archiveBaseBandSize + 8*uint64(h.Bins)
+		if uint64(len(p)) != want {
+			return nil, &LengthError{Err: errArchiveTruncated, Want: int(want), Got: len(p)}
+		}
+		a := float32s(p[archiveBaseBandSize:], h.Bins)
+		b := float32s(p[archiveBaseBandSize+4*h.Bins:], h.Bins)
+		if kind == archiveBaseBandIQ {
+			h.Status = basebandIQ
+			return BaseBandIQ{BaseBandHeader: h, SigI: a, SigQ: b}, nil
+		}
+		h.Status = basebandAP
+		return BaseBandAmpPhase{BaseBandHeader: h, Amplitude: a, Phase: b}, nil
+	}
+	return nil, fmt.Errorf("%w: %#02x", errArchiveType, kind)
+}
+
+func float32At(b []byte, i int) float64 {
+	return float64(math.Float32frombits(binary.LittleEndian.Uint32(b[i:])))
+}
+
+func float32s(b []byte, n uint32) []float64 {
+	if n == 0 {
+		return nil
+	}
+	fs := make([]float64, n)
+	for i := range fs {
+		fs[i] = float32At(b, 4*i)
+	}
+	return fs
+}
+
+// ArchiveWriter writes an archive to a directory. Each type of
+// frame goes to its own data file, named after the type and the time of
+// the first frame, and Close writes the meta file listing them. Floats are
+// recorded as float32, as the sensor sends them.
+type ArchiveWriter struct {
+	dir   string
+	meta  ArchiveMeta
+	files map[uint32]*archiveDataFile
+	buf   []byte
+}
+
+type archiveDataFile struct {
+	f *os.File
+	w *bufio.Writer
+}
+
+// NewArchiveWriter creates dir, if it does not exist, and returns an
+// ArchiveWriter recording the session sessionID into it.
+func NewArchiveWriter(dir, sessionID string) (*ArchiveWriter, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &ArchiveWriter{
+		dir:   dir,
+		meta:  ArchiveMeta{Version: archiveVersion, SessionID: sessionID},
+		files: make(map[uint32]*archiveDataFile),
+	}, nil
+}
+
+// WriteFrame records v, a Respiration, BaseBandIQ or BaseBandAmpPhase,
+// received at t.
+func (e *ArchiveWriter) WriteFrame(t time.Time, v interface{}) error {
+	var kind uint32
+	p := e.buf[:0]
+	switch f := v.(type) {
+	case Respiration:
+		kind = archiveRespiration
+		p = appendUint32(p, f.Counter)
+		p = appendUint32(p, uint32(f.State))
+		p = appendUint32(p, f.RPM)
+		p = appendUint32(p, math.Float32bits(float32(f.Distance)))
+		p = appendUint32(p, math.Float32bits(float32(f.Movement)))
+		p = appendUint32(p, uint32(f.SignalQuality))
+	case BaseBandIQ:
+		kind = archiveBaseBandIQ
+		p = appendArchiveBaseBand(p, f.BaseBandHeader, f.SigI, f.SigQ)
+	case BaseBandAmpPhase:
+		kind = archiveBaseBandAmpPhase
+		p = appendArchiveBaseBand(p, f.BaseBandHeader, f.Amplitude, f.Phase)
+	default:
+		return fmt.Errorf("%w: %T", errBinaryType, v)
+	}
+	e.buf = p
+
+	file, err := e.file(kind, t)
+	if err != nil {
+		return err
+	}
+	var header [archiveRecordHeader]byte
+	binary.LittleEndian.PutUint32(header[0:4], kind)
+	binary.LittleEndian.PutUint64(header[4:12], uint64(t.UnixNano()/int64(time.Millisecond)))
+	binary.LittleEndian.PutUint32(header[12:16], uint32(len(p)))
+	if _, err := file.w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err = file.w.Write(p)
+	return err
+}
+
+func appendArchiveBaseBand(p []byte, h BaseBandHeader, a, b []float64) []byte {
+	p = appendUint32(p, h.Counter)
+	p = appendUint32(p, uint32(len(a)))
+	for _, f := range []float64{h.BinLength, h.SamplingFreq, h.CarrierFreq, h.RangeOffset} {
+		p = appendUint32(p, math.Float32bits(float32(f)))
+	}
+	for _, s := range [][]float64{a, b} {
+		for i := range a {
+			var f float64
+			if i < len(s) {
+				f = s[i]
+			}
+			p = appendUint32(p, math.Float32bits(float32(f)))
+		}
+	}
+	return p
+}
+
+// file returns the data file for kind, creating it for a first frame at t.
+func (e *ArchiveWriter) file(kind uint32, t time.Time) (*archiveDataFile, error) {
+	if f, ok := e.files[kind]; ok {
+		return f, nil
+	}
+	if e.meta.Start.IsZero() {
+		e.meta.Start = t.UTC()
+	}
+	name := fmt.Sprintf("%s_%s.dat", archiveFiles[kind].prefix, t.UTC().Format("20060102_150405"))
+	f, err := os.Create(filepath.Join(e.dir, name))
+	if err != nil {
+		return nil, err
+	}
+	file := &archiveDataFile{f: f, w: bufio.NewWriter(f)}
+	e.files[kind] = file
+	e.meta.Files = append(e.meta.Files, ArchiveFile{Type: archiveFiles[kind].typ, Name: name})
+	return file, nil
+}
+
+// Close flushes and closes the data files and writes the meta file.
+func (e *ArchiveWriter) Close() error {
+	var errs []error
+	for _, f := range e.files {
+		if err := f.w.Flush(); err != nil {
+			errs = append(errs, err)
+		}
+		if err := f.f.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	b, err := xml.MarshalIndent(e.meta, "", "  ")
+	if err == nil {
+		b = append([]byte(xml.Header), append(b, '\n')...)
+		err = os.WriteFile(filepath.Join(e.dir, ArchiveMetaFile), b, 0o644)
+	}
+	return errors.Join(append(errs, err)...)
+}
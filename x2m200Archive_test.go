@@ -0,0 +1,163 @@
+package xethru
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var archiveStart = time.Date(2017, 3, 1, 22, 15, 0, 0, time.UTC)
+
+// archiveTestFrames are frames whose floats are exact as float32, as they
+// are recorded.
+func archiveTestFrames() []interface{} {
+	header := BaseBandHeader{
+		Status:       basebandIQ,
+		Bins:         4,
+		BinLength:    0.05,
+		SamplingFreq: 39e9,
+		CarrierFreq:  7.29e9,
+		RangeOffset:  0.2,
+	}
+	for _, f := range []*float64{&header.BinLength, &header.SamplingFreq, &header.CarrierFreq, &header.RangeOffset} {
+		*f = float64(float32(*f))
+	}
+	var frames []interface{}
+	for i := 0; i < 3; i++ {
+		t := archiveStart.Add(time.Duration(i) * 50 * time.Millisecond).UnixNano()
+		frames = append(frames, Respiration{Time: t, Status: respApp, Counter: uint32(100 + i), State: breathing, RPM: 14, Distance: 0.75, SignalQuality: 8, Movement: -0.5 * float64(i), Valid: true})
+		iq := header
+		iq.Time, iq.Counter = t, uint32(i)
+		frames = append(frames, BaseBandIQ{BaseBandHeader: iq, SigI: []float64{0.5, -0.25, 1, 0}, SigQ: []float64{-1, 0.125, 0, 2}})
+		ap := header
+		ap.Time, ap.Status, ap.Counter = t, basebandAP, uint32(i)
+		frames = append(frames, BaseBandAmpPhase{BaseBandHeader: ap, Amplitude: []float64{1, 2, 3, 4}, Phase: []float64{0.5, -0.5, 3, -3}})
+	}
+	return frames
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewArchiveWriter(dir, "session-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames := archiveTestFrames()
+	for _, f := range frames {
+		var ts int64
+		switch v := f.(type) {
+		case Respiration:
+			ts = v.Time
+		case BaseBandIQ:
+			ts = v.Time
+		case BaseBandAmpPhase:
+			ts = v.Time
+		}
+		if err := w.WriteFrame(time.Unix(0, ts), f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the sample archive in testdata is what the writer produces, it guards the
+	// format against unintended changes
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 4 {
+		t.Errorf("Expected: meta and 3 data files, got %d\n", len(entries))
+	}
+	for _, e := range entries {
+		b, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		compareGolden(t, "archive/"+e.Name(), b)
+	}
+
+	f, err := os.Open(filepath.Join("testdata/archive", ArchiveMetaFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	meta, err := ReadArchiveMeta(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Version != archiveVersion || meta.SessionID != "session-1" || !meta.Start.Equal(archiveStart) || len(meta.Files) != 3 {
+		t.Fatalf("Expected: meta for session-1 with 3 files, got %+v\n", meta)
+	}
+	got := make(map[string][]interface{})
+	for _, file := range meta.Files {
+		f, err := os.Open(filepath.Join("testdata/archive", file.Name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		frames, err := ReadArchiveData(f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("%s %v\n", file.Name, err)
+		}
+		got[file.Type] = frames
+	}
+	for i, f := range frames {
+		typ := map[reflect.Type]string{
+			reflect.TypeOf(Respiration{}):      "respiration",
+			reflect.TypeOf(BaseBandIQ{}):       "basebandiq",
+			reflect.TypeOf(BaseBandAmpPhase{}): "basebandampphase",
+		}[reflect.TypeOf(f)]
+		if len(got[typ]) <= i/3 {
+			t.Fatalf("test %d Expected: frame in %s, got %d frames\n", i, typ, len(got[typ]))
+		}
+		if v := got[typ][i/3]; !reflect.DeepEqual(v, f) {
+			t.Errorf("test %d Expected: %+v, got %+v\n", i, f, v)
+		}
+	}
+}
+
+func TestArchiveErrors(t *testing.T) {
+	sample, err := os.ReadFile("testdata/archive/baseband_iq_20170301_221500.dat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad := append([]byte(nil), sample...)
+	bad[0] = 0x99
+	tests := []struct {
+		b      []byte
+		frames int
+		err    error
+	}{
+		{sample, 3, nil},
+		{sample[:len(sample)-1], 2, errArchiveTruncated},
+		{sample[:10], 0, errArchiveTruncated},
+		{bad, 0, errArchiveType},
+		{nil, 0, nil},
+	}
+	for n, test := range tests {
+		frames, err := ReadArchiveData(bytes.NewReader(test.b))
+		if !errors.Is(err, test.err) {
+			t.Errorf("test %d Expected: %v, got %v\n", n, test.err, err)
+		}
+		if len(frames) != test.frames {
+			t.Errorf("test %d Expected: %d frames, got %d\n", n, test.frames, len(frames))
+		}
+	}
+
+	w, err := NewArchiveWriter(t.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteFrame(archiveStart, Sleep{}); !errors.Is(err, errBinaryType) {
+		t.Errorf("Expected: %v, got %v\n", errBinaryType, err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,274 @@
+package xethru
+
+import (
+	"bytes"
+	"errors"
+)
+
+// Assembler accumulates raw bytes read from a sensor until a complete
+// protocol frame (start, escaped data, crc and end) is available. Frames that
+// span many reads, or many frames in a single read, are handled.
+type Assembler struct {
+	// MaxFrameSize is the largest raw frame, including escape bytes, that
+	// will be buffered while waiting for an end byte. Zero uses
+	// defaultMaxFrameSize.
+	MaxFrameSize int
+
+	// StrictEscaping rejects frames that are not fully escaped. By default
+	// an unescaped start byte in a frame is taken as data and an end byte
+	// crc that was not escaped, as sent by older firmware, is accepted.
+	StrictEscaping bool
+
+	buf    []byte
+	offset int64 // position of buf[0] in the byte stream
+
+	onFrame   func(raw []byte) // called with the raw bytes of each frame
+	onDiscard func(n int)      // called with the number of bytes dropped outside a frame
+}
+
+// defaultMaxFrameSize is large enough for a 1024 bin IQ frame with room for
+// escape bytes.
+const defaultMaxFrameSize = 16 * 1024
+
+// NewAssembler creates an empty Assembler.
+func NewAssembler() *Assembler {
+	return &Assembler{}
+}
+
+// Write appends raw bytes from the transport to the Assembler, it never fails.
+func (a *Assembler) Write(p []byte) (int, error) {
+	a.buf = append(a.buf, p...)
+	return len(p), nil
+}
+
+// Buffered returns the number of bytes waiting to be assembled.
+func (a *Assembler) Buffered() int {
+	return len(a.buf)
+}
+
+// consume drops the first n buffered bytes.
+func (a *Assembler) consume(n int) {
+	a.offset += int64(n)
+	a.buf = a.buf[:copy(a.buf, a.buf[n:])]
+}
+
+// frameDone passes the first n buffered bytes, a whole raw frame, to onFrame
+// and then drops them.
+func (a *Assembler) frameDone(n int) {
+	if a.onFrame != nil {
+		a.onFrame(a.buf[:n])
+	}
+	a.consume(n)
+}
+
+// discardToStart drops buffered bytes up to the next start byte.
+func (a *Assembler) discardToStart() {
+	start := bytes.IndexByte(a.buf, startByte)
+	if start < 0 {
+		start = len(a.buf)
+	}
+	if start > 0 && a.onDiscard != nil {
+		a.onDiscard(start)
+	}
+	a.consume(start)
+}
+
+// Next returns the unescaped payload of the next complete frame, without the
+// start, crc and end bytes. If no complete frame is buffered it returns nil,
+// nil. A frame that fails its checksum is discarded and a CRCError is
+// returned. A frame longer than MaxFrameSize, or with an escape byte
+// followed by a byte that is not escaped, is discarded up to the next start
+// byte and a FramingError wrapping ErrFrameTooLarge or
+// ErrInvalidEscapeSequence is returned.
+func (a *Assembler) Next() ([]byte, error) {
+	a.discardToStart()
+	if len(a.buf) == 0 {
+		return nil, nil
+	}
+
+	max := a.MaxFrameSize
+	if max <= 0 {
+		max = defaultMaxFrameSize
+	}
+	body, n, err := unescape(make([]byte, 0, payloadSizeHint(a.buf)), a.buf, max, a.StrictEscaping)
+	switch {
+	case err != nil:
+		ferr := &FramingError{Reason: err, Offset: a.offset + int64(n)}
+		a.consume(1)
+		a.discardToStart()
+		return nil, ferr
+	case n == 0:
+		return nil, nil
+	case len(body) == 0:
+		err := &FramingError{Reason: ErrPacketNotLongEnough, Offset: a.offset + int64(n-1)}
+		a.frameDone(n)
+		return nil, err
+	}
+	data, crc := body[:len(body)-1], body[len(body)-1]
+	if sum := startByte ^ ChecksumX2M200(data); sum == crc {
+		a.frameDone(n)
+		return data, nil
+	}
+	// A crc of endByte that was sent unescaped, followed by the real endByte.
+	if !a.StrictEscaping && startByte^ChecksumX2M200(body) == endByte {
+		if n >= len(a.buf) {
+			return nil, nil
+		}
+		if a.buf[n] == endByte {
+			a.frameDone(n + 1)
+			return body, nil
+		}
+	}
+	a.frameDone(n)
+	return nil, &CRCError{Expected: startByte ^ ChecksumX2M200(data), Got: crc}
+}
+
+// payloadSizeHint guesses the payload size of the frame at the start of raw
+// from its first end byte, so a complete payload is usually allocated once.
+// It is zero while no end byte has been buffered.
+func payloadSizeHint(raw []byte) int {
+	if end := bytes.IndexByte(raw, endByte); end > 0 {
+		return end
+	}
+	return 0
+}
+
+// unescape appends the unescaped bytes of the frame that starts at raw[0],
+// after the start byte and up to the end byte, to dst. n is the number of raw
+// bytes in the frame including the end byte, or 0 if the end byte has not
+// been received yet. An escape byte must be followed by a start, end or
+// escape byte, which is taken literally, otherwise ErrInvalidEscapeSequence
+// is returned, as it is for an unescaped start byte if strict. If there is no
+// end byte in the first max bytes ErrFrameTooLarge is returned. On error n is
+// the offset of the bad byte.
+//
+// Once shortRun literal bytes in a row have been copied the rest of the run,
+// up to the next control byte found with bytes.IndexByte, is copied in bulk.
+// The next index of each control byte is remembered until it is passed so
+// the frame is scanned at most once for each, and densely escaped frames are
+// still copied a byte at a time.
+func unescape(dst, raw []byte, max int, strict bool) (out []byte, n int, err error) {
+	limit := raw
+	if max < len(raw) {
+		limit = raw[:0]
+		if max > 0 {
+			limit = raw[:max]
+		}
+	}
+	nextEsc, nextEnd, nextStart := -1, -1, len(limit)
+	if strict {
+		nextStart = -1
+	}
+	literal := 0
+	for k := 1; k < len(raw); k++ {
+		if k >= max {
+			return dst, k, ErrFrameTooLarge
+		}
+		switch raw[k] {
+		case escByte:
+			if k+1 >= len(raw) {
+				return dst, 0, nil
+			}
+			k++
+			if !isControlByte(raw[k]) {
+				return dst, k, ErrInvalidEscapeSequence
+			}
+			dst = append(dst, raw[k])
+			literal = 0
+			continue
+		case endByte:
+			return dst, k + 1, nil
+		case startByte:
+			if strict {
+				return dst, k, ErrInvalidEscapeSequence
+			}
+		}
+		dst = append(dst, raw[k])
+		if literal++; literal < shortRun {
+			continue
+		}
+		literal = 0
+		if nextEsc <= k {
+			nextEsc = nextIndex(limit, k+1, escByte)
+		}
+		if nextEnd <= k {
+			nextEnd = nextIndex(limit, k+1, endByte)
+		}
+		if strict && nextStart <= k {
+			nextStart = nextIndex(limit, k+1, startByte)
+		}
+		next := nextEsc
+		if nextEnd < next {
+			next = nextEnd
+		}
+		if nextStart < next {
+			next = nextStart
+		}
+		dst = append(dst, raw[k+1:next]...)
+		k = next - 1
+	}
+	return dst, 0, nil
+}
+
+// shortRun is the number of literal bytes escape and unescape copy one at a
+// time before looking for the end of the run with bytes.IndexByte.
+const shortRun = 8
+
+// nextIndex returns the index of the first c in b at or after from, or len(b)
+// if there is none.
+func nextIndex(b []byte, from int, c byte) int {
+	if i := bytes.IndexByte(b[from:], c); i >= 0 {
+		return from + i
+	}
+	return len(b)
+}
+
+// isControlByte reports whether b is one of the bytes that is escaped in a
+// frame.
+func isControlByte(b byte) bool {
+	return b == startByte || b == endByte || b == escByte
+}
+
+// SetMaxFrameSize sets the largest raw frame a Framer created by this package
+// will buffer, see Assembler.MaxFrameSize. It must be called before the
+// Framer is read from.
+func SetMaxFrameSize(f Framer, n int) error {
+	x, ok := f.(*x2m200Frame)
+	if !ok {
+		return errMaxFrameSizeNotSupported
+	}
+	x.a.MaxFrameSize = n
+	return nil
+}
+
+// SetStrictEscaping sets whether a Framer created by this package rejects
+// frames that are not fully escaped, see Assembler.StrictEscaping. It must be
+// called before the Framer is read from.
+func SetStrictEscaping(f Framer, strict bool) error {
+	x, ok := f.(*x2m200Frame)
+	if !ok {
+		return errStrictEscapingNotSupported
+	}
+	x.a.StrictEscaping = strict
+	return nil
+}
+
+// SetResync sets whether a Framer created by this package silently skips
+// bytes before a start byte, as seen when attaching to a sensor mid-frame.
+// Framers from NewFramer and Open resync by default, otherwise each run of
+// such bytes is returned as a FramingError wrapping ErrPacketNoStartByte.
+// Skipped bytes are counted in Stats.DiscardedBytes either way.
+func SetResync(f Framer, resync bool) error {
+	x, ok := f.(*x2m200Frame)
+	if !ok {
+		return errResyncNotSupported
+	}
+	x.resync = resync
+	return nil
+}
+
+var (
+	errMaxFrameSizeNotSupported   = errors.New("framer does not support a maximum frame size")
+	errStrictEscapingNotSupported = errors.New("framer does not support strict escaping")
+	errResyncNotSupported         = errors.New("framer does not support resync")
+)
@@ -0,0 +1,348 @@
+package xethru
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// buildIQPayload creates an unframed baseband iq message with bins samples
+func buildIQPayload(counter uint32, bins int) []byte {
+	b := make([]byte, iqheadersize+8*bins)
+	b[0] = appDataByte
+	b[1] = basebandIQStartByte
+	binary.LittleEndian.PutUint32(b[5:9], counter)
+	binary.LittleEndian.PutUint32(b[9:13], uint32(bins))
+	binary.LittleEndian.PutUint32(b[13:17], math.Float32bits(0.0514))
+	binary.LittleEndian.PutUint32(b[25:29], math.Float32bits(0.2075))
+	for i := 0; i < 2*bins; i++ {
+		v := float32(math.Sin(float64(i)))
+		binary.LittleEndian.PutUint32(b[iqheadersize+4*i:], math.Float32bits(v))
+	}
+	return b
+}
+
+// encodeFrame escapes every control byte including the crc
+func encodeFrame(payload []byte) []byte {
+	crc := byte(startByte)
+	for _, v := range payload {
+		crc ^= v
+	}
+	out := []byte{startByte}
+	for _, v := range append(append([]byte{}, payload...), crc) {
+		if v == startByte || v == endByte || v == escByte {
+			out = append(out, escByte)
+		}
+		out = append(out, v)
+	}
+	return append(out, endByte)
+}
+
+func TestAssemblerChunked(t *testing.T) {
+	payload := buildIQPayload(7, 256)
+	frame := encodeFrame(payload)
+	expected, err := parseBaseBandIQ(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := rand.New(rand.NewSource(1))
+	for n := 0; n < 50; n++ {
+		a := NewAssembler()
+		a.Write([]byte{0x00, 0x13})
+		var got []BaseBandIQ
+		for p := frame; len(p) > 0; {
+			size := r.Intn(len(frame)/10+1) + 1
+			if size > len(p) {
+				size = len(p)
+			}
+			a.Write(p[:size])
+			p = p[size:]
+			for {
+				b, err := a.Next()
+				if err != nil {
+					t.Fatalf("test %d unexpected error %v\n", n, err)
+				}
+				if b == nil {
+					break
+				}
+				iq, err := parseBaseBandIQ(b)
+				if err != nil {
+					t.Fatalf("test %d unexpected error %v\n", n, err)
+				}
+				got = append(got, iq)
+			}
+		}
+		if len(got) != 1 {
+			t.Fatalf("test %d Expected: 1 frame, got %d\n", n, len(got))
+		}
+		got[0].Time = expected.Time
+		if !reflect.DeepEqual(got[0], expected) {
+			t.Errorf("test %d frame does not match\n", n)
+		}
+	}
+}
+
+func TestAssemblerBackToBack(t *testing.T) {
+	a := NewAssembler()
+	var in []byte
+	for i := 0; i < 3; i++ {
+		in = append(in, encodeFrame(buildIQPayload(uint32(i), 4))...)
+	}
+	in = append(in, encodeFrame([]byte{0x10})[:1]...)
+	a.Write(in)
+	for i := 0; i < 3; i++ {
+		b, err := a.Next()
+		if err != nil || b == nil {
+			t.Fatalf("frame %d Expected payload, got %x %v\n", i, b, err)
+		}
+		iq, _ := parseBaseBandIQ(b)
+		if iq.Counter != uint32(i) {
+			t.Errorf("Expected: counter %d, got %d\n", i, iq.Counter)
+		}
+	}
+	if b, err := a.Next(); b != nil || err != nil {
+		t.Errorf("Expected: no frame, got %x %v\n", b, err)
+	}
+	if a.Buffered() != 1 {
+		t.Errorf("Expected: partial frame to remain buffered, got %d bytes\n", a.Buffered())
+	}
+}
+
+func TestAssemblerBadCRC(t *testing.T) {
+	a := NewAssembler()
+	a.Write([]byte{0x7d, 0x01, 0x02, 0x03, 0x71, 0x7e})
+	a.Write(encodeFrame([]byte{0x10}))
+	_, err := a.Next()
+	var crcErr *CRCError
+	if !errors.As(err, &crcErr) || !errors.Is(err, ErrPacketBadCRC) {
+		t.Fatalf("Expected: %v, got %v\n", ErrPacketBadCRC, err)
+	}
+	if crcErr.Expected != 0x7d || crcErr.Got != 0x71 {
+		t.Errorf("Expected: crc 0x7d got 0x71, got %#02x %#02x\n", crcErr.Expected, crcErr.Got)
+	}
+	b, err := a.Next()
+	if err != nil || string(b) != string([]byte{0x10}) {
+		t.Errorf("Expected: 10, got %x %v\n", b, err)
+	}
+}
+
+func TestAssemblerFrameTooLarge(t *testing.T) {
+	noise := make([]byte, 1<<20)
+	for i := range noise {
+		noise[i] = byte(i % startByte)
+	}
+	payload := buildIQPayload(3, 1024)
+
+	cases := []struct {
+		lead     []byte
+		tooLarge bool
+	}{
+		{noise, false},
+		{append([]byte{startByte}, noise...), true},
+	}
+	for n, c := range cases {
+		in := append(append([]byte{}, c.lead...), encodeFrame(payload)...)
+		x := CreateSplitReadWriter(nil, bytes.NewReader(in)).(*x2m200Frame)
+		b := make([]byte, 2*len(payload))
+		var tooLarge bool
+		var got []byte
+		for got == nil {
+			m, err := x.Read(b)
+			if x.a.Buffered() > defaultMaxFrameSize+readChunkSize {
+				t.Fatalf("test %d Expected: at most %d bytes buffered, got %d\n", n, defaultMaxFrameSize+readChunkSize, x.a.Buffered())
+			}
+			switch {
+			case errors.Is(err, ErrFrameTooLarge):
+				tooLarge = true
+			case err == io.EOF:
+				t.Fatalf("test %d Expected: frame, got %v\n", n, err)
+			case err == nil:
+				got = b[:m]
+			}
+		}
+		if tooLarge != c.tooLarge {
+			t.Errorf("test %d Expected: %v, got %v\n", n, c.tooLarge, tooLarge)
+		}
+		if !bytes.Equal(got, payload) {
+			t.Errorf("test %d Expected: valid frame after noise, got %d bytes\n", n, len(got))
+		}
+	}
+}
+
+func TestAssemblerMaxFrameSize(t *testing.T) {
+	a := NewAssembler()
+	a.MaxFrameSize = 8
+	a.Write([]byte{0x7d, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08})
+	a.Write(encodeFrame([]byte{0x10}))
+	if _, err := a.Next(); !errors.Is(err, ErrFrameTooLarge) {
+		t.Fatalf("Expected: %v, got %v\n", ErrFrameTooLarge, err)
+	}
+	b, err := a.Next()
+	if err != nil || !bytes.Equal(b, []byte{0x10}) {
+		t.Errorf("Expected: 10, got %x %v\n", b, err)
+	}
+
+	f := NewFramer(&bytes.Buffer{})
+	if err := SetMaxFrameSize(f, 32); err != nil {
+		t.Error(err)
+	}
+	if got := f.(*x2m200Frame).a.MaxFrameSize; got != 32 {
+		t.Errorf("Expected: %d, got %d\n", 32, got)
+	}
+}
+
+func TestAssemblerEscapes(t *testing.T) {
+	cases := []struct {
+		in      []byte
+		payload []byte
+		err     error
+		offset  int64
+	}{
+		{[]byte{0x7d, 0x7f, 0x7d, 0x00, 0x7e}, []byte{0x7d}, nil, 0},
+		{[]byte{0x7d, 0x7f, 0x7e, 0x03, 0x7e}, []byte{0x7e}, nil, 0},
+		{[]byte{0x7d, 0x7f, 0x7f, 0x02, 0x7e}, []byte{0x7f}, nil, 0},
+		{[]byte{0x7d, 0x10, 0x7f, 0x7d, 0x7f, 0x7e, 0x7f, 0x7f, 0x11, 0x7e}, []byte{0x10, 0x7d, 0x7e, 0x7f}, nil, 0},
+		{[]byte{0x7d, 0x7f, 0x00, 0x7d, 0x7e}, nil, ErrInvalidEscapeSequence, 2},
+		{[]byte{0x7d, 0x7f, 0x01, 0x7c, 0x7e}, nil, ErrInvalidEscapeSequence, 2},
+		{[]byte{0x7d, 0x10, 0x7f, 0x10, 0x6d, 0x7e}, nil, ErrInvalidEscapeSequence, 3},
+		{[]byte{0x7d, 0x7f, 0x7c, 0x01, 0x7e}, nil, ErrInvalidEscapeSequence, 2},
+		{[]byte{0x7d, 0x7f, 0x80, 0x82, 0x7e}, nil, ErrInvalidEscapeSequence, 2},
+		{[]byte{0x7d, 0x7f, 0xff, 0x7d, 0x7e}, nil, ErrInvalidEscapeSequence, 2},
+	}
+	for n, c := range cases {
+		a := NewAssembler()
+		a.Write(c.in)
+		a.Write(encodeFrame([]byte{0x10}))
+		b, err := a.Next()
+		if !errors.Is(err, c.err) {
+			t.Errorf("test %d Expected: %v, got %v\n", n, c.err, err)
+		}
+		if !bytes.Equal(b, c.payload) {
+			t.Errorf("test %d Expected: %x, got %x\n", n, c.payload, b)
+		}
+		var framingErr *FramingError
+		if c.err != nil && (!errors.As(err, &framingErr) || framingErr.Offset != c.offset) {
+			t.Errorf("test %d Expected: FramingError at offset %d, got %v\n", n, c.offset, err)
+		}
+		// start bytes in the bad frame may give more errors before the
+		// next good frame
+		b, err = a.Next()
+		for err != nil {
+			b, err = a.Next()
+		}
+		if !bytes.Equal(b, []byte{0x10}) {
+			t.Errorf("test %d Expected: resync to 10, got %x\n", n, b)
+		}
+
+		if _, err := DecodeFrame(c.in); !errors.Is(err, c.err) {
+			t.Errorf("test %d Expected: %v, got %v\n", n, c.err, err)
+		}
+	}
+}
+
+func FuzzAssembler(f *testing.F) {
+	f.Add(encodeFrame([]byte{0x10}))
+	f.Add(encodeFrame(respirationPayload))
+	f.Add([]byte{0x7d, 0x7f, 0x00, 0x7d, 0x7e})
+	f.Add([]byte{0x7d, 0x7f})
+	f.Fuzz(func(t *testing.T, in []byte) {
+		a := NewAssembler()
+		a.MaxFrameSize = 64
+		a.Write(in)
+		for i := 0; ; i++ {
+			b, err := a.Next()
+			if b == nil && err == nil {
+				break
+			}
+			if i > len(in) {
+				t.Fatalf("Expected: at most %d frames or errors from %d bytes\n", len(in), len(in))
+			}
+		}
+		DecodeFrame(in)
+	})
+}
+
+func TestAssemblerStrictEscaping(t *testing.T) {
+	cases := []struct {
+		in      []byte
+		payload []byte
+		err     error
+	}{
+		{[]byte{0x7d, 0x00, 0x7c, 0x7f, 0x7f, 0x7e, 0x7e}, []byte{0x00, 0x7c, 0x7f}, ErrPacketBadCRC},
+		{[]byte{0x7d, 0x01, 0x02, 0x00, 0x7e, 0x7e}, []byte{0x01, 0x02, 0x00}, ErrPacketBadCRC},
+		{[]byte{0x7d, 0x10, 0x7d, 0x10, 0x00, 0x7e}, []byte{0x10, 0x7d, 0x10}, ErrInvalidEscapeSequence},
+	}
+	for n, c := range cases {
+		for _, strict := range []bool{false, true} {
+			a := NewAssembler()
+			a.StrictEscaping = strict
+			a.Write(c.in)
+			b, err := a.Next()
+			if strict {
+				if !errors.Is(err, c.err) {
+					t.Errorf("test %d Expected: %v, got %v\n", n, c.err, err)
+				}
+				continue
+			}
+			if err != nil || !bytes.Equal(b, c.payload) {
+				t.Errorf("test %d Expected: %x, got %x %v\n", n, c.payload, b, err)
+			}
+		}
+	}
+
+	if err := SetStrictEscaping(NewFramer(&bytes.Buffer{}), true); err != nil {
+		t.Error(err)
+	}
+}
+
+// unescapeReference is unescape as it was first written, a byte at a time.
+func unescapeReference(dst, raw []byte, max int, strict bool) (out []byte, n int, err error) {
+	for k := 1; k < len(raw); k++ {
+		if k >= max {
+			return dst, k, ErrFrameTooLarge
+		}
+		switch raw[k] {
+		case escByte:
+			if k+1 >= len(raw) {
+				return dst, 0, nil
+			}
+			k++
+			if !isControlByte(raw[k]) {
+				return dst, k, ErrInvalidEscapeSequence
+			}
+			dst = append(dst, raw[k])
+		case endByte:
+			return dst, k + 1, nil
+		case startByte:
+			if strict {
+				return dst, k, ErrInvalidEscapeSequence
+			}
+			dst = append(dst, raw[k])
+		default:
+			dst = append(dst, raw[k])
+		}
+	}
+	return dst, 0, nil
+}
+
+func FuzzUnescape(f *testing.F) {
+	f.Add(encodeFrame(respirationPayload), 64, false)
+	f.Add(encodeFrame(escapeTestPayload(100, 5)), 64, true)
+	f.Add(encodeFrame(escapeTestPayload(100, 50)), 200, false)
+	f.Add([]byte{0x7d, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x7d, 0x0a, 0x7e}, 13, true)
+	f.Add([]byte{0x7d, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x7f}, 10, false)
+	f.Add([]byte{0x7d, 0x01}, -1, false)
+	f.Fuzz(func(t *testing.T, raw []byte, max int, strict bool) {
+		want, wantN, wantErr := unescapeReference(nil, raw, max, strict)
+		got, n, err := unescape(nil, raw, max, strict)
+		if !bytes.Equal(got, want) || n != wantN || err != wantErr {
+			t.Errorf("Expected: %x %d %v, got %x %d %v\n", want, wantN, wantErr, got, n, err)
+		}
+	})
+}
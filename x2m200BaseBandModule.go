@@ -0,0 +1,57 @@
+package xethru
+
+// BaseBandModule streams baseband amplitude/phase and IQ frames routed to it
+// by a Dispatcher, so baseband data can be received alongside another module.
+type BaseBandModule struct {
+	BasebandFormat BasebandFormat
+	Protocol       Protocol
+	Logger         Logger      // nil uses the Framer's Logger
+	Metrics        MetricsSink // nil uses the Framer's MetricsSink
+	KeepRaw        bool        // attach a copy of each payload to the frames parsed from it
+	Limits         *Limits     // sanity checks on parsed frames, nil uses DefaultLimits
+	d              *Dispatcher
+	frames         <-chan Frame
+}
+
+// NewBaseBandModule creates a BaseBandModule subscribed to d.
+func NewBaseBandModule(d *Dispatcher) *BaseBandModule {
+	return &BaseBandModule{
+		d:      d,
+		frames: d.Subscribe(1000, FrameBaseBandAmpPhase, FrameBaseBandIQ),
+	}
+}
+
+// Run starts the dispatcher if needed, then parses baseband frames and sends
+// them on stream until the dispatcher stops.
+func (b *BaseBandModule) Run(stream chan interface{}) {
+	b.d.Start()
+	for f := range b.frames {
+		data, err := parseProtocol(f.Payload, b.BasebandFormat, b.Protocol)
+		if err == nil {
+			err = b.limits().Check(data)
+		}
+		if err != nil {
+			b.log().Warnf("%v", err)
+			b.metrics().Counter(MetricParseErrors, 1)
+			continue
+		}
+		if b.KeepRaw {
+			data = withRaw(data, f.Payload)
+		}
+		stream <- data
+	}
+}
+
+func (b *BaseBandModule) log() Logger {
+	if b.Logger != nil {
+		return b.Logger
+	}
+	return frameLogger(b.d.f)
+}
+
+func (b *BaseBandModule) metrics() MetricsSink {
+	if b.Metrics != nil {
+		return b.Metrics
+	}
+	return frameMetrics(b.d.f)
+}
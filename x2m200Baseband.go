@@ -0,0 +1,167 @@
+package xethru
+
+import (
+	"errors"
+	"math"
+	"math/cmplx"
+)
+
+// RangeBins returns the range in meters of each bin in the frame, calculated
+// as RangeOffset + i*BinLength.
+func (h BaseBandHeader) RangeBins() []float64 {
+	r := make([]float64, h.Bins)
+	for i := range r {
+		r[i] = h.RangeOffset + float64(i)*h.BinLength
+	}
+	return r
+}
+
+// BinAtRange returns the index of the bin closest to meters.
+func (h BaseBandHeader) BinAtRange(meters float64) (int, error) {
+	if h.BinLength <= 0 || h.Bins == 0 {
+		return 0, errBinLengthInvalid
+	}
+	i := math.Round((meters - h.RangeOffset) / h.BinLength)
+	if i < 0 || i >= float64(h.Bins) {
+		return 0, errRangeOutOfBounds
+	}
+	return int(i), nil
+}
+
+// Complex returns the IQ samples as complex numbers with SigI as the real part
+// and SigQ as the imaginary part.
+func (iq BaseBandIQ) Complex() []complex128 {
+	n := len(iq.SigI)
+	if len(iq.SigQ) < n {
+		n = len(iq.SigQ)
+	}
+	c := make([]complex128, n)
+	for i := range c {
+		c[i] = complex(iq.SigI[i], iq.SigQ[i])
+	}
+	return c
+}
+
+// Magnitude returns the magnitude of each IQ sample.
+func (iq BaseBandIQ) Magnitude() []float64 {
+	c := iq.Complex()
+	m := make([]float64, len(c))
+	for i, v := range c {
+		m[i] = cmplx.Abs(v)
+	}
+	return m
+}
+
+// PhaseSlice returns the phase in radians of each IQ sample.
+func (iq BaseBandIQ) PhaseSlice() []float64 {
+	c := iq.Complex()
+	p := make([]float64, len(c))
+	for i, v := range c {
+		p[i] = cmplx.Phase(v)
+	}
+	return p
+}
+
+// BaseBandIQFromComplex builds a BaseBandIQ frame from the header fields and
+// complex samples, the inverse of Complex.
+func BaseBandIQFromComplex(counter uint32, binLength, samplingFreq, carrierFreq, rangeOffset float64, data []complex128) BaseBandIQ {
+	iq := BaseBandIQ{
+		BaseBandHeader: BaseBandHeader{
+			Time:         clock().Now().UnixNano(),
+			Status:       basebandIQ,
+			Counter:      counter,
+			Bins:         uint32(len(data)),
+			BinLength:    binLength,
+			SamplingFreq: samplingFreq,
+			CarrierFreq:  carrierFreq,
+			RangeOffset:  rangeOffset,
+		},
+		SigI: make([]float64, len(data)),
+		SigQ: make([]float64, len(data)),
+	}
+	for i, v := range data {
+		iq.SigI[i] = real(v)
+		iq.SigQ[i] = imag(v)
+	}
+	return iq
+}
+
+// Decimate returns a copy of iq with each group of factor bins averaged into a
+// single bin. The range of the new bins is the centre of each group. If
+// factor does not evenly divide the bins an error is returned, unless
+// truncate is set in which case the remaining bins are dropped.
+func (iq BaseBandIQ) Decimate(factor int, truncate bool) (BaseBandIQ, error) {
+	data := iq.Complex()
+	bins, err := decimatedBins(len(data), factor, truncate)
+	if err != nil {
+		return iq, err
+	}
+	out := make([]complex128, bins)
+	for i := range out {
+		var sum complex128
+		for _, v := range data[i*factor : (i+1)*factor] {
+			sum += v
+		}
+		out[i] = sum / complex(float64(factor), 0)
+	}
+	d := BaseBandIQFromComplex(iq.Counter, iq.BinLength*float64(factor), iq.SamplingFreq, iq.CarrierFreq, decimatedOffset(iq.RangeOffset, iq.BinLength, factor), out)
+	d.Time = iq.Time
+	d.Status = iq.Status
+	return d, nil
+}
+
+// Decimate returns a copy of ap with each group of factor bins combined into a
+// single bin. Amplitudes are combined by averaging power and phases by the
+// amplitude weighted circular mean. The range of the new bins is the centre
+// of each group. If factor does not evenly divide the bins an error is
+// returned, unless truncate is set in which case the remaining bins are
+// dropped.
+func (ap BaseBandAmpPhase) Decimate(factor int, truncate bool) (BaseBandAmpPhase, error) {
+	n := len(ap.Amplitude)
+	if len(ap.Phase) < n {
+		n = len(ap.Phase)
+	}
+	bins, err := decimatedBins(n, factor, truncate)
+	if err != nil {
+		return ap, err
+	}
+	d := ap
+	d.Bins = uint32(bins)
+	d.BinLength = ap.BinLength * float64(factor)
+	d.RangeOffset = decimatedOffset(ap.RangeOffset, ap.BinLength, factor)
+	d.Amplitude = make([]float64, bins)
+	d.Phase = make([]float64, bins)
+	for i := 0; i < bins; i++ {
+		var power float64
+		var sum complex128
+		for k := i * factor; k < (i+1)*factor; k++ {
+			power += ap.Amplitude[k] * ap.Amplitude[k]
+			sum += cmplx.Rect(ap.Amplitude[k], ap.Phase[k])
+		}
+		d.Amplitude[i] = math.Sqrt(power / float64(factor))
+		d.Phase[i] = cmplx.Phase(sum)
+	}
+	return d, nil
+}
+
+func decimatedBins(bins, factor int, truncate bool) (int, error) {
+	if factor <= 0 {
+		return 0, errDecimateFactorInvalid
+	}
+	if bins%factor != 0 && !truncate {
+		return 0, errDecimateFactorUneven
+	}
+	return bins / factor, nil
+}
+
+func decimatedOffset(offset, binLength float64, factor int) float64 {
+	return offset + float64(factor-1)/2*binLength
+}
+
+var (
+	errBinLengthInvalid = errors.New("baseband frame has no valid bins")
+	errRangeOutOfBounds = errors.New("range is outside of the baseband frame")
+
+	errDecimateFactorInvalid = errors.New("decimation factor must be greater than zero")
+	errDecimateFactorUneven  = errors.New("decimation factor does not evenly divide the bins")
+)
@@ -0,0 +1,76 @@
+package xethru
+
+import (
+	"fmt"
+)
+
+// BasebandKind is the kind of a baseband message, its first byte after the
+// app data byte.
+type BasebandKind byte
+
+// Baseband message kinds
+const (
+	BasebandKindAmpPhase BasebandKind = basebandPhaseAmpltudeStartByte
+	BasebandKindIQ       BasebandKind = basebandIQStartByte
+)
+
+// ErrBasebandKind is returned by SniffBaseBandKind for a payload that is not
+// a baseband message.
+var ErrBasebandKind = fmt.Errorf("%w: not a baseband message", ErrParse)
+
+func (k BasebandKind) String() string {
+	switch k {
+	case BasebandKindAmpPhase:
+		return "amplitude/phase"
+	case BasebandKindIQ:
+		return "iq"
+	}
+	return fmt.Sprintf("BasebandKind(%#02x)", byte(k))
+}
+
+// FrameType returns the type the Dispatcher routes messages of kind k as.
+func (k BasebandKind) FrameType() FrameType {
+	switch k {
+	case BasebandKindAmpPhase:
+		return FrameBaseBandAmpPhase
+	case BasebandKindIQ:
+		return FrameBaseBandIQ
+	}
+	return FrameUnknown
+}
+
+// SniffBaseBandKind returns the kind of the baseband message in b without
+// parsing it, so the right parser can be chosen. b may be a payload or a
+// whole frame as for ParseRespiration. A payload too short to say is a
+// *LengthError, any other message is ErrBasebandKind.
+func SniffBaseBandKind(b []byte) (BasebandKind, error) {
+	if len(b) > 0 && b[0] == startByte {
+		payload, err := DecodeFrame(b)
+		if err != nil {
+			return 0, err
+		}
+		b = payload
+	}
+	if len(b) < 2 {
+		return 0, &LengthError{Err: ErrNoData, Want: 2, Got: len(b)}
+	}
+	if kind, ok := basebandKind(b); ok {
+		return kind, nil
+	}
+	if b[0] != appDataByte {
+		return 0, fmt.Errorf("%w: not app data %#02x", ErrBasebandKind, b[0])
+	}
+	return 0, fmt.Errorf("%w: unknown message %#02x", ErrBasebandKind, b[1])
+}
+
+// basebandKind is SniffBaseBandKind for a payload that does not allocate.
+func basebandKind(b []byte) (BasebandKind, bool) {
+	if len(b) < 2 || b[0] != appDataByte {
+		return 0, false
+	}
+	switch kind := BasebandKind(b[1]); kind {
+	case BasebandKindAmpPhase, BasebandKindIQ:
+		return kind, true
+	}
+	return 0, false
+}
@@ -0,0 +1,70 @@
+package xethru
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSniffBaseBandKind(t *testing.T) {
+	header := BaseBandHeader{Status: basebandIQ, Counter: 1, Bins: 2, BinLength: 0.5}
+	iq, err := MarshalPayload(BaseBandIQ{BaseBandHeader: header, SigI: []float64{1, 2}, SigQ: []float64{3, 4}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	header.Status = basebandAP
+	ap, err := MarshalPayload(BaseBandAmpPhase{BaseBandHeader: header, Amplitude: []float64{1, 2}, Phase: []float64{0, 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unknown := append([]byte(nil), iq...)
+	unknown[1] = 0x0e
+
+	cases := []struct {
+		b     []byte
+		kind  BasebandKind
+		frame FrameType
+		err   error
+	}{
+		{iq, BasebandKindIQ, FrameBaseBandIQ, nil},
+		{ap, BasebandKindAmpPhase, FrameBaseBandAmpPhase, nil},
+		{EncodeFrame(ap), BasebandKindAmpPhase, FrameBaseBandAmpPhase, nil},
+		{unknown, 0, FrameUnknown, ErrBasebandKind},
+		{respirationPayload, 0, FrameRespiration, ErrBasebandKind},
+		{[]byte{ack}, 0, FrameAck, ErrNoData},
+		{[]byte{errorByte, notReconsied}, 0, FrameError, ErrBasebandKind},
+		{nil, 0, FrameUnknown, ErrNoData},
+	}
+	for n, c := range cases {
+		kind, err := SniffBaseBandKind(c.b)
+		if kind != c.kind || !errors.Is(err, c.err) || (c.err == nil) != (err == nil) {
+			t.Errorf("test %d Expected: %v %v, got %v %v\n", n, c.kind, c.err, kind, err)
+		}
+		if c.err != nil && !errors.Is(err, ErrParse) {
+			t.Errorf("test %d Expected: %v, got %v\n", n, ErrParse, err)
+		}
+		if n == 2 {
+			continue // framed, the dispatcher sees payloads
+		}
+		if got := frameType(c.b); got != c.frame {
+			t.Errorf("test %d Expected: frame type %v, got %v\n", n, c.frame, got)
+		}
+	}
+
+	// each kind goes to its own parser
+	if v, err := parse(iq); err != nil {
+		t.Error(err)
+	} else if _, ok := v.(BaseBandIQ); !ok {
+		t.Errorf("Expected: BaseBandIQ, got %T\n", v)
+	}
+	if v, err := parse(ap); err != nil {
+		t.Error(err)
+	} else if _, ok := v.(BaseBandAmpPhase); !ok {
+		t.Errorf("Expected: BaseBandAmpPhase, got %T\n", v)
+	}
+	if _, err := parse(unknown); !errors.Is(err, ErrParseNotImplemented) {
+		t.Errorf("Expected: %v, got %v\n", ErrParseNotImplemented, err)
+	}
+	if got := BasebandKind(0x0e).String(); got != "BasebandKind(0x0e)" {
+		t.Errorf("Expected: BasebandKind(0x0e), got %s\n", got)
+	}
+}
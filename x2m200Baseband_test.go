@@ -0,0 +1,164 @@
+package xethru
+
+import (
+	"math"
+	"math/cmplx"
+	"math/rand"
+	"testing"
+)
+
+func TestRangeBins(t *testing.T) {
+	iq := BaseBandIQ{BaseBandHeader: BaseBandHeader{Bins: 4, BinLength: 0.0514, RangeOffset: 0.2075}}
+	ap := BaseBandAmpPhase{BaseBandHeader: BaseBandHeader{Bins: 4, BinLength: 0.0514, RangeOffset: 0.2075}}
+	expected := []float64{0.2075, 0.2589, 0.3103, 0.3617}
+
+	for _, r := range [][]float64{iq.RangeBins(), ap.RangeBins()} {
+		if len(r) != len(expected) {
+			t.Fatalf("Expected: %d bins, got %d\n", len(expected), len(r))
+		}
+		for i := range r {
+			if math.Abs(r[i]-expected[i]) > 1e-9 {
+				t.Errorf("bin %d Expected: %v, got %v\n", i, expected[i], r[i])
+			}
+		}
+	}
+}
+
+func TestBinAtRange(t *testing.T) {
+	cases := []struct {
+		frame  BaseBandAmpPhase
+		meters float64
+		bin    int
+		err    error
+	}{
+		{BaseBandAmpPhase{BaseBandHeader: BaseBandHeader{Bins: 4, BinLength: 0.0514, RangeOffset: 0.2075}}, 0.2075, 0, nil},
+		{BaseBandAmpPhase{BaseBandHeader: BaseBandHeader{Bins: 4, BinLength: 0.0514, RangeOffset: 0.2075}}, 0.3103, 2, nil},
+		{BaseBandAmpPhase{BaseBandHeader: BaseBandHeader{Bins: 4, BinLength: 0.0514, RangeOffset: 0.2075}}, 0.3650, 3, nil},
+		{BaseBandAmpPhase{BaseBandHeader: BaseBandHeader{Bins: 4, BinLength: 0.0514, RangeOffset: 0.2075}}, 0.1, 0, errRangeOutOfBounds},
+		{BaseBandAmpPhase{BaseBandHeader: BaseBandHeader{Bins: 4, BinLength: 0.0514, RangeOffset: 0.2075}}, 0.5, 0, errRangeOutOfBounds},
+		{BaseBandAmpPhase{BaseBandHeader: BaseBandHeader{Bins: 4, BinLength: 0, RangeOffset: 0.2075}}, 0.3, 0, errBinLengthInvalid},
+		{BaseBandAmpPhase{BaseBandHeader: BaseBandHeader{Bins: 0, BinLength: 0.0514, RangeOffset: 0.2075}}, 0.3, 0, errBinLengthInvalid},
+	}
+	for n, c := range cases {
+		bin, err := c.frame.BinAtRange(c.meters)
+		if err != c.err {
+			t.Errorf("test %d Expected: %v, got %v\n", n, c.err, err)
+		}
+		if bin != c.bin {
+			t.Errorf("test %d Expected: %d, got %d\n", n, c.bin, bin)
+		}
+		iq := BaseBandIQ{BaseBandHeader: BaseBandHeader{Bins: c.frame.Bins, BinLength: c.frame.BinLength, RangeOffset: c.frame.RangeOffset}}
+		iqbin, iqerr := iq.BinAtRange(c.meters)
+		if iqbin != bin || iqerr != err {
+			t.Errorf("test %d iq and ampphase disagree: %d %v, %d %v\n", n, iqbin, iqerr, bin, err)
+		}
+	}
+}
+
+func randomIQ(r *rand.Rand, bins int) BaseBandIQ {
+	iq := BaseBandIQ{BaseBandHeader: BaseBandHeader{Bins: uint32(bins), BinLength: 0.0514, RangeOffset: 0.2075}}
+	for i := 0; i < bins; i++ {
+		iq.SigI = append(iq.SigI, r.NormFloat64())
+		iq.SigQ = append(iq.SigQ, r.NormFloat64())
+	}
+	return iq
+}
+
+func TestBaseBandIQComplex(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for n := 0; n < 100; n++ {
+		iq := randomIQ(r, r.Intn(300))
+		c := iq.Complex()
+		if len(c) != len(iq.SigI) {
+			t.Fatalf("test %d Expected: %d samples, got %d\n", n, len(iq.SigI), len(c))
+		}
+		mag := iq.Magnitude()
+		phase := iq.PhaseSlice()
+		for i := range c {
+			if c[i] != complex(iq.SigI[i], iq.SigQ[i]) {
+				t.Errorf("test %d bin %d Expected: %v, got %v\n", n, i, complex(iq.SigI[i], iq.SigQ[i]), c[i])
+			}
+			if mag[i] != cmplx.Abs(c[i]) {
+				t.Errorf("test %d bin %d Expected magnitude: %v, got %v\n", n, i, cmplx.Abs(c[i]), mag[i])
+			}
+			if phase[i] != math.Atan2(iq.SigQ[i], iq.SigI[i]) {
+				t.Errorf("test %d bin %d Expected phase: %v, got %v\n", n, i, math.Atan2(iq.SigQ[i], iq.SigI[i]), phase[i])
+			}
+		}
+
+		back := BaseBandIQFromComplex(iq.Counter, iq.BinLength, iq.SamplingFreq, iq.CarrierFreq, iq.RangeOffset, c)
+		if back.Bins != iq.Bins || back.Status != basebandIQ {
+			t.Errorf("test %d Expected: %d bins, got %d\n", n, iq.Bins, back.Bins)
+		}
+		for i := range c {
+			if back.SigI[i] != iq.SigI[i] || back.SigQ[i] != iq.SigQ[i] {
+				t.Errorf("test %d bin %d Expected: %v %v, got %v %v\n", n, i, iq.SigI[i], iq.SigQ[i], back.SigI[i], back.SigQ[i])
+			}
+		}
+	}
+}
+
+func TestBaseBandIQDecimate(t *testing.T) {
+	iq := BaseBandIQFromComplex(1, 0.1, 0, 0, 0.5, []complex128{1 + 1i, 3 - 1i, 2, 4 + 2i, 5, 5})
+	cases := []struct {
+		factor   int
+		truncate bool
+		err      error
+		data     []complex128
+		offset   float64
+	}{
+		{2, false, nil, []complex128{2, 3 + 1i, 5}, 0.55},
+		{3, false, nil, []complex128{2, complex(14.0/3, 2.0/3)}, 0.6},
+		{4, false, errDecimateFactorUneven, nil, 0},
+		{4, true, nil, []complex128{2.5 + 0.5i}, 0.65},
+		{0, true, errDecimateFactorInvalid, nil, 0},
+		{-2, false, errDecimateFactorInvalid, nil, 0},
+	}
+	for n, c := range cases {
+		d, err := iq.Decimate(c.factor, c.truncate)
+		if err != c.err {
+			t.Errorf("test %d Expected: %v, got %v\n", n, c.err, err)
+		}
+		if err != nil {
+			continue
+		}
+		if int(d.Bins) != len(c.data) || math.Abs(d.BinLength-0.1*float64(c.factor)) > 1e-9 || math.Abs(d.RangeOffset-c.offset) > 1e-9 {
+			t.Errorf("test %d Expected: %d bins %v long offset %v, got %d %v %v\n", n, len(c.data), 0.1*float64(c.factor), c.offset, d.Bins, d.BinLength, d.RangeOffset)
+		}
+		for i, v := range d.Complex() {
+			if cmplx.Abs(v-c.data[i]) > 1e-9 {
+				t.Errorf("test %d bin %d Expected: %v, got %v\n", n, i, c.data[i], v)
+			}
+		}
+	}
+}
+
+func TestBaseBandAmpPhaseDecimate(t *testing.T) {
+	ap := BaseBandAmpPhase{
+		BaseBandHeader: BaseBandHeader{Bins: 4, BinLength: 0.05, RangeOffset: 0.2},
+		Amplitude:      []float64{1, 7, 3, 4},
+		Phase:          []float64{0.5, 0.5, 0, math.Pi / 2},
+	}
+	d, err := ap.Decimate(2, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// sqrt((1+49)/2) = 5, sqrt((9+16)/2) = 3.5355
+	amp := []float64{5, math.Sqrt(12.5)}
+	// phase of 3+4i
+	phase := []float64{0.5, math.Atan2(4, 3)}
+	for i := range amp {
+		if math.Abs(d.Amplitude[i]-amp[i]) > 1e-9 || math.Abs(d.Phase[i]-phase[i]) > 1e-9 {
+			t.Errorf("bin %d Expected: %v %v, got %v %v\n", i, amp[i], phase[i], d.Amplitude[i], d.Phase[i])
+		}
+	}
+	if d.Bins != 2 || math.Abs(d.BinLength-0.1) > 1e-9 || math.Abs(d.RangeOffset-0.225) > 1e-9 {
+		t.Errorf("Expected: 2 bins 0.1 long offset 0.225, got %d %v %v\n", d.Bins, d.BinLength, d.RangeOffset)
+	}
+	if _, err := ap.Decimate(3, false); err != errDecimateFactorUneven {
+		t.Errorf("Expected: %v, got %v\n", errDecimateFactorUneven, err)
+	}
+	if ap.Amplitude[1] != 7 {
+		t.Errorf("Expected: original frame unchanged, got %v\n", ap.Amplitude)
+	}
+}
@@ -0,0 +1,84 @@
+package xethru
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// defaultBaudRate is the rate the sensor uses after power on.
+const defaultBaudRate = 115200
+
+// Set baud rate command. The values follow the layout of the other direct
+// commands but have not been checked against the X2M200 datasheet. A wrong
+// command can leave the sensor at a rate the host does not know, so
+// setBaudRate stays unexported until they are.
+// <Start> + <XTS_SPC_DIR_COMMAND> + <XTS_SDC_COMM_SETBAUDRATE> + [Rate(i)] + <CRC> + <End>
+const (
+	x2m200DirCommand  = 0x90
+	x2m200SetBaudRate = 0x80
+)
+
+var supportedBaudRates = map[int]bool{
+	9600:   true,
+	19200:  true,
+	38400:  true,
+	57600:  true,
+	115200: true,
+	230400: true,
+	460800: true,
+	921600: true,
+}
+
+var errBaudRateUnsupported = errors.New("unsupported baud rate")
+
+// setBaudRate changes the sensor's uart baud rate. Once the sensor acks the
+// command reconfigure is called to change the serial port to rate, then the
+// sensor is pinged. If the ping fails reconfigure is called again with the
+// old rate and an error returned.
+// Response: <Start> + <XTS_SPR_ACK> + <CRC> + <End>
+func (r *Module) setBaudRate(rate int, reconfigure func(rate int) error) error {
+	if !supportedBaudRates[rate] {
+		return fmt.Errorf("%w: %d", errBaudRateUnsupported, rate)
+	}
+	old := r.baudRate
+	if old == 0 {
+		old = defaultBaudRate
+	}
+	r.log().Debugf("setting baud rate %d", rate)
+
+	cmd := make([]byte, 6)
+	cmd[0] = x2m200DirCommand
+	cmd[1] = x2m200SetBaudRate
+	binary.LittleEndian.PutUint32(cmd[2:], uint32(rate))
+	if _, err := r.Execute(cmd, x2m200Ack, r.Timeout); err != nil {
+		return fmt.Errorf("failed to set baud rate %d: %w", rate, err)
+	}
+	if err := reconfigure(rate); err != nil {
+		return fmt.Errorf("failed to reconfigure port to %d: %w", rate, err)
+	}
+	if err := r.ping(); err != nil {
+		r.log().Warnf("no ping response at baud rate %d, reverting to %d", rate, old)
+		if rerr := reconfigure(old); rerr != nil {
+			return fmt.Errorf("failed to revert port to %d: %w", old, rerr)
+		}
+		return fmt.Errorf("no response at baud rate %d: %w", rate, err)
+	}
+	r.baudRate = rate
+	return nil
+}
+
+// ping sends the ping command and waits for a valid response.
+func (r *Module) ping() error {
+	cmd := make([]byte, 5)
+	cmd[0] = x2m200PingCommand
+	binary.BigEndian.PutUint32(cmd[1:], x2m200PingSeed)
+	_, err := r.exchange(cmd, r.Timeout, func(p []byte) bool {
+		if len(p) < 5 {
+			return false
+		}
+		_, err := isValidPingResponse(p)
+		return err == nil
+	})
+	return err
+}
@@ -0,0 +1,98 @@
+package xethru
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// baudConn garbles every byte read while the host and sensor rates differ.
+// The sensor changes rate after replying to the set baud rate command.
+type baudConn struct {
+	io.ReadWriteCloser
+	mu         sync.Mutex
+	hostRate   int
+	sensorRate int
+	pending    int
+}
+
+func (c *baudConn) Write(b []byte) (int, error) {
+	if i := bytes.Index(b, []byte{x2m200DirCommand, x2m200SetBaudRate}); i >= 0 && len(b) >= i+6 {
+		c.mu.Lock()
+		c.pending = int(binary.LittleEndian.Uint32(b[i+2:]))
+		c.mu.Unlock()
+	}
+	return c.ReadWriteCloser.Write(b)
+}
+
+func (c *baudConn) Read(b []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Read(b)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.hostRate != c.sensorRate {
+		for i := range b[:n] {
+			b[i] ^= 0x55
+		}
+	}
+	if c.pending != 0 {
+		c.sensorRate, c.pending = c.pending, 0
+	}
+	return n, err
+}
+
+func (c *baudConn) setHostRate(rate int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hostRate = rate
+	return nil
+}
+
+func TestSetBaudRate(t *testing.T) {
+	cases := []struct {
+		rate      int
+		portRate  int // rate the port is really set to
+		err       error
+		baudRate  int
+		reconfigs []int
+	}{
+		{921600, 921600, nil, 921600, []int{921600}},
+		{921600, 57600, ErrCommandTimeout, 0, []int{921600, 115200}},
+		{1000, 0, errBaudRateUnsupported, 0, nil},
+	}
+	for n, c := range cases {
+		conn, sensor := newFakeSensorConn(0)
+		sensor.setReplies([]byte{x2m200Ack}, []byte{x2m200PingCommand, 0xaa, 0xee, 0xae, 0xea})
+		bc := &baudConn{ReadWriteCloser: conn, hostRate: defaultBaudRate, sensorRate: defaultBaudRate}
+		m := NewModule(NewFramer(bc), "respiration")
+		m.Timeout = 50 * time.Millisecond
+
+		var reconfigs []int
+		err := m.setBaudRate(c.rate, func(rate int) error {
+			reconfigs = append(reconfigs, rate)
+			if rate == c.rate {
+				rate = c.portRate
+			}
+			return bc.setHostRate(rate)
+		})
+		if !errors.Is(err, c.err) {
+			t.Errorf("test %d Expected: %v, got %v\n", n, c.err, err)
+		}
+		if m.baudRate != c.baudRate {
+			t.Errorf("test %d Expected: %d, got %d\n", n, c.baudRate, m.baudRate)
+		}
+		if len(reconfigs) != len(c.reconfigs) {
+			t.Errorf("test %d Expected: %v, got %v\n", n, c.reconfigs, reconfigs)
+		} else {
+			for i := range reconfigs {
+				if reconfigs[i] != c.reconfigs[i] {
+					t.Errorf("test %d Expected: %v, got %v\n", n, c.reconfigs, reconfigs)
+				}
+			}
+		}
+		sensor.Close()
+	}
+}
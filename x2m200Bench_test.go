@@ -0,0 +1,78 @@
+package xethru
+
+import (
+	"io"
+	"testing"
+)
+
+// repeatReader replays wire n times, then returns io.EOF.
+type repeatReader struct {
+	wire []byte
+	n    int
+	off  int
+}
+
+func (r *repeatReader) Read(b []byte) (int, error) {
+	if r.n == 0 {
+		return 0, io.EOF
+	}
+	k := copy(b, r.wire[r.off:])
+	r.off += k
+	if r.off == len(r.wire) {
+		r.off = 0
+		r.n--
+	}
+	return k, nil
+}
+
+// runFrames runs a respiration Module over an in-memory Framer replaying n
+// respiration frames, draining the stream until Run returns.
+func runFrames(n int) {
+	f := CreateSplitReadWriter(io.Discard, &repeatReader{wire: encodeFrame(respirationPayload), n: n})
+	m := NewModule(f, "respiration")
+	m.Timeout = 1
+	stream := make(chan interface{}, 64)
+	done := make(chan struct{})
+	go func() {
+		for range stream {
+		}
+		close(done)
+	}()
+	m.Run(stream)
+	close(stream)
+	<-done
+}
+
+func TestParseRespirationAllocs(t *testing.T) {
+	allocs := testing.AllocsPerRun(100, func() {
+		parseRespiration(respirationPayload)
+	})
+	if allocs != 0 {
+		t.Errorf("Expected: 0 allocs, got %v\n", allocs)
+	}
+}
+
+func TestRunLoopAllocs(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode")
+	}
+	const frames = 5000
+	allocs := testing.AllocsPerRun(1, func() {
+		runFrames(frames)
+	})
+	if perFrame := allocs / frames; perFrame > 2 {
+		t.Errorf("Expected: <= 2 allocs per frame, got %.2f\n", perFrame)
+	}
+}
+
+func BenchmarkParseRespiration(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		parseRespiration(respirationPayload)
+	}
+}
+
+func BenchmarkRunLoop(b *testing.B) {
+	b.ReportAllocs()
+	runFrames(b.N)
+}
@@ -0,0 +1,354 @@
+package xethru
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Binary encoding
+// version byte + kind byte + fields in declaration order, all little endian.
+// Floats are float64 and each sample slice is a uint32 count followed by the
+// samples, Respiration's Valid and Settling are a flags byte. WriteFrameTo
+// prefixes each encoding with its uint32 length.
+const (
+	binaryVersion = 0x01
+
+	binaryRespiration      = 0x01
+	binaryBaseBandIQ       = 0x02
+	binaryBaseBandAmpPhase = 0x03
+
+	respirationBinarySize = 2 + 49
+	baseBandBinarySize    = 2 + 52
+
+	respirationValid    = 0x01 // flag set if Respiration.Valid
+	respirationSettling = 0x02 // flag set if Respiration.Settling
+
+	// maxBinaryFrame bounds the length read by ReadFrameFrom
+	maxBinaryFrame = 1 << 24
+)
+
+// Binary encoding errors
+var (
+	ErrBinaryVersion   = errors.New("unsupported binary encoding version")
+	errBinaryKind      = errors.New("unknown binary frame kind")
+	errBinaryType      = errors.New("type has no binary encoding")
+	errBinaryTooLarge  = errors.New("binary frame too large")
+	errBinaryTruncated = errors.New("binary frame truncated")
+	errBinaryLength    = errors.New("binary frame longer than its contents")
+)
+
+// MarshalBinary encodes r in the package's compact binary form.
+func (r Respiration) MarshalBinary() ([]byte, error) {
+	return r.appendBinary(make([]byte, 0, respirationBinarySize)), nil
+}
+
+func (r Respiration) appendBinary(b []byte) []byte {
+	b = append(b, binaryVersion, binaryRespiration)
+	b = appendUint64(b, uint64(r.Time))
+	b = appendUint32(b, uint32(r.Status))
+	b = appendUint32(b, r.Counter)
+	b = appendUint32(b, uint32(r.State))
+	b = appendUint32(b, r.RPM)
+	b = appendFloat(b, r.Distance)
+	b = appendFloat(b, r.SignalQuality)
+	b = appendFloat(b, r.Movement)
+	var flags byte
+	if r.Valid {
+		flags |= respirationValid
+	}
+	if r.Settling {
+		flags |= respirationSettling
+	}
+	return append(b, flags)
+}
+
+// UnmarshalBinary decodes r from the form written by MarshalBinary.
+func (r *Respiration) UnmarshalBinary(b []byte) error {
+	d, err := newBinaryDecoder(b, binaryRespiration)
+	if err != nil {
+		return err
+	}
+	v := Respiration{
+		Time:          int64(d.uint64()),
+		Status:        status(d.uint32()),
+		Counter:       d.uint32(),
+		State:         respirationState(d.uint32()),
+		RPM:           d.uint32(),
+		Distance:      d.float(),
+		SignalQuality: d.float(),
+		Movement:      d.float(),
+	}
+	// encodings from before Valid was added end here, their frames were valid
+	flags := byte(respirationValid)
+	if len(d.b) > 0 {
+		flags = d.byte()
+	}
+	v.Valid = flags&respirationValid != 0
+	v.Settling = flags&respirationSettling != 0
+	if err := d.done(); err != nil {
+		return err
+	}
+	*r = v
+	return nil
+}
+
+// MarshalBinary encodes iq in the package's compact binary form.
+func (iq BaseBandIQ) MarshalBinary() ([]byte, error) {
+	return iq.appendBinary(make([]byte, 0, iq.binarySize())), nil
+}
+
+func (iq BaseBandIQ) binarySize() int {
+	return baseBandBinarySize + 8 + 8*(len(iq.SigI)+len(iq.SigQ))
+}
+
+func (iq BaseBandIQ) appendBinary(b []byte) []byte {
+	b = append(b, binaryVersion, binaryBaseBandIQ)
+	b = iq.BaseBandHeader.appendBinary(b)
+	b = appendFloats(b, iq.SigI)
+	return appendFloats(b, iq.SigQ)
+}
+
+// UnmarshalBinary decodes iq from the form written by MarshalBinary.
+func (iq *BaseBandIQ) UnmarshalBinary(b []byte) error {
+	d, err := newBinaryDecoder(b, binaryBaseBandIQ)
+	if err != nil {
+		return err
+	}
+	v := BaseBandIQ{BaseBandHeader: d.header()}
+	v.SigI = d.floats()
+	v.SigQ = d.floats()
+	if err := d.done(); err != nil {
+		return err
+	}
+	*iq = v
+	return nil
+}
+
+// MarshalBinary encodes ap in the package's compact binary form.
+func (ap BaseBandAmpPhase) MarshalBinary() ([]byte, error) {
+	return ap.appendBinary(make([]byte, 0, ap.binarySize())), nil
+}
+
+func (ap BaseBandAmpPhase) binarySize() int {
+	return baseBandBinarySize + 8 + 8*(len(ap.Amplitude)+len(ap.Phase))
+}
+
+func (ap BaseBandAmpPhase) appendBinary(b []byte) []byte {
+	b = append(b, binaryVersion, binaryBaseBandAmpPhase)
+	b = ap.BaseBandHeader.appendBinary(b)
+	b = appendFloats(b, ap.Amplitude)
+	return appendFloats(b, ap.Phase)
+}
+
+// UnmarshalBinary decodes ap from the form written by MarshalBinary.
+func (ap *BaseBandAmpPhase) UnmarshalBinary(b []byte) error {
+	d, err := newBinaryDecoder(b, binaryBaseBandAmpPhase)
+	if err != nil {
+		return err
+	}
+	v := BaseBandAmpPhase{BaseBandHeader: d.header()}
+	v.Amplitude = d.floats()
+	v.Phase = d.floats()
+	if err := d.done(); err != nil {
+		return err
+	}
+	*ap = v
+	return nil
+}
+
+func (h BaseBandHeader) appendBinary(b []byte) []byte {
+	b = appendUint64(b, uint64(h.Time))
+	b = appendUint32(b, uint32(h.Status))
+	b = appendUint32(b, h.Counter)
+	b = appendUint32(b, h.Bins)
+	b = appendFloat(b, h.BinLength)
+	b = appendFloat(b, h.SamplingFreq)
+	b = appendFloat(b, h.CarrierFreq)
+	return appendFloat(b, h.RangeOffset)
+}
+
+// binaryFrame is implemented by the types WriteFrameTo can write.
+type binaryFrame interface {
+	MarshalBinary() ([]byte, error)
+	appendBinary(b []byte) []byte
+	binarySize() int
+	binaryKind() byte
+}
+
+func (Respiration) binarySize() int { return respirationBinarySize }
+
+func (Respiration) binaryKind() byte      { return binaryRespiration }
+func (BaseBandIQ) binaryKind() byte       { return binaryBaseBandIQ }
+func (BaseBandAmpPhase) binaryKind() byte { return binaryBaseBandAmpPhase }
+
+// WriteFrameTo writes v, a Respiration, BaseBandIQ or BaseBandAmpPhase, to w
+// as its binary encoding prefixed by its length, for streaming frames between
+// processes.
+func WriteFrameTo(w io.Writer, v interface{}) error {
+	m, ok := v.(binaryFrame)
+	if !ok {
+		return fmt.Errorf("%w: %T", errBinaryType, v)
+	}
+	frame := m.appendBinary(make([]byte, 4, 4+m.binarySize()))
+	binary.LittleEndian.PutUint32(frame, uint32(len(frame)-4))
+	_, err := w.Write(frame)
+	return err
+}
+
+// ReadFrameFrom reads a frame written by WriteFrameTo and returns it as a
+// Respiration, BaseBandIQ or BaseBandAmpPhase. It returns io.EOF if r is at
+// the end of the stream and io.ErrUnexpectedEOF if it ends within a frame.
+func ReadFrameFrom(r io.Reader) (interface{}, error) {
+	var length [4]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return nil, err
+	}
+	n := binary.LittleEndian.Uint32(length[:])
+	if n > maxBinaryFrame {
+		return nil, fmt.Errorf("%w: %d bytes", errBinaryTooLarge, n)
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return decodeBinaryFrame(b)
+}
+
+// decodeBinaryFrame decodes an encoding of any of the binaryFrame types.
+func decodeBinaryFrame(b []byte) (interface{}, error) {
+	if len(b) < 2 {
+		return nil, errBinaryTruncated
+	}
+	switch b[1] {
+	case binaryRespiration:
+		var v Respiration
+		err := v.UnmarshalBinary(b)
+		return v, err
+	case binaryBaseBandIQ:
+		var v BaseBandIQ
+		err := v.UnmarshalBinary(b)
+		return v, err
+	case binaryBaseBandAmpPhase:
+		var v BaseBandAmpPhase
+		err := v.UnmarshalBinary(b)
+		return v, err
+	}
+	return nil, fmt.Errorf("%w: %#02x", errBinaryKind, b[1])
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	return appendUint32(appendUint32(b, uint32(v)), uint32(v>>32))
+}
+
+func appendFloat(b []byte, f float64) []byte {
+	return appendUint64(b, math.Float64bits(f))
+}
+
+func appendFloats(b []byte, fs []float64) []byte {
+	b = appendUint32(b, uint32(len(fs)))
+	for _, f := range fs {
+		b = appendFloat(b, f)
+	}
+	return b
+}
+
+// binaryDecoder reads fields in order, after the first error every read
+// returns zero and done returns the error.
+type binaryDecoder struct {
+	b   []byte
+	err error
+}
+
+func newBinaryDecoder(b []byte, kind byte) (*binaryDecoder, error) {
+	if len(b) < 2 {
+		return nil, errBinaryTruncated
+	}
+	if b[0] != binaryVersion {
+		return nil, fmt.Errorf("%w: %d", ErrBinaryVersion, b[0])
+	}
+	if b[1] != kind {
+		return nil, fmt.Errorf("%w: %#02x", errBinaryKind, b[1])
+	}
+	return &binaryDecoder{b: b[2:]}, nil
+}
+
+func (d *binaryDecoder) next(n int) []byte {
+	if d.err != nil || len(d.b) < n {
+		d.err = errBinaryTruncated
+		return nil
+	}
+	p := d.b[:n]
+	d.b = d.b[n:]
+	return p
+}
+
+func (d *binaryDecoder) byte() byte {
+	if p := d.next(1); p != nil {
+		return p[0]
+	}
+	return 0
+}
+
+func (d *binaryDecoder) uint32() uint32 {
+	if p := d.next(4); p != nil {
+		return binary.LittleEndian.Uint32(p)
+	}
+	return 0
+}
+
+func (d *binaryDecoder) uint64() uint64 {
+	if p := d.next(8); p != nil {
+		return binary.LittleEndian.Uint64(p)
+	}
+	return 0
+}
+
+func (d *binaryDecoder) float() float64 {
+	return math.Float64frombits(d.uint64())
+}
+
+func (d *binaryDecoder) floats() []float64 {
+	n := d.uint32()
+	if n == 0 || uint64(n)*8 > uint64(len(d.b)) {
+		if n != 0 {
+			d.err = errBinaryTruncated
+		}
+		return nil
+	}
+	fs := make([]float64, n)
+	for i := range fs {
+		fs[i] = d.float()
+	}
+	return fs
+}
+
+func (d *binaryDecoder) header() BaseBandHeader {
+	return BaseBandHeader{
+		Time:         int64(d.uint64()),
+		Status:       status(d.uint32()),
+		Counter:      d.uint32(),
+		Bins:         d.uint32(),
+		BinLength:    d.float(),
+		SamplingFreq: d.float(),
+		CarrierFreq:  d.float(),
+		RangeOffset:  d.float(),
+	}
+}
+
+// done returns the first error, or an error if there are bytes left over.
+func (d *binaryDecoder) done() error {
+	if d.err == nil && len(d.b) != 0 {
+		d.err = fmt.Errorf("%w: %d bytes left", errBinaryLength, len(d.b))
+	}
+	return d.err
+}
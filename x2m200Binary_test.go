@@ -0,0 +1,132 @@
+package xethru
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func binaryTestFrames() []interface{} {
+	header := BaseBandHeader{
+		Time:         1480000000000000000,
+		Status:       basebandIQ,
+		Counter:      42,
+		Bins:         1024,
+		BinLength:    0.0514,
+		SamplingFreq: 39e9,
+		CarrierFreq:  7.29e9,
+		RangeOffset:  0.2075,
+	}
+	i, q := make([]float64, 1024), make([]float64, 1024)
+	for n := range i {
+		i[n], q[n] = math.Sin(float64(n)), math.Cos(float64(n))
+	}
+	empty := header
+	empty.Bins = 0
+	ap := header
+	ap.Status = basebandAP
+	return []interface{}{
+		Respiration{Time: 1480000000000000000, Status: respApp, Counter: 1, State: movement, RPM: 14, Distance: 0.7123456789, SignalQuality: 9, Movement: -2.5e-7, Valid: true},
+		Respiration{},
+		BaseBandIQ{BaseBandHeader: header, SigI: i, SigQ: q},
+		BaseBandIQ{BaseBandHeader: empty},
+		BaseBandAmpPhase{BaseBandHeader: ap, Amplitude: i, Phase: q},
+		BaseBandAmpPhase{BaseBandHeader: empty, Amplitude: []float64{math.Inf(1)}, Phase: []float64{math.MaxFloat64}},
+	}
+}
+
+func TestBinaryFrameRoundTrip(t *testing.T) {
+	frames := binaryTestFrames()
+	var b bytes.Buffer
+	for n, f := range frames {
+		if err := WriteFrameTo(&b, f); err != nil {
+			t.Fatalf("test %d %v\n", n, err)
+		}
+	}
+	for n, f := range frames {
+		got, err := ReadFrameFrom(&b)
+		if err != nil {
+			t.Fatalf("test %d %v\n", n, err)
+		}
+		if !reflect.DeepEqual(got, f) {
+			t.Errorf("test %d Expected: %T %+v, got %T %+v\n", n, f, f, got, got)
+		}
+	}
+	if _, err := ReadFrameFrom(&b); err != io.EOF {
+		t.Errorf("Expected: %v, got %v\n", io.EOF, err)
+	}
+}
+
+func TestBinaryFrameErrors(t *testing.T) {
+	resp, _ := Respiration{RPM: 14}.MarshalBinary()
+	withLength := func(b []byte) []byte {
+		return append(appendUint32(nil, uint32(len(b))), b...)
+	}
+	cases := []struct {
+		in  []byte
+		err error
+	}{
+		{withLength(resp)[:10], io.ErrUnexpectedEOF},
+		{withLength(resp[:20]), errBinaryTruncated},
+		{withLength(append(resp, 0x00)), errBinaryLength},
+		{withLength(append([]byte{0x02}, resp[1:]...)), ErrBinaryVersion},
+		{withLength(append([]byte{binaryVersion, 0x09}, resp[2:]...)), errBinaryKind},
+		{appendUint32(nil, maxBinaryFrame+1), errBinaryTooLarge},
+		{withLength(append(append([]byte{binaryVersion, binaryBaseBandIQ}, make([]byte, 52)...), 0xff, 0xff, 0xff, 0xff)), errBinaryTruncated},
+	}
+	for n, c := range cases {
+		if _, err := ReadFrameFrom(bytes.NewReader(c.in)); !errors.Is(err, c.err) {
+			t.Errorf("test %d Expected: %v, got %v\n", n, c.err, err)
+		}
+	}
+	if err := WriteFrameTo(io.Discard, Sleep{}); !errors.Is(err, errBinaryType) {
+		t.Errorf("Expected: %v, got %v\n", errBinaryType, err)
+	}
+}
+
+func TestBinaryRespirationWithoutFlags(t *testing.T) {
+	// encodings written before Valid was added have no flags byte
+	b, _ := Respiration{RPM: 14}.MarshalBinary()
+	var r Respiration
+	if err := r.UnmarshalBinary(b[:len(b)-1]); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(r, Respiration{RPM: 14, Valid: true}) {
+		t.Errorf("Expected: %+v, got %+v\n", Respiration{RPM: 14, Valid: true}, r)
+	}
+}
+
+func BenchmarkBinaryBaseBandIQ(b *testing.B) {
+	f := binaryTestFrames()[2]
+	var buf bytes.Buffer
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		buf.Reset()
+		if err := WriteFrameTo(&buf, f); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := ReadFrameFrom(&buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkJSONBaseBandIQ(b *testing.B) {
+	f := binaryTestFrames()[2].(BaseBandIQ)
+	var buf bytes.Buffer
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		buf.Reset()
+		if err := json.NewEncoder(&buf).Encode(f); err != nil {
+			b.Fatal(err)
+		}
+		var got BaseBandIQ
+		if err := json.NewDecoder(&buf).Decode(&got); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
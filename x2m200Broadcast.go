@@ -0,0 +1,128 @@
+package xethru
+
+import "sync"
+
+// DeliveryPolicy says what happens when a subscriber's buffer, or the
+// module's StreamBuffer, is full.
+type DeliveryPolicy int
+
+// Delivery policies
+const (
+	// DropOldest discards the oldest buffered frame to make room, the
+	// subscriber sees the most recent frames.
+	DropOldest DeliveryPolicy = iota
+	// Block waits for the subscriber, holding up Run and every other
+	// subscriber.
+	Block
+	// DropNewest discards the new frame, the subscriber sees the frames
+	// from before it fell behind.
+	DropNewest
+)
+
+type respirationSubscriber struct {
+	c      chan Respiration
+	policy DeliveryPolicy
+	gone   chan struct{} // closed on unsubscribe to release a blocked send
+	once   sync.Once
+}
+
+// respirationBroadcast fans respiration frames out to subscribers.
+type respirationBroadcast struct {
+	mu     sync.RWMutex // held for reading while publishing
+	subs   []*respirationSubscriber
+	closed bool
+}
+
+// Subscribe returns a channel, buffering up to buffer frames, that receives
+// every Respiration frame Run reads, and a function that unsubscribes and
+// closes the channel. policy says what happens when the buffer is full. The
+// channel is also closed when Run returns. Subscribers may be added before or
+// while Run is running, after it returns they get a closed channel until Run
+// is started again.
+func (r *Module) Subscribe(buffer int, policy DeliveryPolicy) (<-chan Respiration, func()) {
+	return r.broadcast.subscribe(buffer, policy)
+}
+
+func (b *respirationBroadcast) subscribe(buffer int, policy DeliveryPolicy) (<-chan Respiration, func()) {
+	s := &respirationSubscriber{
+		c:      make(chan Respiration, buffer),
+		policy: policy,
+		gone:   make(chan struct{}),
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(s.c)
+		return s.c, func() {}
+	}
+	b.subs = append(b.subs, s)
+	return s.c, func() { b.unsubscribe(s) }
+}
+
+func (b *respirationBroadcast) unsubscribe(s *respirationSubscriber) {
+	s.once.Do(func() {
+		close(s.gone)
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		for i, sub := range b.subs {
+			if sub == s {
+				b.subs = append(b.subs[:i], b.subs[i+1:]...)
+				close(s.c)
+				break
+			}
+		}
+	})
+}
+
+// publish sends resp to every subscriber in turn.
+func (b *respirationBroadcast) publish(resp Respiration) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, s := range b.subs {
+		if s.policy == Block {
+			select {
+			case s.c <- resp:
+			case <-s.gone:
+			}
+			continue
+		}
+		if cap(s.c) == 0 || s.policy == DropNewest {
+			select {
+			case s.c <- resp:
+			default:
+			}
+			continue
+		}
+		for sent := false; !sent; {
+			select {
+			case s.c <- resp:
+				sent = true
+			default:
+				// full, drop the oldest unless the subscriber just took it
+				select {
+				case <-s.c:
+				default:
+				}
+			}
+		}
+	}
+}
+
+// close closes every subscriber's channel, later subscribers get a closed
+// channel.
+func (b *respirationBroadcast) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, s := range b.subs {
+		close(s.c)
+	}
+	b.subs = nil
+	b.closed = true
+}
+
+// reopen accepts subscribers again after close.
+func (b *respirationBroadcast) reopen() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = false
+}
@@ -0,0 +1,86 @@
+package xethru
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSubscribe(t *testing.T) {
+	sensor := NewSimulatedSensor()
+	sensor.Interval = time.Millisecond
+	m := NewModule(sensor, "respiration")
+
+	fast, _ := m.Subscribe(0, Block)
+	slow, unsubscribe := m.Subscribe(2, DropOldest)
+	late, _ := m.Subscribe(1, DropOldest)
+
+	finished := make(chan struct{})
+	go func() {
+		m.Run(nil)
+		close(finished)
+	}()
+
+	// the blocking subscriber sees every frame
+	counters := make(chan []uint32)
+	go func() {
+		var c []uint32
+		for r := range fast {
+			c = append(c, r.Counter)
+		}
+		counters <- c
+	}()
+
+	// the slow subscriber falls behind and sees gaps, but in order
+	var last uint32
+	for n := 0; n < 5; n++ {
+		time.Sleep(5 * time.Millisecond)
+		r, ok := <-slow
+		if !ok {
+			t.Fatalf("test %d Expected: open channel, got closed\n", n)
+		}
+		if r.Counter <= last {
+			t.Errorf("test %d Expected: counter after %d, got %d\n", n, last, r.Counter)
+		}
+		last = r.Counter
+	}
+	unsubscribe()
+	unsubscribe()
+	for range slow {
+	}
+
+	sensor.Close()
+	<-finished
+	for range late {
+	}
+
+	c := <-counters
+	if len(c) < 20 {
+		t.Errorf("Expected: at least 20 frames, got %d\n", len(c))
+	}
+	for n := 1; n < len(c); n++ {
+		if c[n] != c[n-1]+1 {
+			t.Errorf("test %d Expected: %d, got %d\n", n, c[n-1]+1, c[n])
+		}
+	}
+
+	after, _ := m.Subscribe(1, Block)
+	if _, ok := <-after; ok {
+		t.Errorf("Expected: closed channel after Run returns, got open\n")
+	}
+}
+
+func TestSubscribeDropNewest(t *testing.T) {
+	var b respirationBroadcast
+	c, _ := b.subscribe(2, DropNewest)
+	for i := uint32(1); i <= 5; i++ {
+		b.publish(Respiration{Counter: i})
+	}
+	b.close()
+	var got []uint32
+	for r := range c {
+		got = append(got, r.Counter)
+	}
+	if len(got) != 2 || got[0] != 1 || got[1] != 2 {
+		t.Errorf("Expected: [1 2], got %v\n", got)
+	}
+}
@@ -0,0 +1,108 @@
+package xethru
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"strconv"
+)
+
+// RespirationCSVWriter writes Respiration frames as csv rows.
+type RespirationCSVWriter struct {
+	w *csv.Writer
+}
+
+// NewRespirationCSVWriter creates a RespirationCSVWriter writing to w.
+func NewRespirationCSVWriter(w io.Writer) *RespirationCSVWriter {
+	return &RespirationCSVWriter{w: csv.NewWriter(w)}
+}
+
+// WriteHeader writes the column names.
+func (c *RespirationCSVWriter) WriteHeader() error {
+	return c.w.Write([]string{"time", "status", "counter", "state", "rpm", "distance", "signalquality", "movement"})
+}
+
+// Write writes r as a single row.
+func (c *RespirationCSVWriter) Write(r Respiration) error {
+	return c.w.Write([]string{
+		strconv.FormatInt(r.Time, 10),
+		r.Status.String(),
+		strconv.FormatUint(uint64(r.Counter), 10),
+		r.State.String(),
+		strconv.FormatUint(uint64(r.RPM), 10),
+		formatFloat(r.Distance),
+		formatFloat(r.SignalQuality),
+		formatFloat(r.Movement),
+	})
+}
+
+// Flush writes any buffered rows to the underlying writer.
+func (c *RespirationCSVWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// BaseBandAmpPhaseCSVWriter writes BaseBandAmpPhase frames as csv rows with
+// one amp_i and phase_i column per bin. The header is written with the first
+// frame, which also fixes the number of bins.
+type BaseBandAmpPhaseCSVWriter struct {
+	w    *csv.Writer
+	bins int
+}
+
+// NewBaseBandAmpPhaseCSVWriter creates a BaseBandAmpPhaseCSVWriter writing to w.
+func NewBaseBandAmpPhaseCSVWriter(w io.Writer) *BaseBandAmpPhaseCSVWriter {
+	return &BaseBandAmpPhaseCSVWriter{w: csv.NewWriter(w), bins: -1}
+}
+
+// Write writes ap as a single row, writing the header first if needed.
+func (c *BaseBandAmpPhaseCSVWriter) Write(ap BaseBandAmpPhase) error {
+	if len(ap.Amplitude) != len(ap.Phase) {
+		return errCSVBinsMismatch
+	}
+	if c.bins < 0 {
+		c.bins = len(ap.Amplitude)
+		header := []string{"time", "status", "counter", "bins", "binlength", "samplingfreq", "carrier", "offset"}
+		for i := 0; i < c.bins; i++ {
+			header = append(header, "amp_"+strconv.Itoa(i))
+		}
+		for i := 0; i < c.bins; i++ {
+			header = append(header, "phase_"+strconv.Itoa(i))
+		}
+		if err := c.w.Write(header); err != nil {
+			return err
+		}
+	}
+	if len(ap.Amplitude) != c.bins {
+		return errCSVBinsMismatch
+	}
+	row := []string{
+		strconv.FormatInt(ap.Time, 10),
+		ap.Status.String(),
+		strconv.FormatUint(uint64(ap.Counter), 10),
+		strconv.FormatUint(uint64(ap.Bins), 10),
+		formatFloat(ap.BinLength),
+		formatFloat(ap.SamplingFreq),
+		formatFloat(ap.CarrierFreq),
+		formatFloat(ap.RangeOffset),
+	}
+	for _, v := range ap.Amplitude {
+		row = append(row, formatFloat(v))
+	}
+	for _, v := range ap.Phase {
+		row = append(row, formatFloat(v))
+	}
+	return c.w.Write(row)
+}
+
+// Flush writes any buffered rows to the underlying writer.
+func (c *BaseBandAmpPhaseCSVWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+var errCSVBinsMismatch = errors.New("frame has a different number of bins to the csv columns")
@@ -0,0 +1,81 @@
+package xethru
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+func compareGolden(t *testing.T, name string, got []byte) {
+	golden := "testdata/" + name
+	if *update {
+		if err := os.WriteFile(golden, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, expected) {
+		t.Errorf("%s Expected:\n%s\ngot:\n%s\n", golden, expected, got)
+	}
+}
+
+func TestRespirationCSVWriter(t *testing.T) {
+	var b bytes.Buffer
+	w := NewRespirationCSVWriter(&b)
+	if err := w.WriteHeader(); err != nil {
+		t.Fatal(err)
+	}
+	frames := []Respiration{
+		{Time: 1480000000000000000, Status: respApp, Counter: 1, State: breathing, RPM: 14, Distance: 0.7123456789, SignalQuality: 9, Movement: 0.1},
+		{Time: 1480000000050000000, Status: respApp, Counter: 2, State: noMovement, RPM: 0, Distance: 1.0 / 3.0, SignalQuality: 0, Movement: -2.5e-7},
+	}
+	for _, f := range frames {
+		if err := w.Write(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	compareGolden(t, "respiration.csv", b.Bytes())
+}
+
+func TestBaseBandAmpPhaseCSVWriter(t *testing.T) {
+	var b bytes.Buffer
+	w := NewBaseBandAmpPhaseCSVWriter(&b)
+	frame := BaseBandAmpPhase{
+		BaseBandHeader: BaseBandHeader{
+			Time:        1480000000000000000,
+			Status:      basebandAP,
+			Counter:     3,
+			Bins:        3,
+			BinLength:   0.05142857,
+			CarrierFreq: 7.29e9,
+			RangeOffset: 0.2,
+		},
+		Amplitude: []float64{0.001, 0.5, 1.0 / 7.0},
+		Phase:     []float64{-3.14159, 0, 1.5},
+	}
+	if err := w.Write(frame); err != nil {
+		t.Fatal(err)
+	}
+	frame.Counter++
+	if err := w.Write(frame); err != nil {
+		t.Fatal(err)
+	}
+	frame.Amplitude = frame.Amplitude[:2]
+	frame.Phase = frame.Phase[:2]
+	if err := w.Write(frame); err != errCSVBinsMismatch {
+		t.Errorf("Expected: %v, got %v\n", errCSVBinsMismatch, err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	compareGolden(t, "ampphase.csv", b.Bytes())
+}
@@ -0,0 +1,469 @@
+package xethru
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sort"
+	"time"
+)
+
+// Capture file format
+// magic "XCAP" + version byte + flags byte, followed by chunks of
+// header + [data], then an index footer, all little endian.
+//
+// chunk header: stored length(uint32) + raw length(uint32) + count(uint32) +
+// first(int64 unix nano) + last(int64 unix nano) + crc32 of data(uint32).
+// data is the chunk's records, gzip compressed if the file flags say so, each
+// record is timestamp(int64 unix nano) + length(uint32) + binary encoding.
+//
+// index: offset(uint64) + first(int64) + last(int64) per chunk, then the
+// trailer: index offset(uint64) + chunks(uint32) + magic "XIDX".
+const (
+	captureMagic       = "XCAP"
+	captureVersion     = 0x01
+	captureFileHeader  = 6
+	captureChunkHeader = 32
+	captureRecord      = 12
+	captureIndexEntry  = 24
+	captureTrailer     = 16
+	captureIndexMagic  = "XIDX"
+
+	captureGzip = 0x01 // file flag set if chunk data is gzip compressed
+
+	defaultCaptureChunk = 1 << 20
+	maxCaptureChunk     = 1 << 30
+)
+
+// Capture errors
+var (
+	errCaptureBadMagic   = errors.New("not a xethru capture")
+	errCaptureBadVersion = errors.New("unsupported xethru capture version")
+	errCaptureCorrupt    = errors.New("xethru capture chunk is corrupt")
+	errCaptureClosed     = errors.New("xethru capture writer is closed")
+)
+
+// CaptureOption configures a CaptureWriter.
+type CaptureOption func(*captureConfig)
+
+type captureConfig struct {
+	chunkSize int
+	gzip      bool
+	level     int
+}
+
+// WithCaptureGzip gzip compresses each chunk at level, one of the
+// compress/gzip levels.
+func WithCaptureGzip(level int) CaptureOption {
+	return func(c *captureConfig) {
+		c.gzip = true
+		c.level = level
+	}
+}
+
+// WithCaptureChunkSize sets the number of bytes of records buffered before a
+// chunk is written, 1MiB by default. Smaller chunks make seeking finer and
+// lose less on a crash, larger chunks compress better.
+func WithCaptureChunkSize(n int) CaptureOption {
+	return func(c *captureConfig) {
+		if n > 0 && n <= maxCaptureChunk {
+			c.chunkSize = n
+		}
+	}
+}
+
+type captureChunk struct {
+	offset      uint64
+	first, last int64
+}
+
+// CaptureWriter writes Respiration, BaseBandIQ and BaseBandAmpPhase frames to
+// a capture file for long recordings. Frames are encoded straight into a
+// reused chunk buffer, each chunk is written, optionally compressed, once it
+// is full and Close writes an index so a CaptureReader can seek by time. If
+// the writer never closes, the chunks written so far can still be read.
+type CaptureWriter struct {
+	w      io.Writer
+	cfg    captureConfig
+	offset uint64
+	buf    []byte
+	count  uint32
+	first  int64
+	last   int64
+	zbuf   bytes.Buffer
+	gz     *gzip.Writer
+	index  []captureChunk
+	err    error
+	closed bool
+}
+
+// NewCaptureWriter writes the capture file header to w and returns a
+// CaptureWriter. w is not closed by Close.
+func NewCaptureWriter(w io.Writer, opts ...CaptureOption) (*CaptureWriter, error) {
+	cfg := captureConfig{chunkSize: defaultCaptureChunk}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	c := &CaptureWriter{w: w, cfg: cfg}
+	var flags byte
+	if cfg.gzip {
+		gz, err := gzip.NewWriterLevel(&c.zbuf, cfg.level)
+		if err != nil {
+			return nil, err
+		}
+		c.gz = gz
+		flags |= captureGzip
+	}
+	if err := c.write(append([]byte(captureMagic), captureVersion, flags)); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// WriteFrame adds v, received at t, to the current chunk, writing the chunk
+// if it is full.
+func (c *CaptureWriter) WriteFrame(t time.Time, v interface{}) error {
+	if c.closed {
+		return errCaptureClosed
+	}
+	if c.err != nil {
+		return c.err
+	}
+	m, ok := v.(binaryFrame)
+	if !ok {
+		return fmt.Errorf("%w: %T", errBinaryType, v)
+	}
+	if c.buf == nil {
+		c.buf = make([]byte, 0, c.cfg.chunkSize+captureRecord+m.binarySize())
+	}
+	ts := t.UnixNano()
+	if c.count == 0 {
+		c.first = ts
+	}
+	c.last = ts
+
+	start := len(c.buf)
+	c.buf = appendUint64(c.buf, uint64(ts))
+	c.buf = appendUint32(c.buf, 0)
+	c.buf = m.appendBinary(c.buf)
+	binary.LittleEndian.PutUint32(c.buf[start+8:], uint32(len(c.buf)-start-captureRecord))
+	c.count++
+
+	if len(c.buf) >= c.cfg.chunkSize {
+		return c.Flush()
+	}
+	return nil
+}
+
+// Flush writes the current chunk, if it has any frames.
+func (c *CaptureWriter) Flush() error {
+	if c.err != nil || c.count == 0 {
+		return c.err
+	}
+	data := c.buf
+	if c.gz != nil {
+		c.zbuf.Reset()
+		c.gz.Reset(&c.zbuf)
+		if _, err := c.gz.Write(c.buf); err != nil {
+			c.err = err
+			return err
+		}
+		if err := c.gz.Close(); err != nil {
+			c.err = err
+			return err
+		}
+		data = c.zbuf.Bytes()
+	}
+
+	var header [captureChunkHeader]byte
+	binary.LittleEndian.PutUint32(header[0:4], uint32(len(data)))
+	binary.LittleEndian.PutUint32(header[4:8], uint32(len(c.buf)))
+	binary.LittleEndian.PutUint32(header[8:12], c.count)
+	binary.LittleEndian.PutUint64(header[12:20], uint64(c.first))
+	binary.LittleEndian.PutUint64(header[20:28], uint64(c.last))
+	binary.LittleEndian.PutUint32(header[28:32], crc32.ChecksumIEEE(data))
+
+	chunk := captureChunk{offset: c.offset, first: c.first, last: c.last}
+	if err := c.write(header[:]); err != nil {
+		return err
+	}
+	if err := c.write(data); err != nil {
+		return err
+	}
+	c.index = append(c.index, chunk)
+	c.buf = c.buf[:0]
+	c.count = 0
+	return nil
+}
+
+// Close writes the last chunk and the index footer.
+func (c *CaptureWriter) Close() error {
+	if c.closed {
+		return errCaptureClosed
+	}
+	if err := c.Flush(); err != nil {
+		return err
+	}
+	c.closed = true
+
+	b := make([]byte, 0, captureIndexEntry*len(c.index)+captureTrailer)
+	for _, chunk := range c.index {
+		b = appendUint64(b, chunk.offset)
+		b = appendUint64(b, uint64(chunk.first))
+		b = appendUint64(b, uint64(chunk.last))
+	}
+	b = appendUint64(b, c.offset)
+	b = appendUint32(b, uint32(len(c.index)))
+	return c.write(append(b, captureIndexMagic...))
+}
+
+func (c *CaptureWriter) write(b []byte) error {
+	n, err := c.w.Write(b)
+	c.offset += uint64(n)
+	if err != nil {
+		c.err = err
+	}
+	return err
+}
+
+// CaptureReader reads a capture file written by a CaptureWriter.
+type CaptureReader struct {
+	r         io.ReadSeeker
+	gzip      bool
+	index     []captureChunk
+	truncated bool
+
+	next  int    // index of the next chunk to load
+	raw   []byte // chunk as stored
+	out   []byte // decompressed chunk
+	data  []byte // rest of the loaded chunk
+	zr    *gzip.Reader
+	bytes bytes.Reader
+}
+
+// NewCaptureReader checks the capture header of r and loads its index. If
+// the file has no index, because the writer was never closed, the chunks
+// are scanned instead and reading stops at the first truncated or corrupt
+// chunk, see Truncated.
+func NewCaptureReader(r io.ReadSeeker) (*CaptureReader, error) {
+	header := make([]byte, captureFileHeader)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if string(header[:len(captureMagic)]) != captureMagic {
+		return nil, errCaptureBadMagic
+	}
+	if header[len(captureMagic)] != captureVersion {
+		return nil, errCaptureBadVersion
+	}
+	c := &CaptureReader{r: r, gzip: header[5]&captureGzip != 0}
+
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if !c.readIndex(size) {
+		if err := c.scan(size); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := r.Seek(captureFileHeader, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// readIndex loads the index footer, it returns false if there isn't a valid
+// one.
+func (c *CaptureReader) readIndex(size int64) bool {
+	if size < captureFileHeader+captureTrailer {
+		return false
+	}
+	trailer := make([]byte, captureTrailer)
+	if _, err := c.r.Seek(size-captureTrailer, io.SeekStart); err != nil {
+		return false
+	}
+	if _, err := io.ReadFull(c.r, trailer); err != nil {
+		return false
+	}
+	if string(trailer[12:]) != captureIndexMagic {
+		return false
+	}
+	offset := binary.LittleEndian.Uint64(trailer[0:8])
+	n := uint64(binary.LittleEndian.Uint32(trailer[8:12]))
+	if offset < captureFileHeader || offset+n*captureIndexEntry+captureTrailer != uint64(size) {
+		return false
+	}
+	b := make([]byte, n*captureIndexEntry)
+	if _, err := c.r.Seek(int64(offset), io.SeekStart); err != nil {
+		return false
+	}
+	if _, err := io.ReadFull(c.r, b); err != nil {
+		return false
+	}
+	index := make([]captureChunk, n)
+	for i := range index {
+		e := b[i*captureIndexEntry:]
+		index[i] = captureChunk{
+			offset: binary.LittleEndian.Uint64(e[0:8]),
+			first:  int64(binary.LittleEndian.Uint64(e[8:16])),
+			last:   int64(binary.LittleEndian.Uint64(e[16:24])),
+		}
+	}
+	c.index = index
+	return true
+}
+
+// scan rebuilds the index by walking the chunks from the start of the file,
+// stopping at the first one that is cut short or fails its checksum.
+func (c *CaptureReader) scan(size int64) error {
+	offset := int64(captureFileHeader)
+	if _, err := c.r.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	header := make([]byte, captureChunkHeader)
+	for offset < size {
+		if _, err := io.ReadFull(c.r, header); err != nil {
+			c.truncated = true
+			return nil
+		}
+		stored := int64(binary.LittleEndian.Uint32(header[0:4]))
+		if offset+captureChunkHeader+stored > size || stored > maxCaptureChunk {
+			c.truncated = true
+			return nil
+		}
+		c.raw = grow(c.raw, int(stored))
+		if _, err := io.ReadFull(c.r, c.raw); err != nil {
+			return err
+		}
+		if crc32.ChecksumIEEE(c.raw) != binary.LittleEndian.Uint32(header[28:32]) {
+			c.truncated = true
+			return nil
+		}
+		c.index = append(c.index, captureChunk{
+			offset: uint64(offset),
+			first:  int64(binary.LittleEndian.Uint64(header[12:20])),
+			last:   int64(binary.LittleEndian.Uint64(header[20:28])),
+		})
+		offset += captureChunkHeader + stored
+	}
+	return nil
+}
+
+// Truncated reports whether the file had no index and ended with a partly
+// written or corrupt chunk, which is skipped.
+func (c *CaptureReader) Truncated() bool {
+	return c.truncated
+}
+
+// Chunks returns the number of readable chunks in the file.
+func (c *CaptureReader) Chunks() int {
+	return len(c.index)
+}
+
+// Next returns the next frame and the time it was received, as a
+// Respiration, BaseBandIQ or BaseBandAmpPhase. It returns io.EOF at the end
+// of the capture.
+func (c *CaptureReader) Next() (time.Time, interface{}, error) {
+	for len(c.data) == 0 {
+		if c.next >= len(c.index) {
+			return time.Time{}, nil, io.EOF
+		}
+		if err := c.load(c.next); err != nil {
+			return time.Time{}, nil, err
+		}
+		c.next++
+	}
+	if len(c.data) < captureRecord {
+		return time.Time{}, nil, errCaptureCorrupt
+	}
+	ts := int64(binary.LittleEndian.Uint64(c.data[0:8]))
+	n := uint64(binary.LittleEndian.Uint32(c.data[8:12]))
+	if n > uint64(len(c.data)-captureRecord) {
+		return time.Time{}, nil, errCaptureCorrupt
+	}
+	v, err := decodeBinaryFrame(c.data[captureRecord : captureRecord+n])
+	c.data = c.data[captureRecord+n:]
+	return time.Unix(0, ts), v, err
+}
+
+// SeekTime positions the reader so the next frame returned by Next is the
+// first one received at or after t. Only the chunk holding that frame is
+// read and decompressed.
+func (c *CaptureReader) SeekTime(t time.Time) error {
+	ts := t.UnixNano()
+	i := sort.Search(len(c.index), func(i int) bool { return c.index[i].last >= ts })
+	c.next = i
+	c.data = nil
+	if i == len(c.index) {
+		return nil
+	}
+	if err := c.load(i); err != nil {
+		return err
+	}
+	c.next++
+	for len(c.data) >= captureRecord && int64(binary.LittleEndian.Uint64(c.data[0:8])) < ts {
+		n := uint64(binary.LittleEndian.Uint32(c.data[8:12]))
+		if n > uint64(len(c.data)-captureRecord) {
+			return errCaptureCorrupt
+		}
+		c.data = c.data[captureRecord+n:]
+	}
+	return nil
+}
+
+// load reads chunk i into c.data, reusing the reader's buffers.
+func (c *CaptureReader) load(i int) error {
+	if _, err := c.r.Seek(int64(c.index[i].offset), io.SeekStart); err != nil {
+		return err
+	}
+	var header [captureChunkHeader]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		return fmt.Errorf("%w: %v", errCaptureCorrupt, err)
+	}
+	stored := binary.LittleEndian.Uint32(header[0:4])
+	rawLen := binary.LittleEndian.Uint32(header[4:8])
+	if stored > maxCaptureChunk || rawLen > maxCaptureChunk {
+		return errCaptureCorrupt
+	}
+	c.raw = grow(c.raw, int(stored))
+	if _, err := io.ReadFull(c.r, c.raw); err != nil {
+		return fmt.Errorf("%w: %v", errCaptureCorrupt, err)
+	}
+	if crc32.ChecksumIEEE(c.raw) != binary.LittleEndian.Uint32(header[28:32]) {
+		return errCaptureCorrupt
+	}
+	if !c.gzip {
+		c.data = c.raw
+		return nil
+	}
+
+	c.bytes.Reset(c.raw)
+	if c.zr == nil {
+		zr, err := gzip.NewReader(&c.bytes)
+		if err != nil {
+			return fmt.Errorf("%w: %v", errCaptureCorrupt, err)
+		}
+		c.zr = zr
+	} else if err := c.zr.Reset(&c.bytes); err != nil {
+		return fmt.Errorf("%w: %v", errCaptureCorrupt, err)
+	}
+	c.out = grow(c.out, int(rawLen))
+	if _, err := io.ReadFull(c.zr, c.out); err != nil {
+		return fmt.Errorf("%w: %v", errCaptureCorrupt, err)
+	}
+	c.data = c.out
+	return nil
+}
+
+// grow returns b resized to n bytes, reallocating only if it is too small.
+func grow(b []byte, n int) []byte {
+	if cap(b) < n {
+		return make([]byte, n)
+	}
+	return b[:n]
+}
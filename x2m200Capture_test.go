@@ -0,0 +1,334 @@
+package xethru
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var captureStart = time.Unix(1480000000, 0)
+
+func captureTestFrame(n int) interface{} {
+	if n%10 == 9 {
+		return Respiration{Time: int64(n), Status: respApp, Counter: uint32(n), RPM: 14, Valid: true}
+	}
+	i, q := make([]float64, 64), make([]float64, 64)
+	for b := range i {
+		i[b], q[b] = math.Sin(float64(n+b)), math.Cos(float64(n+b))
+	}
+	return BaseBandIQ{
+		BaseBandHeader: BaseBandHeader{Time: int64(n), Status: basebandIQ, Counter: uint32(n), Bins: 64},
+		SigI:           i,
+		SigQ:           q,
+	}
+}
+
+// writeCapture writes n frames 50ms apart in chunks of about 4KiB.
+func writeCapture(t *testing.T, n int, opts ...CaptureOption) []byte {
+	t.Helper()
+	var file bytes.Buffer
+	w, err := NewCaptureWriter(&file, append([]CaptureOption{WithCaptureChunkSize(4096)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		if err := w.WriteFrame(captureStart.Add(time.Duration(i)*50*time.Millisecond), captureTestFrame(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return file.Bytes()
+}
+
+// readCapture returns the counters of the frames left in r.
+func readCapture(t *testing.T, r *CaptureReader) []int {
+	t.Helper()
+	var got []int
+	for {
+		ts, v, err := r.Next()
+		if err == io.EOF {
+			return got
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		var n int
+		switch f := v.(type) {
+		case BaseBandIQ:
+			n = int(f.Counter)
+		case Respiration:
+			n = int(f.Counter)
+		}
+		if !reflect.DeepEqual(v, captureTestFrame(n)) {
+			t.Errorf("frame %d Expected: %+v, got %+v\n", n, captureTestFrame(n), v)
+		}
+		if want := captureStart.Add(time.Duration(n) * 50 * time.Millisecond); !ts.Equal(want) {
+			t.Errorf("frame %d Expected: %v, got %v\n", n, want, ts)
+		}
+		got = append(got, n)
+	}
+}
+
+func TestCaptureRoundTrip(t *testing.T) {
+	tests := []struct {
+		opts []CaptureOption
+	}{
+		{nil},
+		{[]CaptureOption{WithCaptureGzip(gzip.BestSpeed)}},
+	}
+	for n, test := range tests {
+		file := writeCapture(t, 200, test.opts...)
+		r, err := NewCaptureReader(bytes.NewReader(file))
+		if err != nil {
+			t.Fatalf("test %d %v\n", n, err)
+		}
+		if r.Truncated() || r.Chunks() < 2 {
+			t.Errorf("test %d Expected: several chunks, not truncated, got %d %v\n", n, r.Chunks(), r.Truncated())
+		}
+		got := readCapture(t, r)
+		if len(got) != 200 {
+			t.Errorf("test %d Expected: 200 frames, got %d\n", n, len(got))
+		}
+		for i := range got {
+			if got[i] != i {
+				t.Fatalf("test %d Expected: frame %d, got %d\n", n, i, got[i])
+			}
+		}
+	}
+}
+
+func TestCaptureSeekTime(t *testing.T) {
+	for _, opts := range [][]CaptureOption{nil, {WithCaptureGzip(gzip.DefaultCompression)}} {
+		file := writeCapture(t, 500, opts...)
+		tests := []struct {
+			at    time.Duration
+			first int
+		}{
+			{0, 0},
+			{-time.Hour, 0},
+			{5 * time.Second, 100},
+			{5*time.Second + time.Millisecond, 101},
+			{24950 * time.Millisecond, 499},
+			{25 * time.Second, -1},
+			{12 * time.Second, 240},
+			{time.Second, 20},
+		}
+		r, err := NewCaptureReader(bytes.NewReader(file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for n, test := range tests {
+			if err := r.SeekTime(captureStart.Add(test.at)); err != nil {
+				t.Fatalf("test %d %v\n", n, err)
+			}
+			_, v, err := r.Next()
+			if test.first < 0 {
+				if err != io.EOF {
+					t.Errorf("test %d Expected: %v, got %v\n", n, io.EOF, err)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatalf("test %d %v\n", n, err)
+			}
+			if want := captureTestFrame(test.first); !reflect.DeepEqual(v, want) {
+				t.Errorf("test %d Expected: frame %d, got %+v\n", n, test.first, v)
+			}
+		}
+	}
+}
+
+// seekReader counts the bytes read through it.
+type seekReader struct {
+	io.ReadSeeker
+	read int
+}
+
+func (s *seekReader) Read(b []byte) (int, error) {
+	n, err := s.ReadSeeker.Read(b)
+	s.read += n
+	return n, err
+}
+
+func TestCaptureSeekReadsOneChunk(t *testing.T) {
+	file := writeCapture(t, 2000)
+	sr := &seekReader{ReadSeeker: bytes.NewReader(file)}
+	r, err := NewCaptureReader(sr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sr.read = 0
+	if err := r.SeekTime(captureStart.Add(80 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := r.Next(); err != nil {
+		t.Fatal(err)
+	}
+	if sr.read > 2*4096 {
+		t.Errorf("Expected: one chunk read of a %d byte file, got %d bytes\n", len(file), sr.read)
+	}
+}
+
+func TestCaptureTruncatedTail(t *testing.T) {
+	for _, opts := range [][]CaptureOption{nil, {WithCaptureGzip(gzip.BestSpeed)}} {
+		var file bytes.Buffer
+		w, err := NewCaptureWriter(&file, append([]CaptureOption{WithCaptureChunkSize(4096)}, opts...)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 100; i++ {
+			if err := w.WriteFrame(captureStart.Add(time.Duration(i)*50*time.Millisecond), captureTestFrame(i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// the writer never closes, so there is no index and the last chunk
+		// is only partly written
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		complete := file.Len()
+		for i := 100; i < 103; i++ {
+			if err := w.WriteFrame(captureStart.Add(time.Duration(i)*50*time.Millisecond), captureTestFrame(i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+
+		tests := []struct {
+			cut       int
+			truncated bool
+		}{
+			{file.Len(), false},
+			{file.Len() - 1, true},
+			{complete + captureChunkHeader + 10, true},
+			{complete + 5, true},
+			{complete, false},
+		}
+		for n, test := range tests {
+			b := append([]byte(nil), file.Bytes()[:test.cut]...)
+			r, err := NewCaptureReader(bytes.NewReader(b))
+			if err != nil {
+				t.Fatalf("test %d %v\n", n, err)
+			}
+			if r.Truncated() != test.truncated {
+				t.Errorf("test %d Expected: truncated %v, got %v\n", n, test.truncated, r.Truncated())
+			}
+			want := 100
+			if test.cut == file.Len() {
+				want = 103
+			}
+			got := readCapture(t, r)
+			if len(got) != want {
+				t.Errorf("test %d Expected: %d frames, got %d\n", n, want, len(got))
+			}
+			for i := range got {
+				if got[i] != i {
+					t.Fatalf("test %d Expected: frame %d, got %d\n", n, i, got[i])
+				}
+			}
+		}
+	}
+}
+
+func TestCaptureCorruptChunk(t *testing.T) {
+	file := writeCapture(t, 200)
+	r, err := NewCaptureReader(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// flip a byte in the second chunk's data
+	file[r.index[1].offset+captureChunkHeader+20] ^= 0xff
+	if err := r.SeekTime(time.Unix(0, r.index[1].first)); !errors.Is(err, errCaptureCorrupt) {
+		t.Errorf("Expected: %v, got %v\n", errCaptureCorrupt, err)
+	}
+
+	// without the index the scan stops before the corrupt chunk
+	r, err = NewCaptureReader(bytes.NewReader(file[:len(file)-1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Truncated() || r.Chunks() != 1 {
+		t.Errorf("Expected: 1 chunk, truncated, got %d %v\n", r.Chunks(), r.Truncated())
+	}
+}
+
+func TestCaptureErrors(t *testing.T) {
+	tests := []struct {
+		file []byte
+		err  error
+	}{
+		{[]byte("XCAX\x01\x00"), errCaptureBadMagic},
+		{[]byte("XCAP\x02\x00"), errCaptureBadVersion},
+		{[]byte("XCA"), io.ErrUnexpectedEOF},
+	}
+	for n, test := range tests {
+		if _, err := NewCaptureReader(bytes.NewReader(test.file)); !errors.Is(err, test.err) {
+			t.Errorf("test %d Expected: %v, got %v\n", n, test.err, err)
+		}
+	}
+
+	w, err := NewCaptureWriter(io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteFrame(captureStart, "frame"); !errors.Is(err, errBinaryType) {
+		t.Errorf("Expected: %v, got %v\n", errBinaryType, err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteFrame(captureStart, Respiration{}); err != errCaptureClosed {
+		t.Errorf("Expected: %v, got %v\n", errCaptureClosed, err)
+	}
+}
+
+func TestCaptureWriterAllocs(t *testing.T) {
+	w, err := NewCaptureWriter(io.Discard, WithCaptureChunkSize(1<<16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	iq := captureTestFrame(0)
+	allocs := testing.AllocsPerRun(1000, func() {
+		if err := w.WriteFrame(captureStart, iq); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("Expected: 0 allocs per frame, got %v\n", allocs)
+	}
+}
+
+func BenchmarkCaptureWriter(b *testing.B) {
+	for _, bench := range []struct {
+		name string
+		opts []CaptureOption
+	}{
+		{"plain", nil},
+		{"gzip", []CaptureOption{WithCaptureGzip(gzip.BestSpeed)}},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			i, q := make([]float64, 1024), make([]float64, 1024)
+			var iq interface{} = BaseBandIQ{BaseBandHeader: BaseBandHeader{Bins: 1024}, SigI: i, SigQ: q}
+			w, err := NewCaptureWriter(io.Discard, bench.opts...)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.SetBytes(int64(iq.(BaseBandIQ).binarySize()))
+			b.ReportAllocs()
+			for n := 0; n < b.N; n++ {
+				if err := w.WriteFrame(captureStart, iq); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package xethru
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Clock is the source of time for frame timestamps and command timeouts,
+// it can be replaced with SetClock so tests are deterministic.
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is a timer created by a Clock. Stop and Reset behave as they do for
+// a time.Timer.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) NewTimer(d time.Duration) Timer { return systemTimer{time.NewTimer(d)} }
+
+type systemTimer struct{ t *time.Timer }
+
+func (t systemTimer) C() <-chan time.Time { return t.t.C }
+func (t systemTimer) Stop() bool          { return t.t.Stop() }
+
+func (t systemTimer) Reset(d time.Duration) bool { return t.t.Reset(d) }
+
+// restartTimer stops t, discards a time it may already have sent and starts
+// it again for d, so one timer can be reused for a wait that restarts often.
+// The caller must be the only receiver from t.C().
+func restartTimer(t Timer, d time.Duration) {
+	if !t.Stop() {
+		select {
+		case <-t.C():
+		default:
+		}
+	}
+	t.Reset(d)
+}
+
+// clockBox lets clocks of different types share an atomic.Value.
+type clockBox struct{ Clock }
+
+var currentClock atomic.Value // clockBox
+
+// SetClock sets the Clock used by the package, nil restores the system clock.
+func SetClock(c Clock) {
+	currentClock.Store(clockBox{c})
+}
+
+// clock returns the Clock set by SetClock, or the system clock.
+func clock() Clock {
+	if b, _ := currentClock.Load().(clockBox); b.Clock != nil {
+		return b.Clock
+	}
+	return systemClock{}
+}
@@ -0,0 +1,110 @@
+package xethru
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock that only moves when advanced.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	c       chan time.Time
+	at      time.Time
+	clock   *fakeClock
+	stopped bool
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.c }
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	active := !t.stopped
+	t.stopped = true
+	return active
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	active := !t.stopped
+	t.stopped = false
+	t.at = t.clock.now.Add(d)
+	return active
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) NewTimer(d time.Duration) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{c: make(chan time.Time, 1), at: c.now.Add(d), clock: c}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Advance moves the clock on by d and fires the timers that are due.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	for _, t := range c.timers {
+		if !t.stopped && !t.at.After(c.now) {
+			t.stopped = true
+			t.c <- c.now
+		}
+	}
+}
+
+// waitTimers waits until n timers are running.
+func (c *fakeClock) waitTimers(t *testing.T, n int) {
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		c.mu.Lock()
+		running := 0
+		for _, t := range c.timers {
+			if !t.stopped {
+				running++
+			}
+		}
+		c.mu.Unlock()
+		if running >= n {
+			return
+		}
+	}
+	t.Fatalf("Expected: %d timers, got fewer\n", n)
+}
+
+// useFakeClock sets a fakeClock at a fixed time for the rest of the test.
+func useFakeClock(t *testing.T) *fakeClock {
+	c := &fakeClock{now: time.Unix(0, fakeClockTime)}
+	SetClock(c)
+	t.Cleanup(func() { SetClock(nil) })
+	return c
+}
+
+const fakeClockTime = 1480000000000000000
+
+func TestSetClock(t *testing.T) {
+	c := useFakeClock(t)
+	if got := clock().Now().UnixNano(); got != fakeClockTime {
+		t.Errorf("Expected: %d, got %d\n", int64(fakeClockTime), got)
+	}
+	c.Advance(time.Second)
+	if got := clock().Now().UnixNano(); got != fakeClockTime+int64(time.Second) {
+		t.Errorf("Expected: %d, got %d\n", fakeClockTime+int64(time.Second), got)
+	}
+	SetClock(nil)
+	if _, ok := clock().(systemClock); !ok {
+		t.Errorf("Expected: system clock, got %T\n", clock())
+	}
+}
@@ -0,0 +1,39 @@
+package xethru
+
+// ClutterFilter removes static clutter (DC offset) from baseband IQ frames by
+// keeping an exponential running mean of each bin and subtracting it.
+// Alpha is the weight given to each new frame, smaller values adapt slower.
+type ClutterFilter struct {
+	Alpha   float64
+	clutter []complex128
+}
+
+// NewClutterFilter creates a ClutterFilter with the given alpha.
+func NewClutterFilter(alpha float64) *ClutterFilter {
+	return &ClutterFilter{Alpha: alpha}
+}
+
+// Apply updates the clutter estimate with iq and returns a copy of iq with the
+// estimate subtracted. If the number of bins changes the filter is reset.
+func (f *ClutterFilter) Apply(iq BaseBandIQ) BaseBandIQ {
+	data := iq.Complex()
+	if len(f.clutter) != len(data) {
+		f.clutter = make([]complex128, len(data))
+		copy(f.clutter, data)
+	}
+	a := complex(f.Alpha, 0)
+	for i, v := range data {
+		f.clutter[i] = a*v + (1-a)*f.clutter[i]
+		data[i] = v - f.clutter[i]
+	}
+	out := BaseBandIQFromComplex(iq.Counter, iq.BinLength, iq.SamplingFreq, iq.CarrierFreq, iq.RangeOffset, data)
+	out.Time = iq.Time
+	out.Status = iq.Status
+	return out
+}
+
+// Reset clears the clutter estimate, the next frame applied will be used as
+// the starting estimate.
+func (f *ClutterFilter) Reset() {
+	f.clutter = nil
+}
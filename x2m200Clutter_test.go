@@ -0,0 +1,60 @@
+package xethru
+
+import (
+	"math"
+	"testing"
+)
+
+func TestClutterFilter(t *testing.T) {
+	const (
+		bins   = 8
+		frames = 2000
+		period = 20.0
+		amp    = 0.1
+	)
+	background := complex(3.5, -1.25)
+	f := NewClutterFilter(0.01)
+
+	var peak float64
+	var out BaseBandIQ
+	for n := 0; n < frames; n++ {
+		data := make([]complex128, bins)
+		for i := range data {
+			data[i] = background
+		}
+		// oscillation only present in bin 3
+		data[3] += complex(amp*math.Sin(2*math.Pi*float64(n)/period), 0)
+		out = f.Apply(BaseBandIQFromComplex(uint32(n), 0.05, 0, 0, 0, data))
+		if n >= frames-int(period) {
+			peak = math.Max(peak, math.Abs(out.SigI[3]))
+		}
+	}
+	if out.Bins != bins {
+		t.Fatalf("Expected: %d bins, got %d\n", bins, out.Bins)
+	}
+	for i := 0; i < bins; i++ {
+		if i == 3 {
+			continue
+		}
+		if math.Abs(out.SigI[i]) > 1e-9 || math.Abs(out.SigQ[i]) > 1e-9 {
+			t.Errorf("bin %d Expected background removed, got %v %v\n", i, out.SigI[i], out.SigQ[i])
+		}
+	}
+	if peak < 0.9*amp || peak > 1.1*amp {
+		t.Errorf("Expected oscillation of amplitude %v preserved, got %v\n", amp, peak)
+	}
+}
+
+func TestClutterFilterReset(t *testing.T) {
+	f := NewClutterFilter(0.5)
+	f.Apply(BaseBandIQFromComplex(0, 0.05, 0, 0, 0, []complex128{1, 1}))
+	out := f.Apply(BaseBandIQFromComplex(1, 0.05, 0, 0, 0, []complex128{5, 5, 5}))
+	if out.Bins != 3 || out.SigI[0] != 0 {
+		t.Errorf("Expected filter to reset on bin change, got %#v\n", out)
+	}
+	f.Reset()
+	out = f.Apply(BaseBandIQFromComplex(2, 0.05, 0, 0, 0, []complex128{9, 9, 9}))
+	if out.SigI[0] != 0 {
+		t.Errorf("Expected filter to reset, got %v\n", out.SigI[0])
+	}
+}
@@ -0,0 +1,118 @@
+package xethru
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// ErrFrameTrailingData is returned by DecodeFrame when there are bytes after
+// the end byte.
+var ErrFrameTrailingData = errors.New("data after end byte")
+
+// ChecksumX2M200 returns the protocol checksum of data, the XOR of every
+// byte. The frame checksum is calculated over the start byte and the
+// unescaped payload.
+func ChecksumX2M200(data []byte) byte {
+	// XOR eight bytes at a time then fold the word down to a byte
+	var w uint64
+	for len(data) >= 8 {
+		w ^= binary.LittleEndian.Uint64(data)
+		data = data[8:]
+	}
+	w ^= w >> 32
+	w ^= w >> 16
+	w ^= w >> 8
+	crc := byte(w)
+	for _, b := range data {
+		crc ^= b
+	}
+	return crc
+}
+
+// EncodeFrame returns payload framed as it is written by a Framer.
+func EncodeFrame(payload []byte) []byte {
+	return AppendFrame(make([]byte, 0, len(payload)+4), payload)
+}
+
+// AppendFrame appends payload, framed as it is written by a Framer, to dst
+// and returns the extended buffer. The crc is calculated before escaping,
+// then start, end and escape bytes in the payload and crc are escaped. Long
+// runs of other bytes are copied in bulk, as in unescape.
+func AppendFrame(dst, payload []byte) []byte {
+	crc := startByte ^ ChecksumX2M200(payload)
+	dst = append(dst, startByte)
+	nextStart, nextEnd, nextEsc := -1, -1, -1
+	literal := 0
+	for i := 0; i < len(payload); i++ {
+		b := payload[i]
+		if isControlByte(b) {
+			dst = append(dst, escByte, b)
+			literal = 0
+			continue
+		}
+		dst = append(dst, b)
+		if literal++; literal < shortRun {
+			continue
+		}
+		literal = 0
+		if nextStart <= i {
+			nextStart = nextIndex(payload, i+1, startByte)
+		}
+		if nextEnd <= i {
+			nextEnd = nextIndex(payload, i+1, endByte)
+		}
+		if nextEsc <= i {
+			nextEsc = nextIndex(payload, i+1, escByte)
+		}
+		next := nextStart
+		if nextEnd < next {
+			next = nextEnd
+		}
+		if nextEsc < next {
+			next = nextEsc
+		}
+		dst = append(dst, payload[i+1:next]...)
+		i = next - 1
+	}
+	if isControlByte(crc) {
+		dst = append(dst, escByte)
+	}
+	return append(dst, crc, endByte)
+}
+
+// DecodeFrame returns the payload of a single complete frame. It returns a
+// FramingError if frame is not exactly one frame and a CRCError if the
+// checksum does not match. Like a Framer without StrictEscaping it accepts
+// unescaped start bytes and an unescaped end byte crc.
+func DecodeFrame(frame []byte) ([]byte, error) {
+	return AppendPayload(nil, frame)
+}
+
+// AppendPayload appends the payload of a single complete frame to dst, see
+// DecodeFrame. On error dst is returned unchanged.
+func AppendPayload(dst, frame []byte) ([]byte, error) {
+	if len(frame) == 0 || frame[0] != startByte {
+		return dst, &FramingError{Reason: ErrPacketNoStartByte}
+	}
+	start := len(dst)
+	out, n, err := unescape(dst, frame, len(frame)+1, false)
+	if err != nil {
+		return dst, &FramingError{Reason: err, Offset: int64(n)}
+	}
+	body := out[start:]
+	if n == 0 || len(body) == 0 {
+		return dst, &FramingError{Reason: ErrPacketNotLongEnough, Offset: int64(len(frame))}
+	}
+	data, crc := body[:len(body)-1], body[len(body)-1]
+	if sum := startByte ^ ChecksumX2M200(data); sum != crc {
+		// a crc of endByte that was sent unescaped
+		if startByte^ChecksumX2M200(body) == endByte && n == len(frame)-1 && frame[n] == endByte {
+			return out, nil
+		}
+		return dst, &CRCError{Expected: sum, Got: crc}
+	}
+	if n != len(frame) {
+		return dst, &FramingError{Reason: ErrFrameTrailingData, Offset: int64(n)}
+	}
+	return out[:len(out)-1], nil
+}
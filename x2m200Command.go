@@ -0,0 +1,54 @@
+package xethru
+
+import (
+	"errors"
+	"time"
+)
+
+// startReader subscribes the module to its Dispatcher, creating one if the
+// module was not given one, and starts it. App data frames are queued for
+// Run.
+func (r *Module) startReader() {
+	r.readerOnce.Do(func() {
+		if r.dispatcher == nil {
+			r.dispatcher = NewDispatcher(r.f)
+			if r.ParsePool != nil {
+				r.dispatcher.SetParsePool(r.ParsePool, r.parseFrame)
+			}
+		}
+		// system messages tell Run the sensor has rebooted
+		r.frames = r.dispatcher.Subscribe(1000, append(append([]FrameType(nil), AppDataFrames...), FrameSystem)...)
+		r.dispatcher.Start()
+	})
+}
+
+// Execute writes cmd to the sensor and waits up to timeout for a response
+// whose first byte is want, which it returns. Commands are serialized so it
+// is safe to call from many goroutines, and while Run is streaming data.
+// Data frames that arrive while waiting are still delivered to Run.
+func (r *Module) Execute(cmd []byte, want byte, timeout time.Duration) ([]byte, error) {
+	return r.exchange(cmd, timeout, func(p []byte) bool {
+		return len(p) > 0 && p[0] == want
+	})
+}
+
+// parseFrame parses an app data frame for Run, or for the module's ParsePool.
+func (r *Module) parseFrame(f Frame) (interface{}, error) {
+	return parseProtocol(f.Payload, r.BasebandFormat, r.Protocol)
+}
+
+// exchange writes cmd and waits for a response that matches, other frames
+// are dispatched as normal.
+func (r *Module) exchange(cmd []byte, timeout time.Duration, match func([]byte) bool) ([]byte, error) {
+	if r.isAsleep() && !isResetCommand(cmd) {
+		return nil, errModuleAsleep
+	}
+	r.startReader()
+	return r.dispatcher.exchange(cmd, timeout, match)
+}
+
+// Errors returned by commands
+var (
+	ErrCommandTimeout   = errors.New("timeout waiting for command response")
+	ErrConnectionClosed = errors.New("connection to sensor closed")
+)
@@ -0,0 +1,429 @@
+package xethru
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSensor acks every command it receives, or sends replies if set, and
+// streams respiration frames until closed.
+type fakeSensor struct {
+	mu      sync.Mutex
+	replies [][]byte
+	sensor  Framer
+	r       *io.PipeReader
+	w       *io.PipeWriter
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+func newFakeSensor(stream time.Duration) (Framer, *fakeSensor) {
+	conn, s := newFakeSensorConn(stream)
+	return NewFramer(conn), s
+}
+
+type pipeConn struct {
+	*io.PipeReader
+	*io.PipeWriter
+}
+
+func (p pipeConn) Close() error {
+	p.PipeReader.Close()
+	return p.PipeWriter.Close()
+}
+
+// newFakeSensorConn returns the raw transport to a fakeSensor.
+func newFakeSensorConn(stream time.Duration) (io.ReadWriteCloser, *fakeSensor) {
+	sensorReader, clientWriter := io.Pipe()
+	clientReader, sensorWriter := io.Pipe()
+	s := &fakeSensor{
+		sensor: CreateSplitReadWriter(sensorWriter, sensorReader),
+		r:      sensorReader,
+		w:      sensorWriter,
+		stop:   make(chan struct{}),
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			b := make([]byte, 256)
+			_, err := s.sensor.Read(b)
+			if err == io.EOF || err == io.ErrClosedPipe {
+				return
+			}
+			s.mu.Lock()
+			replies := s.replies
+			s.mu.Unlock()
+			if replies == nil {
+				replies = [][]byte{{x2m200Ack}}
+			}
+			for _, reply := range replies {
+				s.send(append([]byte(nil), reply...))
+			}
+		}
+	}()
+	if stream > 0 {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			for {
+				select {
+				case <-s.stop:
+					return
+				case <-time.After(stream):
+					s.send(append([]byte(nil), respirationPayload...))
+				}
+			}
+		}()
+	}
+	return pipeConn{clientReader, clientWriter}, s
+}
+
+func (s *fakeSensor) send(p []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sensor.Write(p)
+}
+
+func (s *fakeSensor) setReplies(frames ...[]byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.replies = frames
+}
+
+func (s *fakeSensor) Close() {
+	close(s.stop)
+	s.r.Close()
+	s.w.Close()
+	s.wg.Wait()
+}
+
+func TestExecuteConcurrentWithRun(t *testing.T) {
+	sensor := NewSimulatedSensor()
+	sensor.Interval = time.Millisecond
+	m := NewModule(sensor, "respiration")
+
+	stream := make(chan interface{})
+	finished := make(chan struct{})
+	go func() {
+		m.Run(stream)
+		close(finished)
+	}()
+
+	received := make(chan int)
+	go func() {
+		n := 0
+		for d := range stream {
+			if _, ok := d.(Respiration); ok {
+				n++
+			}
+		}
+		received <- n
+	}()
+
+	var wg sync.WaitGroup
+	for g := 0; g < 10; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 5; n++ {
+				if err := m.SetLEDMode(); err != nil {
+					t.Error(err)
+				}
+				time.Sleep(2 * time.Millisecond)
+			}
+		}()
+	}
+	wg.Wait()
+
+	sensor.Close()
+	select {
+	case <-finished:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after the sensor closed")
+	}
+	close(stream)
+	if n := <-received; n == 0 {
+		t.Error("Expected: respiration frames while commands were running, got none")
+	}
+}
+
+func TestExecuteTimeout(t *testing.T) {
+	f, sensor := newFakeSensor(0)
+	defer sensor.Close()
+	m := NewModule(f, "respiration")
+
+	// the fake clock times the command out without waiting
+	c := useFakeClock(t)
+	errc := make(chan error)
+	go func() {
+		_, err := m.Execute([]byte{x2m200SetLEDControl, 0x00, 0x00}, 0x99, time.Hour)
+		errc <- err
+	}()
+	c.waitTimers(t, 1)
+	c.Advance(time.Hour)
+	if err := <-errc; err != ErrCommandTimeout {
+		t.Errorf("Expected: %v, got %v\n", ErrCommandTimeout, err)
+	}
+	SetClock(nil)
+	b, err := m.Execute([]byte{x2m200SetLEDControl, 0x00, 0x00}, x2m200Ack, 100*time.Millisecond)
+	if err != nil || len(b) != 1 || b[0] != x2m200Ack {
+		t.Errorf("Expected: ack, got %x %v\n", b, err)
+	}
+}
+
+func TestCommandAfterLongReply(t *testing.T) {
+	f, sensor := newFakeSensor(0)
+	defer sensor.Close()
+	system := make([]byte, 64)
+	system[0] = systemMesg
+	for n := 1; n < len(system); n++ {
+		system[n] = byte(n)
+	}
+	sensor.setReplies(system, []byte{x2m200Ack})
+	m := NewModule(f, "respiration")
+	m.Timeout = 100 * time.Millisecond
+
+	for n, cmd := range []func() error{func() error { return m.Load() }, m.SetLEDMode, func() error {
+		return m.SetDetectionZone(0.5, 1.5)
+	}} {
+		if err := cmd(); err != nil {
+			t.Errorf("test %d Expected: <nil>, got %v\n", n, err)
+		}
+	}
+}
+
+func TestReadPayloadLongerThanReadBuffer(t *testing.T) {
+	f, sensor := newFakeSensor(0)
+	defer sensor.Close()
+	long := make([]byte, 2*readBufferSize)
+	long[0] = appDataByte
+	for n := 1; n < len(long); n++ {
+		long[n] = byte(n % 0x70)
+	}
+	go sensor.send(append([]byte(nil), long...))
+	p, err := readPayload(f)
+	if err != nil || !bytes.Equal(p, long) {
+		t.Errorf("Expected: %d byte payload, got %d bytes %v\n", len(long), len(p), err)
+	}
+}
+
+func TestSensorErrorReply(t *testing.T) {
+	cases := []struct {
+		code     byte
+		sentinel error
+		message  string
+	}{
+		{0x01, ErrProtocolNotRecognised, "command not recognised"},
+		{0x02, ErrProtocolCRCFailed, "command bad crc"},
+		{0x03, ErrProtocolInvalidAppID, "invalid app id"},
+		{0x04, nil, "unknown error"},
+		{0x42, nil, "unknown error"},
+	}
+	f, sensor := newFakeSensor(0)
+	defer sensor.Close()
+	m := NewModule(f, "respiration")
+
+	for n, c := range cases {
+		sensor.setReplies([]byte{errorByte, c.code})
+		err := m.SetLEDMode()
+		var sensorErr *SensorError
+		if !errors.As(err, &sensorErr) {
+			t.Errorf("test %d Expected: SensorError, got %v\n", n, err)
+			continue
+		}
+		if sensorErr.Code != c.code || sensorErr.Message() != c.message {
+			t.Errorf("test %d Expected: %#02x %q, got %#02x %q\n", n, c.code, c.message, sensorErr.Code, sensorErr.Message())
+		}
+		if !errors.Is(err, ErrProtocol) {
+			t.Errorf("test %d Expected: %v to wrap %v\n", n, err, ErrProtocol)
+		}
+		if c.sentinel != nil && !errors.Is(err, c.sentinel) {
+			t.Errorf("test %d Expected: %v to match %v\n", n, err, c.sentinel)
+		}
+	}
+}
+
+func TestResetAndWait(t *testing.T) {
+	f, sensor := newFakeSensor(0)
+	defer sensor.Close()
+	m := NewModule(f, "respiration")
+
+	sensor.setReplies(
+		[]byte{x2m200Ack},
+		[]byte{systemMesg, systemBooting},
+		[]byte{0x55, 0x01, 0x02},
+		respirationPayload,
+		[]byte{systemMesg, systemReady},
+	)
+	if err := m.ResetAndWait(time.Second); err != nil {
+		t.Errorf("Expected: reset to succeed, got %v\n", err)
+	}
+
+	sensor.setReplies([]byte{x2m200Ack}, []byte{systemMesg, systemBooting})
+	if err := m.ResetAndWait(50 * time.Millisecond); !errors.Is(err, ErrCommandTimeout) {
+		t.Errorf("Expected: %v, got %v\n", ErrCommandTimeout, err)
+	}
+
+	sensor.setReplies([]byte{errorByte, notReconsied})
+	if err := m.ResetAndWait(time.Second); !errors.Is(err, ErrProtocolNotRecognised) {
+		t.Errorf("Expected: %v, got %v\n", ErrProtocolNotRecognised, err)
+	}
+}
+
+func TestLoadWhileBooting(t *testing.T) {
+	for _, booting := range []int{1, 2} {
+		var loads int
+		f, sensor, stop := newScriptedSensor(func([]byte) []byte {
+			if loads++; loads <= booting {
+				return []byte{systemMesg, systemReady}
+			}
+			return []byte{x2m200Ack}
+		})
+		m := NewModule(f, "respiration")
+		m.Timeout = 100 * time.Millisecond
+		err := m.Load()
+		if booting < loadAttempts && err != nil {
+			t.Errorf("booting %d Expected: <nil>, got %v\n", booting, err)
+		}
+		if booting >= loadAttempts && !errors.Is(err, errLoadBooting) {
+			t.Errorf("booting %d Expected: %v, got %v\n", booting, errLoadBooting, err)
+		}
+		if cmds := sensor.commands(); len(cmds) != loadAttempts {
+			t.Errorf("booting %d Expected: %d loads, got %x\n", booting, loadAttempts, cmds)
+		}
+		stop()
+	}
+}
+
+func TestExecuteSlowAcksWithStreaming(t *testing.T) {
+	sensor := NewSimulatedSensor()
+	sensor.Interval = time.Millisecond
+	sensor.AckDelay = 5 * time.Millisecond
+	m := NewModule(sensor, "respiration")
+	m.startReader()
+	acks := m.dispatcher.Subscribe(100, FrameAck, FrameUnknown)
+
+	stream := make(chan interface{})
+	finished := make(chan struct{})
+	go func() {
+		m.Run(stream)
+		close(finished)
+	}()
+
+	var counters []uint32
+	others := 0
+	received := make(chan struct{})
+	go func() {
+		for d := range stream {
+			if r, ok := d.(Respiration); ok {
+				counters = append(counters, r.Counter)
+			} else {
+				others++
+			}
+		}
+		close(received)
+	}()
+
+	var wg sync.WaitGroup
+	for g := 0; g < 5; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 5; n++ {
+				if err := m.ping(); err != nil {
+					t.Error(err)
+				}
+				if err := m.SetLEDMode(); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if len(acks) != 0 {
+		t.Errorf("Expected: every response to complete a command, got %d unmatched\n", len(acks))
+	}
+
+	sensor.Close()
+	<-finished
+	close(stream)
+	<-received
+	if others != 0 {
+		t.Errorf("Expected: only respiration frames, got %d others\n", others)
+	}
+	if len(counters) == 0 {
+		t.Fatal("Expected: respiration frames while commands were running, got none")
+	}
+	for i := 1; i < len(counters); i++ {
+		if counters[i] != counters[i-1]+1 {
+			t.Errorf("Expected: counter %d, got %d\n", counters[i-1]+1, counters[i])
+			break
+		}
+	}
+}
+
+// scriptedSensor records the commands it is sent and replies to each with
+// the payload returned by reply, nil sends no reply.
+type scriptedSensor struct {
+	mu     sync.Mutex
+	cmds   [][]byte
+	reply  func(cmd []byte) []byte
+	sensor Framer
+}
+
+// newScriptedSensor returns a Framer connected to s and a function that
+// disconnects it.
+func newScriptedSensor(reply func(cmd []byte) []byte) (Framer, *scriptedSensor, func()) {
+	s := &scriptedSensor{reply: reply}
+	sensorReader, clientWriter := io.Pipe()
+	clientReader, sensorWriter := io.Pipe()
+	sensor := NewFramer(pipeConn{sensorReader, sensorWriter})
+	s.sensor = sensor
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		a := NewAssembler()
+		b := make([]byte, 1024)
+		for {
+			n, err := sensorReader.Read(b)
+			if err != nil {
+				return
+			}
+			a.Write(b[:n])
+			for {
+				cmd, err := a.Next()
+				if cmd == nil || err != nil {
+					break
+				}
+				cmd = append([]byte(nil), cmd...)
+				s.mu.Lock()
+				s.cmds = append(s.cmds, cmd)
+				s.mu.Unlock()
+				if p := s.reply(cmd); p != nil {
+					sensor.Write(p)
+				}
+			}
+		}
+	}()
+	return NewFramer(pipeConn{clientReader, clientWriter}), s, func() {
+		sensor.Close()
+		<-done
+	}
+}
+
+// commands returns the commands received so far.
+func (s *scriptedSensor) commands() [][]byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([][]byte(nil), s.cmds...)
+}
+
+// send sends p unprompted.
+func (s *scriptedSensor) send(p []byte) {
+	s.sensor.Write(p)
+}
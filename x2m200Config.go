@@ -0,0 +1,122 @@
+package xethru
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// RespirationConfig is a set of settings applied together by ApplyConfig.
+type RespirationConfig struct {
+	DetectionZoneStart float64
+	DetectionZoneEnd   float64
+	Sensitivity        int
+	LEDMode            ledMode
+}
+
+// GetSensitivity reads the sensitivity the app is using. The reply layout
+// is assumed from the other app commands.
+// Example: <Start> + <XTS_SPC_APPCOMMAND> + <XTS_SPCA_GET> + [XTS_ID_SENSITIVITY(i)] + <CRC> + <End>
+// Response: <Start> + <XTS_SPR_REPLY> + <XTS_SPC_APPCOMMAND> + <XTS_SPCA_GET> + [Sensitivity(i)] + <CRC> + <End>
+func (r *Module) GetSensitivity() (int, error) {
+	cmd := append([]byte{x2m200AppCommand, x2m200Get}, x2m200Sensitivity[:]...)
+	resp, err := r.exchange(cmd, r.Timeout, func(p []byte) bool {
+		return len(p) > 2 && p[0] == x2m200Reply && p[1] == x2m200AppCommand && p[2] == x2m200Get
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get sensitivity: %w", err)
+	}
+	if len(resp) < sensitivityReplyLen {
+		return 0, &LengthError{Err: errSensitivityReply, Want: sensitivityReplyLen, Got: len(resp)}
+	}
+	return int(binary.LittleEndian.Uint32(resp[3:7])), nil
+}
+
+const sensitivityReplyLen = 7
+
+var errSensitivityReply = errors.New("sensitivity reply is not long enough")
+
+// ConfigApplyError is returned by ApplyConfig when a setting fails. Applied
+// lists the settings sent before Failed, and Rollback is the error restoring
+// the settings read before applying, nil if they were all restored.
+type ConfigApplyError struct {
+	Applied  []string
+	Failed   string
+	Err      error
+	Rollback error
+}
+
+func (e *ConfigApplyError) Error() string {
+	rollback := "rolled back"
+	if e.Rollback != nil {
+		rollback = fmt.Sprintf("rollback failed: %v", e.Rollback)
+	}
+	return fmt.Sprintf("failed to apply %s after applying [%s]: %v, %s", e.Failed, strings.Join(e.Applied, " "), e.Err, rollback)
+}
+
+// Unwrap returns Err and Rollback.
+func (e *ConfigApplyError) Unwrap() []error {
+	if e.Rollback == nil {
+		return []error{e.Err}
+	}
+	return []error{e.Err, e.Rollback}
+}
+
+// ApplyConfig sends the detection zone, sensitivity and led mode of cfg. The
+// zone and sensitivity are read from the sensor first and, if any setting
+// fails, every setting is put back as it was, the led mode as last set by the
+// module as it can not be read. A failure is returned as a
+// ConfigApplyError.
+func (r *Module) ApplyConfig(cfg RespirationConfig) error {
+	prevStart, prevEnd, err := r.GetDetectionZone()
+	if err != nil {
+		return err
+	}
+	prevSensitivity, err := r.GetSensitivity()
+	if err != nil {
+		return err
+	}
+	prevLED := r.LEDMode
+
+	steps := []struct {
+		name           string
+		apply, restore func() error
+	}{
+		{
+			"DetectionZone",
+			func() error { return r.SetDetectionZone(cfg.DetectionZoneStart, cfg.DetectionZoneEnd) },
+			func() error { return r.SetDetectionZone(prevStart, prevEnd) },
+		},
+		{
+			"Sensitivity",
+			func() error { return r.SetSensitivity(cfg.Sensitivity) },
+			func() error { return r.SetSensitivity(prevSensitivity) },
+		},
+		{
+			"LEDMode",
+			func() error { r.LEDMode = cfg.LEDMode; return r.SetLEDMode() },
+			func() error { r.LEDMode = prevLED; return r.SetLEDMode() },
+		},
+	}
+	for i, s := range steps {
+		err := s.apply()
+		if err == nil {
+			continue
+		}
+		e := &ConfigApplyError{Failed: s.name, Err: err}
+		// the failed setting may have been half applied so it is restored too
+		var rollback []error
+		for j := i; j >= 0; j-- {
+			if j < i {
+				e.Applied = append([]string{steps[j].name}, e.Applied...)
+			}
+			if err := steps[j].restore(); err != nil {
+				rollback = append(rollback, fmt.Errorf("%s: %w", steps[j].name, err))
+			}
+		}
+		e.Rollback = errors.Join(rollback...)
+		return e
+	}
+	return nil
+}
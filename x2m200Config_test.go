@@ -0,0 +1,72 @@
+package xethru
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestApplyConfig(t *testing.T) {
+	cfg := RespirationConfig{DetectionZoneStart: 0.5, DetectionZoneEnd: 1.5, Sensitivity: 7, LEDMode: LEDFull}
+	zone := []byte{x2m200AppCommand, x2m200Set, 0x1c, 0x0a, 0xa1, 0x96, 0x00, 0x00, 0x00, 0x3f}
+	sensitivity := append([]byte{x2m200AppCommand, x2m200Set}, append(x2m200Sensitivity[:], 0x07)...)
+	led := []byte{x2m200SetLEDControl, byte(LEDFull)}
+	prefix := func(p []byte) func([]byte) bool {
+		return func(cmd []byte) bool { return bytes.HasPrefix(cmd, p) }
+	}
+
+	cases := []struct {
+		reject   func([]byte) bool
+		applied  []string
+		failed   string
+		rollback bool // rollback fails
+	}{
+		{nil, nil, "", false},
+		{prefix(zone), nil, "DetectionZone", false},
+		{prefix(sensitivity), []string{"DetectionZone"}, "Sensitivity", false},
+		{prefix(led), []string{"DetectionZone", "Sensitivity"}, "LEDMode", false},
+		// the led fails and so does restoring the led mode
+		{prefix([]byte{x2m200SetLEDControl}), []string{"DetectionZone", "Sensitivity"}, "LEDMode", true},
+	}
+	for n, c := range cases {
+		sensor := NewSimulatedSensor()
+		sensor.Reject = c.reject
+		m := NewRespiration(sensor)
+		m.Timeout = 100 * time.Millisecond
+
+		err := m.ApplyConfig(cfg)
+		var applyErr *ConfigApplyError
+		switch {
+		case c.failed == "":
+			if err != nil {
+				t.Errorf("test %d Expected: <nil>, got %v\n", n, err)
+			}
+		case !errors.As(err, &applyErr):
+			t.Errorf("test %d Expected: ConfigApplyError, got %v\n", n, err)
+		default:
+			if applyErr.Failed != c.failed || !reflect.DeepEqual(applyErr.Applied, c.applied) {
+				t.Errorf("test %d Expected: %v failed after %v, got %v\n", n, c.failed, c.applied, err)
+			}
+			if !errors.Is(err, ErrProtocolNotRecognised) {
+				t.Errorf("test %d Expected: %v, got %v\n", n, ErrProtocolNotRecognised, err)
+			}
+			if (applyErr.Rollback != nil) != c.rollback {
+				t.Errorf("test %d Expected: rollback error %v, got %v\n", n, c.rollback, applyErr.Rollback)
+			}
+		}
+
+		// after a failure the sensor is back where it started
+		start, end, zerr := m.GetDetectionZone()
+		sens, serr := m.GetSensitivity()
+		want := [3]float64{0.5, 1.5, 7}
+		if c.failed != "" {
+			want = [3]float64{float64(float32(0.4)), 2, 5}
+		}
+		if got := [3]float64{start, end, float64(sens)}; zerr != nil || serr != nil || got != want {
+			t.Errorf("test %d Expected: %v, got %v %v %v\n", n, want, got, zerr, serr)
+		}
+		sensor.Close()
+	}
+}
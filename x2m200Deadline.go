@@ -0,0 +1,62 @@
+package xethru
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// deadliner is implemented by transports, such as net.Conn and some serial
+// ports, whose blocking reads and writes can be given a deadline.
+//
+// Without one a read can not be abandoned. Where the package has to wait for
+// a reply on such a transport it reads in a goroutine and stops waiting when
+// a timer fires, but the goroutine stays blocked in Read until the transport
+// returns data or is closed and so may take a frame meant for a later read.
+type deadliner interface {
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+}
+
+// ErrDeadlineNotSupported is returned when setting a deadline on a Framer
+// whose transport does not support them.
+var ErrDeadlineNotSupported = errors.New("transport does not support deadlines")
+
+// SetReadDeadline sets the deadline for reads from the transport, a zero
+// value clears it. A read that times out returns an error wrapping
+// os.ErrDeadlineExceeded, buffered frames are not lost.
+func (x *x2m200Frame) SetReadDeadline(t time.Time) error {
+	if x.d == nil {
+		return ErrDeadlineNotSupported
+	}
+	return x.d.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the deadline for writes to the transport, a zero
+// value clears it.
+func (x *x2m200Frame) SetWriteDeadline(t time.Time) error {
+	if x.d == nil {
+		return ErrDeadlineNotSupported
+	}
+	return x.d.SetWriteDeadline(t)
+}
+
+// frameDeadliner returns the deadline support of f, or nil if f or its
+// transport has none.
+func frameDeadliner(f Framer) deadliner {
+	switch x := f.(type) {
+	case *x2m200Frame:
+		if x.d == nil {
+			return nil
+		}
+		return x
+	case deadliner:
+		return x
+	}
+	return nil
+}
+
+// isTimeout reports whether err is a read or write deadline expiring.
+func isTimeout(err error) bool {
+	return errors.Is(err, os.ErrDeadlineExceeded)
+}
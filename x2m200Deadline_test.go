@@ -0,0 +1,105 @@
+package xethru
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func pingReply() []byte {
+	b := make([]byte, 5)
+	b[0] = x2m200PingCommand
+	binary.BigEndian.PutUint32(b[1:], x2m200PingResponseReady)
+	return b
+}
+
+func TestPingDeadline(t *testing.T) {
+	host, sensor := net.Pipe()
+	defer host.Close()
+	defer sensor.Close()
+	f := NewFramer(host).(*x2m200Frame)
+	if frameDeadliner(f) == nil {
+		t.Fatal("Expected: net.Pipe to support deadlines")
+	}
+
+	// the sensor reads each ping but only answers the second
+	go func() {
+		a := NewAssembler()
+		b := make([]byte, 64)
+		for pings := 0; ; {
+			n, err := sensor.Read(b)
+			if err != nil {
+				return
+			}
+			a.Write(b[:n])
+			for p, _ := a.Next(); p != nil; p, _ = a.Next() {
+				if pings++; pings == 2 {
+					sensor.Write(EncodeFrame(pingReply()))
+				}
+			}
+		}
+	}()
+
+	start := time.Now()
+	if _, err := f.Ping(50 * time.Millisecond); !errors.Is(err, errPingTimeout) {
+		t.Errorf("Expected: %v, got %v\n", errPingTimeout, err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Expected: ping to time out after 50ms, took %v\n", d)
+	}
+	// no read was left behind to take the reply
+	ready, err := f.Ping(time.Second)
+	if err != nil || !ready {
+		t.Errorf("Expected: %v, got %v %v\n", true, ready, err)
+	}
+}
+
+func TestPingNoDeadline(t *testing.T) {
+	cases := []struct {
+		in    []byte
+		ready bool
+		err   error
+	}{
+		{EncodeFrame(pingReply()), true, nil},
+		{nil, false, errPingTimeout},
+	}
+	for n, c := range cases {
+		var out bytes.Buffer
+		f := CreateSplitReadWriter(&out, bytes.NewReader(c.in)).(*x2m200Frame)
+		if frameDeadliner(f) != nil {
+			t.Fatalf("test %d Expected: no deadline support\n", n)
+		}
+		if err := f.SetReadDeadline(time.Now()); !errors.Is(err, ErrDeadlineNotSupported) {
+			t.Errorf("test %d Expected: %v, got %v\n", n, ErrDeadlineNotSupported, err)
+		}
+		ready, err := f.Ping(50 * time.Millisecond)
+		if ready != c.ready || !errors.Is(err, c.err) {
+			t.Errorf("test %d Expected: %v %v, got %v %v\n", n, c.ready, c.err, ready, err)
+		}
+	}
+}
+
+func TestExecuteWriteDeadline(t *testing.T) {
+	host, sensor := net.Pipe()
+	defer sensor.Close()
+	defer host.Close()
+	// nothing reads from sensor so the write blocks
+	r := &Module{f: NewFramer(host), Timeout: 50 * time.Millisecond}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := r.Execute([]byte{x2m200SetLEDControl, 0x02, 0x00}, x2m200Ack, r.Timeout)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !isTimeout(err) {
+			t.Errorf("Expected: %v, got %v\n", "deadline exceeded", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected: Execute to return after the write deadline")
+	}
+}
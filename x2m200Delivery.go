@@ -0,0 +1,181 @@
+package xethru
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// frameRing is a fixed size FIFO of frames between Run and its stream, what
+// happens when it is full is set by its DeliveryPolicy. It does not allocate
+// once created.
+type frameRing struct {
+	policy DeliveryPolicy
+	mu     sync.Mutex
+	buf    []interface{}
+	head   int
+	n      int
+	ready  chan struct{} // signalled when a frame is pushed
+	space  chan struct{} // signalled when a frame is popped
+}
+
+func newFrameRing(size int, policy DeliveryPolicy) *frameRing {
+	return &frameRing{
+		policy: policy,
+		buf:    make([]interface{}, size),
+		ready:  make(chan struct{}, 1),
+		space:  make(chan struct{}, 1),
+	}
+}
+
+// push adds v, it reports whether a frame, the oldest or v, was dropped. If
+// the policy is Block and the ring is full it waits for room, returning
+// ctx.Err() if ctx is done first or nil if closed is.
+func (q *frameRing) push(ctx context.Context, v interface{}, closed <-chan struct{}) (dropped bool, err error) {
+	q.mu.Lock()
+	for q.n == len(q.buf) && q.policy == Block {
+		q.mu.Unlock()
+		select {
+		case <-q.space:
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-closed:
+			return true, nil
+		}
+		q.mu.Lock()
+	}
+	switch {
+	case q.n < len(q.buf):
+		q.buf[(q.head+q.n)%len(q.buf)] = v
+		q.n++
+	case q.policy == DropNewest:
+		dropped = true
+	default:
+		q.buf[q.head] = v
+		q.head = (q.head + 1) % len(q.buf)
+		dropped = true
+	}
+	q.mu.Unlock()
+	signal(q.ready)
+	return dropped, nil
+}
+
+// pop removes the oldest frame, ok is false if the ring is empty.
+func (q *frameRing) pop() (v interface{}, ok bool) {
+	q.mu.Lock()
+	if q.n == 0 {
+		q.mu.Unlock()
+		return nil, false
+	}
+	v = q.buf[q.head]
+	q.buf[q.head] = nil
+	q.head = (q.head + 1) % len(q.buf)
+	q.n--
+	q.mu.Unlock()
+	signal(q.space)
+	return v, true
+}
+
+// signal wakes the waiter on c, if there is one, without blocking.
+func signal(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
+
+// drain sends the frames pushed to q on stream until stop is closed and q is
+// empty, or ctx is done. Once stop is closed it waits at most linger for the
+// consumer to take each frame, if it does not the rest are dropped so a
+// consumer that stopped reading can not hold it up. It returns how many
+// frames it dropped.
+func (q *frameRing) drain(ctx context.Context, stream chan<- interface{}, stop <-chan struct{}, linger time.Duration) (dropped int) {
+	stopped := false
+	for {
+		v, ok := q.pop()
+		if !ok {
+			if stopped {
+				// nothing is pushed once stop is closed
+				return 0
+			}
+			select {
+			case <-q.ready:
+			case <-stop:
+				stopped = true
+			case <-ctx.Done():
+				return 0
+			}
+			continue
+		}
+		if !stopped {
+			select {
+			case stream <- v:
+				continue
+			case <-stop:
+				stopped = true
+			case <-ctx.Done():
+				return 0
+			}
+		}
+		if !lingerSend(ctx, stream, v, linger) {
+			return 1 + q.clear()
+		}
+	}
+}
+
+// lingerSend sends v on stream, waiting at most linger for the consumer. It
+// reports whether v was sent.
+func lingerSend(ctx context.Context, stream chan<- interface{}, v interface{}, linger time.Duration) bool {
+	select {
+	case stream <- v:
+		return true
+	default:
+	}
+	if linger <= 0 {
+		return false
+	}
+	timer := time.NewTimer(linger)
+	defer timer.Stop()
+	select {
+	case stream <- v:
+		return true
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	return false
+}
+
+// clear drops the frames in q and returns how many there were.
+func (q *frameRing) clear() int {
+	n := 0
+	for _, ok := q.pop(); ok; _, ok = q.pop() {
+		n++
+	}
+	return n
+}
+
+// drop counts n frames dropped from the StreamBuffer.
+func (r *Module) drop(n int) {
+	r.dropped.Add(uint64(n))
+	r.metrics().Counter(MetricDroppedFrames, float64(n))
+}
+
+// Stats returns the Stats of the module's Framer, if it keeps them, with
+// DroppedFrames set to the frames Run has dropped from a full StreamBuffer,
+// or left in it for a consumer that stopped reading,
+// SinkDropped to those it dropped from a full sink queue and FrameRate to the
+// rate Run is receiving respiration frames at.
+func (r *Module) Stats() Stats {
+	var s Stats
+	if f, ok := r.f.(StatsFramer); ok {
+		s = f.Stats()
+	}
+	s.DroppedFrames = r.dropped.Load()
+	s.FrameRate = r.rate.Rate()
+	r.handlersMu.Lock()
+	if t := r.sink; t != nil {
+		s.SinkDropped = t.dropped.Load()
+	}
+	r.handlersMu.Unlock()
+	return s
+}
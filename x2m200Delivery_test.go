@@ -0,0 +1,188 @@
+package xethru
+
+import (
+	"context"
+	"encoding/binary"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFrameRing(t *testing.T) {
+	cases := []struct {
+		policy  DeliveryPolicy
+		want    []interface{}
+		dropped int
+	}{
+		{DropOldest, []interface{}{3, 4, 5}, 2},
+		{DropNewest, []interface{}{1, 2, 3}, 2},
+	}
+	for n, c := range cases {
+		q := newFrameRing(3, c.policy)
+		dropped := 0
+		for i := 1; i <= 5; i++ {
+			if d, err := q.push(context.Background(), i, nil); err != nil || d {
+				dropped++
+			}
+		}
+		var got []interface{}
+		for v, ok := q.pop(); ok; v, ok = q.pop() {
+			got = append(got, v)
+		}
+		if !reflect.DeepEqual(got, c.want) || dropped != c.dropped {
+			t.Errorf("test %d Expected: %v with %d dropped, got %v with %d\n", n, c.want, c.dropped, got, dropped)
+		}
+	}
+
+	// Block waits for room
+	q := newFrameRing(1, Block)
+	q.push(context.Background(), 1, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := q.push(ctx, 2, nil); err != context.DeadlineExceeded {
+		t.Errorf("Expected: %v, got %v\n", context.DeadlineExceeded, err)
+	}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		q.pop()
+	}()
+	if d, err := q.push(context.Background(), 3, nil); d || err != nil {
+		t.Errorf("Expected: push once there is room, got %v %v\n", d, err)
+	}
+}
+
+func TestFrameRingNoAlloc(t *testing.T) {
+	q := newFrameRing(4, DropOldest)
+	var v interface{} = Respiration{Counter: 1}
+	allocs := testing.AllocsPerRun(100, func() {
+		for i := 0; i < 6; i++ {
+			q.push(context.Background(), v, nil)
+		}
+		q.pop()
+	})
+	if allocs != 0 {
+		t.Errorf("Expected: 0 allocs, got %v\n", allocs)
+	}
+}
+
+func TestStreamPolicy(t *testing.T) {
+	const frames, buffer = 20, 4
+	for _, policy := range []DeliveryPolicy{DropOldest, DropNewest, Block} {
+		f, sensor := newFakeSensor(0)
+		m := NewModule(f, "respiration")
+		m.Timeout = 10 * time.Millisecond
+		m.StreamBuffer = buffer
+		m.StreamPolicy = policy
+
+		var seen atomic.Int32
+		read := make(chan struct{})
+		m.OnRespiration(func(Respiration) {
+			if seen.Add(1) == frames {
+				close(read)
+			}
+		})
+		stream := make(chan interface{})
+		var got []uint32
+		all := make(chan struct{})
+		consumed := make(chan struct{})
+		go func() {
+			defer close(consumed)
+			if policy != Block {
+				// stall until every frame has been read
+				<-read
+				time.Sleep(20 * time.Millisecond)
+			}
+			for d := range stream {
+				if got = append(got, d.(Respiration).Counter); len(got) == frames {
+					close(all)
+				}
+				time.Sleep(time.Millisecond)
+			}
+		}()
+		finished := make(chan struct{})
+		go func() {
+			m.Run(stream)
+			close(finished)
+		}()
+		for i := 1; i <= frames; i++ {
+			p := append([]byte(nil), respirationPayload...)
+			binary.LittleEndian.PutUint32(p[5:9], uint32(i))
+			sensor.send(p)
+		}
+		if policy == Block {
+			<-all
+		} else {
+			<-read
+			time.Sleep(20 * time.Millisecond)
+		}
+		sensor.Close()
+		<-finished
+		close(stream)
+		<-consumed
+
+		dropped := m.Stats().DroppedFrames
+		if int(dropped) != frames-len(got) {
+			t.Errorf("%v Expected: %d dropped, got %d\n", policy, frames-len(got), dropped)
+		}
+		switch policy {
+		case DropOldest:
+			// the newest frames survive, and perhaps the one the ring was
+			// already sending
+			if len(got) < buffer || len(got) > buffer+1 || !reflect.DeepEqual(got[len(got)-buffer:], []uint32{17, 18, 19, 20}) {
+				t.Errorf("%v Expected: frames ending 17 to 20, got %v\n", policy, got)
+			}
+		case DropNewest:
+			// the oldest frames survive
+			if len(got) < buffer || len(got) > buffer+1 || !reflect.DeepEqual(got[:buffer], []uint32{1, 2, 3, 4}) {
+				t.Errorf("%v Expected: frames starting 1 to 4, got %v\n", policy, got)
+			}
+		case Block:
+			for i, c := range got {
+				if c != uint32(i+1) {
+					t.Errorf("%v Expected: all %d frames in order, got %v\n", policy, frames, got)
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestStreamBufferAbandoned(t *testing.T) {
+	const frames, buffer = 10, 4
+	f, sensor := newFakeSensor(0)
+	m := NewModule(f, "respiration")
+	m.Timeout = 10 * time.Millisecond
+	m.StreamBuffer = buffer
+	m.StreamPolicy = DropOldest
+	var seen atomic.Int32
+	read := make(chan struct{})
+	m.OnRespiration(func(Respiration) {
+		if seen.Add(1) == frames {
+			close(read)
+		}
+	})
+
+	// nothing ever reads the stream
+	stream := make(chan interface{})
+	finished := make(chan struct{})
+	go func() {
+		m.Run(stream)
+		close(finished)
+	}()
+	for i := 1; i <= frames; i++ {
+		p := append([]byte(nil), respirationPayload...)
+		binary.LittleEndian.PutUint32(p[5:9], uint32(i))
+		sensor.send(p)
+	}
+	<-read
+	sensor.Close()
+	select {
+	case <-finished:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected: Run to return after the connection is lost")
+	}
+	if dropped := m.Stats().DroppedFrames; dropped != frames {
+		t.Errorf("Expected: %d dropped, got %d\n", frames, dropped)
+	}
+}
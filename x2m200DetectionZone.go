@@ -0,0 +1,74 @@
+package xethru
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// GetDetectionZone reads the detection zone the module is using, which can
+// differ from the one set as the module snaps it to its range bins. The
+// reply layout is assumed from the other app commands.
+// Example: <Start> + <XTS_SPC_APPCOMMAND> + <XTS_SPCA_GET> + [XTS_ID_DETECTION_ZONE(i)] + <CRC> + <End>
+// Response: <Start> + <XTS_SPR_REPLY> + <XTS_SPC_APPCOMMAND> + <XTS_SPCA_GET> + [Start(f)] + [End(f)] + <CRC> + <End>
+func (r *Module) GetDetectionZone() (start, end float64, err error) {
+	cmd := []byte{x2m200AppCommand, x2m200Get}
+	cmd = binary.LittleEndian.AppendUint32(cmd, x2m200DetectionZone)
+	resp, err := r.exchange(cmd, r.Timeout, func(p []byte) bool {
+		return len(p) > 2 && p[0] == x2m200Reply && p[1] == x2m200AppCommand && p[2] == x2m200Get
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get detection zone: %w", err)
+	}
+	if len(resp) < detectionZoneReplyLen {
+		return 0, 0, &LengthError{Err: errDetectionZoneReply, Want: detectionZoneReplyLen, Got: len(resp)}
+	}
+	start = float64(math.Float32frombits(binary.LittleEndian.Uint32(resp[3:7])))
+	end = float64(math.Float32frombits(binary.LittleEndian.Uint32(resp[7:11])))
+	return start, end, nil
+}
+
+const detectionZoneReplyLen = 11
+
+// defaultZoneTolerance is used when Module.ZoneTolerance is zero.
+const defaultZoneTolerance = 0.01
+
+var (
+	// ErrInvalidDetectionZone is returned for a zone that does not start at
+	// or after zero and end after it starts.
+	ErrInvalidDetectionZone = errors.New("invalid detection zone")
+	errDetectionZoneReply   = errors.New("detection zone reply is not long enough")
+)
+
+// DetectionZoneError is returned by SetDetectionZone when the zone the
+// module applied moved by more than ZoneTolerance from the one requested.
+// The module accepted the zone, so it is a warning rather than a failure.
+type DetectionZoneError struct {
+	Start, End               float64 // requested
+	AppliedStart, AppliedEnd float64
+}
+
+func (e *DetectionZoneError) Error() string {
+	return fmt.Sprintf("detection zone %2.2f %2.2f applied as %2.2f %2.2f", e.Start, e.End, e.AppliedStart, e.AppliedEnd)
+}
+
+// verifyDetectionZone reads back the zone after it has been set and records
+// the applied zone in DetectionZoneStart and DetectionZoneEnd.
+func (r *Module) verifyDetectionZone(start, end float64) error {
+	appliedStart, appliedEnd, err := r.GetDetectionZone()
+	if err != nil {
+		return err
+	}
+	r.DetectionZoneStart = float32(appliedStart)
+	r.DetectionZoneEnd = float32(appliedEnd)
+
+	tolerance := r.ZoneTolerance
+	if tolerance == 0 {
+		tolerance = defaultZoneTolerance
+	}
+	if math.Abs(appliedStart-start) > tolerance || math.Abs(appliedEnd-end) > tolerance {
+		return &DetectionZoneError{Start: start, End: end, AppliedStart: appliedStart, AppliedEnd: appliedEnd}
+	}
+	return nil
+}
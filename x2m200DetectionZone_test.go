@@ -0,0 +1,101 @@
+package xethru
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func zoneReply(start, end float32) []byte {
+	b := []byte{x2m200Reply, x2m200AppCommand, x2m200Get}
+	b = binary.LittleEndian.AppendUint32(b, math.Float32bits(start))
+	return binary.LittleEndian.AppendUint32(b, math.Float32bits(end))
+}
+
+func TestSetDetectionZone(t *testing.T) {
+	var applied []byte
+	f, sensor, stop := newScriptedSensor(func(cmd []byte) []byte {
+		if len(cmd) > 1 && cmd[1] == x2m200Get {
+			return applied
+		}
+		return []byte{x2m200Ack}
+	})
+	defer stop()
+	m := NewModule(f, "respiration")
+	m.Timeout = 100 * time.Millisecond
+	m.VerifyZone = true
+
+	cases := []struct {
+		start, end float64
+		applied    []byte
+		err        error
+		snapped    bool
+		zone       [2]float32
+	}{
+		// exact match
+		{0.5, 1.5, zoneReply(0.5, 1.5), nil, false, [2]float32{0.5, 1.5}},
+		// snapped within tolerance
+		{0.5, 1.5, zoneReply(0.505, 1.495), nil, false, [2]float32{0.505, 1.495}},
+		// snapped past it
+		{0.4, 2.0, zoneReply(0.46, 2.0), nil, true, [2]float32{0.46, 2.0}},
+		// the get is not recognised
+		{0.4, 2.0, []byte{errorByte, notReconsied}, ErrProtocolNotRecognised, false, [2]float32{0.4, 2.0}},
+		{0.4, 2.0, zoneReply(0.4, 2.0)[:7], errDetectionZoneReply, false, [2]float32{0.4, 2.0}},
+		{1.0, 1.0, nil, ErrInvalidDetectionZone, false, [2]float32{0.4, 2.0}},
+		{-1, 1.0, nil, ErrInvalidDetectionZone, false, [2]float32{0.4, 2.0}},
+	}
+	for n, c := range cases {
+		applied = c.applied
+		err := m.SetDetectionZone(c.start, c.end)
+		var zoneErr *DetectionZoneError
+		if c.snapped {
+			if !errors.As(err, &zoneErr) || zoneErr.AppliedStart != float64(c.zone[0]) {
+				t.Errorf("test %d Expected: zone moved to %v, got %v\n", n, c.zone, err)
+			}
+		} else if !errors.Is(err, c.err) {
+			t.Errorf("test %d Expected: %v, got %v\n", n, c.err, err)
+		}
+		if got := [2]float32{m.DetectionZoneStart, m.DetectionZoneEnd}; got != c.zone {
+			t.Errorf("test %d Expected: %v, got %v\n", n, c.zone, got)
+		}
+	}
+
+	// the id, start and end are little endian
+	want := []byte{0x10, 0x10, 0x1c, 0x0a, 0xa1, 0x96, 0x00, 0x00, 0x00, 0x3f, 0x00, 0x00, 0xc0, 0x3f}
+	if cmds := sensor.commands(); len(cmds) == 0 || !bytes.Equal(cmds[0], want) {
+		t.Errorf("Expected: %x, got %x\n", want, cmds)
+	}
+}
+
+func TestSetDetectionZoneNak(t *testing.T) {
+	f, sensor, stop := newScriptedSensor(func([]byte) []byte { return []byte{errorByte, notReconsied} })
+	defer stop()
+	m := NewModule(f, "respiration")
+	m.Timeout = 100 * time.Millisecond
+	m.VerifyZone = true
+	if err := m.SetDetectionZone(0.5, 1.5); !errors.Is(err, ErrProtocolNotRecognised) {
+		t.Errorf("Expected: %v, got %v\n", ErrProtocolNotRecognised, err)
+	}
+	// no read back after a nak
+	if cmds := sensor.commands(); len(cmds) != 1 {
+		t.Errorf("Expected: 1 command, got %x\n", cmds)
+	}
+}
+
+func TestSimulatorDetectionZone(t *testing.T) {
+	sensor := NewSimulatedSensor()
+	defer sensor.Close()
+	m := NewModule(sensor, "respiration")
+	m.Timeout = 100 * time.Millisecond
+	m.VerifyZone = true
+	if err := m.SetDetectionZone(0.5, 1.5); err != nil {
+		t.Fatal(err)
+	}
+	start, end, err := m.GetDetectionZone()
+	if err != nil || start != 0.5 || end != 1.5 {
+		t.Errorf("Expected: 0.5 1.5, got %v %v %v\n", start, end, err)
+	}
+}
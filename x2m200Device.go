@@ -0,0 +1,184 @@
+package xethru
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"time"
+)
+
+// System info command and item codes. The values are assumed and have not
+// been checked against the protocol documentation for the module, so Open
+// does not fail if the sensor does not answer them.
+// Example: <Start> + <XTS_SPC_GETSYSTEMINFO> + <Item> + <CRC> + <End>
+// Response: <Start> + <XTS_SPR_SYSTEM> + <Item> + [Value(s)] + <CRC> + <End>
+const (
+	x2m200GetSystemInfo = 0x30
+	systemInfoFirmware  = 0x02
+	systemInfoVersion   = 0x03
+	systemInfoSerial    = 0x06
+)
+
+// SystemInfo identifies a sensor and its firmware.
+type SystemInfo struct {
+	FirmwareID   string
+	Version      string
+	SerialNumber string
+}
+
+type openConfig struct {
+	timeout      time.Duration
+	resetTimeout time.Duration
+	logger       Logger
+	protocol     Protocol
+}
+
+// Option configures Open.
+type Option func(*openConfig)
+
+// WithTimeout sets the timeout of each command, the default is 500ms.
+func WithTimeout(d time.Duration) Option {
+	return func(c *openConfig) { c.timeout = d }
+}
+
+// WithResetTimeout sets how long Open waits for the sensor to be ready after
+// resetting it. The default is 5s.
+func WithResetTimeout(d time.Duration) Option {
+	return func(c *openConfig) { c.resetTimeout = d }
+}
+
+// WithLogger sets the Logger of the device and its modules.
+func WithLogger(l Logger) Option {
+	return func(c *openConfig) { c.logger = l }
+}
+
+// WithProtocol sets the message protocol spoken by the sensor, the default is
+// ProtocolX2M200.
+func WithProtocol(p Protocol) Option {
+	return func(c *openConfig) { c.protocol = p }
+}
+
+// Device is a sensor that has been opened and is ready for use. Its modules
+// share a single Dispatcher so they can be used at the same time.
+type Device struct {
+	Info SystemInfo
+
+	f        Framer
+	d        *Dispatcher
+	timeout  time.Duration
+	protocol Protocol
+}
+
+// Open creates a Framer on rw, resets the sensor and waits for it to be
+// ready, pings it and reads its system info. The error says which step
+// failed, a system info item the sensor does not answer is logged and left
+// empty in Info. Closing the Device closes rw if it is an io.Closer.
+func Open(rw io.ReadWriter, opts ...Option) (*Device, error) {
+	c := openConfig{
+		timeout:      500 * time.Millisecond,
+		resetTimeout: resetTimeout,
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	f := NewFramer(rw)
+	if c.logger != nil {
+		SetLogger(f, c.logger)
+	}
+	dev := &Device{f: f, d: NewDispatcher(f), timeout: c.timeout, protocol: c.protocol}
+	dev.d.Start()
+
+	if err := dev.open(c.resetTimeout); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return dev, nil
+}
+
+func (dev *Device) open(resetTimeout time.Duration) error {
+	_, err := dev.d.exchange([]byte{resetCmd}, resetTimeout, func(p []byte) bool {
+		return len(p) > 1 && p[0] == systemMesg && p[1] == systemReady
+	})
+	if err != nil {
+		return fmt.Errorf("open: waiting for sensor to be ready: %w", err)
+	}
+	_, err = dev.d.exchange(pingCommand(), dev.timeout, func(p []byte) bool {
+		_, err := isValidPingResponse(p)
+		return err == nil
+	})
+	if err != nil {
+		return fmt.Errorf("open: ping: %w", err)
+	}
+	for _, item := range []struct {
+		code byte
+		v    *string
+	}{
+		{systemInfoFirmware, &dev.Info.FirmwareID},
+		{systemInfoVersion, &dev.Info.Version},
+		{systemInfoSerial, &dev.Info.SerialNumber},
+	} {
+		v, err := dev.systemInfo(item.code)
+		if err != nil {
+			frameLogger(dev.f).Warnf("open: reading system info %#02x: %v", item.code, err)
+			continue
+		}
+		*item.v = v
+	}
+	return nil
+}
+
+// systemInfo reads a system info item, a string that may be null terminated.
+func (dev *Device) systemInfo(code byte) (string, error) {
+	resp, err := dev.d.exchange([]byte{x2m200GetSystemInfo, code}, dev.timeout, func(p []byte) bool {
+		return len(p) > 1 && p[0] == systemMesg && p[1] == code
+	})
+	if err != nil {
+		return "", err
+	}
+	return systemInfoValue(resp), nil
+}
+
+// systemInfoValue returns the value of a system info reply, which may be null
+// terminated.
+func systemInfoValue(resp []byte) string {
+	v := resp[2:]
+	if i := bytes.IndexByte(v, 0); i >= 0 {
+		v = v[:i]
+	}
+	return string(v)
+}
+
+// Respiration returns a Module running the respiration app.
+func (dev *Device) Respiration() *Module {
+	return dev.module("respiration")
+}
+
+// Sleep returns a Module running the sleep app.
+func (dev *Device) Sleep() *Module {
+	return dev.module("sleep")
+}
+
+// BaseBand returns a BaseBandModule receiving the device's baseband frames.
+func (dev *Device) BaseBand() *BaseBandModule {
+	b := NewBaseBandModule(dev.d)
+	b.Logger = frameLogger(dev.f)
+	b.Protocol = dev.protocol
+	return b
+}
+
+func (dev *Device) module(mode string) *Module {
+	m := NewModuleDispatcher(dev.d, mode)
+	m.Timeout = dev.timeout
+	m.Protocol = dev.protocol
+	return m
+}
+
+// Dispatcher returns the Dispatcher shared by the device's modules.
+func (dev *Device) Dispatcher() *Dispatcher {
+	return dev.d
+}
+
+// Close closes the transport.
+func (dev *Device) Close() error {
+	return dev.f.Close()
+}
@@ -0,0 +1,124 @@
+package xethru
+
+import (
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// simConn returns the raw transport to s. If notReady is set the sensor
+// never reports that it is ready.
+func simConn(s *SimulatedSensor, notReady bool) net.Conn {
+	host, sensor := net.Pipe()
+	go func() {
+		defer s.Close()
+		a := NewAssembler()
+		b := make([]byte, 512)
+		for {
+			n, err := sensor.Read(b)
+			if err != nil {
+				return
+			}
+			a.Write(b[:n])
+			for p, err := a.Next(); p != nil || err != nil; p, err = a.Next() {
+				if p != nil {
+					s.Write(p)
+				}
+			}
+		}
+	}()
+	go func() {
+		defer sensor.Close()
+		b := make([]byte, readBufferSize)
+		for {
+			n, err := s.Read(b)
+			p := b[:n]
+			var sensorErr *SensorError
+			switch {
+			case errors.As(err, &sensorErr):
+				p = []byte{errorByte, sensorErr.Code}
+			case err == io.EOF:
+				return
+			case err != nil:
+				continue
+			}
+			if notReady && len(p) > 1 && p[0] == systemMesg && p[1] == systemReady {
+				continue
+			}
+			if _, err := sensor.Write(EncodeFrame(p)); err != nil {
+				return
+			}
+		}
+	}()
+	return host
+}
+
+func TestOpen(t *testing.T) {
+	sensor := NewSimulatedSensor()
+	sensor.Interval = time.Millisecond
+	dev, err := Open(simConn(sensor, false), WithResetTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dev.Close()
+	want := SystemInfo{FirmwareID: "X2M200-SIM", Version: "1.0.0", SerialNumber: "000000"}
+	if dev.Info != want {
+		t.Errorf("Expected: %+v, got %+v\n", want, dev.Info)
+	}
+
+	resp := dev.Respiration()
+	if err := resp.Load(); err != nil {
+		t.Error(err)
+	}
+	if err := resp.Enable("iq"); err != nil {
+		t.Error(err)
+	}
+	bb := make(chan interface{}, 10)
+	go dev.BaseBand().Run(bb)
+	stream := make(chan interface{}, 10)
+	go resp.Run(stream)
+
+	timeout := time.After(2 * time.Second)
+	var gotResp, gotIQ bool
+	for !gotResp || !gotIQ {
+		select {
+		case d := <-stream:
+			_, ok := d.(Respiration)
+			gotResp = gotResp || ok
+		case d := <-bb:
+			_, ok := d.(BaseBandIQ)
+			gotIQ = gotIQ || ok
+		case <-timeout:
+			t.Fatalf("Expected: respiration and baseband frames, got %v %v\n", gotResp, gotIQ)
+		}
+	}
+}
+
+func TestOpenNotReady(t *testing.T) {
+	sensor := NewSimulatedSensor()
+	_, err := Open(simConn(sensor, true), WithResetTimeout(100*time.Millisecond))
+	if !errors.Is(err, ErrCommandTimeout) {
+		t.Errorf("Expected: %v, got %v\n", ErrCommandTimeout, err)
+	}
+	if err == nil || !strings.Contains(err.Error(), "ready") {
+		t.Errorf("Expected: error to say the sensor was not ready, got %v\n", err)
+	}
+}
+
+func TestOpenNoSystemInfo(t *testing.T) {
+	sensor := NewSimulatedSensor()
+	sensor.Reject = func(cmd []byte) bool {
+		return cmd[0] == x2m200GetSystemInfo
+	}
+	dev, err := Open(simConn(sensor, false), WithResetTimeout(time.Second))
+	if err != nil {
+		t.Fatalf("Expected: Open to succeed without system info, got %v\n", err)
+	}
+	defer dev.Close()
+	if dev.Info != (SystemInfo{}) {
+		t.Errorf("Expected: empty system info, got %+v\n", dev.Info)
+	}
+}
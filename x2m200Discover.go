@@ -0,0 +1,148 @@
+package xethru
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PortInfo describes a serial port found by DiscoverSerial.
+type PortInfo struct {
+	Name  string // device path, eg /dev/ttyACM0
+	VID   string // usb vendor id if known
+	PID   string // usb product id if known
+	Found bool   // answered a ping with a valid response
+	Ready bool   // the ping response said the sensor is ready
+}
+
+// PortEnumerator lists and opens candidate serial ports.
+type PortEnumerator interface {
+	Ports() ([]PortInfo, error)
+	Open(name string) (io.ReadWriteCloser, error)
+}
+
+// probeTimeout is how long each port has to answer a ping.
+const probeTimeout = 500 * time.Millisecond
+
+// DiscoverSerial pings every candidate serial port on the system and returns
+// them all, with Found set on those that answered like a xethru module. Ports
+// are probed concurrently and closed again before it returns, which is no
+// later than when ctx is done.
+func DiscoverSerial(ctx context.Context) ([]PortInfo, error) {
+	return DiscoverSerialWith(ctx, systemPorts{})
+}
+
+// DiscoverSerialWith is DiscoverSerial using e to find and open ports.
+func DiscoverSerialWith(ctx context.Context, e PortEnumerator) ([]PortInfo, error) {
+	ports, err := e.Ports()
+	if err != nil {
+		return nil, err
+	}
+	var wg sync.WaitGroup
+	for i := range ports {
+		wg.Add(1)
+		go func(p *PortInfo) {
+			defer wg.Done()
+			p.Found, p.Ready = probe(ctx, e, p.Name)
+		}(&ports[i])
+	}
+	wg.Wait()
+	return ports, ctx.Err()
+}
+
+// probe opens name, pings it and closes it.
+func probe(ctx context.Context, e PortEnumerator, name string) (found, ready bool) {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	rwc, err := e.Open(name)
+	if err != nil {
+		return false, false
+	}
+	f := NewFramer(rwc)
+
+	type result struct{ found, ready bool }
+	done := make(chan result, 1)
+	go func() {
+		seed := make([]byte, 4)
+		binary.BigEndian.PutUint32(seed, x2m200PingSeed)
+		if _, err := f.Write(append([]byte{x2m200PingCommand}, seed...)); err != nil {
+			done <- result{}
+			return
+		}
+		b := make([]byte, readBufferSize)
+		for {
+			n, err := f.Read(b)
+			if err != nil {
+				if isTransportErr(err) {
+					done <- result{}
+					return
+				}
+				continue
+			}
+			if n < 5 {
+				continue
+			}
+			if ready, err := isValidPingResponse(b[:n]); err == nil {
+				done <- result{true, ready}
+				return
+			}
+		}
+	}()
+	select {
+	case r := <-done:
+		f.Close()
+		return r.found, r.ready
+	case <-ctx.Done():
+		// closing unblocks the write or read
+		f.Close()
+		<-done
+		return false, false
+	}
+}
+
+// systemPorts finds usb serial ports by their device names, on linux the usb
+// vendor and product ids are read from sysfs.
+type systemPorts struct{}
+
+var serialPortPatterns = []string{
+	"/dev/ttyACM*",
+	"/dev/ttyUSB*",
+	"/dev/tty.usbmodem*",
+	"/dev/tty.usbserial*",
+}
+
+func (systemPorts) Ports() ([]PortInfo, error) {
+	var ports []PortInfo
+	for _, pattern := range serialPortPatterns {
+		names, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			p := PortInfo{Name: name}
+			usb := filepath.Join("/sys/class/tty", filepath.Base(name), "device", "..")
+			p.VID = readSysfs(filepath.Join(usb, "idVendor"))
+			p.PID = readSysfs(filepath.Join(usb, "idProduct"))
+			ports = append(ports, p)
+		}
+	}
+	return ports, nil
+}
+
+func (systemPorts) Open(name string) (io.ReadWriteCloser, error) {
+	return os.OpenFile(name, os.O_RDWR, 0)
+}
+
+func readSysfs(name string) string {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
@@ -0,0 +1,111 @@
+package xethru
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// silentConn accepts writes and never answers.
+type silentConn struct {
+	once   sync.Once
+	closed chan struct{}
+}
+
+func (c *silentConn) Read(b []byte) (int, error) {
+	<-c.closed
+	return 0, io.EOF
+}
+
+func (c *silentConn) Write(b []byte) (int, error) { return len(b), nil }
+
+func (c *silentConn) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return nil
+}
+
+// countingConn counts Close calls.
+type countingConn struct {
+	io.ReadWriteCloser
+	e *fakeEnumerator
+}
+
+func (c countingConn) Close() error {
+	c.e.mu.Lock()
+	c.e.closed++
+	c.e.mu.Unlock()
+	return c.ReadWriteCloser.Close()
+}
+
+type fakeEnumerator struct {
+	mu      sync.Mutex
+	opened  int
+	closed  int
+	sensors []*SimulatedSensor
+}
+
+func (e *fakeEnumerator) Ports() ([]PortInfo, error) {
+	return []PortInfo{
+		{Name: "sensor", VID: "03eb", PID: "2404"},
+		{Name: "silent"},
+		{Name: "missing"},
+	}, nil
+}
+
+func (e *fakeEnumerator) Open(name string) (io.ReadWriteCloser, error) {
+	var rwc io.ReadWriteCloser
+	switch name {
+	case "sensor":
+		s := NewSimulatedSensor()
+		e.mu.Lock()
+		e.sensors = append(e.sensors, s)
+		e.mu.Unlock()
+		rwc = simConn(s, false)
+	case "silent":
+		rwc = &silentConn{closed: make(chan struct{})}
+	default:
+		return nil, errors.New("no such port")
+	}
+	e.mu.Lock()
+	e.opened++
+	e.mu.Unlock()
+	return countingConn{rwc, e}, nil
+}
+
+func TestDiscoverSerial(t *testing.T) {
+	e := &fakeEnumerator{}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	ports, err := DiscoverSerialWith(ctx, e)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected: discovery bounded by context, took %v\n", elapsed)
+	}
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected: %v, got %v\n", context.DeadlineExceeded, err)
+	}
+	for _, s := range e.sensors {
+		s.Close()
+	}
+
+	want := []PortInfo{
+		{Name: "sensor", VID: "03eb", PID: "2404", Found: true, Ready: true},
+		{Name: "silent"},
+		{Name: "missing"},
+	}
+	if len(ports) != len(want) {
+		t.Fatalf("Expected: %d ports, got %d\n", len(want), len(ports))
+	}
+	for i := range want {
+		if ports[i] != want[i] {
+			t.Errorf("test %d Expected: %+v, got %+v\n", i, want[i], ports[i])
+		}
+	}
+	if e.opened != e.closed {
+		t.Errorf("Expected: %d ports closed, got %d\n", e.opened, e.closed)
+	}
+}
@@ -0,0 +1,417 @@
+package xethru
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// FrameType identifies the kind of payload read from the sensor.
+type FrameType byte
+
+// Frame types used to route payloads with a Dispatcher
+const (
+	FrameUnknown FrameType = iota
+	FrameRespiration
+	FrameSleep
+	FrameBaseBandAmpPhase
+	FrameBaseBandIQ
+	FrameAck
+	FrameError
+	FrameSystem
+	FramePresence     // X4M300 presence messages
+	FrameData         // X4 data responses
+	frameMovingList   // sleep app movinglist messages
+	framePulseDoppler // X4 pulse-doppler and noise map messages
+)
+
+// AppDataFrames are the frame types that carry app data.
+var AppDataFrames = []FrameType{FrameRespiration, FrameSleep, FrameBaseBandAmpPhase, FrameBaseBandIQ, FramePresence, FrameData, frameMovingList, framePulseDoppler}
+
+// Frame is a payload read from the sensor. Protocol errors reported by the
+// sensor are delivered as a FrameError with Err set. If the Dispatcher has a
+// ParsePool app data frames arrive already parsed, with the result in Data or
+// the error in ParseErr.
+type Frame struct {
+	Type     FrameType
+	Payload  []byte
+	Err      error
+	Data     interface{}
+	ParseErr error
+}
+
+// frameType classifies a de-framed payload by its first byte(s).
+func frameType(b []byte) FrameType {
+	if len(b) == 0 {
+		return FrameUnknown
+	}
+	switch b[0] {
+	case appDataByte:
+		if len(b) < 2 {
+			return FrameUnknown
+		}
+		if kind, ok := basebandKind(b); ok {
+			return kind.FrameType()
+		}
+		switch b[1] {
+		case respirationStartByte:
+			return FrameRespiration
+		case sleepStartByte:
+			return FrameSleep
+		case presenceSingleStartByte, presenceMovingListStartByte:
+			return FramePresence
+		case movingListStartByte:
+			return frameMovingList
+		case pulseDopplerStartByte, noiseMapStartByte:
+			return framePulseDoppler
+		}
+	case ack:
+		return FrameAck
+	case errorByte:
+		return FrameError
+	case systemMesg:
+		return FrameSystem
+	case dataResponse:
+		return FrameData
+	}
+	return FrameUnknown
+}
+
+type subscriber struct {
+	types map[FrameType]bool
+	c     chan Frame
+}
+
+// call is a command waiting for its response.
+type call struct {
+	gen     uint64 // sequence number of the command
+	match   func([]byte) bool
+	done    chan Frame
+	replied bool      // a reply that was not the response, such as an ack, was seen
+	expires time.Time // when an abandoned call's response is no longer expected
+}
+
+// staleWindow is how long after a command times out its response is still
+// expected, and will be dropped rather than taken as the response to a later
+// command.
+const staleWindow = 2 * time.Second
+
+// Dispatcher owns the read side of a Framer and routes each frame, by type,
+// to every subscriber of that type. Frames are delivered in the order they
+// are read. A subscriber whose channel is full misses the frame rather than
+// blocking the others. A frame that completes a pending command is given to
+// that command instead of the subscribers.
+type Dispatcher struct {
+	f Framer
+
+	mu   sync.RWMutex
+	subs []subscriber
+
+	callMu    sync.Mutex // held for the whole of each command, one at a time
+	pendingMu sync.Mutex
+	pending   *call
+	queue     []*call // pipelined commands waiting behind pending, see pipeline
+	gen       uint64
+	abandoned []*call // timed out commands, oldest first
+	stale     uint64  // responses to abandoned commands that were dropped
+
+	pool    chan<- parseJob // nil unless SetParsePool was called
+	parse   func(Frame) (interface{}, error)
+	parsing sync.WaitGroup // frames handed to the pool and not yet dispatched
+
+	outputMu     sync.Mutex
+	outputs      map[uint32]bool // messages set with setOutputControl
+	outputWarned map[uint32]bool
+
+	resetAt atomic.Int64 // when the sensor was last reset through the Dispatcher, in unix nanoseconds
+
+	once sync.Once
+	done chan struct{}
+	err  error
+}
+
+// NewDispatcher creates a Dispatcher reading from f, call Start to begin
+// reading.
+func NewDispatcher(f Framer) *Dispatcher {
+	return &Dispatcher{f: f, done: make(chan struct{})}
+}
+
+// Subscribe returns a channel, with room for buffer frames, that receives
+// every frame of the given types. The channel is closed when the Dispatcher
+// stops.
+func (d *Dispatcher) Subscribe(buffer int, types ...FrameType) <-chan Frame {
+	s := subscriber{types: make(map[FrameType]bool), c: make(chan Frame, buffer)}
+	for _, t := range types {
+		s.types[t] = true
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	select {
+	case <-d.done:
+		close(s.c)
+	default:
+		d.subs = append(d.subs, s)
+	}
+	return s.c
+}
+
+// Start starts the read loop, it is safe to call more than once.
+func (d *Dispatcher) Start() {
+	d.once.Do(func() {
+		go d.run()
+	})
+}
+
+// Done is closed when the read loop stops because the transport has closed.
+func (d *Dispatcher) Done() <-chan struct{} {
+	return d.done
+}
+
+// Err returns the error that stopped the read loop.
+func (d *Dispatcher) Err() error {
+	select {
+	case <-d.done:
+		return d.err
+	default:
+		return nil
+	}
+}
+
+func (d *Dispatcher) run() {
+	defer func() {
+		// frames still with the pool are dispatched before the
+		// subscriber channels close
+		d.parsing.Wait()
+		d.stop()
+	}()
+	for {
+		p, err := readPayload(d.f)
+		if err != nil {
+			switch {
+			case err == io.EOF, err == io.ErrUnexpectedEOF, err == io.ErrClosedPipe:
+				d.err = err
+				return
+			case errors.Is(err, ErrProtocol):
+				d.handOff(Frame{Type: FrameError, Err: err})
+			case isTimeout(err):
+				// a read deadline set by someone else
+			case isTransportErr(err):
+				// the transport has failed, reading again would spin
+				d.err = err
+				return
+			default:
+				frameLogger(d.f).Warnf("%v", err)
+			}
+			continue
+		}
+		d.handOff(Frame{Type: frameType(p), Payload: p})
+	}
+}
+
+// StaleResponses returns the number of responses that arrived after their
+// command had timed out and were dropped.
+func (d *Dispatcher) StaleResponses() uint64 {
+	d.pendingMu.Lock()
+	defer d.pendingMu.Unlock()
+	return d.stale
+}
+
+// exchange writes cmd and waits up to timeout for a response that matches,
+// or an error reply. The protocol has no sequence numbers so only one command
+// is outstanding at a time, others wait their turn. Frames that do not match
+// are dispatched as normal.
+//
+// The sensor answers commands in order, so if a command times out the next
+// frame that would match it is taken to be its late response and dropped,
+// unless it arrives more than staleWindow later.
+func (d *Dispatcher) exchange(cmd []byte, timeout time.Duration, match func([]byte) bool) ([]byte, error) {
+	if timeout <= 0 {
+		timeout = 500 * time.Millisecond
+	}
+	if isResetCommand(cmd) {
+		d.markReset()
+	}
+	return d.exchangeFunc(context.Background(), func() error {
+		// a wedged transport can block the write forever, the response
+		// is waited for below
+		if dl := frameDeadliner(d.f); dl != nil {
+			dl.SetWriteDeadline(time.Now().Add(timeout))
+			defer dl.SetWriteDeadline(time.Time{})
+		}
+		_, err := d.f.Write(cmd)
+		return err
+	}, timeout, match)
+}
+
+// exchangeFunc is exchange with the command sent by send, which need not
+// write to the sensor, a hardware reset releases the reset line instead. It
+// also stops waiting when ctx is done, returning ctx.Err().
+func (d *Dispatcher) exchangeFunc(ctx context.Context, send func() error, timeout time.Duration, match func([]byte) bool) ([]byte, error) {
+	d.callMu.Lock()
+	defer d.callMu.Unlock()
+
+	c := &call{match: match, done: make(chan Frame, 1)}
+	d.pendingMu.Lock()
+	d.gen++
+	c.gen = d.gen
+	d.pending = c
+	d.pendingMu.Unlock()
+	defer func() {
+		d.pendingMu.Lock()
+		if d.pending == c {
+			d.pending = nil
+		}
+		d.pendingMu.Unlock()
+	}()
+
+	if timeout <= 0 {
+		timeout = 500 * time.Millisecond
+	}
+	if err := send(); err != nil {
+		return nil, err
+	}
+
+	resp, err := d.await(ctx, c, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Err != nil {
+		return nil, resp.Err
+	}
+	return resp.Payload, nil
+}
+
+// await waits up to timeout, or until ctx is done, for the response to c, an
+// error is only returned if there was none.
+func (d *Dispatcher) await(ctx context.Context, c *call, timeout time.Duration) (Frame, error) {
+	timer := clock().NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case resp := <-c.done:
+		return resp, nil
+	case <-d.done:
+		if err := d.Err(); err != nil {
+			return Frame{}, err
+		}
+		return Frame{}, ErrConnectionClosed
+	case <-timer.C():
+		if !d.abandon(c) {
+			// the response arrived as the timer fired
+			return <-c.done, nil
+		}
+		return Frame{}, ErrCommandTimeout
+	case <-ctx.Done():
+		if !d.abandon(c) {
+			return <-c.done, nil
+		}
+		return Frame{}, ctx.Err()
+	}
+}
+
+// abandon stops waiting for c, it reports false if c has already been
+// completed.
+func (d *Dispatcher) abandon(c *call) bool {
+	d.pendingMu.Lock()
+	defer d.pendingMu.Unlock()
+	if d.pending != c {
+		return false
+	}
+	d.pending = nil
+	c.expires = clock().Now().Add(staleWindow)
+	d.abandoned = append(d.abandoned, c)
+	// the responses to pipelined commands written after c are still coming
+	for _, q := range d.queue {
+		q.expires = c.expires
+		d.abandoned = append(d.abandoned, q)
+	}
+	d.queue = nil
+	return true
+}
+
+// forgetAbandoned stops expecting the responses to commands that timed out,
+// after a hardware reset they will never arrive.
+func (d *Dispatcher) forgetAbandoned() {
+	d.pendingMu.Lock()
+	d.abandoned = nil
+	d.pendingMu.Unlock()
+}
+
+// dropStale reports whether f is the late response to an abandoned command,
+// d.pendingMu must be held.
+func (d *Dispatcher) dropStale(f Frame) bool {
+	now := clock().Now()
+	for len(d.abandoned) > 0 && now.After(d.abandoned[0].expires) {
+		d.abandoned = d.abandoned[1:]
+	}
+	if len(d.abandoned) == 0 {
+		return false
+	}
+	c := d.abandoned[0]
+	// a command that has had a reply, such as the ack to a reset, was not
+	// refused so an error is not for it
+	if f.Type == FrameError && c.replied || f.Type != FrameError && !c.match(f.Payload) {
+		return false
+	}
+	d.abandoned = d.abandoned[1:]
+	d.stale++
+	frameLogger(d.f).Debugf("dropped late response to command %d: %x", c.gen, f.Payload)
+	return true
+}
+
+// complete gives f to the pending command if it is the response, or drops
+// it if it is the response to an abandoned command. It reports whether f was
+// used.
+func (d *Dispatcher) complete(f Frame) bool {
+	d.pendingMu.Lock()
+	defer d.pendingMu.Unlock()
+	if d.dropStale(f) {
+		return true
+	}
+	c := d.pending
+	if c == nil {
+		return false
+	}
+	if f.Type != FrameError && !c.match(f.Payload) {
+		if f.Type == FrameAck || f.Type == FrameSystem {
+			c.replied = true
+		}
+		return false
+	}
+	c.done <- f
+	d.pending = nil
+	if len(d.queue) > 0 {
+		d.pending, d.queue = d.queue[0], d.queue[1:]
+	}
+	return true
+}
+
+func (d *Dispatcher) dispatch(f Frame) {
+	if d.complete(f) {
+		return
+	}
+	d.checkOutput(f.Payload)
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, s := range d.subs {
+		if !s.types[f.Type] {
+			continue
+		}
+		select {
+		case s.c <- f:
+		default:
+		}
+	}
+}
+
+func (d *Dispatcher) stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	close(d.done)
+	for _, s := range d.subs {
+		close(s.c)
+	}
+	d.subs = nil
+}
@@ -0,0 +1,171 @@
+package xethru
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestDispatcherRouting(t *testing.T) {
+	var wire []byte
+	var expected []FrameType
+	for i := 0; i < 5; i++ {
+		wire = append(wire, encodeFrame(respirationPayload)...)
+		wire = append(wire, encodeFrame(buildIQPayload(uint32(i), 4))...)
+		wire = append(wire, encodeFrame([]byte{x2m200Ack})...)
+		expected = append(expected, FrameRespiration, FrameBaseBandIQ, FrameAck)
+	}
+	wire = append(wire, encodeFrame([]byte{systemMesg, systemReady})...)
+	wire = append(wire, 0x7d, 0x20, 0x03, 0x5e, 0x7e)
+
+	d := NewDispatcher(CreateSplitReadWriter(io.Discard, bytes.NewReader(wire)))
+	resp := d.Subscribe(100, FrameRespiration)
+	iq := d.Subscribe(100, FrameBaseBandIQ)
+	acks := d.Subscribe(100, FrameAck, FrameSystem, FrameError)
+	all := d.Subscribe(100, append(AppDataFrames, FrameAck)...)
+	d.Start()
+	<-d.Done()
+	if d.Err() != io.EOF {
+		t.Errorf("Expected: %v, got %v\n", io.EOF, d.Err())
+	}
+
+	n := 0
+	for f := range resp {
+		if f.Type != FrameRespiration {
+			t.Errorf("Expected: respiration, got %v\n", f.Type)
+		}
+		n++
+	}
+	if n != 5 {
+		t.Errorf("Expected: 5 respiration frames, got %d\n", n)
+	}
+
+	n = 0
+	for f := range iq {
+		b, err := parseBaseBandIQ(f.Payload)
+		if err != nil || b.Counter != uint32(n) {
+			t.Errorf("Expected: iq frame %d, got %d %v\n", n, b.Counter, err)
+		}
+		n++
+	}
+	if n != 5 {
+		t.Errorf("Expected: 5 iq frames, got %d\n", n)
+	}
+
+	var types []FrameType
+	var lastErr error
+	for f := range acks {
+		types = append(types, f.Type)
+		lastErr = f.Err
+	}
+	if len(types) != 7 || types[5] != FrameSystem || types[6] != FrameError || !errors.Is(lastErr, ErrProtocolInvalidAppID) {
+		t.Errorf("Expected: 5 acks, a system message and an error, got %v %v\n", types, lastErr)
+	}
+
+	n = 0
+	for f := range all {
+		if n >= len(expected) || f.Type != expected[n] {
+			t.Fatalf("frame %d out of order, got %v\n", n, f.Type)
+		}
+		n++
+	}
+	if n != len(expected) {
+		t.Errorf("Expected: %d frames, got %d\n", len(expected), n)
+	}
+
+	if _, ok := <-d.Subscribe(1, FrameAck); ok {
+		t.Error("Expected: subscribing to a stopped dispatcher to return a closed channel")
+	}
+}
+
+func TestBaseBandModule(t *testing.T) {
+	var wire []byte
+	for i := 0; i < 3; i++ {
+		wire = append(wire, encodeFrame(buildIQPayload(uint32(i), 4))...)
+		wire = append(wire, encodeFrame(respirationPayload)...)
+	}
+	d := NewDispatcher(CreateSplitReadWriter(io.Discard, bytes.NewReader(wire)))
+	b := NewBaseBandModule(d)
+	stream := make(chan interface{}, 10)
+	b.Run(stream)
+	close(stream)
+
+	n := 0
+	for data := range stream {
+		iq, ok := data.(BaseBandIQ)
+		if !ok || iq.Counter != uint32(n) {
+			t.Errorf("Expected: iq frame %d, got %#v\n", n, data)
+		}
+		n++
+	}
+	if n != 3 {
+		t.Errorf("Expected: 3 frames, got %d\n", n)
+	}
+}
+
+func TestDispatcherExchange(t *testing.T) {
+	sensor := NewSimulatedSensor()
+	defer sensor.Close()
+	d := NewDispatcher(sensor)
+	system := d.Subscribe(10, FrameAck, FrameSystem)
+	d.Start()
+
+	// the reset ack and booting message are not the response
+	resp, err := d.exchange([]byte{resetCmd}, time.Second, func(p []byte) bool {
+		return len(p) > 1 && p[0] == systemMesg && p[1] == systemReady
+	})
+	if err != nil || len(resp) != 2 || resp[1] != systemReady {
+		t.Errorf("Expected: %x, got %x %v\n", []byte{systemMesg, systemReady}, resp, err)
+	}
+	if len(system) != 2 {
+		t.Fatalf("Expected: %d unmatched frames, got %d\n", 2, len(system))
+	}
+	if f := <-system; f.Type != FrameAck {
+		t.Errorf("Expected: %v, got %v\n", FrameAck, f.Type)
+	}
+	if f := <-system; f.Type != FrameSystem || f.Payload[1] != systemBooting {
+		t.Errorf("Expected: booting, got %x\n", f.Payload)
+	}
+
+	if _, err := d.exchange([]byte{0x42}, time.Second, func(p []byte) bool { return true }); !errors.Is(err, ErrProtocolNotRecognised) {
+		t.Errorf("Expected: %v, got %v\n", ErrProtocolNotRecognised, err)
+	}
+}
+
+func TestDispatcherStaleResponse(t *testing.T) {
+	sensor := NewSimulatedSensor()
+	sensor.AckDelay = 100 * time.Millisecond
+	defer sensor.Close()
+	d := NewDispatcher(sensor)
+	d.Start()
+
+	isAck := func(p []byte) bool { return len(p) > 0 && p[0] == x2m200Ack }
+	// the error reply to this arrives after it has timed out
+	if _, err := d.exchange([]byte{0x42}, 50*time.Millisecond, isAck); err != ErrCommandTimeout {
+		t.Fatalf("Expected: %v, got %v\n", ErrCommandTimeout, err)
+	}
+	resp, err := d.exchange([]byte{x2m200SetLEDControl, 0x02, 0x00}, time.Second, isAck)
+	if err != nil || !bytes.Equal(resp, []byte{x2m200Ack}) {
+		t.Errorf("Expected: %x, got %x %v\n", []byte{x2m200Ack}, resp, err)
+	}
+	if got := d.StaleResponses(); got != 1 {
+		t.Errorf("Expected: %d stale responses, got %d\n", 1, got)
+	}
+
+	// a late ack is not taken by the next ack'ed command either
+	if _, err := d.exchange([]byte{x2m200SetLEDControl, 0x02, 0x00}, 50*time.Millisecond, isAck); err != ErrCommandTimeout {
+		t.Fatalf("Expected: %v, got %v\n", ErrCommandTimeout, err)
+	}
+	start := time.Now()
+	if _, err := d.exchange([]byte{x2m200SetLEDControl, 0x02, 0x00}, time.Second, isAck); err != nil {
+		t.Error(err)
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("Expected: to wait for its own ack, returned after %v\n", elapsed)
+	}
+	if got := d.StaleResponses(); got != 2 {
+		t.Errorf("Expected: %d stale responses, got %d\n", 2, got)
+	}
+}
@@ -0,0 +1,50 @@
+package xethru
+
+// frameCounter returns the Counter of a parsed frame, ok is false for frames
+// without one.
+func frameCounter(data interface{}) (counter uint32, ok bool) {
+	switch d := data.(type) {
+	case Respiration:
+		return d.Counter, true
+	case Sleep:
+		return d.Counter, true
+	case BaseBandIQ:
+		return d.Counter, true
+	case BaseBandAmpPhase:
+		return d.Counter, true
+	case movingList:
+		return d.Counter, true
+	case PresenceSingle:
+		return d.Counter, true
+	case PresenceMovingList:
+		return d.Counter, true
+	}
+	return 0, false
+}
+
+// duplicate reports whether data has the same Counter as the previous frame
+// of type t, as happens when a frame is delivered twice. Only equal counters
+// are duplicates, so gaps and the wrap from 2^32-1 to 0 are passed.
+func (r *Module) duplicate(t FrameType, data interface{}) bool {
+	counter, ok := frameCounter(data)
+	if !ok {
+		return false
+	}
+	if r.lastCounter == nil {
+		r.lastCounter = make(map[FrameType]uint32)
+	}
+	last, seen := r.lastCounter[t]
+	r.lastCounter[t] = counter
+	if !seen || last != counter {
+		return false
+	}
+	r.duplicates.Add(1)
+	r.metrics().Counter(MetricDuplicateFrames, 1)
+	r.log().Debugf("dropped duplicate frame %d", counter)
+	return true
+}
+
+// DuplicateFrames returns the number of frames Run dropped as duplicates.
+func (r *Module) DuplicateFrames() uint64 {
+	return r.duplicates.Load()
+}
@@ -0,0 +1,63 @@
+package xethru
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDropDuplicates(t *testing.T) {
+	resp := func(counter uint32) []byte {
+		b := append([]byte(nil), respirationPayload...)
+		binary.LittleEndian.PutUint32(b[5:9], counter)
+		return b
+	}
+	payloads := [][]byte{
+		resp(1), resp(1), resp(2),
+		// another message type keeps its own counter
+		buildIQPayload(2, 4),
+		resp(2), resp(5), resp(5), resp(4),
+		resp(0xffffffff), resp(0), resp(0), resp(1),
+	}
+	var session []byte
+	for _, p := range payloads {
+		session = append(session, encodeFrame(p)...)
+	}
+
+	cases := []struct {
+		drop       bool
+		counters   []uint32
+		duplicates uint64
+	}{
+		{false, []uint32{1, 1, 2, 2, 2, 5, 5, 4, 0xffffffff, 0, 0, 1}, 0},
+		{true, []uint32{1, 2, 2, 5, 4, 0xffffffff, 0, 1}, 4},
+	}
+	for n, c := range cases {
+		sink := &fakeMetrics{values: make(map[string]float64)}
+		m := NewModule(CreateSplitReadWriter(io.Discard, bytes.NewReader(session)), "respiration")
+		m.Timeout = 10 * time.Millisecond
+		m.Metrics = sink
+		m.DropDuplicates = c.drop
+		stream := make(chan interface{}, len(payloads))
+		m.Run(stream)
+		close(stream)
+
+		var counters []uint32
+		for data := range stream {
+			counter, _ := frameCounter(data)
+			counters = append(counters, counter)
+		}
+		if !reflect.DeepEqual(counters, c.counters) {
+			t.Errorf("test %d Expected: %v, got %v\n", n, c.counters, counters)
+		}
+		if got := m.DuplicateFrames(); got != c.duplicates {
+			t.Errorf("test %d Expected: %d duplicates, got %d\n", n, c.duplicates, got)
+		}
+		if got := sink.values[MetricDuplicateFrames]; got != float64(c.duplicates) {
+			t.Errorf("test %d Expected: %d duplicates metric, got %v\n", n, c.duplicates, got)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package xethru
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/NeuralSpaz/xethru/protocol"
+)
+
+// ErrProtocol is wrapped by every protocol error reported by the sensor.
+var ErrProtocol = errors.New("protocol error")
+
+// ErrParse is wrapped by every error returned while parsing a payload.
+var ErrParse = protocol.ErrParse
+
+// SensorError is an error reply from the sensor, it wraps ErrProtocol.
+type SensorError struct {
+	Code byte
+}
+
+var sensorErrorMessages = map[byte]string{
+	notReconsied: "command not recognised",
+	crcFailed:    "command bad crc",
+	invaidAppID:  "invalid app id",
+}
+
+// Message returns a human readable description of the error code.
+func (e *SensorError) Message() string {
+	if m, ok := sensorErrorMessages[e.Code]; ok {
+		return m
+	}
+	return "unknown error"
+}
+
+func (e *SensorError) Error() string {
+	return fmt.Sprintf("%v %s (code %#02x)", ErrProtocol, e.Message(), e.Code)
+}
+
+// Unwrap returns ErrProtocol.
+func (e *SensorError) Unwrap() error {
+	return ErrProtocol
+}
+
+// Is reports whether target is a SensorError with the same code.
+func (e *SensorError) Is(target error) bool {
+	t, ok := target.(*SensorError)
+	return ok && t.Code == e.Code
+}
+
+// CRCError is returned when a frame fails its checksum, it wraps
+// ErrPacketBadCRC.
+type CRCError struct {
+	Expected byte // crc calculated from the frame
+	Got      byte // crc sent in the frame
+}
+
+func (e *CRCError) Error() string {
+	return fmt.Sprintf("%v: expected %#02x, got %#02x", ErrPacketBadCRC, e.Expected, e.Got)
+}
+
+// Unwrap returns ErrPacketBadCRC.
+func (e *CRCError) Unwrap() error {
+	return ErrPacketBadCRC
+}
+
+// FramingError is returned when the byte stream does not contain a well formed
+// frame. Offset is the position in the byte stream of the offending byte.
+type FramingError struct {
+	Reason error
+	Offset int64
+}
+
+func (e *FramingError) Error() string {
+	return fmt.Sprintf("%v at offset %d", e.Reason, e.Offset)
+}
+
+// Unwrap returns the Reason.
+func (e *FramingError) Unwrap() error {
+	return e.Reason
+}
+
+// LengthError is returned by the parsers when a payload is the wrong length.
+type LengthError = protocol.LengthError
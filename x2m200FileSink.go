@@ -0,0 +1,197 @@
+package xethru
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileFormat is the format of the files a FileSink writes.
+type FileFormat int
+
+// File formats
+const (
+	FileNDJSON FileFormat = iota // a frame per line encoded as JSON
+	FileBinary                   // frames as written by WriteFrameTo
+)
+
+// partSuffix is added to the name of the file a FileSink is writing until it
+// is rotated or closed.
+const partSuffix = ".part"
+
+// ErrSinkClosed is returned by a FileSink once it has been closed.
+var ErrSinkClosed = errors.New("sink closed")
+
+var errSinkFrameType = errors.New("sink does not store the type")
+
+// FileSink is a Sink that writes frames to files in a directory, starting a
+// new file when the one being written reaches MaxSize or MaxAge, checked as
+// each frame is written. Files are named after the prefix, the time they
+// were started and a sequence number. The file being written has a ".part"
+// suffix, when it is rotated or the sink closed it is synced to disk and
+// renamed without it, so a file without the suffix is always complete. A
+// ".part" file left by a crash holds the frames written up to the last
+// Flush, its last frame may be cut short. A FileSink is safe for concurrent
+// use.
+type FileSink struct {
+	MaxSize int64         // bytes a file may grow to before it is rotated, zero is 64 MiB
+	MaxAge  time.Duration // how long a file is written before it is rotated, zero is one hour
+
+	dir    string
+	prefix string
+	format FileFormat
+
+	mu     sync.Mutex
+	f      *os.File
+	w      *bufio.Writer
+	name   string // of the file being written, without partSuffix
+	size   int64
+	opened time.Time
+	seq    int
+	buf    bytes.Buffer
+	closed bool
+}
+
+// NewFileSink creates dir, if it does not exist, and returns a FileSink
+// writing files in format to it named after prefix, "frames" if it is empty.
+func NewFileSink(dir, prefix string, format FileFormat) (*FileSink, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	if prefix == "" {
+		prefix = "frames"
+	}
+	return &FileSink{dir: dir, prefix: prefix, format: format}, nil
+}
+
+// WriteRespiration writes r.
+func (s *FileSink) WriteRespiration(r Respiration) error {
+	return s.write(r)
+}
+
+// WriteBaseBand writes v, a BaseBandIQ or BaseBandAmpPhase.
+func (s *FileSink) WriteBaseBand(v interface{}) error {
+	switch v.(type) {
+	case BaseBandIQ, BaseBandAmpPhase:
+		return s.write(v)
+	}
+	return fmt.Errorf("%w: %T", errSinkFrameType, v)
+}
+
+func (s *FileSink) write(v interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrSinkClosed
+	}
+	s.buf.Reset()
+	var err error
+	if s.format == FileBinary {
+		err = WriteFrameTo(&s.buf, v)
+	} else {
+		err = json.NewEncoder(&s.buf).Encode(v)
+	}
+	if err != nil {
+		return err
+	}
+
+	now := clock().Now()
+	// a frame larger than MaxSize gets a file of its own
+	full := s.size > 0 && s.size+int64(s.buf.Len()) > s.maxSize()
+	if s.f != nil && (full || now.Sub(s.opened) >= s.maxAge()) {
+		if err := s.finish(); err != nil {
+			return err
+		}
+	}
+	if s.f == nil {
+		if err := s.open(now); err != nil {
+			return err
+		}
+	}
+	n, err := s.w.Write(s.buf.Bytes())
+	s.size += int64(n)
+	return err
+}
+
+func (s *FileSink) maxSize() int64 {
+	if s.MaxSize > 0 {
+		return s.MaxSize
+	}
+	return 64 << 20
+}
+
+func (s *FileSink) maxAge() time.Duration {
+	if s.MaxAge > 0 {
+		return s.MaxAge
+	}
+	return time.Hour
+}
+
+// open starts a file at now.
+func (s *FileSink) open(now time.Time) error {
+	ext := ".ndjson"
+	if s.format == FileBinary {
+		ext = ".bin"
+	}
+	s.seq++
+	name := filepath.Join(s.dir, fmt.Sprintf("%s-%s-%04d%s", s.prefix, now.UTC().Format("20060102T150405.000000000Z"), s.seq, ext))
+	f, err := os.OpenFile(name+partSuffix, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	s.f, s.w, s.name = f, bufio.NewWriter(f), name
+	s.size, s.opened = 0, now
+	return nil
+}
+
+// finish syncs the file being written to disk and renames it without
+// partSuffix, then syncs the directory so the rename survives a crash.
+func (s *FileSink) finish() error {
+	f, w := s.f, s.w
+	s.f, s.w = nil, nil
+	err := w.Flush()
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(s.name+partSuffix, s.name); err != nil {
+		return err
+	}
+	return syncDir(s.dir)
+}
+
+// Flush writes the buffered frames to the file being written, without
+// syncing it to disk.
+func (s *FileSink) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.w == nil {
+		return nil
+	}
+	return s.w.Flush()
+}
+
+// Close finishes the file being written, later writes return ErrSinkClosed.
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	if s.f == nil {
+		return nil
+	}
+	return s.finish()
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+
+package xethru
+
+import "os"
+
+// syncDir syncs the directory dir to disk, so the files renamed in it
+// survive a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if cerr := d.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
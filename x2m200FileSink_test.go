@@ -0,0 +1,182 @@
+package xethru
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sinkFiles returns the files in dir, in the order they were written.
+func sinkFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// readSinkFile returns the counters of the frames in a file written by a
+// FileSink.
+func readSinkFile(t *testing.T, name string, format FileFormat) []uint32 {
+	t.Helper()
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var counters []uint32
+	if format == FileBinary {
+		for {
+			v, err := ReadFrameFrom(f)
+			if err == io.EOF {
+				return counters
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch v := v.(type) {
+			case Respiration:
+				counters = append(counters, v.Counter)
+			case BaseBandIQ:
+				counters = append(counters, v.Counter)
+			}
+		}
+	}
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		var r Respiration
+		if err := json.Unmarshal(s.Bytes(), &r); err != nil {
+			t.Fatal(err)
+		}
+		counters = append(counters, r.Counter)
+	}
+	return counters
+}
+
+func TestFileSinkRotateSize(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewFileSink(dir, "", FileBinary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// three respiration frames to a file
+	frame := int64(4 + respirationBinarySize)
+	s.MaxSize = 3 * frame
+	for n := uint32(1); n <= 7; n++ {
+		if err := s.WriteRespiration(Respiration{Status: respApp, Counter: n, Valid: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// larger than MaxSize, it gets a file of its own
+	iq := BaseBandIQ{BaseBandHeader: BaseBandHeader{Status: basebandIQ, Counter: 8, Bins: 8}, SigI: make([]float64, 8), SigQ: make([]float64, 8)}
+	if err := s.WriteBaseBand(iq); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.WriteRespiration(Respiration{Status: respApp, Counter: 9}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.WriteBaseBand(Respiration{}); !errors.Is(err, errSinkFrameType) {
+		t.Errorf("Expected: %v, got %v\n", errSinkFrameType, err)
+	}
+
+	names := sinkFiles(t, dir)
+	if len(names) != 5 || !strings.HasSuffix(names[4], ".bin"+partSuffix) {
+		t.Fatalf("Expected: 4 files and one being written, got %v\n", names)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.WriteRespiration(Respiration{}); !errors.Is(err, ErrSinkClosed) {
+		t.Errorf("Expected: %v, got %v\n", ErrSinkClosed, err)
+	}
+	want := [][]uint32{{1, 2, 3}, {4, 5, 6}, {7}, {8}, {9}}
+	names = sinkFiles(t, dir)
+	if len(names) != len(want) {
+		t.Fatalf("Expected: %d files, got %v\n", len(want), names)
+	}
+	for n, name := range names {
+		if !strings.HasPrefix(name, "frames-") || !strings.HasSuffix(name, ".bin") {
+			t.Errorf("test %d Expected: a finished frames file, got %s\n", n, name)
+		}
+		got := readSinkFile(t, filepath.Join(dir, name), FileBinary)
+		if len(got) != len(want[n]) || got[0] != want[n][0] || got[len(got)-1] != want[n][len(want[n])-1] {
+			t.Errorf("test %d Expected: %v, got %v\n", n, want[n], got)
+		}
+		if info, err := os.Stat(filepath.Join(dir, name)); err != nil || (len(want[n]) > 1 && info.Size() > s.MaxSize) {
+			t.Errorf("test %d Expected: at most %d bytes, got %v %v\n", n, s.MaxSize, info.Size(), err)
+		}
+	}
+}
+
+func TestFileSinkRotateAge(t *testing.T) {
+	c := useFakeClock(t)
+	dir := t.TempDir()
+	s, err := NewFileSink(dir, "bedroom", FileNDJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.MaxAge = time.Minute
+	write := func(counter uint32) {
+		t.Helper()
+		if err := s.WriteRespiration(Respiration{Status: respApp, Counter: counter, Valid: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(1)
+	c.Advance(59 * time.Second)
+	write(2)
+	// Flush makes the frames readable before the file is finished
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	names := sinkFiles(t, dir)
+	if len(names) != 1 || !strings.HasSuffix(names[0], ".ndjson"+partSuffix) {
+		t.Fatalf("Expected: a file being written, got %v\n", names)
+	}
+	if got := readSinkFile(t, filepath.Join(dir, names[0]), FileNDJSON); len(got) != 2 {
+		t.Errorf("Expected: 2 frames flushed, got %v\n", got)
+	}
+	c.Advance(time.Second)
+	write(3)
+	c.Advance(10 * time.Minute)
+	write(4)
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Unix(0, fakeClockTime).UTC()
+	want := []struct {
+		start    time.Time
+		counters []uint32
+	}{
+		{start, []uint32{1, 2}},
+		{start.Add(time.Minute), []uint32{3}},
+		{start.Add(11 * time.Minute), []uint32{4}},
+	}
+	names = sinkFiles(t, dir)
+	if len(names) != len(want) {
+		t.Fatalf("Expected: %d files, got %v\n", len(want), names)
+	}
+	for n, w := range want {
+		if stamp := w.start.Format("20060102T150405"); !strings.HasPrefix(names[n], "bedroom-"+stamp) {
+			t.Errorf("test %d Expected: started at %s, got %s\n", n, stamp, names[n])
+		}
+		got := readSinkFile(t, filepath.Join(dir, names[n]), FileNDJSON)
+		if len(got) != len(w.counters) || got[0] != w.counters[0] {
+			t.Errorf("test %d Expected: %v, got %v\n", n, w.counters, got)
+		}
+	}
+}
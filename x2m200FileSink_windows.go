@@ -0,0 +1,7 @@
+package xethru
+
+// syncDir does nothing, a directory can not be opened to sync it on Windows
+// so making the renames in it durable is left to the file system.
+func syncDir(dir string) error {
+	return nil
+}
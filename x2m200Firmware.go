@@ -0,0 +1,236 @@
+package xethru
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Bootloader commands. Once in the bootloader the sensor accepts only these.
+// The command values, and sending them in normal frames, are assumed: the
+// bootloader documentation gives its pages a framing of their own. Writing
+// the wrong commands during a flash can leave a module unable to boot, so
+// enterBootloader and flashFirmware stay unexported until they are checked
+// against it.
+const (
+	x2m200EnterBootloader = 0x2a // <Start> + <XTS_SPC_MOD_BOOTLOADER> + <CRC> + <End>
+	bootWritePage         = 0xb1 // + [Address(i)] + [Data]
+	bootReadPage          = 0xb2 // + [Address(i)] + [Length(i)]
+	bootPageData          = 0xb3 // reply to bootReadPage: + [Address(i)] + [Data]
+	bootStartApp          = 0xb4
+)
+
+// firmwarePageSize is the number of bytes written by each page write.
+const firmwarePageSize = 256
+
+// pageRetries is how many times a page write is attempted.
+const pageRetries = 3
+
+// Firmware errors
+var (
+	errFirmwareVerify  = errors.New("firmware verification failed")
+	errFirmwareFormat  = errors.New("unknown firmware image format")
+	errFirmwareHex     = errors.New("invalid hex record")
+	errFirmwareHexCRC  = errors.New("hex record checksum mismatch")
+	errFirmwareEmpty   = errors.New("firmware image is empty")
+	errFirmwareAddress = errors.New("hex record address out of order")
+)
+
+// FirmwareImage is a contiguous firmware image to be written at Base.
+type FirmwareImage struct {
+	Base uint32
+	Data []byte
+}
+
+// Pages returns the number of pages needed to write the image.
+func (img *FirmwareImage) Pages() int {
+	return (len(img.Data) + firmwarePageSize - 1) / firmwarePageSize
+}
+
+// page returns the address and data of page n, the last page is padded with
+// 0xff.
+func (img *FirmwareImage) page(n int) (uint32, []byte) {
+	p := bytes.Repeat([]byte{0xff}, firmwarePageSize)
+	copy(p, img.Data[n*firmwarePageSize:])
+	return img.Base + uint32(n*firmwarePageSize), p
+}
+
+// LoadFirmware reads a firmware image from an Intel hex (.hex) or raw binary
+// (.bin) file. Binary images are written at address zero.
+func LoadFirmware(name string) (*FirmwareImage, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".hex":
+		return ParseFirmwareHex(f)
+	case ".bin":
+		return ParseFirmwareBin(f, 0)
+	}
+	return nil, fmt.Errorf("%w: %s", errFirmwareFormat, name)
+}
+
+// ParseFirmwareBin reads a raw binary image to be written at base.
+func ParseFirmwareBin(r io.Reader, base uint32) (*FirmwareImage, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, errFirmwareEmpty
+	}
+	return &FirmwareImage{Base: base, Data: b}, nil
+}
+
+// ParseFirmwareHex reads an Intel hex image. Gaps between records are filled
+// with 0xff, records must be in ascending address order.
+func ParseFirmwareHex(r io.Reader) (*FirmwareImage, error) {
+	img := &FirmwareImage{}
+	var upper uint32 // from extended address records
+	var started bool
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		text := strings.TrimSpace(s.Text())
+		if text == "" {
+			continue
+		}
+		if text[0] != ':' {
+			return nil, fmt.Errorf("%w: line %d", errFirmwareHex, line)
+		}
+		rec, err := hex.DecodeString(text[1:])
+		if err != nil || len(rec) < 5 || len(rec) != int(rec[0])+5 {
+			return nil, fmt.Errorf("%w: line %d", errFirmwareHex, line)
+		}
+		var sum byte
+		for _, b := range rec {
+			sum += b
+		}
+		if sum != 0 {
+			return nil, fmt.Errorf("%w: line %d", errFirmwareHexCRC, line)
+		}
+		data := rec[4 : len(rec)-1]
+		switch rec[3] {
+		case 0x00: // data
+			addr := upper + uint32(binary.BigEndian.Uint16(rec[1:3]))
+			if !started {
+				img.Base = addr
+				started = true
+			}
+			if addr < img.Base+uint32(len(img.Data)) {
+				return nil, fmt.Errorf("%w: line %d", errFirmwareAddress, line)
+			}
+			for img.Base+uint32(len(img.Data)) < addr {
+				img.Data = append(img.Data, 0xff)
+			}
+			img.Data = append(img.Data, data...)
+		case 0x01: // end of file
+			if len(img.Data) == 0 {
+				return nil, errFirmwareEmpty
+			}
+			return img, nil
+		case 0x02: // extended segment address
+			if len(data) != 2 {
+				return nil, fmt.Errorf("%w: line %d", errFirmwareHex, line)
+			}
+			upper = uint32(binary.BigEndian.Uint16(data)) << 4
+		case 0x04: // extended linear address
+			if len(data) != 2 {
+				return nil, fmt.Errorf("%w: line %d", errFirmwareHex, line)
+			}
+			upper = uint32(binary.BigEndian.Uint16(data)) << 16
+		case 0x03, 0x05: // start address, not needed
+		default:
+			return nil, fmt.Errorf("%w: line %d", errFirmwareHex, line)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("%w: no end of file record", errFirmwareHex)
+}
+
+// enterBootloader restarts the sensor in its bootloader, ready for
+// flashFirmware. It is not exported until the bootloader commands are
+// checked.
+// Response: <Start> + <XTS_SPR_ACK> + <CRC> + <End>
+func (r *Module) enterBootloader() error {
+	if _, err := r.Execute([]byte{x2m200EnterBootloader}, x2m200Ack, r.Timeout); err != nil {
+		return fmt.Errorf("failed to enter bootloader: %w", err)
+	}
+	return nil
+}
+
+// flashFirmware writes img to a sensor that is in its bootloader. Each page
+// is written, retrying if the sensor does not ack it, then read back and
+// compared. When every page is written the sensor is started in the new
+// application. If ctx is cancelled, or a page fails, the sensor is left in the
+// bootloader so the flash can be tried again. progress, if not nil, is called
+// after each page. It is not exported until the bootloader commands and
+// framing are checked.
+func (r *Module) flashFirmware(ctx context.Context, img *FirmwareImage, progress func(done, total int)) error {
+	total := img.Pages()
+	if total == 0 {
+		return errFirmwareEmpty
+	}
+	for n := 0; n < total; n++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		addr, data := img.page(n)
+		if err := r.writePage(addr, data); err != nil {
+			return fmt.Errorf("failed to write page at %#08x: %w", addr, err)
+		}
+		if err := r.verifyPage(addr, data); err != nil {
+			return fmt.Errorf("failed to verify page at %#08x: %w", addr, err)
+		}
+		if progress != nil {
+			progress(n+1, total)
+		}
+	}
+	if _, err := r.Execute([]byte{bootStartApp}, x2m200Ack, r.Timeout); err != nil {
+		return fmt.Errorf("failed to start application: %w", err)
+	}
+	return nil
+}
+
+func (r *Module) writePage(addr uint32, data []byte) error {
+	cmd := make([]byte, 5, 5+len(data))
+	cmd[0] = bootWritePage
+	binary.LittleEndian.PutUint32(cmd[1:], addr)
+	cmd = append(cmd, data...)
+	var err error
+	for try := 0; try < pageRetries; try++ {
+		if _, err = r.Execute(cmd, x2m200Ack, r.Timeout); err == nil {
+			return nil
+		}
+		r.log().Warnf("page write at %#08x failed, attempt %d: %v", addr, try+1, err)
+	}
+	return err
+}
+
+func (r *Module) verifyPage(addr uint32, data []byte) error {
+	cmd := make([]byte, 9)
+	cmd[0] = bootReadPage
+	binary.LittleEndian.PutUint32(cmd[1:], addr)
+	binary.LittleEndian.PutUint32(cmd[5:], uint32(len(data)))
+	resp, err := r.exchange(cmd, r.Timeout, func(p []byte) bool {
+		return len(p) >= 5 && p[0] == bootPageData && binary.LittleEndian.Uint32(p[1:5]) == addr
+	})
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(resp[5:], data) {
+		return errFirmwareVerify
+	}
+	return nil
+}
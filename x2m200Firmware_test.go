@@ -0,0 +1,185 @@
+package xethru
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseFirmwareHex(t *testing.T) {
+	cases := []struct {
+		in  string
+		img *FirmwareImage
+		err error
+	}{
+		{":0400000501020304ED\n:020000040001F9\n:0400100001020304E2\n:02001600AABB83\n:00000001FF\n",
+			&FirmwareImage{Base: 0x10010, Data: []byte{0x01, 0x02, 0x03, 0x04, 0xff, 0xff, 0xaa, 0xbb}}, nil},
+		{":0400100001020304E3\n:00000001FF\n", nil, errFirmwareHexCRC},
+		{":0400100001020304E2\n", nil, errFirmwareHex},
+		{"0400100001020304E2\n:00000001FF\n", nil, errFirmwareHex},
+		{":00000001FF\n", nil, errFirmwareEmpty},
+		{":0400100001020304E2\n:0400000001020304F2\n:00000001FF\n", nil, errFirmwareAddress},
+	}
+	for n, c := range cases {
+		img, err := ParseFirmwareHex(strings.NewReader(c.in))
+		if !errors.Is(err, c.err) {
+			t.Errorf("test %d Expected: %v, got %v\n", n, c.err, err)
+		}
+		if c.img == nil {
+			continue
+		}
+		if img == nil || img.Base != c.img.Base || !bytes.Equal(img.Data, c.img.Data) {
+			t.Errorf("test %d Expected: %+v, got %+v\n", n, c.img, img)
+		}
+	}
+}
+
+// fakeBootloader is a sensor in its bootloader. It naks the first write of
+// each page in nak, and corrupts the read back of pages in corrupt.
+type fakeBootloader struct {
+	mu      sync.Mutex
+	mem     map[uint32][]byte
+	nak     map[uint32]bool
+	corrupt map[uint32]bool
+	started bool
+}
+
+func newFakeBootloader(b *fakeBootloader) (Framer, func()) {
+	sensorReader, clientWriter := io.Pipe()
+	clientReader, sensorWriter := io.Pipe()
+	sensor := NewFramer(pipeConn{sensorReader, sensorWriter})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		a := NewAssembler()
+		buf := make([]byte, 1024)
+		for {
+			n, err := sensorReader.Read(buf)
+			if err != nil {
+				return
+			}
+			a.Write(buf[:n])
+			for {
+				p, err := a.Next()
+				if p == nil || err != nil {
+					break
+				}
+				sensor.Write(b.handle(p))
+			}
+		}
+	}()
+	return NewFramer(pipeConn{clientReader, clientWriter}), func() {
+		sensor.Close()
+		<-done
+	}
+}
+
+func (b *fakeBootloader) handle(p []byte) []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch p[0] {
+	case x2m200EnterBootloader:
+	case bootWritePage:
+		addr := binary.LittleEndian.Uint32(p[1:])
+		if b.nak[addr] {
+			delete(b.nak, addr)
+			return []byte{errorByte, crcFailed}
+		}
+		b.mem[addr] = append([]byte(nil), p[5:]...)
+	case bootReadPage:
+		addr := binary.LittleEndian.Uint32(p[1:])
+		data := append([]byte(nil), b.mem[addr]...)
+		if b.corrupt[addr] && len(data) > 0 {
+			data[0] ^= 0xff
+		}
+		return append(append([]byte{bootPageData}, p[1:5]...), data...)
+	case bootStartApp:
+		b.started = true
+	default:
+		return []byte{errorByte, notReconsied}
+	}
+	return []byte{x2m200Ack}
+}
+
+func TestFlashFirmware(t *testing.T) {
+	data := make([]byte, 3*firmwarePageSize-10)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	img := &FirmwareImage{Base: 0x8000, Data: data}
+
+	cases := []struct {
+		nak     map[uint32]bool
+		corrupt map[uint32]bool
+		err     error
+		pages   int
+		started bool
+	}{
+		{nil, nil, nil, 3, true},
+		{map[uint32]bool{0x8100: true}, nil, nil, 3, true},
+		{nil, map[uint32]bool{0x8100: true}, errFirmwareVerify, 1, false},
+	}
+	for n, c := range cases {
+		b := &fakeBootloader{mem: make(map[uint32][]byte), nak: c.nak, corrupt: c.corrupt}
+		f, stop := newFakeBootloader(b)
+		m := NewModule(f, "respiration")
+		if err := m.enterBootloader(); err != nil {
+			t.Errorf("test %d Expected: %v, got %v\n", n, nil, err)
+		}
+		pages := 0
+		err := m.flashFirmware(context.Background(), img, func(done, total int) {
+			if total != 3 {
+				t.Errorf("test %d Expected: %d, got %d\n", n, 3, total)
+			}
+			pages = done
+		})
+		if !errors.Is(err, c.err) {
+			t.Errorf("test %d Expected: %v, got %v\n", n, c.err, err)
+		}
+		if pages != c.pages {
+			t.Errorf("test %d Expected: %d, got %d\n", n, c.pages, pages)
+		}
+		b.mu.Lock()
+		if b.started != c.started {
+			t.Errorf("test %d Expected: %v, got %v\n", n, c.started, b.started)
+		}
+		if c.err == nil {
+			last := b.mem[0x8200]
+			if len(last) != firmwarePageSize || last[firmwarePageSize-11] != data[len(data)-1] || last[firmwarePageSize-1] != 0xff {
+				t.Errorf("test %d Expected: padded last page, got %x\n", n, last)
+			}
+		}
+		b.mu.Unlock()
+		stop()
+	}
+}
+
+func TestFlashFirmwareCancel(t *testing.T) {
+	b := &fakeBootloader{mem: make(map[uint32][]byte)}
+	f, stop := newFakeBootloader(b)
+	defer stop()
+	m := NewModule(f, "respiration")
+	m.Timeout = time.Second
+
+	ctx, cancel := context.WithCancel(context.Background())
+	img := &FirmwareImage{Data: make([]byte, 10*firmwarePageSize)}
+	err := m.flashFirmware(ctx, img, func(done, total int) {
+		if done == 2 {
+			cancel()
+		}
+	})
+	if err != context.Canceled {
+		t.Errorf("Expected: %v, got %v\n", context.Canceled, err)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.mem) != 2 || b.started {
+		t.Errorf("Expected: 2 pages and still in bootloader, got %d pages started %v\n", len(b.mem), b.started)
+	}
+}
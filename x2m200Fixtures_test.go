@@ -0,0 +1,168 @@
+package xethru
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// readFixtures reads the frames in testdata/frames.hex by name.
+func readFixtures(t *testing.T) map[string][]byte {
+	f, err := os.Open("testdata/frames.hex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	frames := make(map[string][]byte)
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			t.Fatalf("bad fixture line %q", line)
+		}
+		b, err := hex.DecodeString(fields[1])
+		if err != nil {
+			t.Fatalf("fixture %s: %v", fields[0], err)
+		}
+		frames[fields[0]] = b
+	}
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return frames
+}
+
+// TestFixtureByteOrder guards against any parser decoding the little endian
+// fields in the wrong byte order. The fixtures are built from the documented
+// layout, not captured from hardware, so a layout that is wrong on the module
+// would pass.
+func TestFixtureByteOrder(t *testing.T) {
+	useFakeClock(t)
+	header := BaseBandHeader{
+		Time:         fakeClockTime,
+		Bins:         2,
+		BinLength:    float64(float32(0.0514)),
+		SamplingFreq: float64(float32(39e9)),
+		CarrierFreq:  float64(float32(7.29e9)),
+		RangeOffset:  float64(float32(0.2075)),
+	}
+	iq, ap := header, header
+	iq.Status, iq.Counter = basebandIQ, 0x0304
+	ap.Status, ap.Counter = basebandAP, 0x0403
+
+	cases := []struct {
+		name string
+		data interface{}
+	}{
+		{"respiration", Respiration{Time: fakeClockTime, Status: respApp, Counter: 0x0102, State: breathing, RPM: 14, Distance: 0.75, SignalQuality: 7, Movement: -0.5, Valid: true}},
+		{"sleep", Sleep{Time: fakeClockTime, Status: sleepApp, Counter: 0x0201, State: movement, RPM: 13.5, Distance: 1.25, SignalQuality: 6, MovementSlow: 0.25, MovementFast: 2}},
+		{"basebandiq", BaseBandIQ{BaseBandHeader: iq, SigI: []float64{0.5, -0.25}, SigQ: []float64{1, -1}}},
+		{"basebandap", BaseBandAmpPhase{BaseBandHeader: ap, Amplitude: []float64{2, 0.125}, Phase: []float64{3, -3}}},
+	}
+	frames := readFixtures(t)
+	for _, c := range cases {
+		frame, ok := frames[c.name]
+		if !ok {
+			t.Errorf("%s Expected: fixture, got none\n", c.name)
+			continue
+		}
+		b := make([]byte, len(frame))
+		n, err := NewFramer(bytes.NewBuffer(frame)).Read(b)
+		if err != nil {
+			t.Fatalf("%s %v", c.name, err)
+		}
+		data, err := parse(b[:n])
+		if err != nil {
+			t.Errorf("%s Expected: %v, got %v\n", c.name, nil, err)
+		}
+		if !reflect.DeepEqual(data, c.data) {
+			t.Errorf("%s Expected: %+v, got %+v\n", c.name, c.data, data)
+		}
+	}
+}
+
+// goldenFrames are the values of the frames in testdata/frames.hex, every
+// fixture must have one. The frames were generated with MarshalFrame from
+// these values, so the golden tests only catch unintended changes to the
+// encoders or parsers, not disagreement with the module.
+func goldenFrames() map[string]interface{} {
+	header := BaseBandHeader{
+		Time:         fakeClockTime,
+		Bins:         2,
+		BinLength:    float64(float32(0.0514)),
+		SamplingFreq: float64(float32(39e9)),
+		CarrierFreq:  float64(float32(7.29e9)),
+		RangeOffset:  float64(float32(0.2075)),
+	}
+	iq, ap := header, header
+	iq.Status, iq.Counter = basebandIQ, 0x0304
+	ap.Status, ap.Counter = basebandAP, 0x0403
+	return map[string]interface{}{
+		"respiration":         Respiration{Time: fakeClockTime, Status: respApp, Counter: 0x0102, State: breathing, RPM: 14, Distance: 0.75, SignalQuality: 7, Movement: -0.5, Valid: true},
+		"respiration_escaped": Respiration{Time: fakeClockTime, Status: respApp, Counter: 0x7f7e7d, State: tracking, RPM: 0x7e, Distance: 1.5, SignalQuality: 0x7d, Movement: 0.25, Valid: true},
+		"sleep":               Sleep{Time: fakeClockTime, Status: sleepApp, Counter: 0x0201, State: movement, RPM: 13.5, Distance: 1.25, SignalQuality: 6, MovementSlow: 0.25, MovementFast: 2},
+		"basebandiq":          BaseBandIQ{BaseBandHeader: iq, SigI: []float64{0.5, -0.25}, SigQ: []float64{1, -1}},
+		"basebandap":          BaseBandAmpPhase{BaseBandHeader: ap, Amplitude: []float64{2, 0.125}, Phase: []float64{3, -3}},
+		"ack":                 SystemMessage{Message: messageAck},
+		"error":               &SensorError{Code: notReconsied},
+		"system":              SystemMessage{Message: messageReady},
+		"booting":             SystemMessage{Message: messageBooting},
+		"sysinfo_firmware":    "X2M200",
+		"sysinfo_version":     "1.2.3",
+		"sysinfo_serial":      "170512345",
+	}
+}
+
+// TestFixtureGolden checks every fixture parses to its golden value.
+func TestFixtureGolden(t *testing.T) {
+	useFakeClock(t)
+	golden := goldenFrames()
+	for name, frame := range readFixtures(t) {
+		want, ok := golden[name]
+		if !ok {
+			t.Errorf("%s Expected: a golden value, got none\n", name)
+			continue
+		}
+		var got interface{}
+		var err error
+		if _, info := want.(string); info {
+			var p []byte
+			if p, err = DecodeFrame(frame); err == nil {
+				got = systemInfoValue(p)
+			}
+		} else {
+			got, err = ParseHexFrame(hex.EncodeToString(frame))
+		}
+		if err != nil {
+			t.Errorf("%s Expected: %v, got %v\n", name, nil, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s Expected: %+v, got %+v\n", name, want, got)
+		}
+	}
+}
+
+// TestMarshalFixtures checks the generator reproduces the corpus.
+func TestMarshalFixtures(t *testing.T) {
+	frames := readFixtures(t)
+	for name, v := range goldenFrames() {
+		if _, info := v.(string); info {
+			continue
+		}
+		got, err := MarshalFrame(v)
+		if err != nil {
+			t.Errorf("%s Expected: %v, got %v\n", name, nil, err)
+		}
+		if !bytes.Equal(got, frames[name]) {
+			t.Errorf("%s Expected: %x, got %x\n", name, frames[name], got)
+		}
+	}
+}
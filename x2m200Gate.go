@@ -0,0 +1,32 @@
+package xethru
+
+// GateMode says what Run does with a Respiration frame whose SignalQuality is
+// below the module's MinSignalQuality.
+type GateMode int
+
+// Gate modes
+const (
+	// GateMark delivers the frame with Valid false.
+	GateMark GateMode = iota
+	// GateSuppress drops the frame, it is not delivered to handlers,
+	// subscribers, Latest or the Run stream.
+	GateSuppress
+)
+
+// gate applies the quality gate to resp, it reports whether the frame should
+// be delivered.
+func (r *Module) gate(resp *Respiration) bool {
+	if r.MinSignalQuality <= 0 || resp.SignalQuality >= r.MinSignalQuality {
+		return true
+	}
+	r.gated.Add(1)
+	r.metrics().Counter(MetricGatedFrames, 1)
+	resp.Valid = false
+	return r.QualityGate != GateSuppress
+}
+
+// GatedFrames returns the number of Respiration frames Run found below
+// MinSignalQuality, whether marked or suppressed.
+func (r *Module) GatedFrames() uint64 {
+	return r.gated.Load()
+}
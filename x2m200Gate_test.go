@@ -0,0 +1,71 @@
+package xethru
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func TestQualityGate(t *testing.T) {
+	// signal quality straddles the threshold of 5
+	qualities := []uint32{9, 4, 5, 0, 6, 1}
+	cases := []struct {
+		mode     GateMode
+		counters []uint32
+		valid    []bool
+	}{
+		{GateMark, []uint32{0, 1, 2, 3, 4, 5}, []bool{true, false, true, false, true, false}},
+		{GateSuppress, []uint32{0, 2, 4}, []bool{true, true, true}},
+	}
+	for n, c := range cases {
+		f, sensor := newFakeSensor(0)
+		m := NewModule(f, "respiration")
+		m.MinSignalQuality = 5
+		m.QualityGate = c.mode
+		metrics := &fakeMetrics{values: make(map[string]float64)}
+		m.Metrics = metrics
+		m.startReader()
+		for i, q := range qualities {
+			p := append([]byte(nil), respirationPayload...)
+			binary.LittleEndian.PutUint32(p[5:9], uint32(i))
+			binary.LittleEndian.PutUint32(p[25:29], q)
+			sensor.send(p)
+		}
+
+		stream := make(chan interface{}, len(qualities))
+		finished := make(chan struct{})
+		go func() {
+			m.Run(stream)
+			close(finished)
+		}()
+
+		for i := range c.counters {
+			select {
+			case d := <-stream:
+				r := d.(Respiration)
+				if r.Counter != c.counters[i] || r.Valid != c.valid[i] {
+					t.Errorf("test %d frame %d Expected: %d %v, got %d %v\n", n, i, c.counters[i], c.valid[i], r.Counter, r.Valid)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("test %d frame %d Expected: frame, got none\n", n, i)
+			}
+		}
+		sensor.Close()
+		<-finished
+		last := c.counters[len(c.counters)-1]
+		if latest, _, _ := m.Latest(); latest.Counter != last {
+			t.Errorf("test %d Expected: latest %d, got %d\n", n, last, latest.Counter)
+		}
+		if g := m.GatedFrames(); g != 3 {
+			t.Errorf("test %d Expected: %d gated, got %d\n", n, 3, g)
+		}
+		metrics.mu.Lock()
+		if g := metrics.values[MetricGatedFrames]; g != 3 {
+			t.Errorf("test %d Expected: %d gated metric, got %v\n", n, 3, g)
+		}
+		metrics.mu.Unlock()
+		if len(stream) != 0 {
+			t.Errorf("test %d Expected: no more frames, got %d\n", n, len(stream))
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package xethru
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// HTTPStaleAfter is the age after which NewHandler reports a sensor's last
+// frame as stale.
+var HTTPStaleAfter = 5 * time.Second
+
+// sensorJSON is the JSON form of a sensor served by NewHandler.
+type sensorJSON struct {
+	Name     string       `json:"name"`
+	Latest   *Respiration `json:"latest"`
+	Received *time.Time   `json:"received,omitempty"`
+	Age      *float64     `json:"age,omitempty"` // seconds since received
+	Stale    bool         `json:"stale"`
+	Error    string       `json:"error,omitempty"`
+	Stats    statsJSON    `json:"stats"`
+}
+
+// statsJSON is the JSON form of Stats.
+type statsJSON struct {
+	FramesOK       uint64  `json:"framesok"`
+	CRCErrors      uint64  `json:"crcerrors"`
+	FramingErrors  uint64  `json:"framingerrors"`
+	BytesRead      uint64  `json:"bytesread"`
+	BytesWritten   uint64  `json:"byteswritten"`
+	DiscardedBytes uint64  `json:"discardedbytes"`
+	DroppedFrames  uint64  `json:"droppedframes"`
+	FrameRate      float64 `json:"framerate"`
+}
+
+// NewHandler returns an http.Handler serving the devices of reg as JSON:
+//
+//	GET /sensors                every sensor with its last frame, how long
+//	                            ago it was received, whether it is stale and
+//	                            its Stats
+//	GET /sensors/{name}         the sensor's last Respiration frame, 204 No
+//	                            Content if it has none yet
+//	GET /sensors/{name}/stream  the sensor's Respiration frames as server-sent
+//	                            events while its Run loop is running
+//
+// An unknown name is 404 Not Found. The patterns need Go 1.22 or later.
+func NewHandler(reg *Registry) http.Handler {
+	h := &httpHandler{reg: reg}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /sensors", h.sensors)
+	mux.HandleFunc("GET /sensors/{name}", h.sensor)
+	mux.HandleFunc("GET /sensors/{name}/stream", h.stream)
+	return mux
+}
+
+type httpHandler struct {
+	reg *Registry
+}
+
+func (h *httpHandler) sensors(w http.ResponseWriter, req *http.Request) {
+	stats := h.reg.DeviceStats()
+	names := h.reg.Names()
+	sensors := make([]sensorJSON, 0, len(names))
+	now := clock().Now()
+	for _, name := range names {
+		m := h.reg.Module(name)
+		if m == nil {
+			// removed since Names
+			continue
+		}
+		s := stats[name]
+		sensor := sensorJSON{
+			Name: name,
+			Stats: statsJSON{
+				FramesOK:       s.FramesOK,
+				CRCErrors:      s.CRCErrors,
+				FramingErrors:  s.FramingErrors,
+				BytesRead:      s.BytesRead,
+				BytesWritten:   s.BytesWritten,
+				DiscardedBytes: s.DiscardedBytes,
+				DroppedFrames:  s.DroppedFrames,
+				FrameRate:      s.FrameRate,
+			},
+		}
+		if resp, at, ok := m.Latest(); ok {
+			age := now.Sub(at)
+			seconds := age.Seconds()
+			at = at.UTC()
+			sensor.Latest, sensor.Received, sensor.Age = &resp, &at, &seconds
+			sensor.Stale = age >= HTTPStaleAfter
+		}
+		if err := h.reg.Err(name); err != nil {
+			sensor.Error = err.Error()
+		}
+		sensors = append(sensors, sensor)
+	}
+	writeJSON(w, sensors)
+}
+
+func (h *httpHandler) sensor(w http.ResponseWriter, req *http.Request) {
+	m := h.module(w, req)
+	if m == nil {
+		return
+	}
+	resp, _, ok := m.Latest()
+	if !ok {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, resp)
+}
+
+func (h *httpHandler) stream(w http.ResponseWriter, req *http.Request) {
+	m := h.module(w, req)
+	if m == nil {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	frames, unsubscribe := m.Subscribe(16, DropOldest)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	for {
+		select {
+		case resp, ok := <-frames:
+			if !ok {
+				return
+			}
+			b, err := json.Marshal(resp)
+			if err != nil {
+				m.log().Warnf("%v", err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: respiration\ndata: %s\n\n", b); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-req.Context().Done():
+			return
+		}
+	}
+}
+
+// module returns the module of the sensor named in req, or writes 404 Not
+// Found and returns nil.
+func (h *httpHandler) module(w http.ResponseWriter, req *http.Request) *Module {
+	name := req.PathValue("name")
+	m := h.reg.Module(name)
+	if m == nil {
+		http.Error(w, fmt.Sprintf("no sensor %q", name), http.StatusNotFound)
+	}
+	return m
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(b, '\n'))
+}
@@ -0,0 +1,166 @@
+package xethru
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandler(t *testing.T) {
+	reg := NewRegistry()
+	alive := openSimulated(t)
+	defer alive.Close()
+	quietSensor := NewSimulatedSensor()
+	quietSensor.Interval = time.Hour
+	quiet, err := Open(simConn(quietSensor, false), WithResetTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer quiet.Close()
+	reg.Add("alive", alive)
+	reg.Add("quiet", quiet)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		reg.Wait()
+	}()
+	if err := reg.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for range reg.Respiration() {
+		}
+	}()
+	deadline := time.Now().Add(2 * time.Second)
+	for _, _, ok := reg.Module("alive").Latest(); !ok; _, _, ok = reg.Module("alive").Latest() {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected: a frame from alive")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	srv := httptest.NewServer(NewHandler(reg))
+	defer srv.Close()
+
+	tests := []struct {
+		method, path string
+		code         int
+	}{
+		{"GET", "/sensors", http.StatusOK},
+		{"GET", "/sensors/alive", http.StatusOK},
+		{"GET", "/sensors/quiet", http.StatusNoContent},
+		{"GET", "/sensors/nope", http.StatusNotFound},
+		{"GET", "/sensors/nope/stream", http.StatusNotFound},
+		{"POST", "/sensors", http.StatusMethodNotAllowed},
+	}
+	for n, test := range tests {
+		req, _ := http.NewRequest(test.method, srv.URL+test.path, nil)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("test %d %v\n", n, err)
+		}
+		res.Body.Close()
+		if res.StatusCode != test.code {
+			t.Errorf("test %d Expected: %d, got %d\n", n, test.code, res.StatusCode)
+		}
+	}
+
+	var resp Respiration
+	getJSON(t, srv.URL+"/sensors/alive", &resp)
+	if resp.Status != respApp || resp.RPM == 0 {
+		t.Errorf("Expected: a respiration frame, got %+v\n", resp)
+	}
+
+	for _, test := range []struct {
+		staleAfter time.Duration
+		stale      bool
+	}{
+		{time.Hour, false},
+		{0, true},
+	} {
+		defer func(d time.Duration) { HTTPStaleAfter = d }(HTTPStaleAfter)
+		HTTPStaleAfter = test.staleAfter
+		var sensors []sensorJSON
+		getJSON(t, srv.URL+"/sensors", &sensors)
+		if len(sensors) != 2 || sensors[0].Name != "alive" || sensors[1].Name != "quiet" {
+			t.Fatalf("Expected: alive and quiet, got %+v\n", sensors)
+		}
+		a, q := sensors[0], sensors[1]
+		if a.Latest == nil || a.Received == nil || a.Age == nil || a.Stale != test.stale || a.Stats.FramesOK == 0 {
+			t.Errorf("Expected: alive with a frame, stale %v, got %+v\n", test.stale, a)
+		}
+		if q.Latest != nil || q.Received != nil || q.Age != nil || q.Stale {
+			t.Errorf("Expected: quiet with no data, got %+v\n", q)
+		}
+	}
+}
+
+func TestHandlerStream(t *testing.T) {
+	reg := NewRegistry()
+	dev := openSimulated(t)
+	defer dev.Close()
+	reg.Add("alive", dev)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		reg.Wait()
+	}()
+	if err := reg.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for range reg.Respiration() {
+		}
+	}()
+
+	srv := httptest.NewServer(NewHandler(reg))
+	defer srv.Close()
+	reqCtx, stop := context.WithTimeout(context.Background(), 2*time.Second)
+	defer stop()
+	req, _ := http.NewRequestWithContext(reqCtx, "GET", srv.URL+"/sensors/alive/stream", nil)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Expected: text/event-stream, got %s\n", ct)
+	}
+	scanner := bufio.NewScanner(res.Body)
+	var events []Respiration
+	for len(events) < 3 && scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		var resp Respiration
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &resp); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, resp)
+	}
+	if len(events) != 3 {
+		t.Fatalf("Expected: 3 events, got %d %v\n", len(events), scanner.Err())
+	}
+	if events[1].Counter <= events[0].Counter {
+		t.Errorf("Expected: frames in order, got %d then %d\n", events[0].Counter, events[1].Counter)
+	}
+}
+
+func getJSON(t *testing.T, url string, v interface{}) {
+	t.Helper()
+	res, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		t.Fatal(err)
+	}
+}
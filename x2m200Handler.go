@@ -0,0 +1,87 @@
+package xethru
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Handler errors
+var (
+	ErrModuleRunning = errors.New("module is already running")
+	ErrHandlerPanic  = errors.New("handler panicked")
+)
+
+// OnRespiration registers h to be called by Run with each Respiration frame.
+// Handlers are called synchronously, in the order they were registered, before
+// the frame is sent on the stream, so a slow handler holds up the stream. It
+// returns ErrModuleRunning while Run is running.
+func (r *Module) OnRespiration(h func(Respiration)) error {
+	r.handlersMu.Lock()
+	defer r.handlersMu.Unlock()
+	if r.running {
+		return ErrModuleRunning
+	}
+	r.onRespiration = append(r.onRespiration, h)
+	return nil
+}
+
+// OnError registers h to be called by Run with each error, such as a frame
+// that fails to parse or a panic in a respiration handler, which is wrapped in
+// ErrHandlerPanic. Like OnRespiration it returns ErrModuleRunning while Run is
+// running.
+func (r *Module) OnError(h func(error)) error {
+	r.handlersMu.Lock()
+	defer r.handlersMu.Unlock()
+	if r.running {
+		return ErrModuleRunning
+	}
+	r.onError = append(r.onError, h)
+	return nil
+}
+
+// startRun marks the module as running, after which the handlers can no
+// longer change, and reopens the subscriptions closed by the last Run. It
+// returns ErrModuleRunning if the module is already running.
+func (r *Module) startRun() error {
+	r.handlersMu.Lock()
+	defer r.handlersMu.Unlock()
+	if r.running {
+		return ErrModuleRunning
+	}
+	r.running = true
+	r.broadcast.reopen()
+	return nil
+}
+
+// stopRun marks the module as no longer running.
+func (r *Module) stopRun() {
+	r.handlersMu.Lock()
+	r.running = false
+	r.handlersMu.Unlock()
+}
+
+func (r *Module) handleRespiration(resp Respiration) {
+	for _, h := range r.onRespiration {
+		func() {
+			defer func() {
+				if p := recover(); p != nil {
+					r.handleError(fmt.Errorf("%w: %v", ErrHandlerPanic, p))
+				}
+			}()
+			h(resp)
+		}()
+	}
+}
+
+func (r *Module) handleError(err error) {
+	for _, h := range r.onError {
+		func() {
+			defer func() {
+				if p := recover(); p != nil {
+					r.log().Errorf("%v: error handler: %v", ErrHandlerPanic, p)
+				}
+			}()
+			h(err)
+		}()
+	}
+}
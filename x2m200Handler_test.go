@@ -0,0 +1,217 @@
+package xethru
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHandlers(t *testing.T) {
+	sensor := NewSimulatedSensor()
+	sensor.Interval = time.Millisecond
+	m := NewModule(sensor, "respiration")
+
+	var mu sync.Mutex
+	var calls []string
+	var errs []error
+	record := func(s string) {
+		mu.Lock()
+		calls = append(calls, s)
+		mu.Unlock()
+	}
+	got := make(chan struct{})
+	var once sync.Once
+
+	if err := m.OnRespiration(func(r Respiration) { record("first") }); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.OnRespiration(func(r Respiration) {
+		record("second")
+		if r.Counter == 1 {
+			panic("boom")
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.OnRespiration(func(r Respiration) {
+		record("third")
+		if r.Counter >= 3 {
+			once.Do(func() { close(got) })
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.OnError(func(err error) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		m.Run(nil)
+		close(finished)
+	}()
+	<-got
+
+	if err := m.OnRespiration(func(Respiration) {}); err != ErrModuleRunning {
+		t.Errorf("Expected: %v, got %v\n", ErrModuleRunning, err)
+	}
+	if err := m.OnError(func(error) {}); err != ErrModuleRunning {
+		t.Errorf("Expected: %v, got %v\n", ErrModuleRunning, err)
+	}
+	sensor.Close()
+	<-finished
+
+	// the panic in the second handler does not stop the third
+	want := []string{"first", "second", "third"}
+	for n, c := range calls {
+		if c != want[n%3] {
+			t.Errorf("test %d Expected: %v, got %v\n", n, want[n%3], c)
+		}
+	}
+	if len(errs) != 1 || !errors.Is(errs[0], ErrHandlerPanic) {
+		t.Errorf("Expected: one %v, got %v\n", ErrHandlerPanic, errs)
+	}
+}
+
+func TestRunSkipsUnparsableFrames(t *testing.T) {
+	var session []byte
+	session = append(session, encodeFrame(respirationPayload)...)
+	session = append(session, encodeFrame([]byte{appDataByte, respirationStartByte, 0x00})...)
+	session = append(session, encodeFrame(respirationPayload)...)
+
+	m := NewModule(CreateSplitReadWriter(io.Discard, bytes.NewReader(session)), "respiration")
+	m.Timeout = 10 * time.Millisecond
+	var errs []error
+	if err := m.OnError(func(err error) { errs = append(errs, err) }); err != nil {
+		t.Fatal(err)
+	}
+	stream := make(chan interface{}, 10)
+	m.Run(stream)
+	close(stream)
+
+	var frames []interface{}
+	for data := range stream {
+		frames = append(frames, data)
+	}
+	if len(frames) != 2 {
+		t.Fatalf("Expected: 2 frames, got %d: %v\n", len(frames), frames)
+	}
+	for n, data := range frames {
+		if _, ok := data.(Respiration); !ok {
+			t.Errorf("test %d Expected: respiration frame, got %v\n", n, data)
+		}
+	}
+	// the start command also fails once the session is exhausted
+	var parseErrs int
+	for _, err := range errs {
+		if errors.Is(err, ErrParse) {
+			parseErrs++
+		}
+	}
+	if parseErrs != 1 {
+		t.Errorf("Expected: one %v, got %v\n", ErrParse, errs)
+	}
+}
+
+func TestRunFullSizeFrames(t *testing.T) {
+	// 1024 IQ bins is larger than the pooled read buffer
+	iq := buildIQPayload(7, 1024)
+	var session []byte
+	session = append(session, encodeFrame(respirationPayload)...)
+	session = append(session, encodeFrame(iq)...)
+
+	m := NewModule(CreateSplitReadWriter(io.Discard, bytes.NewReader(session)), "respiration")
+	m.Timeout = 10 * time.Millisecond
+	var errs []error
+	if err := m.OnError(func(err error) { errs = append(errs, err) }); err != nil {
+		t.Fatal(err)
+	}
+	stream := make(chan interface{}, 10)
+	m.Run(stream)
+	close(stream)
+
+	var frames []interface{}
+	for data := range stream {
+		frames = append(frames, data)
+	}
+	if len(frames) != 2 {
+		t.Fatalf("Expected: 2 frames, got %d, errors %v\n", len(frames), errs)
+	}
+	if _, ok := frames[0].(Respiration); !ok {
+		t.Errorf("Expected: respiration frame, got %T\n", frames[0])
+	}
+	got, ok := frames[1].(BaseBandIQ)
+	if !ok || got.Counter != 7 || len(got.SigI) != 1024 || len(got.SigQ) != 1024 {
+		t.Errorf("Expected: 1024 bin IQ frame, got %T %d bins\n", frames[1], len(got.SigI))
+	}
+	for _, err := range errs {
+		if errors.Is(err, ErrParse) {
+			t.Errorf("Expected: no parse errors, got %v\n", err)
+		}
+	}
+}
+
+func TestRunOnce(t *testing.T) {
+	sensor := NewSimulatedSensor()
+	sensor.Interval = time.Millisecond
+	defer sensor.Close()
+	m := NewModule(sensor, "respiration")
+	m.Timeout = 100 * time.Millisecond
+
+	// concurrent starts, one runs until cancelled and the rest are refused
+	ctx, cancel := context.WithCancel(context.Background())
+	const starts = 8
+	errc := make(chan error, starts)
+	for n := 0; n < starts; n++ {
+		go func() { errc <- m.RunContext(ctx, nil) }()
+	}
+	for n := 0; n < starts-1; n++ {
+		if err := <-errc; err != ErrModuleRunning {
+			t.Errorf("test %d Expected: %v, got %v\n", n, ErrModuleRunning, err)
+		}
+	}
+	if err := m.OnError(func(error) {}); err != ErrModuleRunning {
+		t.Errorf("Expected: %v, got %v\n", ErrModuleRunning, err)
+	}
+	list := m.movingListChan()
+	cancel()
+	if err := <-errc; err != context.Canceled {
+		t.Errorf("Expected: %v, got %v\n", context.Canceled, err)
+	}
+	if _, ok := <-list; ok {
+		t.Error("Expected: movinglist closed after Run, got open")
+	}
+
+	// start after stop
+	if err := m.OnError(func(error) {}); err != nil {
+		t.Errorf("Expected: <nil>, got %v\n", err)
+	}
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	stream := make(chan interface{}, 10)
+	done := make(chan error)
+	go func() { done <- m.RunContext(ctx, stream) }()
+	sub, _ := m.Subscribe(1, DropOldest)
+	select {
+	case <-stream:
+	case <-time.After(time.Second):
+		t.Fatal("Expected: frames after restarting Run, got none")
+	}
+	if m.movingListChan() == list {
+		t.Error("Expected: a new movinglist channel, got the closed one")
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Expected: %v, got %v\n", context.Canceled, err)
+	}
+	for range sub {
+	}
+}
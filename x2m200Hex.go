@@ -0,0 +1,126 @@
+package xethru
+
+import (
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// dumpSamples is the number of samples of a slice DumpFrame shows.
+const dumpSamples = 8
+
+// ParseHexFrame decodes a frame written as hex, such as one copied from a
+// logic analyzer, and returns it parsed. Bytes may be separated by
+// whitespace or commas and prefixed with 0x, so "7d 10 6d 7e",
+// "0x7d,0x10,0x6d,0x7e" and "7d106d7e" are the same frame. The frame is
+// checked by DecodeFrame, then its payload is parsed as a Respiration,
+// Sleep, BaseBandIQ or BaseBandAmpPhase, a SystemMessage for a system
+// message or an ack, or a *SensorError for an error reply, which is
+// returned as the frame rather than as the error.
+func ParseHexFrame(s string) (interface{}, error) {
+	b, err := decodeHex(s)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := DecodeFrame(b)
+	if err != nil {
+		return nil, err
+	}
+	if err := protocolErr(payload); err != nil {
+		return err, nil
+	}
+	return parse(payload)
+}
+
+// decodeHex decodes s, ignoring separators and 0x prefixes.
+func decodeHex(s string) ([]byte, error) {
+	var digits strings.Builder
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	})
+	for _, f := range fields {
+		if len(f) > 2 && (f[:2] == "0x" || f[:2] == "0X") {
+			f = f[2:]
+			if len(f) == 1 {
+				// 0x7 is a byte too
+				digits.WriteByte('0')
+			}
+		}
+		digits.WriteString(f)
+	}
+	b, err := hex.DecodeString(digits.String())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrParse, err)
+	}
+	return b, nil
+}
+
+// DumpFrame returns a multi-line description of a parsed frame, the value
+// returned by ParseHexFrame or sent on a Module's stream, with its type on
+// the first line and a field on each line after. Only the first few samples
+// of a baseband frame are shown, and Raw is left out.
+func DumpFrame(v interface{}) string {
+	var b strings.Builder
+	if e, ok := v.(*SensorError); ok {
+		fmt.Fprintf(&b, "SensorError\n  Code:    %#02x\n  Message: %s\n", e.Code, e.Message())
+		return b.String()
+	}
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return fmt.Sprintf("%T %v\n", v, v)
+	}
+	b.WriteString(rv.Type().Name())
+	b.WriteByte('\n')
+	var names []string
+	var values []string
+	dumpFields(rv, &names, &values)
+	width := 0
+	for _, name := range names {
+		if len(name) > width {
+			width = len(name)
+		}
+	}
+	for i, name := range names {
+		fmt.Fprintf(&b, "  %-*s %s\n", width+1, name+":", values[i])
+	}
+	return b.String()
+}
+
+// dumpFields appends the names and values of the exported fields of v,
+// flattening embedded structs such as BaseBandHeader.
+func dumpFields(v reflect.Value, names, values *[]string) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() || f.Name == "Raw" {
+			continue
+		}
+		fv := v.Field(i)
+		if f.Anonymous && fv.Kind() == reflect.Struct {
+			dumpFields(fv, names, values)
+			continue
+		}
+		*names = append(*names, f.Name)
+		*values = append(*values, dumpValue(f.Name, fv))
+	}
+}
+
+func dumpValue(name string, v reflect.Value) string {
+	switch {
+	case name == "Time" && v.Kind() == reflect.Int64:
+		return time.Unix(0, v.Int()).UTC().Format(time.RFC3339Nano)
+	case v.Kind() == reflect.Slice:
+		n := v.Len()
+		parts := make([]string, 0, dumpSamples+1)
+		for i := 0; i < n && i < dumpSamples; i++ {
+			parts = append(parts, fmt.Sprint(v.Index(i).Interface()))
+		}
+		if n > dumpSamples {
+			parts = append(parts, "...")
+		}
+		return fmt.Sprintf("[%s] (%d)", strings.Join(parts, " "), n)
+	}
+	return fmt.Sprint(v.Interface())
+}
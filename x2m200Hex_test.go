@@ -0,0 +1,97 @@
+package xethru
+
+import (
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseHexFrame(t *testing.T) {
+	useFakeClock(t)
+	frames := readFixtures(t)
+	tests := []struct {
+		fixture string
+		want    interface{}
+		dump    []string
+	}{
+		{"respiration", Respiration{Time: fakeClockTime, Status: respApp, Counter: 0x0102, State: breathing, RPM: 14, Distance: 0.75, SignalQuality: 7, Movement: -0.5, Valid: true},
+			[]string{"Respiration\n", "  Counter:       258\n", "  Distance:      0.75\n"}},
+		{"sleep", Sleep{Time: fakeClockTime, Status: sleepApp, Counter: 0x0201, State: movement, RPM: 13.5, Distance: 1.25, SignalQuality: 6, MovementSlow: 0.25, MovementFast: 2},
+			[]string{"Sleep\n", "  MovementFast:  2\n"}},
+		{"basebandiq", nil, []string{"BaseBandIQ\n", "  Bins:         2\n", "  SigI:         [0.5 -0.25] (2)\n"}},
+		{"basebandap", nil, []string{"BaseBandAmpPhase\n", "  Phase:        [3 -3] (2)\n"}},
+		{"ack", SystemMessage{Message: "Command Ack'ed"}, []string{"SystemMessage\n", "  Message: Command Ack'ed\n"}},
+		{"error", ErrProtocolNotRecognised, []string{"SensorError\n", "  Code:    0x01\n", "  Message: command not recognised\n"}},
+		{"system", SystemMessage{Message: "System Ready"}, []string{"SystemMessage\n"}},
+	}
+	for n, test := range tests {
+		frame, ok := frames[test.fixture]
+		if !ok {
+			t.Fatalf("test %d Expected: fixture %s, got none\n", n, test.fixture)
+		}
+		// as a logic analyzer would copy it
+		var spaced []string
+		for _, b := range frame {
+			spaced = append(spaced, "0x"+hex.EncodeToString([]byte{b}))
+		}
+		v, err := ParseHexFrame(strings.Join(spaced, " "))
+		if err != nil {
+			t.Errorf("test %d Expected: %v, got %v\n", n, nil, err)
+			continue
+		}
+		if test.want != nil && !reflect.DeepEqual(v, test.want) {
+			t.Errorf("test %d Expected: %+v, got %+v\n", n, test.want, v)
+		}
+		dump := DumpFrame(v)
+		if !strings.HasPrefix(dump, test.dump[0]) {
+			t.Errorf("test %d Expected: dump to start %q, got %q\n", n, test.dump[0], dump)
+		}
+		for _, line := range test.dump[1:] {
+			if !strings.Contains(dump, line) {
+				t.Errorf("test %d Expected: dump to contain %q, got %q\n", n, line, dump)
+			}
+		}
+		if strings.Contains(dump, "Raw") {
+			t.Errorf("test %d Expected: no Raw in dump, got %q\n", n, dump)
+		}
+	}
+}
+
+func TestParseHexFrameFormats(t *testing.T) {
+	tests := []struct {
+		in  string
+		err error
+	}{
+		{"7d106d7e", nil},
+		{"7D 10 6D 7E", nil},
+		{"0x7d,0x10,0x6d,0x7e", nil},
+		{"0x7d, 0x10,\n0x6d, 0x7e\n", nil},
+		{"7d10 6d7e", nil},
+		{"7d 10 6c 7e", ErrPacketBadCRC},
+		{"7d 10 6d 7", ErrParse},
+		{"zz", ErrParse},
+		{"10 6d 7e", ErrPacketNoStartByte},
+	}
+	for n, test := range tests {
+		v, err := ParseHexFrame(test.in)
+		if !errors.Is(err, test.err) {
+			t.Errorf("test %d Expected: %v, got %v\n", n, test.err, err)
+		}
+		if test.err == nil && v != (SystemMessage{Message: "Command Ack'ed"}) {
+			t.Errorf("test %d Expected: ack, got %+v\n", n, v)
+		}
+	}
+}
+
+func TestDumpFrameSamples(t *testing.T) {
+	iq := BaseBandIQ{SigI: make([]float64, 20), SigQ: nil, Raw: []byte{1}}
+	dump := DumpFrame(iq)
+	if !strings.Contains(dump, "[0 0 0 0 0 0 0 0 ...] (20)") || !strings.Contains(dump, "SigQ:") {
+		t.Errorf("Expected: the first samples and their count, got %q\n", dump)
+	}
+	if got := DumpFrame(&iq); got != dump {
+		t.Errorf("Expected: a pointer dumped as its value, got %q\n", got)
+	}
+}
@@ -0,0 +1,89 @@
+package xethru
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// IO pin commands. The command codes, flags and features are unverified, see
+// the package documentation.
+// Example: <Start> + <XTS_SPC_IOPIN> + <XTS_SPCIOP_SETCONTROL> + [Pin(i)] + [Setup(i)] + [Feature(i)] + <CRC> + <End>
+// Example: <Start> + <XTS_SPC_IOPIN> + <XTS_SPCIOP_SETVALUE> + [Pin(i)] + [Value(i)] + <CRC> + <End>
+// Response: <Start> + <XTS_SPR_ACK> + <CRC> + <End>
+// Example: <Start> + <XTS_SPC_IOPIN> + <XTS_SPCIOP_GETVALUE> + [Pin(i)] + <CRC> + <End>
+// Response: <Start> + <XTS_SPR_REPLY> + <XTS_SPC_IOPIN> + <XTS_SPCIOP_GETVALUE> + [Value(i)] + <CRC> + <End>
+const (
+	x2m200IOPin       = 0x40
+	ioPinSetControl   = 0x10
+	ioPinSetValue     = 0x11
+	ioPinGetValue     = 0x12
+	x2m200Reply       = 0x14
+	ioPinGetValueSize = 7
+)
+
+// IO pin setup flags
+const (
+	ioPinInput     uint32 = 0      // the pin is an input
+	ioPinOutput    uint32 = 1 << 0 // the pin is an output
+	ioPinActiveLow uint32 = 1 << 1 // the pin is active low, the default is active high
+)
+
+// IO pin features
+const (
+	ioPinDisabled  uint32 = 0 // the pin is not used
+	ioPinDefault   uint32 = 1 // the pin does what the app does by default
+	ioPinPassive   uint32 = 2 // the pin is controlled by the host with setIOPinValue
+	ioPinPresence  uint32 = 3 // the pin is set while presence is detected
+	ioPinMovement  uint32 = 4 // the pin is set while movement is detected
+	ioPinBreathing uint32 = 5 // the pin is set while breathing is detected
+)
+
+var errIOPinReply = errors.New("io pin reply is not long enough")
+
+// setIOPinControl configures pin with setup, a combination of the io pin setup
+// flags, and feature, one of the io pin features.
+func (r *Module) setIOPinControl(pin, setup, feature uint32) error {
+	cmd := make([]byte, 14)
+	cmd[0] = x2m200IOPin
+	cmd[1] = ioPinSetControl
+	binary.LittleEndian.PutUint32(cmd[2:], pin)
+	binary.LittleEndian.PutUint32(cmd[6:], setup)
+	binary.LittleEndian.PutUint32(cmd[10:], feature)
+	if _, err := r.Execute(cmd, x2m200Ack, r.Timeout); err != nil {
+		return fmt.Errorf("failed to set io pin %d control: %w", pin, err)
+	}
+	return nil
+}
+
+// setIOPinValue sets the value of pin, which must be an output with the
+// passive feature.
+func (r *Module) setIOPinValue(pin, value uint32) error {
+	cmd := make([]byte, 10)
+	cmd[0] = x2m200IOPin
+	cmd[1] = ioPinSetValue
+	binary.LittleEndian.PutUint32(cmd[2:], pin)
+	binary.LittleEndian.PutUint32(cmd[6:], value)
+	if _, err := r.Execute(cmd, x2m200Ack, r.Timeout); err != nil {
+		return fmt.Errorf("failed to set io pin %d value: %w", pin, err)
+	}
+	return nil
+}
+
+// getIOPinValue reads the value of pin.
+func (r *Module) getIOPinValue(pin uint32) (uint32, error) {
+	cmd := make([]byte, 6)
+	cmd[0] = x2m200IOPin
+	cmd[1] = ioPinGetValue
+	binary.LittleEndian.PutUint32(cmd[2:], pin)
+	resp, err := r.exchange(cmd, r.Timeout, func(p []byte) bool {
+		return len(p) > 2 && p[0] == x2m200Reply && p[1] == x2m200IOPin && p[2] == ioPinGetValue
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get io pin %d value: %w", pin, err)
+	}
+	if len(resp) < ioPinGetValueSize {
+		return 0, &LengthError{Err: errIOPinReply, Want: ioPinGetValueSize, Got: len(resp)}
+	}
+	return binary.LittleEndian.Uint32(resp[3:7]), nil
+}
@@ -0,0 +1,73 @@
+package xethru
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestIOPinCommands(t *testing.T) {
+	var value uint32
+	cases := []struct {
+		run   func(m *Module) error
+		reply []byte
+		cmd   []byte
+		err   error
+		value uint32
+	}{
+		{
+			func(m *Module) error { return m.setIOPinControl(1, ioPinOutput, ioPinPassive) },
+			[]byte{x2m200Ack},
+			[]byte{0x40, 0x10, 0x01, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00},
+			nil, 0,
+		}, {
+			func(m *Module) error { return m.setIOPinControl(2, ioPinOutput|ioPinActiveLow, ioPinBreathing) },
+			[]byte{x2m200Ack},
+			[]byte{0x40, 0x10, 0x02, 0x00, 0x00, 0x00, 0x03, 0x00, 0x00, 0x00, 0x05, 0x00, 0x00, 0x00},
+			nil, 0,
+		}, {
+			func(m *Module) error { return m.setIOPinValue(1, 1) },
+			[]byte{x2m200Ack},
+			[]byte{0x40, 0x11, 0x01, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00},
+			nil, 0,
+		}, {
+			func(m *Module) error { return m.setIOPinValue(9, 1) },
+			[]byte{errorByte, notReconsied},
+			[]byte{0x40, 0x11, 0x09, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00},
+			ErrProtocolNotRecognised, 0,
+		}, {
+			func(m *Module) (err error) { value, err = m.getIOPinValue(3); return err },
+			[]byte{x2m200Reply, 0x40, 0x12, 0x01, 0x00, 0x00, 0x00},
+			[]byte{0x40, 0x12, 0x03, 0x00, 0x00, 0x00},
+			nil, 1,
+		}, {
+			func(m *Module) (err error) { value, err = m.getIOPinValue(3); return err },
+			[]byte{x2m200Reply, 0x40, 0x12, 0x01},
+			[]byte{0x40, 0x12, 0x03, 0x00, 0x00, 0x00},
+			errIOPinReply, 0,
+		}, {
+			func(m *Module) (err error) { value, err = m.getIOPinValue(3); return err },
+			[]byte{errorByte, notReconsied},
+			[]byte{0x40, 0x12, 0x03, 0x00, 0x00, 0x00},
+			ErrProtocolNotRecognised, 0,
+		},
+	}
+	for n, c := range cases {
+		f, sensor, stop := newScriptedSensor(func([]byte) []byte { return c.reply })
+		m := NewModule(f, "respiration")
+		m.Timeout = 100 * time.Millisecond
+		value = 0
+		err := c.run(m)
+		if !errors.Is(err, c.err) {
+			t.Errorf("test %d Expected: %v, got %v\n", n, c.err, err)
+		}
+		if value != c.value {
+			t.Errorf("test %d Expected: %d, got %d\n", n, c.value, value)
+		}
+		if cmds := sensor.commands(); len(cmds) != 1 || !bytes.Equal(cmds[0], c.cmd) {
+			t.Errorf("test %d Expected: %x, got %x\n", n, c.cmd, cmds)
+		}
+		stop()
+	}
+}
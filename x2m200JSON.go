@@ -0,0 +1,163 @@
+package xethru
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"time"
+)
+
+// JSONPrecision is the number of decimal places floats are rounded to when
+// Respiration is marshalled to JSON, a negative value does not round.
+var JSONPrecision = 4
+
+// respirationJSON is the JSON form of Respiration.
+type respirationJSON struct {
+	Time          json.RawMessage  `json:"time"`
+	Status        status           `json:"status"`
+	Counter       uint32           `json:"counter"`
+	State         respirationState `json:"state"`
+	RPM           uint32           `json:"rpm"`
+	Distance      jsonFloat        `json:"distance"`
+	SignalQuality jsonFloat        `json:"signalquality"`
+	Movement      jsonFloat        `json:"movement"`
+	Valid         *bool            `json:"valid"`
+	Settling      bool             `json:"settling,omitempty"`
+}
+
+// MarshalJSON encodes r with the time in RFC 3339 format, UTC, the status and
+// state by name and floats rounded to JSONPrecision decimal places. JSON has
+// no NaN or infinity so they are encoded as null, which decodes as NaN.
+func (r Respiration) MarshalJSON() ([]byte, error) {
+	return r.marshalJSON(JSONPrecision)
+}
+
+func (r Respiration) marshalJSON(precision int) ([]byte, error) {
+	t, err := json.Marshal(time.Unix(0, r.Time).UTC().Format(time.RFC3339Nano))
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(respirationJSON{
+		Time:          t,
+		Status:        r.Status,
+		Counter:       r.Counter,
+		State:         r.State,
+		RPM:           r.RPM,
+		Distance:      jsonFloat(roundTo(r.Distance, precision)),
+		SignalQuality: jsonFloat(roundTo(r.SignalQuality, precision)),
+		Movement:      jsonFloat(roundTo(r.Movement, precision)),
+		Valid:         &r.Valid,
+		Settling:      r.Settling,
+	})
+}
+
+// UnmarshalJSON decodes r from the form written by MarshalJSON, the time may
+// also be Unix nanoseconds as it was before. A frame without valid is valid.
+func (r *Respiration) UnmarshalJSON(b []byte) error {
+	var v respirationJSON
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	var ts int64
+	if len(v.Time) > 0 && v.Time[0] == '"' {
+		var s string
+		if err := json.Unmarshal(v.Time, &s); err != nil {
+			return err
+		}
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return err
+		}
+		ts = t.UnixNano()
+	} else if len(v.Time) > 0 {
+		if err := json.Unmarshal(v.Time, &ts); err != nil {
+			return err
+		}
+	}
+	*r = Respiration{
+		Time:          ts,
+		Status:        v.Status,
+		Counter:       v.Counter,
+		State:         v.State,
+		RPM:           v.RPM,
+		Distance:      float64(v.Distance),
+		SignalQuality: float64(v.SignalQuality),
+		Movement:      float64(v.Movement),
+		Valid:         v.Valid == nil || *v.Valid,
+		Settling:      v.Settling,
+	}
+	return nil
+}
+
+// jsonFloat is a float encoded as null when it is NaN or infinite, and
+// decoded as NaN from null.
+type jsonFloat float64
+
+func (f jsonFloat) MarshalJSON() ([]byte, error) {
+	if math.IsNaN(float64(f)) || math.IsInf(float64(f), 0) {
+		return []byte("null"), nil
+	}
+	return json.Marshal(float64(f))
+}
+
+func (f *jsonFloat) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		*f = jsonFloat(math.NaN())
+		return nil
+	}
+	return json.Unmarshal(b, (*float64)(f))
+}
+
+// roundTo rounds f to places decimal places, unless places is negative.
+func roundTo(f float64, places int) float64 {
+	if places < 0 || math.IsNaN(f) || math.IsInf(f, 0) {
+		return f
+	}
+	p := math.Pow10(places)
+	r := math.Round(f*p) / p
+	if r == 0 {
+		return 0 // not -0
+	}
+	return r
+}
+
+// RespirationJSONEncoder writes Respiration frames as newline delimited
+// JSON, one object per line, for tools such as jq or bulk loaders.
+type RespirationJSONEncoder struct {
+	w         io.Writer
+	precision int
+	buf       bytes.Buffer
+}
+
+// JSONOption configures a RespirationJSONEncoder.
+type JSONOption func(*RespirationJSONEncoder)
+
+// WithPrecision sets the number of decimal places floats are rounded to, a
+// negative value does not round.
+func WithPrecision(places int) JSONOption {
+	return func(e *RespirationJSONEncoder) { e.precision = places }
+}
+
+// NewRespirationJSONEncoder creates a RespirationJSONEncoder writing to w that
+// rounds to JSONPrecision unless an option says otherwise.
+func NewRespirationJSONEncoder(w io.Writer, opts ...JSONOption) *RespirationJSONEncoder {
+	e := &RespirationJSONEncoder{w: w, precision: JSONPrecision}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// Encode writes r as a single line.
+func (e *RespirationJSONEncoder) Encode(r Respiration) error {
+	b, err := r.marshalJSON(e.precision)
+	if err != nil {
+		return err
+	}
+	e.buf.Reset()
+	e.buf.Write(b)
+	e.buf.WriteByte('\n')
+	_, err = e.w.Write(e.buf.Bytes())
+	return err
+}
@@ -0,0 +1,97 @@
+package xethru
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+)
+
+var jsonFrames = []Respiration{
+	{Time: 1480000000000000000, Status: respApp, Counter: 1, State: breathing, RPM: 14, Distance: 0.7123456789, SignalQuality: 9, Movement: 0.1, Valid: true},
+	{Time: 1480000000050000000, Status: respApp, Counter: 2, State: noMovement, RPM: 0, Distance: 1.0 / 3.0, SignalQuality: 0, Movement: -2.5e-7},
+}
+
+func TestRespirationJSONEncoder(t *testing.T) {
+	cases := []struct {
+		golden string
+		opts   []JSONOption
+	}{
+		{"respiration.json", nil},
+		{"respiration_full.json", []JSONOption{WithPrecision(-1)}},
+	}
+	for _, c := range cases {
+		var b bytes.Buffer
+		e := NewRespirationJSONEncoder(&b, c.opts...)
+		for _, f := range jsonFrames {
+			if err := e.Encode(f); err != nil {
+				t.Fatal(err)
+			}
+		}
+		compareGolden(t, c.golden, b.Bytes())
+	}
+}
+
+func TestRespirationJSONRoundTrip(t *testing.T) {
+	for n, in := range jsonFrames {
+		b, err := in.marshalJSON(-1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out Respiration
+		if err := json.Unmarshal(b, &out); err != nil {
+			t.Fatalf("test %d %v\n", n, err)
+		}
+		if !reflect.DeepEqual(out, in) {
+			t.Errorf("test %d Expected: %+v, got %+v\n", n, in, out)
+		}
+	}
+
+	// JSON has no NaN or infinity
+	b, err := Respiration{Status: respApp, Distance: math.NaN(), Movement: math.Inf(1), SignalQuality: 0.5}.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(b, []byte(`"distance":null`)) || !bytes.Contains(b, []byte(`"movement":null`)) {
+		t.Errorf("Expected: non-finite floats as null, got %s\n", b)
+	}
+	var nan Respiration
+	if err := json.Unmarshal(b, &nan); err != nil {
+		t.Fatal(err)
+	}
+	if !math.IsNaN(nan.Distance) || !math.IsNaN(nan.Movement) || nan.SignalQuality != 0.5 {
+		t.Errorf("Expected: NaN distance and movement, got %+v\n", nan)
+	}
+
+	// the time used to be Unix nanoseconds
+	var r Respiration
+	if err := json.Unmarshal([]byte(`{"time":1480000000000000000,"state":"movement"}`), &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Time != 1480000000000000000 || r.State != movement || !r.Valid {
+		t.Errorf("Expected: %d %v valid, got %d %v %v\n", int64(1480000000000000000), movement, r.Time, r.State, r.Valid)
+	}
+}
+
+func TestRoundTo(t *testing.T) {
+	cases := []struct {
+		in     float64
+		places int
+		out    float64
+	}{
+		{0.7123456789, 4, 0.7123},
+		{0.71235, 4, 0.7124},
+		{-2.5e-7, 4, 0},
+		{1.5, 0, 2},
+		{1.0 / 3.0, -1, 1.0 / 3.0},
+	}
+	for n, c := range cases {
+		if got := roundTo(c.in, c.places); got != c.out {
+			t.Errorf("test %d Expected: %v, got %v\n", n, c.out, got)
+		}
+	}
+	if got := roundTo(math.NaN(), 2); !math.IsNaN(got) {
+		t.Errorf("Expected: NaN, got %v\n", got)
+	}
+}
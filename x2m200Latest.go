@@ -0,0 +1,29 @@
+package xethru
+
+import "time"
+
+// Latest returns the last Respiration frame Run parsed, when it was received
+// and whether any frame has been received at all.
+func (r *Module) Latest() (Respiration, time.Time, bool) {
+	r.latestMu.RLock()
+	defer r.latestMu.RUnlock()
+	return r.latest, r.latestAt, !r.latestAt.IsZero()
+}
+
+// LatestWithin returns the last Respiration frame Run parsed if it was
+// received less than maxAge ago, so a reading from a sensor that has stopped
+// is not mistaken for a current one.
+func (r *Module) LatestWithin(maxAge time.Duration) (Respiration, bool) {
+	resp, at, ok := r.Latest()
+	if !ok || clock().Now().Sub(at) >= maxAge {
+		return Respiration{}, false
+	}
+	return resp, true
+}
+
+func (r *Module) setLatest(resp Respiration) {
+	r.latestMu.Lock()
+	r.latest = resp
+	r.latestAt = clock().Now()
+	r.latestMu.Unlock()
+}
@@ -0,0 +1,66 @@
+package xethru
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLatest(t *testing.T) {
+	sensor := NewSimulatedSensor()
+	sensor.Interval = time.Millisecond
+	m := NewModule(sensor, "respiration")
+
+	if _, _, ok := m.Latest(); ok {
+		t.Errorf("Expected: nothing received, got ok\n")
+	}
+	if _, ok := m.LatestWithin(time.Hour); ok {
+		t.Errorf("Expected: nothing received, got ok\n")
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		m.Run(nil)
+		close(finished)
+	}()
+
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(time.Millisecond) {
+		if _, _, ok := m.Latest(); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected: a frame, got none\n")
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var last uint32
+			var lastAt time.Time
+			for n := 0; n < 100; n++ {
+				r, at, ok := m.Latest()
+				if ok {
+					if r.Counter < last || at.Before(lastAt) {
+						t.Errorf("test %d Expected: counter and time to increase, got %d after %d\n", i, r.Counter, last)
+					}
+					last, lastAt = r.Counter, at
+				}
+				time.Sleep(100 * time.Microsecond)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	sensor.Close()
+	<-finished
+	if _, ok := m.LatestWithin(time.Hour); !ok {
+		t.Errorf("Expected: recent frame, got none\n")
+	}
+	time.Sleep(5 * time.Millisecond)
+	if _, ok := m.LatestWithin(time.Millisecond); ok {
+		t.Errorf("Expected: stale frame, got ok\n")
+	}
+}
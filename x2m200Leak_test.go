@@ -0,0 +1,89 @@
+package xethru
+
+import (
+	"context"
+	"errors"
+	"io"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// checkGoroutines fails the test if the goroutine count does not return to
+// base, goroutines take a moment to exit after the calls that stop them.
+func checkGoroutines(t *testing.T, base int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > base {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<16)
+			t.Fatalf("Expected: %d goroutines, got %d\n%s", base, runtime.NumGoroutine(), buf[:runtime.Stack(buf, true)])
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+type failingReader struct{ err error }
+
+func (f failingReader) Read([]byte) (int, error) { return 0, f.err }
+
+func TestRunContextTimeoutLeak(t *testing.T) {
+	base := runtime.NumGoroutine()
+	sensor := NewSimulatedSensor()
+	sensor.Interval = time.Millisecond
+	m := NewModule(sensor, "respiration")
+	m.Timeout = 50 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	stream := make(chan interface{}, 1000)
+	if err := m.RunContext(ctx, stream); err != context.DeadlineExceeded {
+		t.Errorf("Expected: %v, got %v\n", context.DeadlineExceeded, err)
+	}
+	sensor.Close()
+	checkGoroutines(t, base)
+}
+
+func TestRunReadErrorLeak(t *testing.T) {
+	base := runtime.NumGoroutine()
+	unplugged := errors.New("device unplugged")
+	f := CreateSplitReadWriter(io.Discard, failingReader{unplugged})
+	m := NewModule(f, "respiration")
+	m.Timeout = 10 * time.Millisecond
+	done := make(chan struct{})
+	go func() {
+		m.Run(nil)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run did not return after a read error")
+	}
+	if err := m.dispatcher.Err(); err != unplugged {
+		t.Errorf("Expected: %v, got %v\n", unplugged, err)
+	}
+	checkGoroutines(t, base)
+}
+
+func TestRunAbandonedConsumerLeak(t *testing.T) {
+	base := runtime.NumGoroutine()
+	sensor := NewSimulatedSensor()
+	sensor.Interval = time.Millisecond
+	m := NewModule(sensor, "respiration")
+	m.Timeout = 50 * time.Millisecond
+	// nobody reads stream, Run blocks handing over the first frame
+	stream := make(chan interface{})
+	done := make(chan struct{})
+	go func() {
+		m.Run(stream)
+		close(done)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	sensor.Close()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run did not return with an abandoned consumer")
+	}
+	checkGoroutines(t, base)
+}
@@ -0,0 +1,94 @@
+package xethru
+
+import (
+	"fmt"
+	"math"
+)
+
+// ErrImplausibleField is wrapped by a FieldError, it wraps ErrParse so an
+// implausible frame is handled like one that failed to parse.
+var ErrImplausibleField = fmt.Errorf("%w: implausible field", ErrParse)
+
+// FieldError is returned for a parsed frame with a field outside Limits,
+// usually a sign that the payload was corrupted or is a different message.
+type FieldError struct {
+	Field string
+	Value float64
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%v: %s %v", ErrImplausibleField, e.Field, e.Value)
+}
+
+// Unwrap returns ErrImplausibleField.
+func (e *FieldError) Unwrap() error {
+	return ErrImplausibleField
+}
+
+// Limits are sanity checks applied to frames after they are parsed. A zero
+// maximum is not checked, NaN and Inf values are always implausible.
+type Limits struct {
+	MaxBins         uint32  // baseband bins
+	MinSamplingFreq float64 // baseband sampling frequency
+	MaxSamplingFreq float64
+	MinCarrierFreq  float64 // baseband carrier frequency
+	MaxCarrierFreq  float64
+	MaxRPM          float64 // respiration and sleep breaths per minute
+}
+
+// DefaultLimits is used by modules with no Limits. The frequency bounds are
+// generous as the units sent by the firmware have not been confirmed.
+var DefaultLimits = Limits{
+	MaxBins:         2048,
+	MaxSamplingFreq: 100e9,
+	MaxCarrierFreq:  100e9,
+	MaxRPM:          255,
+}
+
+// Check returns a FieldError for the first field of a parsed frame outside
+// the limits, frames of other types are not checked.
+func (l Limits) Check(data interface{}) error {
+	switch d := data.(type) {
+	case Respiration:
+		return checkField("rpm", float64(d.RPM), 0, l.MaxRPM)
+	case Sleep:
+		return checkField("rpm", d.RPM, 0, l.MaxRPM)
+	case BaseBandIQ:
+		return l.checkBaseBand(d.BaseBandHeader)
+	case BaseBandAmpPhase:
+		return l.checkBaseBand(d.BaseBandHeader)
+	}
+	return nil
+}
+
+func (l Limits) checkBaseBand(h BaseBandHeader) error {
+	if err := checkField("bins", float64(h.Bins), 0, float64(l.MaxBins)); err != nil {
+		return err
+	}
+	if err := checkField("samplingfreq", h.SamplingFreq, l.MinSamplingFreq, l.MaxSamplingFreq); err != nil {
+		return err
+	}
+	return checkField("carrierfreq", h.CarrierFreq, l.MinCarrierFreq, l.MaxCarrierFreq)
+}
+
+func checkField(name string, v, min, max float64) error {
+	if math.IsNaN(v) || math.IsInf(v, 0) || v < min || max > 0 && v > max {
+		return &FieldError{Field: name, Value: v}
+	}
+	return nil
+}
+
+// limits returns the module's Limits, falling back to DefaultLimits.
+func (r *Module) limits() Limits {
+	if r.Limits != nil {
+		return *r.Limits
+	}
+	return DefaultLimits
+}
+
+func (b *BaseBandModule) limits() Limits {
+	if b.Limits != nil {
+		return *b.Limits
+	}
+	return DefaultLimits
+}
@@ -0,0 +1,46 @@
+package xethru
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestLimits(t *testing.T) {
+	iq := func(bins uint32, sampling, carrier float64) BaseBandIQ {
+		return BaseBandIQ{BaseBandHeader: BaseBandHeader{Bins: bins, SamplingFreq: sampling, CarrierFreq: carrier}}
+	}
+	cases := []struct {
+		limits Limits
+		data   interface{}
+		field  string
+	}{
+		{DefaultLimits, Respiration{RPM: 14}, ""},
+		{DefaultLimits, Respiration{RPM: 255}, ""},
+		{DefaultLimits, Respiration{RPM: 256}, "rpm"},
+		{DefaultLimits, Sleep{RPM: 12.5}, ""},
+		{DefaultLimits, Sleep{RPM: -1}, "rpm"},
+		{DefaultLimits, Sleep{RPM: math.NaN()}, "rpm"},
+		{DefaultLimits, iq(256, 39e9, 7.29e9), ""},
+		{DefaultLimits, iq(0x7fffffff, 39e9, 7.29e9), "bins"},
+		{DefaultLimits, BaseBandAmpPhase{BaseBandHeader: BaseBandHeader{Bins: 256, SamplingFreq: math.Inf(1)}}, "samplingfreq"},
+		{DefaultLimits, iq(256, 39e9, -7.29e9), "carrierfreq"},
+		{Limits{MaxBins: 128}, iq(256, 0, 0), "bins"},
+		{Limits{MinSamplingFreq: 1e9}, iq(256, 0, 0), "samplingfreq"},
+		// zero limits only reject NaN, Inf and negative values
+		{Limits{}, Respiration{RPM: 1000}, ""},
+		{Limits{}, movingList{}, ""},
+	}
+	for n, c := range cases {
+		err := c.limits.Check(c.data)
+		var fieldErr *FieldError
+		switch {
+		case c.field == "" && err != nil:
+			t.Errorf("test %d Expected: <nil>, got %v\n", n, err)
+		case c.field != "" && (!errors.As(err, &fieldErr) || fieldErr.Field != c.field):
+			t.Errorf("test %d Expected: %s, got %v\n", n, c.field, err)
+		case c.field != "" && !errors.Is(err, ErrParse):
+			t.Errorf("test %d Expected: %v, got %v\n", n, ErrParse, err)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package xethru
+
+import (
+	"errors"
+	"fmt"
+	"log"
+)
+
+// Logger receives the package's diagnostic messages. Debugf is used for
+// progress messages during normal operation, Warnf for recoverable problems
+// such as bad frames and Errorf for failures that stop data being received.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debugf(format string, args ...interface{}) {}
+func (nopLogger) Warnf(format string, args ...interface{})  {}
+func (nopLogger) Errorf(format string, args ...interface{}) {}
+
+// stdLogger prefixes each message with its level.
+type stdLogger struct {
+	l     *log.Logger
+	debug bool
+}
+
+// NewStdLogger returns a Logger that writes warnings and errors to l, and
+// debug messages too if debug is set. A nil l uses the standard logger.
+func NewStdLogger(l *log.Logger, debug bool) Logger {
+	if l == nil {
+		l = log.Default()
+	}
+	return &stdLogger{l: l, debug: debug}
+}
+
+func (s *stdLogger) Debugf(format string, args ...interface{}) {
+	if s.debug {
+		s.l.Output(2, "DEBUG "+fmt.Sprintf(format, args...))
+	}
+}
+
+func (s *stdLogger) Warnf(format string, args ...interface{}) {
+	s.l.Output(2, "WARN "+fmt.Sprintf(format, args...))
+}
+
+func (s *stdLogger) Errorf(format string, args ...interface{}) {
+	s.l.Output(2, "ERROR "+fmt.Sprintf(format, args...))
+}
+
+// loggerBox lets loggers of different types share an atomic.Value.
+type loggerBox struct{ Logger }
+
+// SetLogger sets the Logger of a Framer created by this package, it is also
+// used by any Dispatcher reading from f. A nil l discards messages.
+func SetLogger(f Framer, l Logger) error {
+	x, ok := f.(*x2m200Frame)
+	if !ok {
+		return errLoggerNotSupported
+	}
+	x.logger.Store(loggerBox{l})
+	return nil
+}
+
+var errLoggerNotSupported = errors.New("framer does not support a logger")
+
+// frameLogger returns the Logger set on f, or a no-op Logger.
+func frameLogger(f Framer) Logger {
+	if x, ok := f.(*x2m200Frame); ok {
+		if b, _ := x.logger.Load().(loggerBox); b.Logger != nil {
+			return b.Logger
+		}
+	}
+	return nopLogger{}
+}
+
+// log returns the module's Logger, falling back to the Framer's.
+func (r *Module) log() Logger {
+	if r.Logger != nil {
+		return r.Logger
+	}
+	return frameLogger(r.f)
+}
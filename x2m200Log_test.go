@@ -0,0 +1,129 @@
+package xethru
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *fakeLogger) logf(level, format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, level+" "+fmt.Sprintf(format, args...))
+}
+
+func (l *fakeLogger) Debugf(format string, args ...interface{}) { l.logf("debug", format, args...) }
+func (l *fakeLogger) Warnf(format string, args ...interface{})  { l.logf("warn", format, args...) }
+func (l *fakeLogger) Errorf(format string, args ...interface{}) { l.logf("error", format, args...) }
+
+// above returns the lines logged at warn or error.
+func (l *fakeLogger) above() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var out []string
+	for _, line := range l.lines {
+		if !strings.HasPrefix(line, "debug ") {
+			out = append(out, line)
+		}
+	}
+	return out
+}
+
+func TestModuleLogger(t *testing.T) {
+	sensor := NewSimulatedSensor()
+	defer sensor.Close()
+	m := NewModule(sensor, "respiration")
+	l := &fakeLogger{}
+	m.Logger = l
+
+	if err := m.SetLEDMode(); err != nil {
+		t.Error(err)
+	}
+	if err := m.Load(); err != nil {
+		t.Error(err)
+	}
+	if err := m.SetDetectionZone(0.4, 2.0); err != nil {
+		t.Error(err)
+	}
+	if lines := l.above(); len(lines) != 0 {
+		t.Errorf("Expected: no warnings, got %q\n", lines)
+	}
+	if len(l.lines) == 0 {
+		t.Errorf("Expected: debug messages, got none\n")
+	}
+}
+
+func TestFramerLogger(t *testing.T) {
+	f, sensor := newFakeSensor(0)
+	// ack the start command then send a frame too short to parse
+	sensor.setReplies([]byte{x2m200Ack}, []byte{appDataByte, respirationStartByte})
+	l := &fakeLogger{}
+	if err := SetLogger(f, l); err != nil {
+		t.Fatal(err)
+	}
+	m := NewModule(f, "respiration")
+	failed := make(chan struct{}, 1)
+	if err := m.OnError(func(error) {
+		select {
+		case failed <- struct{}{}:
+		default:
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		m.Run(nil)
+		close(done)
+	}()
+	<-failed
+	sensor.Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after the sensor closed")
+	}
+	if lines := l.above(); len(lines) != 1 || !strings.HasPrefix(lines[0], "warn ") {
+		t.Errorf("Expected: 1 warning, got %q\n", lines)
+	}
+}
+
+func TestDefaultLoggerSilent(t *testing.T) {
+	var buf bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&buf)
+
+	sensor := NewSimulatedSensor()
+	defer sensor.Close()
+	m := NewModule(sensor, "sleep")
+	if err := m.SetLEDMode(); err != nil {
+		t.Error(err)
+	}
+	if err := m.Enable("iq"); err != nil {
+		t.Error(err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Expected: no output, got %q\n", buf.String())
+	}
+}
+
+func TestStdLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewStdLogger(log.New(&buf, "", 0), false)
+	l.Debugf("hidden %d", 1)
+	l.Warnf("shown %d", 2)
+	l.Errorf("shown %d", 3)
+	want := "WARN shown 2\nERROR shown 3\n"
+	if buf.String() != want {
+		t.Errorf("Expected: %q, got %q\n", want, buf.String())
+	}
+}
@@ -0,0 +1,88 @@
+package xethru
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/NeuralSpaz/xethru/protocol"
+)
+
+var errMarshalType = errors.New("type can not be marshalled as a payload")
+
+// MarshalPayload returns the payload the sensor sends for v, the inverse of
+// the parsers: a Respiration, Sleep, BaseBandIQ or BaseBandAmpPhase,
+// baseband samples as float32, a SystemMessage as parsed from the booting,
+// ready or ack messages, or a *SensorError as an error reply. Time, Valid and
+// Raw are not sent so are ignored. Parsing the payload gives v back as long
+// as its floats are float32 values.
+func MarshalPayload(v interface{}) ([]byte, error) {
+	switch f := v.(type) {
+	case Respiration:
+		return protocol.AppendRespiration(make([]byte, 0, respsize), protocol.Respiration{
+			Status:        uint32(f.Status),
+			Counter:       f.Counter,
+			State:         uint32(f.State),
+			RPM:           f.RPM,
+			Distance:      f.Distance,
+			SignalQuality: f.SignalQuality,
+			Movement:      f.Movement,
+		}), nil
+	case Sleep:
+		return protocol.AppendSleep(make([]byte, 0, sleepsize), protocol.Sleep{
+			Status:        uint32(f.Status),
+			Counter:       f.Counter,
+			State:         uint32(f.State),
+			RPM:           f.RPM,
+			Distance:      f.Distance,
+			SignalQuality: f.SignalQuality,
+			MovementSlow:  f.MovementSlow,
+			MovementFast:  f.MovementFast,
+		}), nil
+	case BaseBandIQ:
+		return protocol.AppendBaseBandIQ(make([]byte, 0, iqheadersize+8*len(f.SigI)), protocol.BaseBandIQ{
+			BaseBandHeader: protocolHeader(f.BaseBandHeader),
+			SigI:           f.SigI,
+			SigQ:           f.SigQ,
+		}, protocol.FormatFloat), nil
+	case BaseBandAmpPhase:
+		return protocol.AppendBaseBandAP(make([]byte, 0, apheadersize+8*len(f.Amplitude)), protocol.BaseBandAmpPhase{
+			BaseBandHeader: protocolHeader(f.BaseBandHeader),
+			Amplitude:      f.Amplitude,
+			Phase:          f.Phase,
+		}, protocol.FormatFloat), nil
+	case SystemMessage:
+		switch f.Message {
+		case messageBooting:
+			return []byte{systemMesg, systemBooting}, nil
+		case messageReady:
+			return []byte{systemMesg, systemReady}, nil
+		case messageAck:
+			return []byte{ack}, nil
+		}
+		return nil, fmt.Errorf("%w: system message %q", errMarshalType, f.Message)
+	case *SensorError:
+		return []byte{errorByte, f.Code}, nil
+	}
+	return nil, fmt.Errorf("%w: %T", errMarshalType, v)
+}
+
+// MarshalFrame returns v framed as the sensor sends it, see MarshalPayload.
+func MarshalFrame(v interface{}) ([]byte, error) {
+	p, err := MarshalPayload(v)
+	if err != nil {
+		return nil, err
+	}
+	return EncodeFrame(p), nil
+}
+
+func protocolHeader(h BaseBandHeader) protocol.BaseBandHeader {
+	return protocol.BaseBandHeader{
+		Status:       uint32(h.Status),
+		Counter:      h.Counter,
+		Bins:         h.Bins,
+		BinLength:    h.BinLength,
+		SamplingFreq: h.SamplingFreq,
+		CarrierFreq:  h.CarrierFreq,
+		RangeOffset:  h.RangeOffset,
+	}
+}
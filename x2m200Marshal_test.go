@@ -0,0 +1,56 @@
+package xethru
+
+import (
+	"errors"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestMarshalPayloadRoundTrip(t *testing.T) {
+	useFakeClock(t)
+	rnd := rand.New(rand.NewSource(1))
+	f32 := func() float64 { return float64(float32(rnd.NormFloat64())) }
+	samples := func(n int) []float64 {
+		s := make([]float64, n)
+		for i := range s {
+			s[i] = f32()
+		}
+		return s
+	}
+	header := BaseBandHeader{Time: fakeClockTime, Counter: 42, Bins: 17, BinLength: f32(), SamplingFreq: f32(), CarrierFreq: f32(), RangeOffset: f32()}
+	iq, ap := header, header
+	iq.Status, ap.Status = basebandIQ, basebandAP
+
+	cases := []interface{}{
+		Respiration{Time: fakeClockTime, Status: respApp, Counter: 1 << 31, State: noMovement, RPM: 22, Distance: f32(), SignalQuality: 9, Movement: f32(), Valid: true},
+		Sleep{Time: fakeClockTime, Status: sleepApp, Counter: 5, State: initializing, RPM: f32(), Distance: f32(), SignalQuality: 3, MovementSlow: f32(), MovementFast: f32()},
+		BaseBandIQ{BaseBandHeader: iq, SigI: samples(17), SigQ: samples(17)},
+		BaseBandAmpPhase{BaseBandHeader: ap, Amplitude: samples(17), Phase: samples(17)},
+		SystemMessage{Message: messageBooting},
+		&SensorError{Code: crcFailed},
+	}
+	for n, v := range cases {
+		p, err := MarshalPayload(v)
+		if err != nil {
+			t.Fatalf("test %d %v", n, err)
+		}
+		var got interface{}
+		if perr := protocolErr(p); perr != nil {
+			got = perr
+		} else {
+			got, err = parse(p)
+		}
+		if err != nil || !reflect.DeepEqual(got, v) {
+			t.Errorf("test %d Expected: %+v, got %+v %v\n", n, v, got, err)
+		}
+	}
+}
+
+func TestMarshalPayloadErrors(t *testing.T) {
+	for n, v := range []interface{}{nil, 7, SystemMessage{Message: "hello"}, movingList{}} {
+		if _, err := MarshalFrame(v); !errors.Is(err, errMarshalType) {
+			t.Errorf("test %d Expected: %v, got %v\n", n, errMarshalType, err)
+		}
+	}
+}
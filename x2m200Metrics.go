@@ -0,0 +1,122 @@
+package xethru
+
+import (
+	"errors"
+	"expvar"
+	"sync"
+)
+
+// MetricsSink receives counters and gauges for monitoring sensor health, it
+// can be adapted to Prometheus, statsd or similar. The names are the Metric
+// constants. It is called from the read path so must be fast and safe for
+// concurrent use.
+type MetricsSink interface {
+	Counter(name string, delta float64)
+	Gauge(name string, value float64)
+}
+
+// Metric names
+const (
+	MetricFrames               = "xethru_frames_total"                // frames read with a good crc
+	MetricCRCErrors            = "xethru_crc_errors_total"            // frames read with a bad crc
+	MetricFramingErrors        = "xethru_framing_errors_total"        // malformed frames and bytes outside frames
+	MetricRespirationFrames    = "xethru_respiration_frames_total"    // respiration frames parsed by a Module
+	MetricParseErrors          = "xethru_parse_errors_total"          // data frames a Module failed to parse
+	MetricGatedFrames          = "xethru_gated_frames_total"          // respiration frames below MinSignalQuality
+	MetricDuplicateFrames      = "xethru_duplicate_frames_total"      // frames dropped by DropDuplicates
+	MetricDroppedFrames        = "xethru_dropped_frames_total"        // frames dropped from a full StreamBuffer
+	MetricRespirationRPM       = "xethru_respiration_rpm"             // rpm of the last respiration frame
+	MetricRespirationDistance  = "xethru_respiration_distance"        // distance of the last respiration frame
+	MetricFrameRate            = "xethru_frame_rate"                  // respiration frames per second measured by a Module
+	MetricReboots              = "xethru_reboots_total"               // reboots of the sensor while a Module was streaming
+	MetricSinkDropped          = "xethru_sink_dropped_frames_total"   // frames dropped from a full sink queue
+	MetricSinkErrors           = "xethru_sink_errors_total"           // errors writing to a sink
+	MetricAnomalousTransitions = "xethru_anomalous_transitions_total" // illegal respiration state transitions, see TransitionValidator
+)
+
+type nopMetrics struct{}
+
+func (nopMetrics) Counter(name string, delta float64) {}
+func (nopMetrics) Gauge(name string, value float64)   {}
+
+// metricsBox lets sinks of different types share an atomic.Value.
+type metricsBox struct{ MetricsSink }
+
+// SetMetrics sets the MetricsSink of a Framer created by this package. A nil
+// m stops metrics.
+func SetMetrics(f Framer, m MetricsSink) error {
+	x, ok := f.(*x2m200Frame)
+	if !ok {
+		return errMetricsNotSupported
+	}
+	x.metrics.Store(metricsBox{m})
+	return nil
+}
+
+var errMetricsNotSupported = errors.New("framer does not support metrics")
+
+// frameMetrics returns the MetricsSink set on f, or a no-op sink.
+func frameMetrics(f Framer) MetricsSink {
+	if x, ok := f.(*x2m200Frame); ok {
+		if b, _ := x.metrics.Load().(metricsBox); b.MetricsSink != nil {
+			return b.MetricsSink
+		}
+	}
+	return nopMetrics{}
+}
+
+// countErr counts a framing or crc error in the stats and metrics.
+func (x *x2m200Frame) countErr(err error) {
+	x.stats.countErr(err)
+	switch err.(type) {
+	case *CRCError:
+		frameMetrics(x).Counter(MetricCRCErrors, 1)
+	case *FramingError:
+		frameMetrics(x).Counter(MetricFramingErrors, 1)
+	}
+}
+
+// metrics returns the module's MetricsSink, falling back to the Framer's.
+func (r *Module) metrics() MetricsSink {
+	if r.Metrics != nil {
+		return r.Metrics
+	}
+	return frameMetrics(r.f)
+}
+
+// ExpvarMetrics is a MetricsSink that publishes the metrics in an expvar.Map,
+// so they are served on /debug/vars with no other dependencies.
+type ExpvarMetrics struct {
+	m  *expvar.Map
+	mu sync.Mutex // held while adding a gauge
+}
+
+// NewExpvarMetrics publishes a new expvar.Map called name and returns a sink
+// that writes to it. Like expvar.Publish it panics if name is already in use.
+func NewExpvarMetrics(name string) *ExpvarMetrics {
+	return &ExpvarMetrics{m: expvar.NewMap(name)}
+}
+
+// Counter adds delta to the counter name.
+func (e *ExpvarMetrics) Counter(name string, delta float64) {
+	e.m.AddFloat(name, delta)
+}
+
+// Gauge sets the gauge name to value.
+func (e *ExpvarMetrics) Gauge(name string, value float64) {
+	v, ok := e.m.Get(name).(*expvar.Float)
+	if !ok {
+		e.mu.Lock()
+		if v, ok = e.m.Get(name).(*expvar.Float); !ok {
+			v = new(expvar.Float)
+			e.m.Set(name, v)
+		}
+		e.mu.Unlock()
+	}
+	v.Set(value)
+}
+
+// Map returns the expvar.Map the metrics are published in.
+func (e *ExpvarMetrics) Map() *expvar.Map {
+	return e.m
+}
@@ -0,0 +1,94 @@
+package xethru
+
+import (
+	"bytes"
+	"expvar"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeMetrics struct {
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func (f *fakeMetrics) Counter(name string, delta float64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.values[name] += delta
+}
+
+func (f *fakeMetrics) Gauge(name string, value float64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.values[name] = value
+}
+
+func TestMetrics(t *testing.T) {
+	var session []byte
+	session = append(session, encodeFrame(respirationPayload)...)
+	session = append(session, 0x01, 0x02)
+	session = append(session, 0x7d, 0x01, 0x02, 0x03, 0x71, 0x7e)
+	session = append(session, encodeFrame([]byte{appDataByte, respirationStartByte, 0x00})...)
+	session = append(session, encodeFrame(respirationPayload)...)
+
+	sink := &fakeMetrics{values: make(map[string]float64)}
+	f := CreateSplitReadWriter(io.Discard, bytes.NewReader(session))
+	if err := SetMetrics(f, sink); err != nil {
+		t.Fatal(err)
+	}
+	m := NewModule(f, "respiration")
+	m.Timeout = 10 * time.Millisecond
+	stream := make(chan interface{}, 10)
+	m.Run(stream)
+
+	expected := map[string]float64{
+		MetricFrames:              3,
+		MetricCRCErrors:           1,
+		MetricFramingErrors:       1,
+		MetricRespirationFrames:   2,
+		MetricParseErrors:         1,
+		MetricRespirationRPM:      14,
+		MetricRespirationDistance: 0,
+	}
+	// the rate of two frames read back to back depends on the machine
+	if rate, ok := sink.values[MetricFrameRate]; !ok || rate <= 0 {
+		t.Errorf("Expected: %s gauge, got %v\n", MetricFrameRate, sink.values)
+	}
+	delete(sink.values, MetricFrameRate)
+	if !reflect.DeepEqual(sink.values, expected) {
+		t.Errorf("Expected: %v, got %v\n", expected, sink.values)
+	}
+}
+
+func TestExpvarMetrics(t *testing.T) {
+	// names can only be published once, go test -count reruns tests
+	name := fmt.Sprintf("xethru_test_%d", time.Now().UnixNano())
+	e := NewExpvarMetrics(name)
+	e.Counter(MetricFrames, 1)
+	e.Counter(MetricFrames, 2)
+	e.Gauge(MetricRespirationRPM, 12)
+	e.Gauge(MetricRespirationRPM, 14)
+
+	if v := e.Map().Get(MetricFrames).(*expvar.Float).Value(); v != 3 {
+		t.Errorf("Expected: %v, got %v\n", 3, v)
+	}
+	if v := e.Map().Get(MetricRespirationRPM).(*expvar.Float).Value(); v != 14 {
+		t.Errorf("Expected: %v, got %v\n", 14, v)
+	}
+	if expvar.Get(name) != e.Map() {
+		t.Error("Expected: map to be published")
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		e.Counter(MetricFrames, 1)
+		e.Gauge(MetricRespirationRPM, 14)
+	})
+	if allocs != 0 {
+		t.Errorf("Expected: %d allocations, got %v\n", 0, allocs)
+	}
+}
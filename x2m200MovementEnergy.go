@@ -0,0 +1,101 @@
+package xethru
+
+import (
+	"errors"
+	"math"
+)
+
+// Energy is the movement energy of a frame within a MovementEnergy's range
+// gate.
+type Energy struct {
+	Time    int64
+	Energy  float64 // sum of the change in amplitude of each gated bin
+	Average float64 // rolling average of Energy, Energy if there is none
+}
+
+// MovementEnergy measures movement within a range gate, from Start to End
+// meters, as the sum over the gated bins of the absolute change in amplitude
+// from the previous frame. If Average is more than 1 each Energy also has
+// the mean of the last Average energies.
+type MovementEnergy struct {
+	Start   float64
+	End     float64
+	Average int
+
+	prev    []float64
+	lo, hi  int
+	header  BaseBandHeader // geometry prev was gated with
+	history []float64
+	next    int
+	sum     float64
+}
+
+// NewMovementEnergy creates a MovementEnergy gated from start to end meters.
+func NewMovementEnergy(start, end float64) *MovementEnergy {
+	return &MovementEnergy{Start: start, End: end}
+}
+
+// Apply adds ap and returns true with its energy. The first frame, and the
+// first after the number, length or offset of the bins changes, only sets
+// the amplitudes the next frame is compared with.
+func (m *MovementEnergy) Apply(ap BaseBandAmpPhase) (Energy, bool, error) {
+	if m.End < m.Start {
+		return Energy{}, false, errEnergyGate
+	}
+	amp := ap.Amplitude
+	if len(amp) < int(ap.Bins) {
+		return Energy{}, false, errRangeOutOfBounds
+	}
+	h := ap.BaseBandHeader
+	if m.prev == nil || h.Bins != m.header.Bins || h.BinLength != m.header.BinLength || h.RangeOffset != m.header.RangeOffset {
+		lo, hi := -1, -1
+		for i, r := range h.RangeBins() {
+			if r >= m.Start && r <= m.End {
+				if lo < 0 {
+					lo = i
+				}
+				hi = i + 1
+			}
+		}
+		if lo < 0 {
+			return Energy{}, false, errRangeOutOfBounds
+		}
+		m.lo, m.hi, m.header = lo, hi, h
+		m.prev = append(m.prev[:0], amp[lo:hi]...)
+		return Energy{}, false, nil
+	}
+
+	var e float64
+	for i, a := range amp[m.lo:m.hi] {
+		e += math.Abs(a - m.prev[i])
+		m.prev[i] = a
+	}
+	return Energy{Time: h.Time, Energy: e, Average: m.average(e)}, true, nil
+}
+
+// average adds e to the rolling window and returns its mean.
+func (m *MovementEnergy) average(e float64) float64 {
+	if m.Average <= 1 {
+		return e
+	}
+	if len(m.history) < m.Average {
+		m.history = append(m.history, e)
+		m.sum += e
+		return m.sum / float64(len(m.history))
+	}
+	m.next %= len(m.history)
+	m.sum += e - m.history[m.next]
+	m.history[m.next] = e
+	m.next++
+	return m.sum / float64(len(m.history))
+}
+
+// Reset discards the previous frame and the rolling average.
+func (m *MovementEnergy) Reset() {
+	m.prev = nil
+	m.history = m.history[:0]
+	m.next = 0
+	m.sum = 0
+}
+
+var errEnergyGate = errors.New("movement energy gate ends before it starts")
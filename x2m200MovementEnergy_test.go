@@ -0,0 +1,111 @@
+package xethru
+
+import (
+	"math"
+	"testing"
+)
+
+// movingTarget returns frame n of a target with amplitude 1 moving one bin
+// every frame from bin from, with a static reflector of amplitude 5 at bin 2.
+func movingTarget(n, from, bins int) BaseBandAmpPhase {
+	amp := make([]float64, bins)
+	amp[2] = 5
+	if b := from + n; b >= 0 && b < bins {
+		amp[b] += 1
+	}
+	return BaseBandAmpPhase{
+		BaseBandHeader: BaseBandHeader{Time: int64(n), Status: basebandAP, Bins: uint32(bins), BinLength: 0.1, RangeOffset: 0.5},
+		Amplitude:      amp,
+		Phase:          make([]float64, bins),
+	}
+}
+
+func TestMovementEnergy(t *testing.T) {
+	// bins 5 to 10 are 1m to 1.5m
+	m := NewMovementEnergy(1, 1.5)
+	var got []float64
+	for n := 0; n < 15; n++ {
+		e, ok, err := m.Apply(movingTarget(n, 0, 20))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n == 0 {
+			if ok {
+				t.Error("Expected: no energy for the first frame")
+			}
+			continue
+		}
+		if !ok || e.Time != int64(n) {
+			t.Fatalf("frame %d Expected: energy, got %+v %v\n", n, e, ok)
+		}
+		got = append(got, e.Energy)
+	}
+	// the target is in the gate at bins 5 to 10, leaving it or entering it
+	// is a change of 1, moving within it 2
+	expected := []float64{0, 0, 0, 0, 1, 2, 2, 2, 2, 2, 1, 0, 0, 0}
+	for n := range expected {
+		if math.Abs(got[n]-expected[n]) > 1e-9 {
+			t.Errorf("frame %d Expected: %v, got %v\n", n+1, expected[n], got[n])
+		}
+	}
+}
+
+func TestMovementEnergyAverage(t *testing.T) {
+	m := NewMovementEnergy(1, 1.5)
+	m.Average = 3
+	var averages []float64
+	for n := 0; n < 12; n++ {
+		e, ok, err := m.Apply(movingTarget(n, 0, 20))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok {
+			averages = append(averages, e.Average)
+		}
+	}
+	expected := []float64{0, 0, 0, 0, 1.0 / 3, 1, 5.0 / 3, 2, 2, 2, 5.0 / 3}
+	for n := range expected {
+		if math.Abs(averages[n]-expected[n]) > 1e-9 {
+			t.Errorf("frame %d Expected: %v, got %v\n", n+1, expected[n], averages[n])
+		}
+	}
+
+	m.Reset()
+	if _, ok, _ := m.Apply(movingTarget(0, 0, 20)); ok {
+		t.Error("Expected: no energy for the first frame after Reset")
+	}
+	if e, _, _ := m.Apply(movingTarget(4, 0, 20)); e.Average != e.Energy {
+		t.Errorf("Expected: the average to start again, got %+v\n", e)
+	}
+}
+
+func TestMovementEnergyBinsChange(t *testing.T) {
+	m := NewMovementEnergy(1, 1.5)
+	m.Apply(movingTarget(5, 0, 20))
+	if _, ok, _ := m.Apply(movingTarget(6, 0, 20)); !ok {
+		t.Fatal("Expected: energy")
+	}
+	// a frame with fewer bins is the first of a new series
+	if _, ok, err := m.Apply(movingTarget(7, 0, 12)); ok || err != nil {
+		t.Errorf("Expected: no energy after the bins change, got %v %v\n", ok, err)
+	}
+	if e, ok, _ := m.Apply(movingTarget(8, 0, 12)); !ok || e.Energy != 2 {
+		t.Errorf("Expected: energy 2, got %+v %v\n", e, ok)
+	}
+
+	tests := []struct {
+		start, end float64
+		frame      BaseBandAmpPhase
+		err        error
+	}{
+		{1.5, 1, movingTarget(0, 0, 20), errEnergyGate},
+		{5, 6, movingTarget(0, 0, 20), errRangeOutOfBounds},
+		{1, 1.5, BaseBandAmpPhase{BaseBandHeader: BaseBandHeader{Bins: 4}}, errRangeOutOfBounds},
+	}
+	for n, test := range tests {
+		m := NewMovementEnergy(test.start, test.end)
+		if _, _, err := m.Apply(test.frame); err != test.err {
+			t.Errorf("test %d Expected: %v, got %v\n", n, test.err, err)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package xethru
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// movingListID is the content ID of the sleep app's movinglist message. The
+// ID and layout are unverified, see the package documentation, so the
+// messages are only parsed for the movinglist channel and not delivered by
+// Run.
+// <0x50> + <ID> + <Counter> + <IntervalCount(n)> + [Slow(n)] + [Fast(n)]
+const (
+	movingListID         = 0x610a3b00
+	movingListStartByte  = movingListID & 0xff
+	movingListHeaderSize = 13
+)
+
+// movingListBuffer is the number of movinglist messages held for a slow
+// reader of movingListChan before the oldest is dropped.
+const movingListBuffer = 16
+
+var errMovingListLength = fmt.Errorf("%w: movinglist message does not contain its intervals", ErrParse)
+
+// movingList is the sleep app's movement histogram, the slow and fast
+// movement in each of the last IntervalCount intervals, oldest first.
+type movingList struct {
+	Time          int64     `json:"time"`
+	Counter       uint32    `json:"counter"`
+	IntervalCount uint32    `json:"intervalcount"`
+	MovementSlow  []float64 `json:"movementslow"`
+	MovementFast  []float64 `json:"movementfast"`
+}
+
+func parseMovingList(b []byte) (movingList, error) {
+	if len(b) < movingListHeaderSize {
+		return movingList{}, &LengthError{Err: errMovingListLength, Want: movingListHeaderSize, Got: len(b)}
+	}
+	n := binary.LittleEndian.Uint32(b[9:13])
+	want := uint64(movingListHeaderSize) + 8*uint64(n)
+	if uint64(len(b)) != want {
+		return movingList{}, &LengthError{Err: errMovingListLength, Want: int(want), Got: len(b)}
+	}
+	m := movingList{
+		Time:          clock().Now().UnixNano(),
+		Counter:       binary.LittleEndian.Uint32(b[5:9]),
+		IntervalCount: n,
+	}
+	if n == 0 {
+		return m, nil
+	}
+	m.MovementSlow = make([]float64, n)
+	m.MovementFast = make([]float64, n)
+	for i := range m.MovementSlow {
+		m.MovementSlow[i] = float32At(b, movingListHeaderSize+4*i)
+		m.MovementFast[i] = float32At(b, movingListHeaderSize+4*(int(n)+i))
+	}
+	return m, nil
+}
+
+// movingListChan returns the channel that receives the movinglist messages
+// Run reads, they are sent by the sleep app when its movinglist output is
+// enabled. If the reader falls behind the oldest message is dropped. The
+// channel is closed when Run returns, after that a new channel is made for
+// the next Run.
+func (r *Module) movingListChan() chan movingList {
+	r.movingListMu.Lock()
+	defer r.movingListMu.Unlock()
+	if r.movingList == nil {
+		r.movingList = make(chan movingList, movingListBuffer)
+	}
+	return r.movingList
+}
+
+// closeMovingList closes the movinglist channel at the end of Run.
+func (r *Module) closeMovingList() {
+	r.movingListMu.Lock()
+	defer r.movingListMu.Unlock()
+	if r.movingList != nil {
+		close(r.movingList)
+		r.movingList = nil
+	}
+}
+
+// publishMovingList sends m to the movinglist channel, dropping the oldest
+// message if it is full.
+func (r *Module) publishMovingList(m movingList) {
+	c := r.movingListChan()
+	for {
+		select {
+		case c <- m:
+			return
+		default:
+			select {
+			case <-c:
+				r.log().Debugf("movinglist reader is behind, dropped a message")
+			default:
+			}
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package xethru
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// movingListPayload builds a movinglist payload with n intervals, slow
+// movement i and fast movement 2i in interval i.
+func movingListPayload(counter, n uint32) ([]byte, movingList) {
+	b := []byte{appDataByte, 0x00, 0x3b, 0x0a, 0x61}
+	b = binary.LittleEndian.AppendUint32(b, counter)
+	b = binary.LittleEndian.AppendUint32(b, n)
+	m := movingList{Time: fakeClockTime, Counter: counter, IntervalCount: n}
+	for i := uint32(0); i < n; i++ {
+		b = binary.LittleEndian.AppendUint32(b, math.Float32bits(float32(i)))
+		m.MovementSlow = append(m.MovementSlow, float64(i))
+	}
+	for i := uint32(0); i < n; i++ {
+		b = binary.LittleEndian.AppendUint32(b, math.Float32bits(2*float32(i)))
+		m.MovementFast = append(m.MovementFast, 2*float64(i))
+	}
+	return b, m
+}
+
+func TestParseMovingList(t *testing.T) {
+	useFakeClock(t)
+	none, noneList := movingListPayload(1, 0)
+	one, oneList := movingListPayload(2, 1)
+	full, fullList := movingListPayload(3, 120)
+	short := full[:len(full)-4]
+
+	cases := []struct {
+		b    []byte
+		err  error
+		data interface{}
+	}{
+		{none, nil, noneList},
+		{one, nil, oneList},
+		{full, nil, fullList},
+		{short, ErrParse, movingList{}},
+	}
+	for n, c := range cases {
+		if got := frameType(c.b); got != frameMovingList {
+			t.Errorf("test %d Expected: frame type %d, got %d\n", n, frameMovingList, got)
+		}
+		for _, p := range []Protocol{ProtocolX2M200, ProtocolX4} {
+			data, err := parseProtocol(c.b, BasebandFloat, p)
+			if !errors.Is(err, c.err) {
+				t.Errorf("test %d protocol %d Expected: %v, got %v\n", n, p, c.err, err)
+			}
+			if !reflect.DeepEqual(data, c.data) {
+				t.Errorf("test %d protocol %d Expected: %+v, got %+v\n", n, p, c.data, data)
+			}
+		}
+	}
+}
+
+func TestParseMovingListLength(t *testing.T) {
+	full, _ := movingListPayload(3, 120)
+	// the count says 1 interval but 2 follow
+	long, _ := movingListPayload(4, 2)
+	binary.LittleEndian.PutUint32(long[9:13], 1)
+	// a count that would overflow a naive length calculation
+	huge, _ := movingListPayload(5, 0)
+	binary.LittleEndian.PutUint32(huge[9:13], math.MaxUint32)
+
+	for n, b := range [][]byte{full[:len(full)-8], long, huge, huge[:12], nil} {
+		if _, err := parseMovingList(b); !errors.Is(err, errMovingListLength) {
+			t.Errorf("test %d Expected: %v, got %v\n", n, errMovingListLength, err)
+		}
+	}
+}
+
+func TestMovingListChannel(t *testing.T) {
+	useFakeClock(t)
+	f, sensor := newFakeSensor(0)
+	m := NewSleep(f)
+	// start the reader so frames sent before Run are routed
+	m.startReader()
+
+	var want []movingList
+	for n, intervals := range []uint32{0, 1, 120} {
+		b, list := movingListPayload(uint32(n), intervals)
+		sensor.send(b)
+		want = append(want, list)
+		if n == 1 {
+			// a list that is too short for its count is dropped
+			sensor.send(b[:len(b)-1])
+		}
+	}
+
+	stream := make(chan interface{}, 10)
+	finished := make(chan struct{})
+	go func() {
+		m.Run(stream)
+		close(finished)
+	}()
+
+	lists := m.movingListChan()
+	for n, w := range want {
+		select {
+		case got := <-lists:
+			if !reflect.DeepEqual(got, w) {
+				t.Errorf("test %d Expected: %+v, got %+v\n", n, w, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("test %d Expected: movinglist, got none\n", n)
+		}
+	}
+
+	sensor.Close()
+	<-finished
+	if _, ok := <-lists; ok {
+		t.Errorf("Expected: closed channel after Run returns, got open\n")
+	}
+	// the layout is unverified so the lists are not delivered by Run
+	close(stream)
+	for data := range stream {
+		t.Errorf("Expected: no frames on the stream, got %T\n", data)
+	}
+}
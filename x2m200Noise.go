@@ -0,0 +1,83 @@
+package xethru
+
+import "math"
+
+// NoiseEstimator tracks the noise floor of each bin of BaseBandAmpPhase
+// frames using minimum statistics, the floor is the smallest amplitude seen
+// in each bin over the last Window frames.
+type NoiseEstimator struct {
+	window  int
+	bins    int
+	frames  int
+	pos     int
+	history []float64
+	floor   []float64
+}
+
+// NewNoiseEstimator creates a NoiseEstimator over window frames.
+func NewNoiseEstimator(window int) *NoiseEstimator {
+	if window < 1 {
+		window = 1
+	}
+	return &NoiseEstimator{window: window}
+}
+
+// Add updates the noise floor with ap. If the number of bins changes the
+// estimator is reset. Once the window is full Add does not allocate.
+func (e *NoiseEstimator) Add(ap BaseBandAmpPhase) {
+	bins := len(ap.Amplitude)
+	if bins != e.bins || e.history == nil {
+		e.reset(bins)
+	}
+	copy(e.history[e.pos*bins:(e.pos+1)*bins], ap.Amplitude)
+	e.pos = (e.pos + 1) % e.window
+	if e.frames < e.window {
+		e.frames++
+	}
+
+	for i := range e.floor {
+		e.floor[i] = math.Inf(1)
+	}
+	for f := 0; f < e.frames; f++ {
+		row := e.history[f*bins : (f+1)*bins]
+		for i, v := range row {
+			if v < e.floor[i] {
+				e.floor[i] = v
+			}
+		}
+	}
+}
+
+// Reset discards all history.
+func (e *NoiseEstimator) Reset() {
+	e.reset(0)
+	e.history = nil
+}
+
+func (e *NoiseEstimator) reset(bins int) {
+	e.bins = bins
+	e.frames = 0
+	e.pos = 0
+	e.history = make([]float64, e.window*bins)
+	e.floor = make([]float64, bins)
+}
+
+// NoiseFloor returns a copy of the current noise floor amplitude of each bin.
+func (e *NoiseEstimator) NoiseFloor() []float64 {
+	floor := make([]float64, len(e.floor))
+	copy(floor, e.floor)
+	return floor
+}
+
+// SNR returns the signal to noise ratio in dB of each bin of ap against the
+// current noise floor. Bins that are beyond the estimator's bins are zero.
+func (e *NoiseEstimator) SNR(ap BaseBandAmpPhase) []float64 {
+	snr := make([]float64, len(ap.Amplitude))
+	for i, v := range ap.Amplitude {
+		if i >= len(e.floor) {
+			break
+		}
+		snr[i] = 20 * math.Log10(v/e.floor[i])
+	}
+	return snr
+}
@@ -0,0 +1,79 @@
+package xethru
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Noise map commands. The command and sub command codes are unverified, see
+// the package documentation.
+// Example: <Start> + <XTS_SPC_MOD_NOISEMAP> + <XTS_SPCN_STORE> + <CRC> + <End>
+// Example: <Start> + <XTS_SPC_MOD_NOISEMAP> + <XTS_SPCN_SETCONTROL> + [Control(i)] + <CRC> + <End>
+// Response: <Start> + <XTS_SPR_ACK> + <CRC> + <End>
+const (
+	x2m200NoiseMap     = 0x25
+	noiseMapStore      = 0x01
+	noiseMapDelete     = 0x03
+	noiseMapSetControl = 0x04
+)
+
+// noiseMapFlags control how the sensor uses its noise map.
+type noiseMapFlags uint32
+
+// Noise map control flags
+const (
+	noiseMapEnable     noiseMapFlags = 1 << 0 // use a noise map
+	noiseMapAdaptive   noiseMapFlags = 1 << 1 // adapt the noise map while running
+	noiseMapUseDefault noiseMapFlags = 1 << 2 // start from the default noise map instead of the stored one
+
+	noiseMapFlagsMask = noiseMapEnable | noiseMapAdaptive | noiseMapUseDefault
+)
+
+// Noise map errors
+var (
+	errModuleNotStopped = errors.New("module must be stopped")
+	errNoiseMapFlags    = errors.New("unknown noise map flags")
+)
+
+// setNoiseMapControl sets how the sensor uses its noise map. The app must be
+// stopped, while Run is running the command is not sent and the error wraps
+// errModuleNotStopped. The sensor has no documented error code for it, so an
+// app started some other way is not detected.
+func (r *Module) setNoiseMapControl(flags noiseMapFlags) error {
+	if flags&^noiseMapFlagsMask != 0 {
+		return fmt.Errorf("%w: %#x", errNoiseMapFlags, uint32(flags&^noiseMapFlagsMask))
+	}
+	cmd := make([]byte, 6)
+	cmd[0] = x2m200NoiseMap
+	cmd[1] = noiseMapSetControl
+	binary.LittleEndian.PutUint32(cmd[2:], uint32(flags))
+	return r.noiseMapCommand(cmd, "set noise map control")
+}
+
+// storeNoiseMap stores the current noise map in the sensor's flash, so it is
+// used after a reset. The app must be stopped.
+func (r *Module) storeNoiseMap() error {
+	return r.noiseMapCommand([]byte{x2m200NoiseMap, noiseMapStore}, "store noise map")
+}
+
+// resetNoiseMap deletes the stored noise map, which is needed after the
+// sensor is moved. The app must be stopped.
+func (r *Module) resetNoiseMap() error {
+	return r.noiseMapCommand([]byte{x2m200NoiseMap, noiseMapDelete}, "reset noise map")
+}
+
+func (r *Module) noiseMapCommand(cmd []byte, op string) error {
+	r.log().Debugf("%s", op)
+	r.handlersMu.Lock()
+	running := r.running
+	r.handlersMu.Unlock()
+	if running {
+		return fmt.Errorf("failed to %s: %w", op, errModuleNotStopped)
+	}
+	_, err := r.Execute(cmd, x2m200Ack, r.Timeout)
+	if err != nil {
+		return fmt.Errorf("failed to %s: %w", op, err)
+	}
+	return nil
+}
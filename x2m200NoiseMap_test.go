@@ -0,0 +1,58 @@
+package xethru
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNoiseMapCommands(t *testing.T) {
+	// The expected commands pin the layout, the codes in them are unverified.
+	cases := []struct {
+		run   func(m *Module) error
+		reply []byte
+		cmd   []byte
+		err   error
+	}{
+		{func(m *Module) error { return m.setNoiseMapControl(noiseMapEnable | noiseMapAdaptive) }, []byte{x2m200Ack}, []byte{0x25, 0x04, 0x03, 0x00, 0x00, 0x00}, nil},
+		{func(m *Module) error { return m.setNoiseMapControl(noiseMapUseDefault) }, []byte{x2m200Ack}, []byte{0x25, 0x04, 0x04, 0x00, 0x00, 0x00}, nil},
+		{func(m *Module) error { return m.setNoiseMapControl(0) }, []byte{x2m200Ack}, []byte{0x25, 0x04, 0x00, 0x00, 0x00, 0x00}, nil},
+		{func(m *Module) error { return m.storeNoiseMap() }, []byte{x2m200Ack}, []byte{0x25, 0x01}, nil},
+		{func(m *Module) error { return m.resetNoiseMap() }, []byte{x2m200Ack}, []byte{0x25, 0x03}, nil},
+		{func(m *Module) error { return m.resetNoiseMap() }, []byte{errorByte, crcFailed}, []byte{0x25, 0x03}, ErrProtocolCRCFailed},
+		{func(m *Module) error { return m.storeNoiseMap() }, []byte{errorByte, notReconsied}, []byte{0x25, 0x01}, ErrProtocolNotRecognised},
+		{func(m *Module) error { return m.setNoiseMapControl(1 << 5) }, nil, nil, errNoiseMapFlags},
+	}
+	for n, c := range cases {
+		f, sensor, stop := newScriptedSensor(func([]byte) []byte { return c.reply })
+		m := NewModule(f, "respiration")
+		m.Timeout = 100 * time.Millisecond
+		err := c.run(m)
+		if !errors.Is(err, c.err) {
+			t.Errorf("test %d Expected: %v, got %v\n", n, c.err, err)
+		}
+		if c.err == ErrProtocolNotRecognised && errors.Is(err, errModuleNotStopped) {
+			t.Errorf("test %d Expected: not %v, got %v\n", n, errModuleNotStopped, err)
+		}
+		cmds := sensor.commands()
+		if c.cmd == nil && len(cmds) != 0 || c.cmd != nil && (len(cmds) != 1 || !bytes.Equal(cmds[0], c.cmd)) {
+			t.Errorf("test %d Expected: %x, got %x\n", n, c.cmd, cmds)
+		}
+		stop()
+	}
+
+	// nothing is sent while Run is running
+	f, sensor, stop := newScriptedSensor(func([]byte) []byte { return []byte{x2m200Ack} })
+	defer stop()
+	m := NewModule(f, "respiration")
+	if err := m.startRun(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.storeNoiseMap(); !errors.Is(err, errModuleNotStopped) {
+		t.Errorf("Expected: %v, got %v\n", errModuleNotStopped, err)
+	}
+	if cmds := sensor.commands(); len(cmds) != 0 {
+		t.Errorf("Expected: no commands, got %x\n", cmds)
+	}
+}
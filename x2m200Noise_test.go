@@ -0,0 +1,68 @@
+package xethru
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func noiseFrame(r *rand.Rand, bins int) BaseBandAmpPhase {
+	ap := BaseBandAmpPhase{BaseBandHeader: BaseBandHeader{Bins: uint32(bins)}, Amplitude: make([]float64, bins), Phase: make([]float64, bins)}
+	for i := range ap.Amplitude {
+		ap.Amplitude[i] = 0.5 + 0.5*r.Float64()
+	}
+	return ap
+}
+
+func TestNoiseEstimatorSNR(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	e := NewNoiseEstimator(50)
+	for n := 0; n < 200; n++ {
+		e.Add(noiseFrame(r, 32))
+	}
+	for i, v := range e.NoiseFloor() {
+		if v < 0.5 || v > 0.55 {
+			t.Errorf("bin %d Expected: noise floor near 0.5, got %v\n", i, v)
+		}
+	}
+
+	frame := noiseFrame(r, 32)
+	frame.Amplitude[17] = 20
+	snr := e.SNR(frame)
+	peak := 0
+	for i := range snr {
+		if snr[i] > snr[peak] {
+			peak = i
+		}
+	}
+	if peak != 17 {
+		t.Errorf("Expected: SNR peak at bin 17, got %d\n", peak)
+	}
+	if snr[17] < 25 {
+		t.Errorf("Expected: SNR above 25dB, got %v\n", snr[17])
+	}
+}
+
+func TestNoiseEstimatorBinsChange(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	e := NewNoiseEstimator(10)
+	e.Add(noiseFrame(r, 8))
+	e.Add(noiseFrame(r, 16))
+	if len(e.NoiseFloor()) != 16 {
+		t.Errorf("Expected: 16 bins, got %d\n", len(e.NoiseFloor()))
+	}
+	e.Reset()
+	if len(e.NoiseFloor()) != 0 {
+		t.Errorf("Expected: reset noise floor, got %d bins\n", len(e.NoiseFloor()))
+	}
+}
+
+func TestNoiseEstimatorAllocs(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	e := NewNoiseEstimator(10)
+	frame := noiseFrame(r, 256)
+	e.Add(frame)
+	allocs := testing.AllocsPerRun(100, func() { e.Add(frame) })
+	if allocs != 0 {
+		t.Errorf("Expected: 0 allocations per frame, got %v\n", allocs)
+	}
+}
@@ -0,0 +1,104 @@
+package xethru
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/NeuralSpaz/xethru/protocol"
+)
+
+// Output control commands. The command codes are unverified, see the package
+// documentation.
+// Example: <Start> + <XTS_SPC_OUTPUT> + <XTS_SPCO_SETCONTROL> + [MessageID(i)] + [Control(i)] + <CRC> + <End>
+// Response: <Start> + <XTS_SPR_ACK> + <CRC> + <End>
+// Example: <Start> + <XTS_SPC_OUTPUT> + <XTS_SPCO_GETCONTROL> + [MessageID(i)] + <CRC> + <End>
+// Response: <Start> + <XTS_SPR_REPLY> + <XTS_SPC_OUTPUT> + <XTS_SPCO_GETCONTROL> + [Control(i)] + <CRC> + <End>
+const (
+	x2m200Output        = 0x41
+	outputSetControl    = 0x10
+	outputGetControl    = 0x11
+	outputGetControlLen = 7
+)
+
+// Output message IDs for setOutputControl
+const (
+	outputRespiration        uint32 = uint32(respApp)
+	outputSleep              uint32 = uint32(sleepApp)
+	outputMovingList         uint32 = movingListID
+	outputBaseBandAmpPhase   uint32 = uint32(basebandAP)
+	outputBaseBandIQ         uint32 = uint32(basebandIQ)
+	outputPresenceSingle     uint32 = protocol.PresenceSingleID
+	outputPresenceMovingList uint32 = protocol.PresenceMovingListID
+)
+
+var errOutputControlReply = errors.New("output control reply is not long enough")
+
+// setOutputControl enables or disables streaming of the message messageID,
+// one of the output message IDs.
+func (r *Module) setOutputControl(messageID uint32, enabled bool) error {
+	cmd := make([]byte, 10)
+	cmd[0] = x2m200Output
+	cmd[1] = outputSetControl
+	binary.LittleEndian.PutUint32(cmd[2:], messageID)
+	if enabled {
+		binary.LittleEndian.PutUint32(cmd[6:], 1)
+	}
+	if _, err := r.Execute(cmd, x2m200Ack, r.Timeout); err != nil {
+		return fmt.Errorf("failed to set output control %#08x: %w", messageID, err)
+	}
+	r.dispatcher.setOutput(messageID, enabled)
+	return nil
+}
+
+// getOutputControl reports whether the message messageID is streamed.
+func (r *Module) getOutputControl(messageID uint32) (bool, error) {
+	cmd := make([]byte, 6)
+	cmd[0] = x2m200Output
+	cmd[1] = outputGetControl
+	binary.LittleEndian.PutUint32(cmd[2:], messageID)
+	resp, err := r.exchange(cmd, r.Timeout, func(p []byte) bool {
+		return len(p) > 2 && p[0] == x2m200Reply && p[1] == x2m200Output && p[2] == outputGetControl
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to get output control %#08x: %w", messageID, err)
+	}
+	if len(resp) < outputGetControlLen {
+		return false, &LengthError{Err: errOutputControlReply, Want: outputGetControlLen, Got: len(resp)}
+	}
+	enabled := binary.LittleEndian.Uint32(resp[3:7]) != 0
+	r.dispatcher.setOutput(messageID, enabled)
+	return enabled, nil
+}
+
+// setOutput records whether messageID has been enabled.
+func (d *Dispatcher) setOutput(messageID uint32, enabled bool) {
+	d.outputMu.Lock()
+	defer d.outputMu.Unlock()
+	if d.outputs == nil {
+		d.outputs = make(map[uint32]bool)
+	}
+	d.outputs[messageID] = enabled
+	if enabled {
+		delete(d.outputWarned, messageID)
+	}
+}
+
+// checkOutput warns, once per message, when app data arrives for a message
+// that was disabled with setOutputControl.
+func (d *Dispatcher) checkOutput(p []byte) {
+	if len(p) < 5 || p[0] != appDataByte {
+		return
+	}
+	id := binary.LittleEndian.Uint32(p[1:5])
+	d.outputMu.Lock()
+	defer d.outputMu.Unlock()
+	if enabled, ok := d.outputs[id]; !ok || enabled || d.outputWarned[id] {
+		return
+	}
+	if d.outputWarned == nil {
+		d.outputWarned = make(map[uint32]bool)
+	}
+	d.outputWarned[id] = true
+	frameLogger(d.f).Warnf("received message %#08x which was not enabled", id)
+}
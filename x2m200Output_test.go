@@ -0,0 +1,81 @@
+package xethru
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOutputControl(t *testing.T) {
+	var reply []byte
+	f, sensor, stop := newScriptedSensor(func([]byte) []byte { return reply })
+	defer stop()
+	l := &fakeLogger{}
+	SetLogger(f, l)
+	m := NewModule(f, "respiration")
+	m.Timeout = 100 * time.Millisecond
+
+	reply = []byte{x2m200Ack}
+	if err := m.setOutputControl(outputRespiration, true); err != nil {
+		t.Error(err)
+	}
+	if err := m.setOutputControl(outputBaseBandIQ, false); err != nil {
+		t.Error(err)
+	}
+	reply = []byte{errorByte, notReconsied}
+	if err := m.setOutputControl(0x12345678, true); !errors.Is(err, ErrProtocolNotRecognised) {
+		t.Errorf("Expected: %v, got %v\n", ErrProtocolNotRecognised, err)
+	}
+
+	// iq was disabled, respiration was enabled and amplitude/phase is unknown
+	sensor.send(buildIQPayload(1, 4))
+	sensor.send(buildIQPayload(2, 4))
+	sensor.send(respirationPayload)
+	sensor.send([]byte{appDataByte, 0x0d, 0x00, 0x00, 0x00})
+
+	cases := []struct {
+		reply   []byte
+		err     error
+		enabled bool
+	}{
+		{[]byte{x2m200Reply, 0x41, 0x11, 0x01, 0x00, 0x00, 0x00}, nil, true},
+		{[]byte{x2m200Reply, 0x41, 0x11, 0x00, 0x00, 0x00, 0x00}, nil, false},
+		{[]byte{x2m200Reply, 0x41, 0x11, 0x00}, errOutputControlReply, false},
+		{[]byte{errorByte, notReconsied}, ErrProtocolNotRecognised, false},
+	}
+	for n, c := range cases {
+		reply = c.reply
+		enabled, err := m.getOutputControl(outputBaseBandAmpPhase)
+		if !errors.Is(err, c.err) || enabled != c.enabled {
+			t.Errorf("test %d Expected: %v %v, got %v %v\n", n, c.enabled, c.err, enabled, err)
+		}
+	}
+
+	want := [][]byte{
+		{0x41, 0x10, 0x26, 0xfe, 0x75, 0x23, 0x01, 0x00, 0x00, 0x00},
+		{0x41, 0x10, 0x0c, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+		{0x41, 0x10, 0x78, 0x56, 0x34, 0x12, 0x01, 0x00, 0x00, 0x00},
+		{0x41, 0x11, 0x0d, 0x00, 0x00, 0x00},
+	}
+	cmds := sensor.commands()
+	if len(cmds) != 7 {
+		t.Fatalf("Expected: 7 commands, got %x\n", cmds)
+	}
+	for n, w := range want {
+		if !bytes.Equal(cmds[n], w) {
+			t.Errorf("test %d Expected: %x, got %x\n", n, w, cmds[n])
+		}
+	}
+
+	var warnings []string
+	for _, line := range l.above() {
+		if strings.Contains(line, "not enabled") {
+			warnings = append(warnings, line)
+		}
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "0x0000000c") {
+		t.Errorf("Expected: one warning for iq, got %v\n", warnings)
+	}
+}
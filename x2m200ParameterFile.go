@@ -0,0 +1,114 @@
+package xethru
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Parameter file commands. The command codes and file IDs are unverified, see
+// the package documentation.
+// Example: <Start> + <XTS_SPC_MOD_PARAMETERFILE> + <XTS_SPCP_SET> + [FileID(i)] + [Length(i)] + [Data] + <CRC> + <End>
+// Response: <Start> + <XTS_SPR_ACK> + <CRC> + <End>
+// Example: <Start> + <XTS_SPC_MOD_PARAMETERFILE> + <XTS_SPCP_GET> + [FileID(i)] + <CRC> + <End>
+// Response: <Start> + <XTS_SPR_REPLY> + <XTS_SPC_MOD_PARAMETERFILE> + <XTS_SPCP_GET> + [FileID(i)] + [Length(i)] + [Data] + <CRC> + <End>
+const (
+	x2m200ParameterFile = 0x60
+	parameterFileSet    = 0x10
+	parameterFileGet    = 0x11
+	parameterFileHeader = 11 // reply bytes before the data
+
+	// maxParameterFile is the largest file the module stores.
+	maxParameterFile = 1024
+
+	// parameterFileTimeout is the default time storing a file may take, the
+	// module acks once the flash is written.
+	parameterFileTimeout = 2 * time.Second
+)
+
+// Parameter file IDs
+const (
+	parameterFileDetectionZone uint32 = 0x01 // [Start(f)] + [End(f)]
+	parameterFileSensitivity   uint32 = 0x02 // [Sensitivity(i)]
+	parameterFileLEDControl    uint32 = 0x03 // <Mode>
+)
+
+var (
+	errParameterFileSize  = errors.New("parameter file is too large")
+	errParameterFileReply = errors.New("parameter file reply is not long enough")
+)
+
+// storeParameterFile stores data in the module's flash as the file id, it
+// survives power cycles. It waits for flashTimeout, or 2 seconds if that is
+// not set, for the flash to be written.
+func (r *Module) storeParameterFile(id uint32, data []byte) error {
+	if len(data) > maxParameterFile {
+		return fmt.Errorf("%w: %d bytes", errParameterFileSize, len(data))
+	}
+	cmd := make([]byte, 10, 10+len(data))
+	cmd[0] = x2m200ParameterFile
+	cmd[1] = parameterFileSet
+	binary.LittleEndian.PutUint32(cmd[2:], id)
+	binary.LittleEndian.PutUint32(cmd[6:], uint32(len(data)))
+	cmd = append(cmd, data...)
+	timeout := r.flashTimeout
+	if timeout <= 0 {
+		timeout = parameterFileTimeout
+	}
+	if _, err := r.Execute(cmd, x2m200Ack, timeout); err != nil {
+		return fmt.Errorf("failed to store parameter file %#02x: %w", id, err)
+	}
+	return nil
+}
+
+// getParameterFile reads the file id from the module's flash.
+func (r *Module) getParameterFile(id uint32) ([]byte, error) {
+	cmd := make([]byte, 6)
+	cmd[0] = x2m200ParameterFile
+	cmd[1] = parameterFileGet
+	binary.LittleEndian.PutUint32(cmd[2:], id)
+	resp, err := r.exchange(cmd, r.Timeout, func(p []byte) bool {
+		return len(p) > 6 && p[0] == x2m200Reply && p[1] == x2m200ParameterFile && p[2] == parameterFileGet &&
+			binary.LittleEndian.Uint32(p[3:7]) == id
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get parameter file %#02x: %w", id, err)
+	}
+	if len(resp) < parameterFileHeader {
+		return nil, &LengthError{Err: errParameterFileReply, Want: parameterFileHeader, Got: len(resp)}
+	}
+	n := binary.LittleEndian.Uint32(resp[7:11])
+	if uint64(len(resp)) != parameterFileHeader+uint64(n) {
+		return nil, &LengthError{Err: errParameterFileReply, Want: parameterFileHeader + int(n), Got: len(resp)}
+	}
+	return append([]byte(nil), resp[parameterFileHeader:]...), nil
+}
+
+// saveConfiguration stores the module's DetectionZoneStart and
+// DetectionZoneEnd, Sensitivity and LEDMode in flash, as the files
+// parameterFileDetectionZone, parameterFileSensitivity and
+// parameterFileLEDControl.
+func (r *Module) saveConfiguration() error {
+	zone := make([]byte, 8)
+	binary.LittleEndian.PutUint32(zone, math.Float32bits(r.DetectionZoneStart))
+	binary.LittleEndian.PutUint32(zone[4:], math.Float32bits(r.DetectionZoneEnd))
+	sensitivity := make([]byte, 4)
+	binary.LittleEndian.PutUint32(sensitivity, r.Sensitivity)
+
+	files := []struct {
+		id   uint32
+		data []byte
+	}{
+		{parameterFileDetectionZone, zone},
+		{parameterFileSensitivity, sensitivity},
+		{parameterFileLEDControl, []byte{byte(r.LEDMode)}},
+	}
+	for _, f := range files {
+		if err := r.storeParameterFile(f.id, f.data); err != nil {
+			return fmt.Errorf("failed to save configuration: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package xethru
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestParameterFileRoundTrip(t *testing.T) {
+	sensor := NewSimulatedSensor()
+	defer sensor.Close()
+	m := NewModule(sensor, "respiration")
+	m.Timeout = time.Second
+
+	cases := []struct {
+		id   uint32
+		data []byte
+	}{
+		{0x10, []byte{1, 2, 3}},
+		{0x11, nil},
+		{0x10, []byte{4}},
+		{0x12, bytes.Repeat([]byte{0xaa}, maxParameterFile)},
+	}
+	for n, c := range cases {
+		if err := m.storeParameterFile(c.id, c.data); err != nil {
+			t.Fatalf("test %d: %v", n, err)
+		}
+		data, err := m.getParameterFile(c.id)
+		if err != nil {
+			t.Errorf("test %d Expected: %v, got %v\n", n, nil, err)
+		}
+		if !bytes.Equal(data, c.data) {
+			t.Errorf("test %d Expected: %x, got %x\n", n, c.data, data)
+		}
+	}
+
+	if _, err := m.getParameterFile(0x99); !errors.Is(err, ErrProtocolNotRecognised) {
+		t.Errorf("Expected: %v, got %v\n", ErrProtocolNotRecognised, err)
+	}
+	if err := m.storeParameterFile(0x13, make([]byte, maxParameterFile+1)); !errors.Is(err, errParameterFileSize) {
+		t.Errorf("Expected: %v, got %v\n", errParameterFileSize, err)
+	}
+}
+
+func TestSaveConfiguration(t *testing.T) {
+	sensor := NewSimulatedSensor()
+	defer sensor.Close()
+	m := NewModule(sensor, "respiration")
+	m.Timeout = time.Second
+	m.DetectionZoneStart = 0.5
+	m.DetectionZoneEnd = 1.25
+	m.Sensitivity = 7
+	m.LEDMode = LEDInhalation
+
+	if err := m.saveConfiguration(); err != nil {
+		t.Fatal(err)
+	}
+
+	zone := make([]byte, 8)
+	binary.LittleEndian.PutUint32(zone, math.Float32bits(0.5))
+	binary.LittleEndian.PutUint32(zone[4:], math.Float32bits(1.25))
+	cases := []struct {
+		id   uint32
+		data []byte
+	}{
+		{parameterFileDetectionZone, zone},
+		{parameterFileSensitivity, []byte{7, 0, 0, 0}},
+		{parameterFileLEDControl, []byte{byte(LEDInhalation)}},
+	}
+	for n, c := range cases {
+		data, err := m.getParameterFile(c.id)
+		if err != nil {
+			t.Errorf("test %d Expected: %v, got %v\n", n, nil, err)
+		}
+		if !bytes.Equal(data, c.data) {
+			t.Errorf("test %d Expected: %x, got %x\n", n, c.data, data)
+		}
+	}
+}
+
+func TestStoreParameterFileTimeout(t *testing.T) {
+	sensor := NewSimulatedSensor()
+	sensor.AckDelay = 50 * time.Millisecond
+	defer sensor.Close()
+	m := NewModule(sensor, "respiration")
+	m.Timeout = 10 * time.Millisecond
+
+	// the flash write takes longer than other commands are allowed
+	if err := m.SetLEDMode(); !errors.Is(err, ErrCommandTimeout) {
+		t.Errorf("Expected: %v, got %v\n", ErrCommandTimeout, err)
+	}
+	time.Sleep(2 * sensor.AckDelay)
+	m.flashTimeout = time.Second
+	if err := m.storeParameterFile(parameterFileSensitivity, []byte{1, 0, 0, 0}); err != nil {
+		t.Errorf("Expected: %v, got %v\n", nil, err)
+	}
+}
+
+func TestParameterFileCommands(t *testing.T) {
+	cases := []struct {
+		run   func(m *Module) error
+		reply []byte
+		cmd   []byte
+		err   error
+	}{
+		{func(m *Module) error { return m.storeParameterFile(0x0102, []byte{0xaa, 0xbb}) }, []byte{x2m200Ack},
+			[]byte{0x60, 0x10, 0x02, 0x01, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0xaa, 0xbb}, nil},
+		{func(m *Module) error { _, err := m.getParameterFile(0x0102); return err },
+			[]byte{x2m200Reply, 0x60, 0x11, 0x02, 0x01, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0xcc},
+			[]byte{0x60, 0x11, 0x02, 0x01, 0x00, 0x00}, nil},
+		{func(m *Module) error { _, err := m.getParameterFile(0x0102); return err },
+			[]byte{x2m200Reply, 0x60, 0x11, 0x02, 0x01, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0xcc},
+			[]byte{0x60, 0x11, 0x02, 0x01, 0x00, 0x00}, errParameterFileReply},
+		{func(m *Module) error { _, err := m.getParameterFile(0x0102); return err },
+			[]byte{x2m200Reply, 0x60, 0x11, 0x02, 0x01, 0x00, 0x00},
+			[]byte{0x60, 0x11, 0x02, 0x01, 0x00, 0x00}, errParameterFileReply},
+	}
+	for n, c := range cases {
+		f, sensor, stop := newScriptedSensor(func([]byte) []byte { return c.reply })
+		m := NewModule(f, "respiration")
+		m.Timeout = 100 * time.Millisecond
+		if err := c.run(m); !errors.Is(err, c.err) {
+			t.Errorf("test %d Expected: %v, got %v\n", n, c.err, err)
+		}
+		cmds := sensor.commands()
+		if len(cmds) != 1 || !bytes.Equal(cmds[0], c.cmd) {
+			t.Errorf("test %d Expected: %x, got %x\n", n, c.cmd, cmds)
+		}
+		stop()
+	}
+}
@@ -0,0 +1,104 @@
+package xethru
+
+import "sync"
+
+// ParsePool is a pool of workers that parse app data frames for the
+// Dispatchers that use it, see Dispatcher.SetParsePool, so a gateway with many
+// sensors can parse large baseband frames in parallel without one sensor's
+// frames holding up another's. Each Dispatcher is given to one worker, so its
+// frames are parsed and dispatched in the order they were read.
+type ParsePool struct {
+	workers []chan parseJob
+	wg      sync.WaitGroup
+
+	mu   sync.Mutex
+	next int // worker the next Dispatcher is given
+}
+
+type parseJob struct {
+	d     *Dispatcher
+	f     Frame
+	parse func(Frame) (interface{}, error) // nil for frames that are not parsed
+}
+
+// parsePoolQueue is the number of frames each worker queues before the
+// Dispatchers it serves wait.
+const parsePoolQueue = 256
+
+// NewParsePool starts a ParsePool of workers goroutines, at least one.
+func NewParsePool(workers int) *ParsePool {
+	if workers < 1 {
+		workers = 1
+	}
+	p := &ParsePool{workers: make([]chan parseJob, workers)}
+	for i := range p.workers {
+		p.workers[i] = make(chan parseJob, parsePoolQueue)
+		p.wg.Add(1)
+		go p.work(p.workers[i])
+	}
+	return p
+}
+
+func (p *ParsePool) work(jobs <-chan parseJob) {
+	defer p.wg.Done()
+	for j := range jobs {
+		if j.parse != nil {
+			j.f.Data, j.f.ParseErr = j.parse(j.f)
+		}
+		j.d.dispatch(j.f)
+		j.d.parsing.Done()
+	}
+}
+
+// shard returns the queue of the worker for a new Dispatcher, Dispatchers are
+// shared out in turn.
+func (p *ParsePool) shard() chan<- parseJob {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	w := p.workers[p.next]
+	p.next = (p.next + 1) % len(p.workers)
+	return w
+}
+
+// Close stops the workers once they have finished the queued frames. It must
+// only be called once every Dispatcher using the pool has stopped.
+func (p *ParsePool) Close() {
+	for _, w := range p.workers {
+		close(w)
+	}
+	p.wg.Wait()
+}
+
+// SetParsePool has the Dispatcher hand every frame it reads to a worker of p,
+// which parses app data frames with parse, setting Frame.Data and
+// Frame.ParseErr, then dispatches them. Frames are still dispatched in the
+// order they are read. It must be called before Start.
+func (d *Dispatcher) SetParsePool(p *ParsePool, parse func(Frame) (interface{}, error)) {
+	d.pool = p.shard()
+	d.parse = parse
+}
+
+// handOff gives f to the Dispatcher's parse pool worker, or dispatches it if
+// there is no pool.
+func (d *Dispatcher) handOff(f Frame) {
+	if d.pool == nil {
+		d.dispatch(f)
+		return
+	}
+	j := parseJob{d: d, f: f}
+	if isAppData(f.Type) {
+		j.parse = d.parse
+	}
+	d.parsing.Add(1)
+	d.pool <- j
+}
+
+// isAppData reports whether t is one of AppDataFrames.
+func isAppData(t FrameType) bool {
+	for _, a := range AppDataFrames {
+		if t == a {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+package xethru
+
+import (
+	"encoding/binary"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParsePoolOrdering(t *testing.T) {
+	const sensors, frames = 6, 50
+	pool := NewParsePool(4)
+	type source struct {
+		sensor *fakeSensor
+		m      *Module
+		stream chan interface{}
+		done   chan struct{}
+	}
+	sources := make([]source, sensors)
+	for i := range sources {
+		f, sensor := newFakeSensor(0)
+		m := NewModule(f, "respiration")
+		m.Timeout = 10 * time.Millisecond
+		m.BasebandFormat = BasebandFloat
+		m.ParsePool = pool
+		s := source{sensor, m, make(chan interface{}, 3*frames), make(chan struct{})}
+		go func() {
+			s.m.Run(s.stream)
+			close(s.done)
+		}()
+		sources[i] = s
+	}
+
+	// counters are interleaved across the sensors, the first two also send
+	// large IQ frames that are slow to parse
+	for n := 1; n <= frames; n++ {
+		for i, s := range sources {
+			if i < 2 {
+				s.sensor.send(buildIQPayload(uint32(n), 1024))
+			}
+			p := append([]byte(nil), respirationPayload...)
+			binary.LittleEndian.PutUint32(p[5:9], uint32(n))
+			s.sensor.send(p)
+		}
+	}
+
+	for i, s := range sources {
+		var resp, iq uint32
+		for resp < frames || i < 2 && iq < frames {
+			select {
+			case d := <-s.stream:
+				switch d := d.(type) {
+				case Respiration:
+					if d.Counter != resp+1 {
+						t.Fatalf("sensor %d Expected: respiration %d, got %d\n", i, resp+1, d.Counter)
+					}
+					resp = d.Counter
+				case BaseBandIQ:
+					if d.Counter != iq+1 {
+						t.Fatalf("sensor %d Expected: iq %d, got %d\n", i, iq+1, d.Counter)
+					}
+					iq = d.Counter
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("sensor %d Expected: %d frames, got %d and %d\n", i, frames, resp, iq)
+			}
+		}
+	}
+	for _, s := range sources {
+		s.sensor.Close()
+		<-s.done
+	}
+	pool.Close()
+}
+
+func TestDispatcherParsePool(t *testing.T) {
+	pool := NewParsePool(2)
+	defer pool.Close()
+	f, sensor := newFakeSensor(0)
+	d := NewDispatcher(f)
+	var mu sync.Mutex
+	parsed := 0
+	d.SetParsePool(pool, func(f Frame) (interface{}, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		parsed++
+		return len(f.Payload), nil
+	})
+	frames := d.Subscribe(10, AppDataFrames...)
+	acks := d.Subscribe(10, FrameAck)
+	d.Start()
+
+	sensor.send(respirationPayload)
+	sensor.send([]byte{x2m200Ack})
+	sensor.Close()
+
+	if fr := <-frames; fr.Data != len(respirationPayload) || fr.ParseErr != nil {
+		t.Errorf("Expected: parsed %d, got %v %v\n", len(respirationPayload), fr.Data, fr.ParseErr)
+	}
+	// only app data is parsed
+	if fr := <-acks; fr.Data != nil {
+		t.Errorf("Expected: unparsed ack, got %v\n", fr.Data)
+	}
+	// the channels close once the pool has dispatched everything
+	for range frames {
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if parsed != 1 {
+		t.Errorf("Expected: 1 frame parsed, got %d\n", parsed)
+	}
+}
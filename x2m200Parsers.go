@@ -1,18 +1,17 @@
 package xethru
 
 import (
-	"encoding/binary"
-	"errors"
-	"math"
-	"time"
+	"fmt"
+
+	"github.com/NeuralSpaz/xethru/protocol"
 )
 
 const (
 	appDataByte                    = 0x50
 	respirationStartByte           = 0x26
 	sleepStartByte                 = 0x6c
-	basebandPhaseAmpltudeStartByte = 0x0d
-	basebandIQStartByte            = 0x0c
+	basebandPhaseAmpltudeStartByte = protocol.BaseBandAmpPhaseID
+	basebandIQStartByte            = protocol.BaseBandIQID
 	systemMesg                     = 0x30
 	systemBooting                  = 0x10
 	systemReady                    = 0x11
@@ -29,6 +28,9 @@ type Respiration struct {
 	Distance      float64          `json:"distance"`
 	SignalQuality float64          `json:"signalquality"`
 	Movement      float64          `json:"movement"`
+	Valid         bool             `json:"valid"`    // false if SignalQuality is below the module's MinSignalQuality
+	Settling      bool             `json:"settling"` // the sensor is re-acquiring after a settings change, see Module.SettleTime
+	Raw           []byte           `json:"-"`        // the payload it was parsed from, if the module keeps it
 }
 
 // Sleep is the struct
@@ -44,32 +46,33 @@ type Sleep struct {
 	MovementFast  float64          `json:"movementfast"`
 }
 
+// BaseBandHeader is the header shared by the baseband messages, it is
+// embedded in BaseBandAmpPhase and BaseBandIQ.
+type BaseBandHeader struct {
+	Time         int64   `json:"time"`
+	Status       status  `json:"type"`
+	Counter      uint32  `json:"counter"`
+	Bins         uint32  `json:"bins"`
+	BinLength    float64 `json:"binlength"`
+	SamplingFreq float64 `json:"samplingfreq"`
+	CarrierFreq  float64 `json:"carrier"`
+	RangeOffset  float64 `json:"offset"`
+}
+
 // BaseBandAmpPhase is the struct
 type BaseBandAmpPhase struct {
-	Time         int64     `json:"time"`
-	Status       status    `json:"type"`
-	Counter      uint32    `json:"counter"`
-	Bins         uint32    `json:"bins"`
-	BinLength    float64   `json:"binlength"`
-	SamplingFreq float64   `json:"samplingfreq"`
-	CarrierFreq  float64   `json:"carrier"`
-	RangeOffset  float64   `json:"offset"`
-	Amplitude    []float64 `json:"amplitude"`
-	Phase        []float64 `json:"phase"`
+	BaseBandHeader
+	Amplitude []float64 `json:"amplitude"`
+	Phase     []float64 `json:"phase"`
+	Raw       []byte    `json:"-"` // the payload it was parsed from, if the module keeps it
 }
 
 // BaseBandIQ is the struct
 type BaseBandIQ struct {
-	Time         int64     `json:"time"`
-	Status       status    `json:"type"`
-	Counter      uint32    `json:"counter"`
-	Bins         uint32    `json:"bins"`
-	BinLength    float64   `json:"binlength"`
-	SamplingFreq float64   `json:"samplingfreq"`
-	CarrierFreq  float64   `json:"carrier"`
-	RangeOffset  float64   `json:"offset"`
-	SigI         []float64 `json:"i"`
-	SigQ         []float64 `json:"q"`
+	BaseBandHeader
+	SigI []float64 `json:"i"`
+	SigQ []float64 `json:"q"`
+	Raw  []byte    `json:"-"` // the payload it was parsed from, if the module keeps it
 }
 
 // SystemMessage is the struct
@@ -77,10 +80,40 @@ type SystemMessage struct {
 	Message string
 }
 
+// The messages of the SystemMessages parse returns.
+const (
+	messageBooting = "System Still booting"
+	messageReady   = "System Ready"
+	messageAck     = "Command Ack'ed"
+)
+
+// BasebandFormat is the encoding of the samples in baseband messages.
+type BasebandFormat byte
+
+// Baseband sample formats, older X2M200 firmware sends signed 32 bit integers
+// instead of float32.
+const (
+	BasebandFloat BasebandFormat = iota
+	BasebandInt
+)
+
 func parse(b []byte) (interface{}, error) {
+	return parseWithFormat(b, BasebandFloat)
+}
+
+func parseWithFormat(b []byte, format BasebandFormat) (interface{}, error) {
 	// log.Printf("%02x\n", b)
 	if len(b) == 0 {
-		return nil, errNoData
+		return nil, ErrNoData
+	}
+	if (b[0] == appDataByte || b[0] == systemMesg) && len(b) < 2 {
+		return b, &LengthError{Err: ErrNoData, Want: 2, Got: len(b)}
+	}
+	if kind, ok := basebandKind(b); ok {
+		if kind == BasebandKindAmpPhase {
+			return parseBaseBandAPFormat(b, format)
+		}
+		return parseBaseBandIQFormat(b, format)
 	}
 	switch b[0] {
 	case appDataByte:
@@ -90,162 +123,151 @@ func parse(b []byte) (interface{}, error) {
 			return resp, err
 		case sleepStartByte:
 			return parseSleep(b)
-		case basebandPhaseAmpltudeStartByte:
-			return parseBaseBandAP(b)
-		case basebandIQStartByte:
-			return parseBaseBandIQ(b)
+		case movingListStartByte:
+			return parseMovingList(b)
 		default:
-			return b, errParseNotImplemented
+			return b, ErrParseNotImplemented
 		}
 	case systemMesg:
 		switch b[1] {
 		case systemBooting:
-			return SystemMessage{Message: "System Still booting"}, nil
+			return SystemMessage{Message: messageBooting}, nil
 		case systemReady:
-			return SystemMessage{Message: "System Ready"}, nil
+			return SystemMessage{Message: messageReady}, nil
 		default:
-			return b, errParseNotImplemented
+			return b, ErrParseNotImplemented
 		}
 	case ack:
-		return SystemMessage{Message: "Command Ack'ed"}, nil
+		return SystemMessage{Message: messageAck}, nil
 
 	default:
-		return b, errParseNotImplemented
+		return b, ErrParseNotImplemented
 	}
 	// return nil, fmt.Errorf("something went wrong: %#02x\n", b)
 }
 
 var (
-	errParseNotImplemented = errors.New("Parser not implemented")
-	errNoData              = errors.New("no data to parse")
+	ErrParseNotImplemented = fmt.Errorf("%w: Parser not implemented", ErrParse)
+	ErrNoData              = fmt.Errorf("%w: no data to parse", ErrParse)
 )
 
-const respsize = 29
+const (
+	respsize     = protocol.RespirationSize
+	sleepsize    = protocol.SleepSize
+	apheadersize = protocol.BaseBandHeaderSize
+	iqheadersize = protocol.BaseBandHeaderSize
+)
 
-func parseRespiration(b []byte) (Respiration, error) {
-	// Check to make sure respiration data is long enough
-	if len(b) != respsize {
-		return Respiration{}, errParseRespDataNotEnoughBytes
+// ParseRespiration parses a respiration app payload. b may be the payload
+// returned by a Framer or a whole frame with its start, crc and end bytes,
+// which are checked and stripped as by DecodeFrame. A payload starts with the
+// app data byte so it is never mistaken for a frame.
+func ParseRespiration(b []byte) (Respiration, error) {
+	if len(b) > 0 && b[0] == startByte {
+		payload, err := DecodeFrame(b)
+		if err != nil {
+			return Respiration{}, err
+		}
+		b = payload
 	}
-	data := Respiration{}
-	data.Time = time.Now().UnixNano()
-	data.Status = status(binary.LittleEndian.Uint32(b[1:5]))
-	data.Counter = binary.LittleEndian.Uint32(b[5:9])
-	data.State = respirationState(binary.LittleEndian.Uint32(b[9:13]))
-	data.RPM = binary.LittleEndian.Uint32(b[13:17])
-	data.Distance = float64(math.Float32frombits(binary.LittleEndian.Uint32(b[17:21])))
-	data.Movement = float64(math.Float32frombits(binary.LittleEndian.Uint32(b[21:25])))
-	data.SignalQuality = float64(binary.LittleEndian.Uint32(b[25:29]))
-
-	// log.Println(data)
-	return data, nil
+	return parseRespiration(b)
 }
 
-var (
-	errParseRespDataNotEnoughBytes = errors.New("response does not contain enough bytes")
-)
-
-const sleepsize = 33
+func parseRespiration(b []byte) (Respiration, error) {
+	p, err := protocol.ParseRespiration(b)
+	if err != nil {
+		return Respiration{}, err
+	}
+	return Respiration{
+		Time:          clock().Now().UnixNano(),
+		Status:        status(p.Status),
+		Counter:       p.Counter,
+		State:         respirationState(p.State),
+		RPM:           p.RPM,
+		Distance:      p.Distance,
+		SignalQuality: p.SignalQuality,
+		Movement:      p.Movement,
+		Valid:         true,
+	}, nil
+}
 
 func parseSleep(b []byte) (Sleep, error) {
-	// Make sure we have enough bytes to parse packet without panic
-	if len(b) != sleepsize {
-		return Sleep{}, errParseSleepDataNotEnoughBytes
+	p, err := protocol.ParseSleep(b)
+	if err != nil {
+		return Sleep{}, err
 	}
-	data := Sleep{}
-	data.Time = time.Now().UnixNano()
-	data.Status = status(binary.LittleEndian.Uint32(b[1:5]))
-	data.Counter = binary.LittleEndian.Uint32(b[5:9])
-	data.State = respirationState(binary.LittleEndian.Uint32(b[9:13]))
-	data.RPM = float64(math.Float32frombits(binary.LittleEndian.Uint32(b[13:17])))
-	data.Distance = float64(math.Float32frombits(binary.LittleEndian.Uint32(b[17:21])))
-	data.SignalQuality = float64(binary.LittleEndian.Uint32(b[21:25]))
-	data.MovementSlow = float64(math.Float32frombits(binary.LittleEndian.Uint32(b[25:29])))
-	data.MovementFast = float64(math.Float32frombits(binary.LittleEndian.Uint32(b[29:33])))
-
-	return data, nil
+	return Sleep{
+		Time:          clock().Now().UnixNano(),
+		Status:        status(p.Status),
+		Counter:       p.Counter,
+		State:         respirationState(p.State),
+		RPM:           p.RPM,
+		Distance:      p.Distance,
+		SignalQuality: p.SignalQuality,
+		MovementSlow:  p.MovementSlow,
+		MovementFast:  p.MovementFast,
+	}, nil
 }
 
-var (
-	errParseSleepDataNotEnoughBytes = errors.New("response does not contain enough bytes")
-)
+// baseBandHeader stamps the header parsed by the protocol package.
+func baseBandHeader(h protocol.BaseBandHeader) BaseBandHeader {
+	return BaseBandHeader{
+		Time:         clock().Now().UnixNano(),
+		Status:       status(h.Status),
+		Counter:      h.Counter,
+		Bins:         h.Bins,
+		BinLength:    h.BinLength,
+		SamplingFreq: h.SamplingFreq,
+		CarrierFreq:  h.CarrierFreq,
+		RangeOffset:  h.RangeOffset,
+	}
+}
 
-const apheadersize = 29
+// headerParsed reports whether a baseband parser got as far as the header,
+// only then is a partial frame returned with an error.
+func headerParsed(b []byte, format BasebandFormat) bool {
+	return (format == BasebandFloat || format == BasebandInt) && len(b) >= apheadersize
+}
 
 func parseBaseBandAP(b []byte) (BaseBandAmpPhase, error) {
-	// Make sure we have enough bytes to parse header without panic
-	if len(b) < apheadersize {
-		return BaseBandAmpPhase{}, errParseBaseBandAPNotEnoughBytes
-	}
-	var ap BaseBandAmpPhase
-	ap.Time = time.Now().UnixNano()
-	ap.Status = status(binary.LittleEndian.Uint32(b[1:5]))
-	ap.Counter = binary.LittleEndian.Uint32(b[5:9])
-	ap.Bins = binary.LittleEndian.Uint32(b[9:13])
-	ap.BinLength = float64(math.Float32frombits(binary.LittleEndian.Uint32(b[13:17])))
-	ap.SamplingFreq = float64(math.Float32frombits(binary.LittleEndian.Uint32(b[17:21])))
-	ap.CarrierFreq = float64(math.Float32frombits(binary.LittleEndian.Uint32(b[21:25])))
-	ap.RangeOffset = float64(math.Float32frombits(binary.LittleEndian.Uint32(b[25:29])))
-
-	if len(b) < int(iqheadersize+uint32(ap.Bins)) {
-		return ap, errParseBaseBandAPIncompletePacket
-	}
-
-	for i := apheadersize; i < int((ap.Bins*4)+apheadersize); i += 4 {
-		amplitude := float64(math.Float32frombits(binary.LittleEndian.Uint32(b[i : i+4])))
-		ap.Amplitude = append(ap.Amplitude, amplitude)
-	}
+	return parseBaseBandAPFormat(b, BasebandFloat)
+}
 
-	for i := int(apheadersize + 4*ap.Bins); i < int((ap.Bins*8)+apheadersize); i += 4 {
-		phase := float64(math.Float32frombits(binary.LittleEndian.Uint32(b[i : i+4])))
-		ap.Phase = append(ap.Phase, phase)
+func parseBaseBandAPFormat(b []byte, format BasebandFormat) (BaseBandAmpPhase, error) {
+	p, err := protocol.ParseBaseBandAP(b, protocol.Format(format))
+	if !headerParsed(b, format) {
+		return BaseBandAmpPhase{}, err
 	}
-	return ap, nil
+	return BaseBandAmpPhase{
+		BaseBandHeader: baseBandHeader(p.BaseBandHeader),
+		Amplitude:      p.Amplitude,
+		Phase:          p.Phase,
+	}, err
 }
 
-var (
-	errParseBaseBandAPNotEnoughBytes   = errors.New("baseband data does contain enough bytes")
-	errParseBaseBandAPIncompletePacket = errors.New("baseband data does contain a full packet of data")
-)
-
-const iqheadersize = 29
-
 func parseBaseBandIQ(b []byte) (BaseBandIQ, error) {
-	// Make sure we have enough bytes to parse header without panic
-	if len(b) < iqheadersize {
-		return BaseBandIQ{}, errParseBaseBandIQNotEnoughBytes
-	}
-
-	var iq BaseBandIQ
-
-	iq.Time = time.Now().UnixNano()
-	iq.Status = status(binary.LittleEndian.Uint32(b[1:5]))
-	iq.Counter = binary.LittleEndian.Uint32(b[5:9])
-	iq.Bins = binary.LittleEndian.Uint32(b[9:13])
-	iq.BinLength = float64(math.Float32frombits(binary.LittleEndian.Uint32(b[13:17])))
-	iq.SamplingFreq = float64(math.Float32frombits(binary.LittleEndian.Uint32(b[17:21])))
-	iq.CarrierFreq = float64(math.Float32frombits(binary.LittleEndian.Uint32(b[21:25])))
-	iq.RangeOffset = float64(math.Float32frombits(binary.LittleEndian.Uint32(b[25:29])))
-
-	if len(b) < int(iqheadersize+uint32(iq.Bins)) {
-		return iq, errParseBaseBandIQIncompletePacket
-	}
-
-	for i := iqheadersize; i < int((iq.Bins*4)+iqheadersize); i += 4 {
-		sigi := float64(math.Float32frombits(binary.LittleEndian.Uint32(b[i : i+4])))
-		iq.SigI = append(iq.SigI, sigi)
-	}
+	return parseBaseBandIQFormat(b, BasebandFloat)
+}
 
-	for i := int(iqheadersize + 4*iq.Bins); i < int((iq.Bins*8)+iqheadersize); i += 4 {
-		sigq := float64(math.Float32frombits(binary.LittleEndian.Uint32(b[i : i+4])))
-		iq.SigQ = append(iq.SigQ, sigq)
+func parseBaseBandIQFormat(b []byte, format BasebandFormat) (BaseBandIQ, error) {
+	p, err := protocol.ParseBaseBandIQ(b, protocol.Format(format))
+	if !headerParsed(b, format) {
+		return BaseBandIQ{}, err
 	}
-
-	return iq, nil
-
+	return BaseBandIQ{
+		BaseBandHeader: baseBandHeader(p.BaseBandHeader),
+		SigI:           p.SigI,
+		SigQ:           p.SigQ,
+	}, err
 }
 
 var (
-	errParseBaseBandIQNotEnoughBytes   = errors.New("baseband data does contain enough bytes")
-	errParseBaseBandIQIncompletePacket = errors.New("baseband data does contain a full packet of data")
+	errParseRespDataNotEnoughBytes     = protocol.ErrRespirationLength
+	errParseSleepDataNotEnoughBytes    = protocol.ErrSleepLength
+	errParseBaseBandAPNotEnoughBytes   = protocol.ErrAmpPhaseLength
+	errParseBaseBandAPIncompletePacket = protocol.ErrAmpPhaseSamples
+	errParseBaseBandIQNotEnoughBytes   = protocol.ErrIQLength
+	errParseBaseBandIQIncompletePacket = protocol.ErrIQSamples
+	errParseBasebandFormatUnknown      = protocol.ErrFormatUnknown
+	errParseBasebandInvalidSample      = protocol.ErrInvalidSample
 )
@@ -1,6 +1,8 @@
 package xethru
 
 import (
+	"encoding/json"
+	"errors"
 	"reflect"
 	"testing"
 )
@@ -11,19 +13,21 @@ func TestParse(t *testing.T) {
 		err  error
 		resp interface{}
 	}{
-		// {[]byte{0xFF}, errParseNotImplemented, nil},
-		{[]byte{}, errNoData, nil},
+		// {[]byte{0xFF}, ErrParseNotImplemented, nil},
+		{[]byte{}, ErrNoData, nil},
+		{[]byte{appDataByte}, ErrNoData, []byte{}},
+		{[]byte{systemMesg}, ErrNoData, []byte{}},
 		{[]byte{appDataByte, respirationStartByte}, errParseRespDataNotEnoughBytes, Respiration{}},
 		{[]byte{appDataByte, sleepStartByte}, errParseSleepDataNotEnoughBytes, Sleep{}},
 		{[]byte{appDataByte, basebandPhaseAmpltudeStartByte}, errParseBaseBandAPNotEnoughBytes, BaseBandAmpPhase{}},
 		{[]byte{appDataByte, basebandIQStartByte}, errParseBaseBandIQNotEnoughBytes, BaseBandIQ{}},
-		// {[]byte{appDataByte, 0x00}, errParseNotImplemented, nil},
+		// {[]byte{appDataByte, 0x00}, ErrParseNotImplemented, nil},
 		// {[]byte{appDataByte, sleepStartByte}, errParseSleepDataNotEnoughBytes, BaseBandIQ{}},
 	}
 	for n, c := range cases {
 		resp, err := parse(c.b)
 		// log.Printf("%#v, %#v \n", resp, err)
-		if err != c.err {
+		if !errors.Is(err, c.err) {
 			t.Errorf("test %d Expected: %v, got %v\n", n, c.err, err)
 		}
 		resptype := reflect.TypeOf(resp)
@@ -58,7 +62,7 @@ func TestParseRespiration(t *testing.T) {
 			[]byte{appDataByte, 0x26, 0xfe, 0x75, 0x23, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
 			nil,
 			Respiration{
-				Time:          0,
+				Time:          fakeClockTime,
 				Status:        respApp,
 				Counter:       0,
 				State:         0,
@@ -66,16 +70,17 @@ func TestParseRespiration(t *testing.T) {
 				Distance:      0,
 				SignalQuality: 0,
 				Movement:      0,
+				Valid:         true,
 			}},
 	}
+	useFakeClock(t)
 	for n, c := range cases {
 		resp, err := parseRespiration(c.b)
 		// log.Printf("%#v, %#v \n", resp, err)
-		if err != c.err {
+		if !errors.Is(err, c.err) {
 			t.Errorf("test %d Expected: %v, got %v\n", n, c.err, err)
 		}
-		resp.Time = 0
-		if resp != c.resp {
+		if !reflect.DeepEqual(resp, c.resp) {
 			t.Errorf("test %d Expected: %#v, got %#v\n", n, c.resp, resp)
 		}
 	}
@@ -104,7 +109,7 @@ func TestParseSleep(t *testing.T) {
 			[]byte{appDataByte, 0x6c, 0xa1, 0x75, 0x23, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
 			nil,
 			Sleep{
-				Time:          0,
+				Time:          fakeClockTime,
 				Status:        sleepApp,
 				Counter:       0,
 				State:         0,
@@ -115,14 +120,14 @@ func TestParseSleep(t *testing.T) {
 				MovementFast:  0,
 			}},
 	}
+	useFakeClock(t)
 	for n, c := range cases {
 		// log.Println(len(c.b))
 		resp, err := parseSleep(c.b)
 		// log.Printf("%#v, %#v \n", resp, err)
-		if err != c.err {
+		if !errors.Is(err, c.err) {
 			t.Errorf("test %d Expected: %v, got %v\n", n, c.err, err)
 		}
-		resp.Time = 0
 		if resp != c.resp {
 			t.Errorf("test %d Expected: %#v, got %#v\n", n, c.resp, resp)
 		}
@@ -149,13 +154,17 @@ func TestBasebandAmpPhase(t *testing.T) {
 			nil,
 			BaseBandAmpPhase{}},
 	}
+	useFakeClock(t)
 	for n, c := range cases {
 		// log.Println(len(c.b))
-		_, err := parseBaseBandAP(c.b)
+		resp, err := parseBaseBandAP(c.b)
 		// log.Printf("%#v, %#v \n", resp, err)
-		if err != c.err {
+		if !errors.Is(err, c.err) {
 			t.Errorf("test %d Expected: %v, got %v\n", n, c.err, err)
 		}
+		if err == nil && resp.Time != fakeClockTime {
+			t.Errorf("test %d Expected: time %d, got %d\n", n, int64(fakeClockTime), resp.Time)
+		}
 		// TODO: Validate response
 	}
 }
@@ -180,13 +189,180 @@ func TestBasebandIQ(t *testing.T) {
 			nil,
 			BaseBandIQ{}},
 	}
+	useFakeClock(t)
 	for n, c := range cases {
 		// log.Println(len(c.b))
-		_, err := parseBaseBandIQ(c.b)
+		resp, err := parseBaseBandIQ(c.b)
 		// log.Printf("%#v, %#v \n", resp, err)
-		if err != c.err {
+		if !errors.Is(err, c.err) {
 			t.Errorf("test %d Expected: %v, got %v\n", n, c.err, err)
 		}
+		if err == nil && resp.Time != fakeClockTime {
+			t.Errorf("test %d Expected: time %d, got %d\n", n, int64(fakeClockTime), resp.Time)
+		}
 		// TODO: Validate response
 	}
 }
+
+func TestBasebandFormats(t *testing.T) {
+	// header with 2 bins, followed by I0 I1 Q0 Q1
+	header := []byte{appDataByte, 0x0c, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+	floats := append(append([]byte{}, header...), 0x00, 0x00, 0x80, 0x3f, 0x00, 0x00, 0x00, 0xbf, 0x00, 0x00, 0x40, 0x40, 0x00, 0x00, 0x80, 0x3e)
+	ints := append(append([]byte{}, header...), 0x00, 0x00, 0x01, 0x00, 0x00, 0x80, 0xff, 0xff, 0x00, 0x00, 0x03, 0x00, 0x00, 0x40, 0x00, 0x00)
+	nans := append(append([]byte{}, header...), 0x00, 0x00, 0xc0, 0x7f, 0x00, 0x00, 0x00, 0xbf, 0x00, 0x00, 0x40, 0x40, 0x00, 0x00, 0x80, 0x3e)
+
+	cases := []struct {
+		b      []byte
+		format BasebandFormat
+		err    error
+		i      []float64
+		q      []float64
+	}{
+		{floats, BasebandFloat, nil, []float64{1, -0.5}, []float64{3, 0.25}},
+		{ints, BasebandInt, nil, []float64{1, -0.5}, []float64{3, 0.25}},
+		{nans, BasebandFloat, errParseBasebandInvalidSample, nil, nil},
+		{floats, BasebandFormat(9), errParseBasebandFormatUnknown, nil, nil},
+	}
+	for n, c := range cases {
+		resp, err := parseWithFormat(c.b, c.format)
+		if !errors.Is(err, c.err) {
+			t.Errorf("test %d Expected: %v, got %v\n", n, c.err, err)
+		}
+		if err != nil {
+			continue
+		}
+		iq := resp.(BaseBandIQ)
+		if !reflect.DeepEqual(iq.SigI, c.i) || !reflect.DeepEqual(iq.SigQ, c.q) {
+			t.Errorf("test %d Expected: %v %v, got %v %v\n", n, c.i, c.q, iq.SigI, iq.SigQ)
+		}
+
+		// amplitude phase shares the same sample encoding
+		ap := append([]byte{}, c.b...)
+		ap[1] = basebandPhaseAmpltudeStartByte
+		resp, err = parseWithFormat(ap, c.format)
+		if err != nil {
+			t.Errorf("test %d unexpected error %v\n", n, err)
+			continue
+		}
+		if a := resp.(BaseBandAmpPhase); !reflect.DeepEqual(a.Amplitude, c.i) || !reflect.DeepEqual(a.Phase, c.q) {
+			t.Errorf("test %d Expected: %v %v, got %v %v\n", n, c.i, c.q, a.Amplitude, a.Phase)
+		}
+	}
+}
+
+func TestBasebandJSONRoundTrip(t *testing.T) {
+	header := BaseBandHeader{
+		Time:         1480000000000000000,
+		Status:       basebandAP,
+		Counter:      42,
+		Bins:         2,
+		BinLength:    0.0514,
+		SamplingFreq: 39e9,
+		CarrierFreq:  7.29e9,
+		RangeOffset:  0.2075,
+	}
+	ap := BaseBandAmpPhase{BaseBandHeader: header, Amplitude: []float64{0.5, 0.25}, Phase: []float64{-1, 1}}
+	header.Status = basebandIQ
+	iq := BaseBandIQ{BaseBandHeader: header, SigI: []float64{0.5, 0.25}, SigQ: []float64{-1, 1}}
+
+	cases := []struct {
+		in   interface{}
+		out  interface{}
+		keys []string
+	}{
+		{ap, &BaseBandAmpPhase{}, []string{"time", "type", "counter", "bins", "binlength", "samplingfreq", "carrier", "offset", "amplitude", "phase"}},
+		{iq, &BaseBandIQ{}, []string{"time", "type", "counter", "bins", "binlength", "samplingfreq", "carrier", "offset", "i", "q"}},
+	}
+	for n, c := range cases {
+		b, err := json.Marshal(c.in)
+		if err != nil {
+			t.Fatalf("test %d %v\n", n, err)
+		}
+		var fields map[string]interface{}
+		if err := json.Unmarshal(b, &fields); err != nil {
+			t.Fatalf("test %d %v\n", n, err)
+		}
+		if len(fields) != len(c.keys) {
+			t.Errorf("test %d Expected: keys %v, got %s\n", n, c.keys, b)
+		}
+		for _, k := range c.keys {
+			if _, ok := fields[k]; !ok {
+				t.Errorf("test %d Expected: key %q, got %s\n", n, k, b)
+			}
+		}
+		if err := json.Unmarshal(b, c.out); err != nil {
+			t.Fatalf("test %d %v\n", n, err)
+		}
+		if !reflect.DeepEqual(reflect.ValueOf(c.out).Elem().Interface(), c.in) {
+			t.Errorf("test %d Expected: %#v, got %#v\n", n, c.in, c.out)
+		}
+	}
+}
+
+func TestParseLengthError(t *testing.T) {
+	_, err := parse([]byte{appDataByte, basebandIQStartByte, 0x00})
+	var lenErr *LengthError
+	if !errors.As(err, &lenErr) || lenErr.Want != iqheadersize || lenErr.Got != 3 {
+		t.Errorf("Expected: length error want %d got 3, got %v\n", iqheadersize, err)
+	}
+	if !errors.Is(err, ErrParse) {
+		t.Errorf("Expected: %v to wrap %v\n", err, ErrParse)
+	}
+}
+
+func FuzzParseProtocol(f *testing.F) {
+	f.Add(respirationPayload)
+	f.Add(buildIQPayload(1, 4))
+	f.Add([]byte{appDataByte})
+	f.Add([]byte{appDataByte, basebandIQStartByte, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff})
+	f.Add([]byte{dataResponse, 0x01, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 0xff, 0x0f})
+	f.Fuzz(func(t *testing.T, b []byte) {
+		for _, p := range []Protocol{ProtocolX2M200, ProtocolX4} {
+			for _, format := range []BasebandFormat{BasebandFloat, BasebandInt} {
+				data, err := parseProtocol(b, format, p)
+				if err == nil {
+					DefaultLimits.Check(data)
+				}
+				// samples come from the payload, never from a length field alone
+				if iq, ok := data.(BaseBandIQ); ok && 4*(len(iq.SigI)+len(iq.SigQ)) > len(b) {
+					t.Errorf("Expected: at most %d samples, got %d\n", len(b)/4, len(iq.SigI)+len(iq.SigQ))
+				}
+			}
+		}
+	})
+}
+
+func TestParseRespirationShapes(t *testing.T) {
+	useFakeClock(t)
+	want, err := parseRespiration(respirationPayload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame := EncodeFrame(respirationPayload)
+	badCRC := append([]byte(nil), frame...)
+	badCRC[len(badCRC)-2] ^= 0x01
+
+	// payloads and frames mixed, as read from different layers
+	cases := []struct {
+		b   []byte
+		err error
+	}{
+		{respirationPayload, nil},
+		{frame, nil},
+		{respirationPayload, nil},
+		{frame, nil},
+		{badCRC, ErrPacketBadCRC},
+		{frame[:len(frame)-1], ErrPacketNotLongEnough},
+		{append(append([]byte(nil), frame...), frame...), ErrFrameTrailingData},
+		{EncodeFrame(respirationPayload[:20]), errParseRespDataNotEnoughBytes},
+	}
+	for n, c := range cases {
+		got, err := ParseRespiration(c.b)
+		if !errors.Is(err, c.err) {
+			t.Errorf("test %d Expected: %v, got %v\n", n, c.err, err)
+		}
+		if c.err == nil && !reflect.DeepEqual(got, want) {
+			t.Errorf("test %d Expected: %+v, got %+v\n", n, want, got)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package xethru
+
+import (
+	"math"
+	"sort"
+)
+
+// Peak is a local maximum in the amplitude range profile.
+type Peak struct {
+	BinIndex    int
+	RangeMeters float64
+	Amplitude   float64
+	Prominence  float64
+}
+
+// PeakOptions control which peaks FindPeaks returns. Zero values disable the
+// option.
+type PeakOptions struct {
+	MinProminence float64
+	MinSeparation float64 // meters
+	MaxPeaks      int
+}
+
+// FindPeaks returns the peaks in the amplitude of ap, strongest first.
+func FindPeaks(ap BaseBandAmpPhase, opts PeakOptions) []Peak {
+	amp := ap.Amplitude
+	var peaks []Peak
+	for i := range amp {
+		if i > 0 && amp[i] <= amp[i-1] {
+			continue
+		}
+		if i < len(amp)-1 && amp[i] < amp[i+1] {
+			continue
+		}
+		p := Peak{
+			BinIndex:    i,
+			RangeMeters: ap.RangeOffset + float64(i)*ap.BinLength,
+			Amplitude:   amp[i],
+			Prominence:  prominence(amp, i),
+		}
+		if p.Prominence < opts.MinProminence {
+			continue
+		}
+		peaks = append(peaks, p)
+	}
+
+	sort.SliceStable(peaks, func(i, j int) bool {
+		return peaks[i].Amplitude > peaks[j].Amplitude
+	})
+
+	selected := peaks[:0]
+	for _, p := range peaks {
+		if opts.MaxPeaks > 0 && len(selected) >= opts.MaxPeaks {
+			break
+		}
+		tooClose := false
+		for _, s := range selected {
+			if math.Abs(p.RangeMeters-s.RangeMeters) < opts.MinSeparation {
+				tooClose = true
+				break
+			}
+		}
+		if !tooClose {
+			selected = append(selected, p)
+		}
+	}
+	return selected
+}
+
+// prominence is the height of peak i above the higher of the lowest points
+// between it and a higher bin on either side. A side with no bins is ignored
+// so peaks at the edges of the profile are not discarded.
+func prominence(amp []float64, i int) float64 {
+	base := math.Inf(-1)
+	if i > 0 {
+		low := amp[i]
+		for k := i - 1; k >= 0 && amp[k] <= amp[i]; k-- {
+			low = math.Min(low, amp[k])
+		}
+		base = math.Max(base, low)
+	}
+	if i < len(amp)-1 {
+		low := amp[i]
+		for k := i + 1; k < len(amp) && amp[k] <= amp[i]; k++ {
+			low = math.Min(low, amp[k])
+		}
+		base = math.Max(base, low)
+	}
+	if math.IsInf(base, -1) {
+		return amp[i]
+	}
+	return amp[i] - base
+}
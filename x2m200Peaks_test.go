@@ -0,0 +1,74 @@
+package xethru
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFindPeaks(t *testing.T) {
+	profile := BaseBandAmpPhase{
+		BaseBandHeader: BaseBandHeader{Bins: 10, BinLength: 0.1, RangeOffset: 0.5},
+		Amplitude:      []float64{5, 1, 2, 1, 8, 3, 4, 1, 1, 6},
+	}
+	cases := []struct {
+		opts PeakOptions
+		bins []int
+	}{
+		{PeakOptions{}, []int{4, 9, 0, 6, 2}},
+		{PeakOptions{MinProminence: 1.5}, []int{4, 9, 0}},
+		{PeakOptions{MaxPeaks: 2}, []int{4, 9}},
+		{PeakOptions{MinSeparation: 0.15}, []int{4, 9, 0, 6, 2}},
+		{PeakOptions{MinSeparation: 0.25}, []int{4, 9, 0}},
+		{PeakOptions{MinSeparation: 0.45}, []int{4, 9}},
+	}
+	for n, c := range cases {
+		peaks := FindPeaks(profile, c.opts)
+		if len(peaks) != len(c.bins) {
+			t.Errorf("test %d Expected: %v, got %+v\n", n, c.bins, peaks)
+			continue
+		}
+		for i, p := range peaks {
+			if p.BinIndex != c.bins[i] {
+				t.Errorf("test %d Expected: %v, got %+v\n", n, c.bins, peaks)
+				break
+			}
+		}
+	}
+
+	peaks := FindPeaks(profile, PeakOptions{MaxPeaks: 1})
+	if math.Abs(peaks[0].RangeMeters-0.9) > 1e-9 || peaks[0].Amplitude != 8 || peaks[0].Prominence != 7 {
+		t.Errorf("Expected: peak at 0.9m amplitude 8 prominence 7, got %+v\n", peaks[0])
+	}
+}
+
+func TestFindPeaksEdges(t *testing.T) {
+	cases := []struct {
+		amp        []float64
+		bin        int
+		prominence float64
+	}{
+		{[]float64{9, 1, 2}, 0, 8},
+		{[]float64{2, 1, 9}, 2, 8},
+		{[]float64{3}, 0, 3},
+	}
+	for n, c := range cases {
+		peaks := FindPeaks(BaseBandAmpPhase{BaseBandHeader: BaseBandHeader{Bins: uint32(len(c.amp))}, Amplitude: c.amp}, PeakOptions{MaxPeaks: 1})
+		if len(peaks) != 1 || peaks[0].BinIndex != c.bin || peaks[0].Prominence != c.prominence {
+			t.Errorf("test %d Expected: bin %d prominence %v, got %+v\n", n, c.bin, c.prominence, peaks)
+		}
+	}
+	if peaks := FindPeaks(BaseBandAmpPhase{}, PeakOptions{}); len(peaks) != 0 {
+		t.Errorf("Expected: no peaks, got %+v\n", peaks)
+	}
+}
+
+func BenchmarkFindPeaks1024(b *testing.B) {
+	ap := BaseBandAmpPhase{BaseBandHeader: BaseBandHeader{Bins: 1024, BinLength: 0.0514}, Amplitude: make([]float64, 1024)}
+	for i := range ap.Amplitude {
+		ap.Amplitude[i] = math.Abs(math.Sin(float64(i)/7)) * (1 + math.Cos(float64(i)/50))
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		FindPeaks(ap, PeakOptions{MinProminence: 0.1, MinSeparation: 0.3, MaxPeaks: 5})
+	}
+}
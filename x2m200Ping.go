@@ -20,7 +20,6 @@ package xethru
 import (
 	"encoding/binary"
 	"errors"
-	"log"
 	"time"
 )
 
@@ -34,12 +33,18 @@ const (
 // Ping send the xethru ping command and will wait for the timeout to expire
 // before closing and returning an error, It is Recommended that you Reset or
 // panic if a Ping fails
-func (x x2m200Frame) Ping(t time.Duration) (bool, error) {
-	resp := make(chan []byte)
-	x.ping(resp)
+//
+// If the transport supports deadlines the read is abandoned at the timeout,
+// otherwise it is left running and may consume the next frame.
+func (x *x2m200Frame) Ping(t time.Duration) (bool, error) {
 	if t == 0 {
 		t = time.Millisecond * 100
 	}
+	if x.d != nil {
+		return x.pingDeadline(t)
+	}
+	resp := make(chan []byte, 1)
+	x.ping(resp)
 	select {
 	case <-time.After(t):
 
@@ -54,33 +59,67 @@ func (x x2m200Frame) Ping(t time.Duration) (bool, error) {
 
 var errPingTimeout = errors.New("ping timeout")
 
-func (x x2m200Frame) ping(response chan []byte) {
+func pingCommand() []byte {
+	seed := make([]byte, 4)
+	binary.BigEndian.PutUint32(seed, x2m200PingSeed)
+	return []byte{x2m200PingCommand, seed[0], seed[1], seed[2], seed[3]}
+}
+
+// pingDeadline pings with the transport deadlines set to t from now.
+func (x *x2m200Frame) pingDeadline(t time.Duration) (bool, error) {
+	deadline := time.Now().Add(t)
+	x.d.SetWriteDeadline(deadline)
+	x.d.SetReadDeadline(deadline)
+	defer x.d.SetWriteDeadline(time.Time{})
+	defer x.d.SetReadDeadline(time.Time{})
+
+	if _, err := x.Write(pingCommand()); err != nil {
+		if isTimeout(err) {
+			return false, errPingTimeout
+		}
+		return false, err
+	}
+	b := make([]byte, 20)
+	for {
+		n, err := x.Read(b)
+		switch {
+		case isTimeout(err):
+			return false, errPingTimeout
+		case err != nil && isTransportErr(err):
+			return false, err
+		case err != nil:
+			frameLogger(x).Warnf("ping read error %v", err)
+			continue
+		case n == 0:
+			continue
+		}
+		return isValidPingResponse(b[:n])
+	}
+}
+
+func (x *x2m200Frame) ping(response chan []byte) {
 	go func() {
-		// build ping command
-		// find betterway to do this
-		seed := make([]byte, 4)
-		binary.BigEndian.PutUint32(seed, x2m200PingSeed)
-		// fmt.Printf("seed %x\n", seed)
-		cmd := []byte{x2m200PingCommand, seed[0], seed[1], seed[2], seed[3]}
 		// Write to Framer
-		n, err := x.Write(cmd)
+		n, err := x.Write(pingCommand())
 		// x.w.Flush()
 		if err != nil {
-			log.Printf("Ping Write Error %v, number of bytes %d\n", err, n)
+			frameLogger(x).Warnf("ping write error %v, number of bytes %d", err, n)
 		}
 
 		// Read from Framer
 		b := make([]byte, 20)
 		n, err = x.Read(b)
 		if err != nil {
-			log.Printf("Ping Read Error %v, number of bytes %d\n", err, n)
+			frameLogger(x).Warnf("ping read error %v, number of bytes %d", err, n)
 		}
 		// retry
 		for n == 0 {
+			if err != nil && isTransportErr(err) {
+				return
+			}
 			n, err = x.Read(b)
 			if err != nil {
-				log.Printf("Ping Read Error %v, number of bytes %d\n", err, n)
-				log.Printf("bytes %x\n", b)
+				frameLogger(x).Warnf("ping read error %v, number of bytes %d, bytes %x", err, n, b)
 			}
 		}
 		// send response []byte back to caller
@@ -93,9 +132,9 @@ func (x x2m200Frame) ping(response chan []byte) {
 //
 func isValidPingResponse(b []byte) (bool, error) {
 	// check response length is
-	// if len(b) != 5 {
-	// 	return false, errPingNotEnoughBytes
-	// }
+	if len(b) != 5 {
+		return false, errPingNotEnoughBytes
+	}
 	// Check response starts with Ping Byte
 	if b[0] != x2m200PingCommand {
 		return false, errPingDoesNotStartWithPingCMD
@@ -0,0 +1,153 @@
+package xethru
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// BatchError is returned by ExecuteAll when a command in the batch fails,
+// Index is the position of the command in the batch.
+type BatchError struct {
+	Index int
+	Err   error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("command %d of batch: %v", e.Index, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// batchWriter is implemented by Framers that can write several frames with
+// a single write to the transport.
+type batchWriter interface {
+	WriteBatch(payloads [][]byte) error
+}
+
+// WriteBatch frames each payload and writes them all with one write, so a
+// batch of commands costs a single syscall.
+func (x *x2m200Frame) WriteBatch(payloads [][]byte) error {
+	x.wmu.Lock()
+	defer x.wmu.Unlock()
+	var frames []byte
+	for _, p := range payloads {
+		start := len(frames)
+		frames = AppendFrame(frames, p)
+		if trace := x.tracer(); trace != nil {
+			trace(DirectionWrite, frames[start:], time.Now())
+		}
+	}
+	return x.writeFrames(frames)
+}
+
+// orderIndependent reports whether the sensor may be sent cmd before the
+// commands written ahead of it are acked. Only settings of an app that is
+// already loaded qualify, they do not depend on each other.
+func orderIndependent(cmd []byte) bool {
+	if len(cmd) < 2 {
+		return false
+	}
+	switch {
+	case cmd[0] == x2m200SetLEDControl:
+		return true
+	case cmd[0] == x2m200AppCommand && cmd[1] == x2m200Set:
+		return true
+	}
+	return false
+}
+
+// ExecuteAll sends cmds, each waiting up to timeout for a response starting
+// with want, and returns the responses in order. If Pipeline is set and every
+// command is order independent the commands are written together without
+// waiting for each response, which saves a round trip per command on a slow
+// link. Otherwise they are sent one at a time and the first failure stops the
+// batch. A failure is returned as a BatchError.
+func (r *Module) ExecuteAll(cmds [][]byte, want byte, timeout time.Duration) ([][]byte, error) {
+	if len(cmds) == 0 {
+		return nil, nil
+	}
+	match := func(p []byte) bool {
+		return len(p) > 0 && p[0] == want
+	}
+	pipelined := r.Pipeline
+	for _, cmd := range cmds {
+		pipelined = pipelined && orderIndependent(cmd)
+	}
+	if pipelined && !r.isAsleep() {
+		r.startReader()
+		return r.dispatcher.pipeline(cmds, timeout, match)
+	}
+	resps := make([][]byte, len(cmds))
+	for i, cmd := range cmds {
+		resp, err := r.exchange(cmd, timeout, match)
+		if err != nil {
+			return resps, &BatchError{Index: i, Err: err}
+		}
+		resps[i] = resp
+	}
+	return resps, nil
+}
+
+// pipeline writes all of cmds, with one write if the Framer supports it, then
+// waits for their responses. The sensor answers in order so each response, or
+// error reply, is taken to be for the oldest command still waiting. Every
+// response is waited for, the first failure is returned. A timeout abandons
+// the rest of the batch.
+func (d *Dispatcher) pipeline(cmds [][]byte, timeout time.Duration, match func([]byte) bool) ([][]byte, error) {
+	d.callMu.Lock()
+	defer d.callMu.Unlock()
+
+	calls := make([]*call, len(cmds))
+	d.pendingMu.Lock()
+	for i := range calls {
+		d.gen++
+		calls[i] = &call{gen: d.gen, match: match, done: make(chan Frame, 1)}
+	}
+	d.pending, d.queue = calls[0], calls[1:]
+	d.pendingMu.Unlock()
+	defer func() {
+		// callMu is held so anything still waiting is from this batch
+		d.pendingMu.Lock()
+		d.pending, d.queue = nil, nil
+		d.pendingMu.Unlock()
+	}()
+
+	if timeout <= 0 {
+		timeout = 500 * time.Millisecond
+	}
+	if dl := frameDeadliner(d.f); dl != nil {
+		dl.SetWriteDeadline(time.Now().Add(timeout))
+		defer dl.SetWriteDeadline(time.Time{})
+	}
+	if bw, ok := d.f.(batchWriter); ok {
+		if err := bw.WriteBatch(cmds); err != nil {
+			return nil, &BatchError{Index: 0, Err: err}
+		}
+	} else {
+		for i, cmd := range cmds {
+			if _, err := d.f.Write(cmd); err != nil {
+				return nil, &BatchError{Index: i, Err: err}
+			}
+		}
+	}
+
+	resps := make([][]byte, len(cmds))
+	var first error
+	for i, c := range calls {
+		resp, err := d.await(context.Background(), c, timeout)
+		if err != nil {
+			return resps, &BatchError{Index: i, Err: err}
+		}
+		if resp.Err != nil {
+			if first == nil {
+				first = &BatchError{Index: i, Err: resp.Err}
+			}
+			continue
+		}
+		resps[i] = resp.Payload
+	}
+	return resps, first
+}
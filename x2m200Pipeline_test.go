@@ -0,0 +1,194 @@
+package xethru
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// latencySensor answers each command delay after it was written, like a
+// sensor behind a slow link, and counts the writes made to it.
+type latencySensor struct {
+	writes atomic.Int64
+	mu     sync.Mutex
+	cmds   [][]byte
+}
+
+type countingWriter struct {
+	io.Writer
+	n *atomic.Int64
+}
+
+func (w countingWriter) Write(p []byte) (int, error) {
+	w.n.Add(1)
+	return w.Writer.Write(p)
+}
+
+func newLatencySensor(delay time.Duration, reply func(cmd []byte) []byte) (Framer, *latencySensor, func()) {
+	s := &latencySensor{}
+	sensorReader, clientWriter := io.Pipe()
+	clientReader, sensorWriter := io.Pipe()
+	sensor := NewFramer(pipeConn{sensorReader, sensorWriter})
+	type delayed struct {
+		due time.Time
+		p   []byte
+	}
+	replies := make(chan delayed, 64)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for d := range replies {
+			time.Sleep(time.Until(d.due))
+			sensor.Write(d.p)
+		}
+	}()
+	go func() {
+		defer close(replies)
+		a := NewAssembler()
+		b := make([]byte, 1024)
+		for {
+			n, err := sensorReader.Read(b)
+			if err != nil {
+				return
+			}
+			a.Write(b[:n])
+			for {
+				cmd, err := a.Next()
+				if cmd == nil || err != nil {
+					break
+				}
+				s.mu.Lock()
+				s.cmds = append(s.cmds, cmd)
+				s.mu.Unlock()
+				if p := reply(cmd); p != nil {
+					replies <- delayed{due: time.Now().Add(delay), p: p}
+				}
+			}
+		}
+	}()
+	f := NewFramer(struct {
+		io.Reader
+		io.Writer
+	}{clientReader, countingWriter{clientWriter, &s.writes}})
+	return f, s, func() {
+		sensor.Close()
+		clientWriter.Close()
+		<-done
+	}
+}
+
+func ackAll([]byte) []byte { return []byte{x2m200Ack} }
+
+func TestSetupPipelined(t *testing.T) {
+	const delay = 40 * time.Millisecond
+	setup := func(pipeline bool) (time.Duration, int64) {
+		f, sensor, stop := newLatencySensor(delay, ackAll)
+		defer stop()
+		m := NewRespiration(f)
+		m.Timeout = time.Second
+		m.DetectionZoneStart, m.DetectionZoneEnd = 0.5, 1.5
+		m.Pipeline = pipeline
+		start := time.Now()
+		if err := m.Setup(); err != nil {
+			t.Fatal(err)
+		}
+		return time.Since(start), sensor.writes.Load()
+	}
+
+	// load, led, zone and sensitivity are four round trips one at a time,
+	// two when the settings are pipelined behind the load
+	strict, strictWrites := setup(false)
+	pipelined, pipelinedWrites := setup(true)
+	if strict < 4*delay {
+		t.Errorf("Expected: strict setup to take at least %v, got %v\n", 4*delay, strict)
+	}
+	if pipelined >= 3*delay {
+		t.Errorf("Expected: pipelined setup to take under %v, got %v\n", 3*delay, pipelined)
+	}
+	if strictWrites != 4 || pipelinedWrites != 2 {
+		t.Errorf("Expected: 4 and 2 writes, got %d and %d\n", strictWrites, pipelinedWrites)
+	}
+}
+
+func TestExecuteAll(t *testing.T) {
+	led := []byte{x2m200SetLEDControl, byte(LEDFull), 0x00}
+	sens := []byte{x2m200AppCommand, x2m200Set, 0x2b, 0x11, 0xa5, 0x10, 0x05, 0x00, 0x00, 0x00}
+	load := []byte{x2m200LoadModule, 0xd6, 0xa2, 0x23, 0x14}
+	refuse := func(cmd []byte) []byte {
+		if cmd[0] == x2m200SetLEDControl {
+			return []byte{errorByte, 0x02}
+		}
+		return []byte{x2m200Ack}
+	}
+	cases := []struct {
+		pipeline bool
+		cmds     [][]byte
+		reply    func([]byte) []byte
+		writes   int64
+		sent     int
+		index    int // of the failed command, -1 for none
+	}{
+		{pipeline: true, cmds: [][]byte{led, sens}, reply: ackAll, writes: 1, sent: 2, index: -1},
+		// a command that is not order independent is sent one at a time
+		{pipeline: true, cmds: [][]byte{load, led, sens}, reply: ackAll, writes: 3, sent: 3, index: -1},
+		{pipeline: false, cmds: [][]byte{led, sens}, reply: ackAll, writes: 2, sent: 2, index: -1},
+		// the error reply is for the oldest command, the rest are still acked
+		{pipeline: true, cmds: [][]byte{sens, led, sens}, reply: refuse, writes: 1, sent: 3, index: 1},
+		// one at a time the batch stops at the failure
+		{pipeline: false, cmds: [][]byte{sens, led, sens}, reply: refuse, writes: 2, sent: 2, index: 1},
+	}
+	for n, c := range cases {
+		f, sensor, stop := newLatencySensor(time.Millisecond, c.reply)
+		m := NewRespiration(f)
+		m.Timeout = time.Second
+		m.Pipeline = c.pipeline
+		_, err := m.ExecuteAll(c.cmds, x2m200Ack, m.Timeout)
+		var be *BatchError
+		switch {
+		case c.index < 0 && err != nil:
+			t.Errorf("test %d Expected: <nil>, got %v\n", n, err)
+		case c.index >= 0 && (!errors.As(err, &be) || be.Index != c.index || !errors.Is(err, ErrProtocol)):
+			t.Errorf("test %d Expected: failure of command %d, got %v\n", n, c.index, err)
+		}
+		// a later command must not be mistaken for a response
+		if _, err := m.Execute(sens, x2m200Ack, m.Timeout); err != nil {
+			t.Errorf("test %d Expected: <nil>, got %v\n", n, err)
+		}
+		if w := sensor.writes.Load(); w != c.writes+1 {
+			t.Errorf("test %d Expected: %d writes, got %d\n", n, c.writes+1, w)
+		}
+		sensor.mu.Lock()
+		if len(sensor.cmds) != c.sent+1 || !bytes.Equal(sensor.cmds[0], c.cmds[0]) {
+			t.Errorf("test %d Expected: %d commands, got %x\n", n, c.sent+1, sensor.cmds)
+		}
+		sensor.mu.Unlock()
+		stop()
+	}
+}
+
+func TestExecuteAllTimeout(t *testing.T) {
+	led := []byte{x2m200SetLEDControl, byte(LEDFull), 0x00}
+	// only the first command is answered
+	var answered atomic.Bool
+	f, _, stop := newLatencySensor(time.Millisecond, func([]byte) []byte {
+		if answered.Swap(true) {
+			return nil
+		}
+		return []byte{x2m200Ack}
+	})
+	defer stop()
+	m := NewRespiration(f)
+	m.Pipeline = true
+	_, err := m.ExecuteAll([][]byte{led, led, led}, x2m200Ack, 50*time.Millisecond)
+	var be *BatchError
+	if !errors.As(err, &be) || be.Index != 1 || !errors.Is(err, ErrCommandTimeout) {
+		t.Errorf("Expected: timeout of command 1, got %v\n", err)
+	}
+	if d := m.dispatcher; d.pending != nil || len(d.queue) != 0 || len(d.abandoned) != 2 {
+		t.Errorf("Expected: the rest of the batch abandoned, got %v %v %v\n", d.pending, d.queue, d.abandoned)
+	}
+}
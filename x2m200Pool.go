@@ -0,0 +1,47 @@
+package xethru
+
+import "sync"
+
+// readBufferSize is large enough for a 256 bin baseband frame.
+const readBufferSize = 4096
+
+// readBuffers holds read buffers for the frame read path so a new buffer is
+// not allocated for every frame.
+var readBuffers = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, readBufferSize)
+		return &b
+	},
+}
+
+func getReadBuffer() *[]byte {
+	b := readBuffers.Get().(*[]byte)
+	*b = (*b)[:cap(*b)]
+	return b
+}
+
+func putReadBuffer(b *[]byte) {
+	readBuffers.Put(b)
+}
+
+// payloadReader is implemented by framers that can return a whole payload
+// without truncating it to a caller's buffer.
+type payloadReader interface {
+	ReadPayload() ([]byte, error)
+}
+
+// readPayload reads a frame from f. Framers without ReadPayload are read into
+// a pooled buffer and a copy of just the payload is returned, so the buffer
+// can go straight back to the pool.
+func readPayload(f Framer) ([]byte, error) {
+	if pr, ok := f.(payloadReader); ok {
+		return pr.ReadPayload()
+	}
+	b := getReadBuffer()
+	defer putReadBuffer(b)
+	n, err := f.Read(*b)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), (*b)[:n]...), nil
+}
@@ -0,0 +1,113 @@
+package xethru
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+var respirationPayload = []byte{appDataByte, 0x26, 0xfe, 0x75, 0x23, 0x05, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x0e, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+
+func TestReadPayloadDetached(t *testing.T) {
+	f := NewFramer(bytes.NewBuffer(encodeFrame([]byte{0x99, 0x01, 0x02})))
+	p, err := readPayload(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// reuse the buffer as the read path would
+	b := getReadBuffer()
+	for i := range *b {
+		(*b)[i] = 0x00
+	}
+	putReadBuffer(b)
+	if !bytes.Equal(p, []byte{0x99, 0x01, 0x02}) {
+		t.Errorf("Expected: payload to be independent of the pooled buffer, got %x\n", p)
+	}
+}
+
+func TestReadPayloadConcurrent(t *testing.T) {
+	iqPayload := buildIQPayload(3, 64)
+	expectedIQ, _ := parseBaseBandIQ(iqPayload)
+	expectedResp, _ := parseRespiration(respirationPayload)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for n := 0; n < 200; n++ {
+				payload := respirationPayload
+				if (g+n)%2 == 0 {
+					payload = iqPayload
+				}
+				p, err := readPayload(NewFramer(bytes.NewBuffer(encodeFrame(payload))))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				data, err := parse(p)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				// scribble over whatever buffer the next caller is handed
+				s := getReadBuffer()
+				for i := range *s {
+					(*s)[i] = 0xff
+				}
+				putReadBuffer(s)
+
+				switch d := data.(type) {
+				case BaseBandIQ:
+					d.Time = expectedIQ.Time
+					if !reflect.DeepEqual(d, expectedIQ) {
+						t.Error("baseband frame changed after its buffer was returned")
+					}
+				case Respiration:
+					d.Time = expectedResp.Time
+					if !reflect.DeepEqual(d, expectedResp) {
+						t.Error("respiration frame changed after its buffer was returned")
+					}
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+func benchmarkReadParse(b *testing.B, payload []byte, pooled bool) {
+	wire := encodeFrame(payload)
+	r := bytes.NewReader(wire)
+	x := CreateSplitReadWriter(io.Discard, r)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.Reset(wire)
+		if pooled {
+			p, _ := readPayload(x)
+			parseWithFormat(p, BasebandFloat)
+		} else {
+			buf := make([]byte, readBufferSize)
+			n, _ := x.Read(buf)
+			parseWithFormat(buf[:n], BasebandFloat)
+		}
+	}
+}
+
+func BenchmarkReadParseRespiration(b *testing.B) {
+	benchmarkReadParse(b, respirationPayload, false)
+}
+
+func BenchmarkReadParseRespirationPooled(b *testing.B) {
+	benchmarkReadParse(b, respirationPayload, true)
+}
+
+func BenchmarkReadParseIQ256(b *testing.B) {
+	benchmarkReadParse(b, buildIQPayload(1, 256), false)
+}
+
+func BenchmarkReadParseIQ256Pooled(b *testing.B) {
+	benchmarkReadParse(b, buildIQPayload(1, 256), true)
+}
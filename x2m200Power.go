@@ -0,0 +1,98 @@
+package xethru
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Set mode command. The sleep mode code is unverified, see the package
+// documentation.
+// Example: <Start> + <XTS_SPC_MOD_SETMODE> + <XTS_SM_SLEEP> + <CRC> + <End>
+// Response: <Start> + <XTS_SPR_ACK> + <CRC> + <End>
+const (
+	x2m200SetMode = 0x20
+	modeSleep     = 0x15
+)
+
+// errModuleAsleep is returned by commands issued while the module is asleep,
+// call wake first.
+var errModuleAsleep = errors.New("module is asleep")
+
+// enterSleep puts the module into its low power sleep mode, it stops
+// streaming and ignores commands until wake resets it. While asleep commands
+// other than a reset fail with errModuleAsleep.
+func (r *Module) enterSleep() error {
+	if _, err := r.Execute([]byte{x2m200SetMode, modeSleep}, x2m200Ack, r.Timeout); err != nil {
+		return fmt.Errorf("failed to enter sleep: %w", err)
+	}
+	r.setAsleep(true)
+	return nil
+}
+
+// wake resets the module and waits for it to be ready. The module boots with
+// no app running so it must be configured and started again.
+func (r *Module) wake() error {
+	if err := r.ResetAndWait(resetTimeout); err != nil {
+		return fmt.Errorf("failed to wake: %w", err)
+	}
+	r.setAsleep(false)
+	return nil
+}
+
+// isAsleep reports whether the module was put to sleep by enterSleep and has
+// not been woken.
+func (r *Module) isAsleep() bool {
+	r.sleepMu.Lock()
+	defer r.sleepMu.Unlock()
+	return r.asleep
+}
+
+func (r *Module) setAsleep(asleep bool) {
+	r.sleepMu.Lock()
+	r.asleep = asleep
+	r.sleepMu.Unlock()
+}
+
+// dutyCycle runs the module for active then sleeps it for idle, over and over
+// until ctx is done, when it returns ctx.Err() leaving the module as it was.
+// It is used alongside Run, which configures and starts the app for the first
+// active period. After each wake configure is called to configure the module
+// again, for example with Load and SetDetectionZone, then the app is started.
+func (r *Module) dutyCycle(ctx context.Context, active, idle time.Duration, configure func(*Module) error) error {
+	for {
+		if err := waitContext(ctx, active); err != nil {
+			return err
+		}
+		if err := r.enterSleep(); err != nil {
+			return err
+		}
+		if err := waitContext(ctx, idle); err != nil {
+			return err
+		}
+		if err := r.wake(); err != nil {
+			return err
+		}
+		if configure != nil {
+			if err := configure(r); err != nil {
+				return fmt.Errorf("failed to configure after wake: %w", err)
+			}
+		}
+		if _, err := r.Execute([]byte{x2m200SetMode, 0x01}, x2m200Ack, r.Timeout); err != nil {
+			return fmt.Errorf("failed to start app after wake: %w", err)
+		}
+	}
+}
+
+// waitContext waits for d, or until ctx is done.
+func waitContext(ctx context.Context, d time.Duration) error {
+	t := clock().NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
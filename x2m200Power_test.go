@@ -0,0 +1,130 @@
+package xethru
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSleepWake(t *testing.T) {
+	sensor := NewSimulatedSensor()
+	sensor.Interval = time.Millisecond
+	m := NewModule(sensor, "respiration")
+	m.Timeout = time.Second
+	frames, _ := m.Subscribe(100, DropOldest)
+
+	finished := make(chan struct{})
+	go func() {
+		m.Run(nil)
+		close(finished)
+	}()
+	<-frames
+
+	if err := m.enterSleep(); err != nil {
+		t.Fatal(err)
+	}
+	if !m.isAsleep() {
+		t.Errorf("Expected: asleep, got awake\n")
+	}
+	// frames sent before the sensor slept may still be in flight
+	time.Sleep(10 * time.Millisecond)
+	for len(frames) > 0 {
+		<-frames
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n := len(frames); n != 0 {
+		t.Errorf("Expected: no frames while asleep, got %d\n", n)
+	}
+
+	start := time.Now()
+	if err := m.SetLEDMode(); !errors.Is(err, errModuleAsleep) {
+		t.Errorf("Expected: %v, got %v\n", errModuleAsleep, err)
+	}
+	if d := time.Since(start); d > m.Timeout/2 {
+		t.Errorf("Expected: command to fail fast, took %v\n", d)
+	}
+
+	if err := m.wake(); err != nil {
+		t.Fatal(err)
+	}
+	if m.isAsleep() {
+		t.Errorf("Expected: awake, got asleep\n")
+	}
+	if err := m.SetLEDMode(); err != nil {
+		t.Errorf("Expected: %v, got %v\n", nil, err)
+	}
+
+	sensor.Close()
+	<-finished
+}
+
+func TestDutyCycle(t *testing.T) {
+	sensor := NewSimulatedSensor()
+	sensor.Interval = time.Millisecond
+	m := NewModule(sensor, "respiration")
+	m.Timeout = time.Second
+	frames, _ := m.Subscribe(1000, DropOldest)
+
+	finished := make(chan struct{})
+	go func() {
+		m.Run(nil)
+		close(finished)
+	}()
+
+	var mu sync.Mutex
+	var configured int
+	var received []int
+	configure := func(m *Module) error {
+		mu.Lock()
+		defer mu.Unlock()
+		configured++
+		received = append(received, len(frames))
+		for len(frames) > 0 {
+			<-frames
+		}
+		return m.Load()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	err := m.dutyCycle(ctx, 30*time.Millisecond, 20*time.Millisecond, configure)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected: %v, got %v\n", context.DeadlineExceeded, err)
+	}
+
+	mu.Lock()
+	if configured < 2 {
+		t.Errorf("Expected: at least 2 wakes, got %d\n", configured)
+	}
+	// every active period streamed frames
+	for n, c := range received {
+		if c == 0 {
+			t.Errorf("test %d Expected: frames before sleeping, got none\n", n)
+		}
+	}
+	mu.Unlock()
+
+	if m.isAsleep() {
+		if err := m.wake(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sensor.Close()
+	<-finished
+}
+
+func TestDutyCycleConfigureError(t *testing.T) {
+	sensor := NewSimulatedSensor()
+	m := NewModule(sensor, "respiration")
+	defer sensor.Close()
+	failed := errors.New("failed")
+	err := m.dutyCycle(context.Background(), time.Millisecond, time.Millisecond, func(*Module) error { return failed })
+	if !errors.Is(err, failed) {
+		t.Errorf("Expected: %v, got %v\n", failed, err)
+	}
+	if m.isAsleep() {
+		t.Errorf("Expected: awake, got asleep\n")
+	}
+}
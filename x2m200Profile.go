@@ -0,0 +1,146 @@
+package xethru
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Profile is the ID of an app, or profile on newer firmware, hosted by the
+// module. It is sent little endian as the AppID of the load app command.
+type Profile uint32
+
+// Profiles. The X4 profile IDs are unverified, see the package documentation.
+const (
+	ProfileRespiration  Profile = 0x1423a2d6 // X2M200 respiration
+	ProfileSleep        Profile = 0x00f17b17 // X2M200 sleep
+	profileRespiration2 Profile = 0x064e57ad // X4M200 respiration
+	profilePresence     Profile = 0x014d4ab8 // X4M300 presence
+)
+
+// ErrProfileNotSupported is returned by LoadProfile when the firmware does
+// not have the profile.
+var ErrProfileNotSupported = errors.New("profile not supported by the firmware")
+
+func (p Profile) String() string {
+	switch p {
+	case ProfileRespiration:
+		return "respiration"
+	case ProfileSleep:
+		return "sleep"
+	case profileRespiration2:
+		return "respiration2"
+	case profilePresence:
+		return "presence"
+	}
+	return fmt.Sprintf("Profile(%#08x)", uint32(p))
+}
+
+// AppID returns p as the bytes of the load app command.
+func (p Profile) AppID() [4]byte {
+	var id [4]byte
+	binary.LittleEndian.PutUint32(id[:], uint32(p))
+	return id
+}
+
+// AppID is the ID of an app as the bytes sent by the load app command, the
+// app's Profile little endian.
+type AppID [4]byte
+
+// Apps that can be loaded by name. Go has no array constants so they are
+// variables, they must not be changed.
+var (
+	AppRespiration = AppID(ProfileRespiration.AppID())
+	AppSleep       = AppID(ProfileSleep.AppID())
+
+	appPresence = AppID(profilePresence.AppID())
+)
+
+// ErrInvalidAppID is returned for an AppID that is all zero, or a name that
+// is not an app.
+var ErrInvalidAppID = errors.New("invalid app id")
+
+// appNames are the names ParseAppID accepts, a name may also end in " app".
+var appNames = map[string]Profile{
+	"resp":        ProfileRespiration,
+	"respiration": ProfileRespiration,
+	"sleep":       ProfileSleep,
+}
+
+// ParseAppID returns the AppID of an app named respiration (or resp) or sleep,
+// optionally followed by "app", so "resp app" is AppRespiration. Case is
+// ignored. The ID may also be given as its Profile number, such as
+// 0x1423a2d6.
+func ParseAppID(s string) (AppID, error) {
+	name := strings.ToLower(strings.TrimSpace(s))
+	name = strings.TrimSpace(strings.TrimSuffix(name, "app"))
+	if p, ok := appNames[name]; ok {
+		return AppID(p.AppID()), nil
+	}
+	n, err := strconv.ParseUint(name, 0, 32)
+	if err != nil || n == 0 {
+		return AppID{}, fmt.Errorf("%w: %q", ErrInvalidAppID, s)
+	}
+	return AppID(Profile(n).AppID()), nil
+}
+
+// Profile returns the app's Profile.
+func (id AppID) Profile() Profile {
+	return Profile(binary.LittleEndian.Uint32(id[:]))
+}
+
+// String returns the name of a known app, or the Profile number.
+func (id AppID) String() string {
+	switch p := id.Profile(); p {
+	case ProfileRespiration, ProfileSleep:
+		return p.String() + " app"
+	}
+	return fmt.Sprintf("AppID(%#08x)", uint32(id.Profile()))
+}
+
+// NewRespiration creates a Module for the respiration profile.
+func NewRespiration(f Framer) *Module {
+	return NewModule(f, "respiration")
+}
+
+// NewSleep creates a Module for the sleep profile.
+func NewSleep(f Framer) *Module {
+	return NewModule(f, "sleep")
+}
+
+// newPresence creates a Module for the X4M300 presence profile, it speaks
+// ProtocolX4.
+func newPresence(f Framer) *Module {
+	m := NewModule(f, "")
+	m.AppID = appPresence
+	m.Protocol = ProtocolX4
+	return m
+}
+
+// LoadProfile loads the profile p, which becomes the module's AppID. If the
+// firmware does not have the profile the error wraps ErrProfileNotSupported.
+func (r *Module) LoadProfile(p Profile) error {
+	r.AppID = p.AppID()
+	err := r.Load()
+	if errors.Is(err, ErrProtocolInvalidAppID) || errors.Is(err, ErrProtocolNotRecognised) {
+		return fmt.Errorf("failed to load profile %v: %w: %w", p, ErrProfileNotSupported, err)
+	}
+	return err
+}
+
+// Profile returns the profile last loaded by Load or LoadProfile, the sensor
+// can not be asked. It reports false if no profile has been loaded.
+func (r *Module) Profile() (Profile, bool) {
+	r.profileMu.Lock()
+	defer r.profileMu.Unlock()
+	return r.profile, r.profileLoaded
+}
+
+func (r *Module) setProfile(id [4]byte) {
+	r.profileMu.Lock()
+	r.profile = Profile(binary.LittleEndian.Uint32(id[:]))
+	r.profileLoaded = true
+	r.profileMu.Unlock()
+}
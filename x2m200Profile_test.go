@@ -0,0 +1,140 @@
+package xethru
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLoadProfile(t *testing.T) {
+	cases := []struct {
+		profile Profile
+		reply   []byte
+		cmd     []byte
+		err     error
+	}{
+		{ProfileRespiration, []byte{x2m200Ack}, []byte{0x21, 0xd6, 0xa2, 0x23, 0x14}, nil},
+		{ProfileSleep, []byte{x2m200Ack}, []byte{0x21, 0x17, 0x7b, 0xf1, 0x00}, nil},
+		{profileRespiration2, []byte{x2m200Ack}, []byte{0x21, 0xad, 0x57, 0x4e, 0x06}, nil},
+		{profilePresence, []byte{x2m200Ack}, []byte{0x21, 0xb8, 0x4a, 0x4d, 0x01}, nil},
+		{profilePresence, []byte{errorByte, invaidAppID}, []byte{0x21, 0xb8, 0x4a, 0x4d, 0x01}, ErrProfileNotSupported},
+		{profileRespiration2, []byte{errorByte, notReconsied}, []byte{0x21, 0xad, 0x57, 0x4e, 0x06}, ErrProfileNotSupported},
+		{ProfileSleep, []byte{errorByte, crcFailed}, []byte{0x21, 0x17, 0x7b, 0xf1, 0x00}, ErrProtocolCRCFailed},
+	}
+	for n, c := range cases {
+		f, sensor, stop := newScriptedSensor(func([]byte) []byte { return c.reply })
+		m := NewModule(f, "respiration")
+		m.Timeout = 100 * time.Millisecond
+		err := m.LoadProfile(c.profile)
+		if !errors.Is(err, c.err) {
+			t.Errorf("test %d Expected: %v, got %v\n", n, c.err, err)
+		}
+		if c.err == ErrProtocolCRCFailed && errors.Is(err, ErrProfileNotSupported) {
+			t.Errorf("test %d Expected: not %v, got %v\n", n, ErrProfileNotSupported, err)
+		}
+		cmds := sensor.commands()
+		if len(cmds) != 1 || !bytes.Equal(cmds[0], c.cmd) {
+			t.Errorf("test %d Expected: %x, got %x\n", n, c.cmd, cmds)
+		}
+		p, ok := m.Profile()
+		if ok != (c.err == nil) || ok && p != c.profile {
+			t.Errorf("test %d Expected: %v %v, got %v %v\n", n, c.profile, c.err == nil, p, ok)
+		}
+		stop()
+	}
+}
+
+func TestProfileConstructors(t *testing.T) {
+	cases := []struct {
+		new      func(Framer) *Module
+		profile  Profile
+		protocol Protocol
+	}{
+		{NewRespiration, ProfileRespiration, ProtocolX2M200},
+		{NewSleep, ProfileSleep, ProtocolX2M200},
+		{newPresence, profilePresence, ProtocolX4},
+	}
+	for n, c := range cases {
+		m := c.new(nil)
+		if m.AppID != c.profile.AppID() {
+			t.Errorf("test %d Expected: %x, got %x\n", n, c.profile.AppID(), m.AppID)
+		}
+		if m.Protocol != c.protocol {
+			t.Errorf("test %d Expected: %v, got %v\n", n, c.protocol, m.Protocol)
+		}
+		if _, ok := m.Profile(); ok {
+			t.Errorf("test %d Expected: no profile before Load, got loaded\n", n)
+		}
+	}
+}
+
+func TestParseAppID(t *testing.T) {
+	cases := []struct {
+		s    string
+		id   AppID
+		name string
+		err  error
+	}{
+		{"resp app", AppRespiration, "respiration app", nil},
+		{"Respiration", AppRespiration, "respiration app", nil},
+		{"sleep app", AppSleep, "sleep app", nil},
+		{" SLEEP ", AppSleep, "sleep app", nil},
+		{"presence app", AppID{}, "", ErrInvalidAppID},
+		{"0x064e57ad", AppID{0xad, 0x57, 0x4e, 0x06}, "AppID(0x064e57ad)", nil},
+		{"0x1423a2d6", AppRespiration, "respiration app", nil},
+		{"0x12345678", AppID{0x78, 0x56, 0x34, 0x12}, "AppID(0x12345678)", nil},
+		{"0", AppID{}, "", ErrInvalidAppID},
+		{"breathing app", AppID{}, "", ErrInvalidAppID},
+		{"", AppID{}, "", ErrInvalidAppID},
+	}
+	for n, c := range cases {
+		id, err := ParseAppID(c.s)
+		if !errors.Is(err, c.err) {
+			t.Errorf("test %d Expected: %v, got %v\n", n, c.err, err)
+		}
+		if err != nil {
+			continue
+		}
+		if id != c.id {
+			t.Errorf("test %d Expected: %x, got %x\n", n, c.id, id)
+		}
+		if id.String() != c.name {
+			t.Errorf("test %d Expected: %s, got %s\n", n, c.name, id.String())
+		}
+	}
+}
+
+func TestLoadAppID(t *testing.T) {
+	// the load app command carries the app's profile little endian
+	cases := []struct {
+		mode     string
+		override []AppID
+		cmd      []byte
+		err      error
+	}{
+		{"respiration", nil, []byte{0x21, 0xd6, 0xa2, 0x23, 0x14}, nil},
+		{"basebandiq", nil, []byte{0x21, 0xd6, 0xa2, 0x23, 0x14}, nil},
+		{"sleep", nil, []byte{0x21, 0x17, 0x7b, 0xf1, 0x00}, nil},
+		{"presence", nil, nil, ErrInvalidAppID},
+		{"respiration", []AppID{AppSleep}, []byte{0x21, 0x17, 0x7b, 0xf1, 0x00}, nil},
+		{"", nil, nil, ErrInvalidAppID},
+		{"respiration", []AppID{{}}, nil, ErrInvalidAppID},
+	}
+	for n, c := range cases {
+		sensor := &recordingSensor{SimulatedSensor: NewSimulatedSensor()}
+		m := NewModule(sensor, c.mode)
+		m.Timeout = 100 * time.Millisecond
+		if err := m.Load(c.override...); !errors.Is(err, c.err) {
+			t.Errorf("test %d Expected: %v, got %v\n", n, c.err, err)
+		}
+		cmds := sensor.commands()
+		if c.cmd == nil && len(cmds) != 0 || c.cmd != nil && (len(cmds) != 1 || !bytes.Equal(cmds[0], c.cmd)) {
+			t.Errorf("test %d Expected: %x, got %x\n", n, c.cmd, cmds)
+		}
+		if c.err == nil && len(c.override) > 0 && m.AppID != c.override[0] {
+			t.Errorf("test %d Expected: AppID %v, got %v\n", n, c.override[0], m.AppID)
+		}
+		sensor.Close()
+	}
+}
@@ -0,0 +1,217 @@
+package xethru
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Pulse-Doppler and noise map float message IDs. The IDs and layout are
+// unverified, see the package documentation, so Run reassembles the matrices
+// to report broken ones but does not deliver them.
+// <0x50> + <ID> + <Counter> + <MatrixCounter> + <RangeBins> + <DopplerBins>
+// + <FrequencyStart(f)> + <FrequencyStep(f)> + <RangeStart(f)> + <RangeStep(f)>
+// + <Offset> + [Data(f)]
+const (
+	pulseDopplerFloatID    = 0x16a2b818
+	noiseMapFloatID        = 0x16a2b81a
+	pulseDopplerStartByte  = pulseDopplerFloatID & 0xff
+	noiseMapStartByte      = noiseMapFloatID & 0xff
+	pulseDopplerHeaderSize = 41
+
+	// maxPulseDopplerBins bounds the matrix size, range bins × doppler bins,
+	// accepted from a message header.
+	maxPulseDopplerBins = 1 << 22
+)
+
+// Pulse-Doppler parse and reassembly errors
+var (
+	errPulseDopplerLength     = fmt.Errorf("%w: pulse-doppler message does not contain enough bytes", ErrParse)
+	errPulseDopplerSize       = fmt.Errorf("%w: pulse-doppler matrix size is not valid", ErrParse)
+	errPulseDopplerOffset     = fmt.Errorf("%w: pulse-doppler chunk is outside the matrix", ErrParse)
+	errPulseDopplerMismatch   = fmt.Errorf("%w: pulse-doppler chunk does not match the matrix it belongs to", ErrParse)
+	errPulseDopplerIncomplete = fmt.Errorf("%w: pulse-doppler matrix is missing chunks", ErrParse)
+	errPulseDopplerStale      = fmt.Errorf("%w: pulse-doppler chunk is for an earlier matrix", ErrParse)
+)
+
+// pulseDopplerHeader describes a pulse-Doppler or noise map matrix, it is
+// repeated in every chunk of the matrix.
+type pulseDopplerHeader struct {
+	ID             uint32 // pulseDopplerFloatID or noiseMapFloatID
+	Counter        uint32 // frame counter
+	MatrixCounter  uint32
+	RangeBins      uint32
+	DopplerBins    uint32
+	FrequencyStart float64
+	FrequencyStep  float64
+	RangeStart     float64
+	RangeStep      float64
+}
+
+func (h pulseDopplerHeader) bins() uint64 {
+	return uint64(h.RangeBins) * uint64(h.DopplerBins)
+}
+
+// pulseDopplerChunk is one message of a matrix, the floats at byte Offset in
+// the matrix data.
+type pulseDopplerChunk struct {
+	pulseDopplerHeader
+	Offset uint32
+	Data   []float64
+}
+
+// pulseDoppler is an X4 pulse-Doppler or noise map matrix of RangeBins ×
+// DopplerBins values. The sensor sends it in several messages which Run
+// reassembles.
+type pulseDoppler struct {
+	pulseDopplerHeader
+	Data []float64 // the DopplerBins values of each range bin in turn
+}
+
+// noiseMap reports whether p is a noise map rather than pulse-Doppler data.
+func (p pulseDoppler) noiseMap() bool {
+	return p.ID == noiseMapFloatID
+}
+
+// At returns the value of the range bin rangeBin and doppler bin dopplerBin,
+// it panics if either is out of range.
+func (p pulseDoppler) At(rangeBin, dopplerBin int) float64 {
+	if rangeBin < 0 || rangeBin >= int(p.RangeBins) || dopplerBin < 0 || dopplerBin >= int(p.DopplerBins) {
+		panic("xethru: pulse-doppler bin out of range")
+	}
+	return p.Data[rangeBin*int(p.DopplerBins)+dopplerBin]
+}
+
+// Frequency returns the doppler frequency of the doppler bin dopplerBin.
+func (p pulseDoppler) Frequency(dopplerBin int) float64 {
+	return p.FrequencyStart + float64(dopplerBin)*p.FrequencyStep
+}
+
+// Frequencies returns the doppler frequency of each doppler bin.
+func (p pulseDoppler) Frequencies() []float64 {
+	f := make([]float64, p.DopplerBins)
+	for i := range f {
+		f[i] = p.Frequency(i)
+	}
+	return f
+}
+
+// Range returns the distance of the range bin rangeBin.
+func (p pulseDoppler) Range(rangeBin int) float64 {
+	return p.RangeStart + float64(rangeBin)*p.RangeStep
+}
+
+// parsePulseDopplerChunk parses a pulse-Doppler or noise map float payload,
+// including the app data byte, for Run to reassemble.
+func parsePulseDopplerChunk(b []byte) (interface{}, error) {
+	c, err := decodePulseDopplerChunk(b)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func decodePulseDopplerChunk(b []byte) (pulseDopplerChunk, error) {
+	if len(b) < pulseDopplerHeaderSize || (len(b)-pulseDopplerHeaderSize)%4 != 0 {
+		return pulseDopplerChunk{}, &LengthError{Err: errPulseDopplerLength, Want: pulseDopplerHeaderSize, Got: len(b)}
+	}
+	c := pulseDopplerChunk{
+		pulseDopplerHeader: pulseDopplerHeader{
+			ID:             binary.LittleEndian.Uint32(b[1:5]),
+			Counter:        binary.LittleEndian.Uint32(b[5:9]),
+			MatrixCounter:  binary.LittleEndian.Uint32(b[9:13]),
+			RangeBins:      binary.LittleEndian.Uint32(b[13:17]),
+			DopplerBins:    binary.LittleEndian.Uint32(b[17:21]),
+			FrequencyStart: float32At(b, 21),
+			FrequencyStep:  float32At(b, 25),
+			RangeStart:     float32At(b, 29),
+			RangeStep:      float32At(b, 33),
+		},
+		Offset: binary.LittleEndian.Uint32(b[37:41]),
+	}
+	n := c.bins()
+	if n == 0 || n > maxPulseDopplerBins {
+		return pulseDopplerChunk{}, fmt.Errorf("%w: %d × %d", errPulseDopplerSize, c.RangeBins, c.DopplerBins)
+	}
+	count := (len(b) - pulseDopplerHeaderSize) / 4
+	if c.Offset%4 != 0 || uint64(c.Offset)/4+uint64(count) > n {
+		return pulseDopplerChunk{}, fmt.Errorf("%w: %d bytes at offset %d of %d", errPulseDopplerOffset, 4*count, c.Offset, 4*n)
+	}
+	if count > 0 {
+		c.Data = make([]float64, count)
+		for i := range c.Data {
+			c.Data[i] = float32At(b, pulseDopplerHeaderSize+4*i)
+		}
+	}
+	return c, nil
+}
+
+// pulseDopplerAssembler reassembles matrices from their chunks, which may
+// arrive in any order. It holds one matrix per message ID, a chunk of a later
+// matrix drops an incomplete one. The zero value is ready to use, it is not
+// safe for concurrent use.
+type pulseDopplerAssembler struct {
+	pending map[uint32]*pendingMatrix
+}
+
+type pendingMatrix struct {
+	pulseDopplerHeader
+	data   []float64
+	filled []bool
+	left   int
+}
+
+// add adds a chunk, it returns the matrix and true when the chunk completes
+// it. An error is returned when the chunk does not fit the pending matrix, or
+// when the chunk starts a new matrix before the pending one is complete, in
+// which case the pending matrix is dropped and the chunk starts the new one.
+func (a *pulseDopplerAssembler) add(c pulseDopplerChunk) (pulseDoppler, bool, error) {
+	if a.pending == nil {
+		a.pending = make(map[uint32]*pendingMatrix)
+	}
+	var err error
+	m := a.pending[c.ID]
+	if m != nil && c.MatrixCounter != m.MatrixCounter {
+		if int32(c.MatrixCounter-m.MatrixCounter) < 0 {
+			return pulseDoppler{}, false, fmt.Errorf("%w: matrix %d, pending %d", errPulseDopplerStale, c.MatrixCounter, m.MatrixCounter)
+		}
+		err = fmt.Errorf("%w: dropped matrix %d with %d of %d values", errPulseDopplerIncomplete, m.MatrixCounter, len(m.data)-m.left, len(m.data))
+		m = nil
+	}
+	if m == nil {
+		n := c.bins()
+		m = &pendingMatrix{
+			pulseDopplerHeader: c.pulseDopplerHeader,
+			data:               make([]float64, n),
+			filled:             make([]bool, n),
+			left:               int(n),
+		}
+		a.pending[c.ID] = m
+	}
+	if c.RangeBins != m.RangeBins || c.DopplerBins != m.DopplerBins {
+		return pulseDoppler{}, false, fmt.Errorf("%w: %d × %d, matrix is %d × %d", errPulseDopplerMismatch, c.RangeBins, c.DopplerBins, m.RangeBins, m.DopplerBins)
+	}
+	start := int(c.Offset / 4)
+	if start+len(c.Data) > len(m.data) {
+		return pulseDoppler{}, false, fmt.Errorf("%w: %d values at %d of %d", errPulseDopplerOffset, len(c.Data), start, len(m.data))
+	}
+	for i, v := range c.Data {
+		if !m.filled[start+i] {
+			m.filled[start+i] = true
+			m.left--
+		}
+		m.data[start+i] = v
+	}
+	if m.left > 0 {
+		return pulseDoppler{}, false, err
+	}
+	delete(a.pending, c.ID)
+	return pulseDoppler{pulseDopplerHeader: m.pulseDopplerHeader, Data: m.data}, true, err
+}
+
+// assemblePulseDoppler adds c to the matrix being reassembled. It returns an
+// error for a chunk that does not fit, or a matrix that was dropped
+// incomplete.
+func (r *Module) assemblePulseDoppler(c pulseDopplerChunk) error {
+	_, _, err := r.pulseDoppler.add(c)
+	return err
+}
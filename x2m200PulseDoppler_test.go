@@ -0,0 +1,243 @@
+package xethru
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// pulseDopplerChunks splits a rangeBins × dopplerBins matrix, value i at
+// index i, into chunks of size floats.
+func pulseDopplerChunks(id, matrix, rangeBins, dopplerBins uint32, size int) ([][]byte, pulseDoppler) {
+	h := pulseDopplerHeader{
+		ID:             id,
+		Counter:        7,
+		MatrixCounter:  matrix,
+		RangeBins:      rangeBins,
+		DopplerBins:    dopplerBins,
+		FrequencyStart: -8,
+		FrequencyStep:  0.5,
+		RangeStart:     0.25,
+		RangeStep:      0.125,
+	}
+	n := int(rangeBins * dopplerBins)
+	p := pulseDoppler{pulseDopplerHeader: h}
+	for i := 0; i < n; i++ {
+		p.Data = append(p.Data, float64(i))
+	}
+	var chunks [][]byte
+	for off := 0; off < n; off += size {
+		b := []byte{appDataByte}
+		for _, v := range []uint32{id, h.Counter, matrix, rangeBins, dopplerBins} {
+			b = binary.LittleEndian.AppendUint32(b, v)
+		}
+		for _, f := range []float64{h.FrequencyStart, h.FrequencyStep, h.RangeStart, h.RangeStep} {
+			b = binary.LittleEndian.AppendUint32(b, math.Float32bits(float32(f)))
+		}
+		b = binary.LittleEndian.AppendUint32(b, uint32(4*off))
+		for i := off; i < off+size && i < n; i++ {
+			b = binary.LittleEndian.AppendUint32(b, math.Float32bits(float32(i)))
+		}
+		chunks = append(chunks, b)
+	}
+	return chunks, p
+}
+
+func TestParsePulseDopplerChunk(t *testing.T) {
+	chunks, _ := pulseDopplerChunks(pulseDopplerFloatID, 1, 2, 3, 4)
+	outside := append([]byte(nil), chunks[1]...)
+	binary.LittleEndian.PutUint32(outside[37:41], 20)
+	unaligned := append([]byte(nil), chunks[1]...)
+	binary.LittleEndian.PutUint32(unaligned[37:41], 2)
+	empty := append([]byte(nil), chunks[0]...)
+	binary.LittleEndian.PutUint32(empty[13:17], 0)
+	huge := append([]byte(nil), chunks[0]...)
+	binary.LittleEndian.PutUint32(huge[13:17], math.MaxUint32)
+	binary.LittleEndian.PutUint32(huge[17:21], math.MaxUint32)
+
+	cases := []struct {
+		b      []byte
+		err    error
+		offset uint32
+		data   []float64
+	}{
+		{chunks[0], nil, 0, []float64{0, 1, 2, 3}},
+		{chunks[1], nil, 16, []float64{4, 5}},
+		{chunks[1][:pulseDopplerHeaderSize], nil, 16, nil},
+		{chunks[1][:pulseDopplerHeaderSize-1], errPulseDopplerLength, 0, nil},
+		{chunks[1][:len(chunks[1])-1], errPulseDopplerLength, 0, nil},
+		{outside, errPulseDopplerOffset, 0, nil},
+		{unaligned, errPulseDopplerOffset, 0, nil},
+		{empty, errPulseDopplerSize, 0, nil},
+		{huge, errPulseDopplerSize, 0, nil},
+	}
+	for n, c := range cases {
+		if got := frameType(c.b); got != framePulseDoppler {
+			t.Errorf("test %d Expected: frame type %d, got %d\n", n, framePulseDoppler, got)
+		}
+		data, err := parseProtocol(c.b, BasebandFloat, ProtocolX4)
+		if !errors.Is(err, c.err) {
+			t.Errorf("test %d Expected: %v, got %v\n", n, c.err, err)
+		}
+		chunk, _ := data.(pulseDopplerChunk)
+		if chunk.Offset != c.offset || !reflect.DeepEqual(chunk.Data, c.data) {
+			t.Errorf("test %d Expected: %d %v, got %d %v\n", n, c.offset, c.data, chunk.Offset, chunk.Data)
+		}
+	}
+}
+
+func TestPulseDopplerAssembler(t *testing.T) {
+	first, firstMatrix := pulseDopplerChunks(pulseDopplerFloatID, 1, 4, 8, 5)
+	second, secondMatrix := pulseDopplerChunks(pulseDopplerFloatID, 2, 4, 8, 5)
+	noise, noiseMatrix := pulseDopplerChunks(noiseMapFloatID, 1, 4, 8, 16)
+	other, _ := pulseDopplerChunks(pulseDopplerFloatID, 2, 2, 8, 5)
+
+	type step struct {
+		b      []byte
+		err    error
+		matrix *pulseDoppler
+	}
+	cases := []struct {
+		name  string
+		steps []step
+	}{
+		{"in order", []step{
+			{first[0], nil, nil}, {first[1], nil, nil}, {first[2], nil, nil},
+			{first[3], nil, nil}, {first[4], nil, nil}, {first[5], nil, nil},
+			{first[6], nil, &firstMatrix},
+		}},
+		{"out of order", []step{
+			{first[6], nil, nil}, {first[2], nil, nil}, {first[0], nil, nil},
+			{first[5], nil, nil}, {first[3], nil, nil}, {first[1], nil, nil},
+			{first[4], nil, &firstMatrix},
+		}},
+		{"duplicate chunk", []step{
+			{first[0], nil, nil}, {first[1], nil, nil}, {first[1], nil, nil},
+			{first[2], nil, nil}, {first[3], nil, nil}, {first[4], nil, nil},
+			{first[5], nil, nil}, {first[6], nil, &firstMatrix},
+		}},
+		{"missing chunk", []step{
+			{first[0], nil, nil}, {first[1], nil, nil}, {first[2], nil, nil},
+			{first[4], nil, nil}, {first[5], nil, nil}, {first[6], nil, nil},
+			{second[1], errPulseDopplerIncomplete, nil},
+			{second[0], nil, nil}, {second[2], nil, nil}, {second[3], nil, nil},
+			{second[4], nil, nil}, {second[5], nil, nil},
+			{second[6], nil, &secondMatrix},
+		}},
+		{"late chunk", []step{
+			{second[0], nil, nil},
+			{first[3], errPulseDopplerStale, nil},
+		}},
+		{"size changed", []step{
+			{second[0], nil, nil},
+			{other[1], errPulseDopplerMismatch, nil},
+		}},
+		{"interleaved ids", []step{
+			{first[0], nil, nil}, {noise[0], nil, nil}, {first[1], nil, nil},
+			{first[2], nil, nil}, {first[3], nil, nil}, {noise[1], nil, &noiseMatrix},
+		}},
+	}
+	for _, c := range cases {
+		var a pulseDopplerAssembler
+		for n, s := range c.steps {
+			chunk, err := decodePulseDopplerChunk(s.b)
+			if err != nil {
+				t.Fatalf("%s test %d: %v", c.name, n, err)
+			}
+			p, ok, err := a.add(chunk)
+			if !errors.Is(err, s.err) {
+				t.Errorf("%s test %d Expected: %v, got %v\n", c.name, n, s.err, err)
+			}
+			if ok != (s.matrix != nil) {
+				t.Errorf("%s test %d Expected: complete %v, got %v\n", c.name, n, s.matrix != nil, ok)
+			}
+			if s.matrix != nil && !reflect.DeepEqual(p, *s.matrix) {
+				t.Errorf("%s test %d Expected: %+v, got %+v\n", c.name, n, *s.matrix, p)
+			}
+		}
+	}
+	if !noiseMatrix.noiseMap() || firstMatrix.noiseMap() {
+		t.Errorf("Expected: only the noise map matrix to be a noise map\n")
+	}
+}
+
+func TestPulseDopplerAccessors(t *testing.T) {
+	p := pulseDoppler{pulseDopplerHeader: pulseDopplerHeader{RangeBins: 2, DopplerBins: 3, FrequencyStart: -1, FrequencyStep: 1, RangeStart: 0.5, RangeStep: 0.25}, Data: []float64{0, 1, 2, 3, 4, 5}}
+	cases := []struct {
+		rangeBin, dopplerBin int
+		value, freq, dist    float64
+	}{
+		{0, 0, 0, -1, 0.5},
+		{0, 2, 2, 1, 0.5},
+		{1, 0, 3, -1, 0.75},
+		{1, 2, 5, 1, 0.75},
+	}
+	for n, c := range cases {
+		if v := p.At(c.rangeBin, c.dopplerBin); v != c.value {
+			t.Errorf("test %d Expected: %v, got %v\n", n, c.value, v)
+		}
+		if f := p.Frequency(c.dopplerBin); f != c.freq {
+			t.Errorf("test %d Expected: frequency %v, got %v\n", n, c.freq, f)
+		}
+		if d := p.Range(c.rangeBin); d != c.dist {
+			t.Errorf("test %d Expected: range %v, got %v\n", n, c.dist, d)
+		}
+	}
+	if f := p.Frequencies(); !reflect.DeepEqual(f, []float64{-1, 0, 1}) {
+		t.Errorf("Expected: %v, got %v\n", []float64{-1, 0, 1}, f)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected: panic for doppler bin 3, got none\n")
+		}
+	}()
+	p.At(0, 3)
+}
+
+func TestRunPulseDoppler(t *testing.T) {
+	useFakeClock(t)
+	f, sensor := newFakeSensor(0)
+	m := NewModule(f, "respiration")
+	m.Protocol = ProtocolX4
+	m.startReader()
+
+	var errs []error
+	if err := m.OnError(func(err error) { errs = append(errs, err) }); err != nil {
+		t.Fatal(err)
+	}
+
+	// matrix 1 out of order, matrix 2 loses a message, the noise map has one
+	first, _ := pulseDopplerChunks(pulseDopplerFloatID, 1, 2, 3, 4)
+	second, _ := pulseDopplerChunks(pulseDopplerFloatID, 2, 2, 3, 4)
+	third, _ := pulseDopplerChunks(pulseDopplerFloatID, 3, 2, 3, 4)
+	noise, _ := pulseDopplerChunks(noiseMapFloatID, 1, 2, 3, 6)
+	// the iq frame after them shows when Run has handled them
+	for _, b := range [][]byte{first[1], first[0], second[0], noise[0], third[0], buildIQPayload(1, 4)} {
+		sensor.send(b)
+	}
+
+	stream := make(chan interface{}, 10)
+	finished := make(chan struct{})
+	go func() {
+		m.Run(stream)
+		close(finished)
+	}()
+	// the layout is unverified so complete matrices are not delivered by Run
+	select {
+	case data := <-stream:
+		if _, ok := data.(BaseBandIQ); !ok {
+			t.Errorf("Expected: BaseBandIQ, got %T\n", data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected: BaseBandIQ, got nothing")
+	}
+	sensor.Close()
+	<-finished
+
+	if len(errs) != 1 || !errors.Is(errs[0], errPulseDopplerIncomplete) {
+		t.Errorf("Expected: %v, got %v\n", errPulseDopplerIncomplete, errs)
+	}
+}
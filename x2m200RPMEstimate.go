@@ -0,0 +1,215 @@
+package xethru
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// EstimatedRPM is a respiration rate estimated from the baseband phase.
+type EstimatedRPM struct {
+	Time       int64   // time of the last frame in the window
+	RPM        float64 // breaths per minute
+	Confidence float64 // share of the power in the breathing band at the peak, 0 to 1
+	Bin        int     // range bin the phase was taken from
+}
+
+// RPMEstimator estimates the respiration rate independently of the firmware
+// from the phase of the range bin at the sensor's reported distance. The
+// phase of the bin is tracked over a sliding window of frames and,
+// periodically, the strongest frequency between MinRPM and MaxRPM is the
+// estimate. The window restarts when the distance moves to another bin.
+type RPMEstimator struct {
+	MinRPM float64
+	MaxRPM float64
+
+	spectral SpectralEstimator
+	distance float64
+	bin      int
+}
+
+// NewRPMEstimator creates an RPMEstimator looking for 4 to 40 breaths per
+// minute over a window of frames, estimating every hop frames. If frameRate
+// is zero it is estimated from the frame timestamps.
+func NewRPMEstimator(window, hop int, frameRate float64) *RPMEstimator {
+	return &RPMEstimator{
+		MinRPM:   4,
+		MaxRPM:   40,
+		spectral: SpectralEstimator{Window: window, Hop: hop, FrameRate: frameRate},
+		bin:      -1,
+	}
+}
+
+// SetDistance sets the distance to the target in meters, usually the
+// Distance of the latest Respiration frame.
+func (e *RPMEstimator) SetDistance(meters float64) {
+	e.distance = meters
+}
+
+// AddFrame adds a BaseBandIQ or BaseBandAmpPhase frame and returns true with
+// a new estimate every Hop frames once the window is full. A Respiration
+// frame sets the distance, as SetDistance, other values are ignored.
+func (e *RPMEstimator) AddFrame(v interface{}) (EstimatedRPM, bool, error) {
+	var (
+		h     BaseBandHeader
+		phase func(bin int) (float64, bool)
+	)
+	switch f := v.(type) {
+	case Respiration:
+		e.SetDistance(f.Distance)
+		return EstimatedRPM{}, false, nil
+	case BaseBandIQ:
+		h = f.BaseBandHeader
+		phase = func(bin int) (float64, bool) {
+			if bin >= len(f.SigI) || bin >= len(f.SigQ) {
+				return 0, false
+			}
+			return math.Atan2(f.SigQ[bin], f.SigI[bin]), true
+		}
+	case BaseBandAmpPhase:
+		h = f.BaseBandHeader
+		phase = func(bin int) (float64, bool) {
+			if bin >= len(f.Phase) {
+				return 0, false
+			}
+			return f.Phase[bin], true
+		}
+	default:
+		return EstimatedRPM{}, false, nil
+	}
+	if e.spectral.Window < 2 || e.spectral.Hop < 1 {
+		return EstimatedRPM{}, false, errSpectrumConfig
+	}
+	if e.distance <= 0 {
+		return EstimatedRPM{}, false, errRPMNoDistance
+	}
+	bin, err := h.BinAtRange(e.distance)
+	if err != nil {
+		return EstimatedRPM{}, false, err
+	}
+	p, ok := phase(bin)
+	if !ok {
+		return EstimatedRPM{}, false, errRangeOutOfBounds
+	}
+	if bin != e.bin {
+		// the phase of another bin does not continue this one
+		e.spectral.Reset()
+		e.bin = bin
+	}
+	spec, ok, err := e.spectral.addPhase(p, h.Time)
+	if !ok || err != nil {
+		return EstimatedRPM{}, false, err
+	}
+	rpm, confidence := e.peak(spec)
+	return EstimatedRPM{Time: h.Time, RPM: rpm, Confidence: confidence, Bin: bin}, true, nil
+}
+
+// peak returns the strongest frequency in the breathing band in breaths per
+// minute, interpolated between spectrum bins, and the share of the band's
+// power in the peak and its neighbours.
+func (e *RPMEstimator) peak(spec Spectrum) (float64, float64) {
+	lo, hi := e.MinRPM/60, e.MaxRPM/60
+	peak := -1
+	var total float64
+	for k, f := range spec.Frequencies {
+		if f < lo || f > hi {
+			continue
+		}
+		total += spec.Magnitudes[k] * spec.Magnitudes[k]
+		if peak < 0 || spec.Magnitudes[k] > spec.Magnitudes[peak] {
+			peak = k
+		}
+	}
+	if peak < 0 || total == 0 {
+		return 0, 0
+	}
+	m := spec.Magnitudes
+	var power float64
+	for k := peak - 1; k <= peak+1; k++ {
+		if k >= 0 && k < len(m) && spec.Frequencies[k] >= lo && spec.Frequencies[k] <= hi {
+			power += m[k] * m[k]
+		}
+	}
+	f := spec.Frequencies[peak]
+	if peak > 0 && peak < len(m)-1 {
+		// parabolic interpolation of the peak
+		a, b, c := m[peak-1], m[peak], m[peak+1]
+		if d := a - 2*b + c; d != 0 {
+			f += 0.5 * (a - c) / d * (spec.Frequencies[1] - spec.Frequencies[0])
+		}
+	}
+	return f * 60, math.Min(power/total, 1)
+}
+
+// Reset discards the window.
+func (e *RPMEstimator) Reset() {
+	e.spectral.Reset()
+	e.bin = -1
+}
+
+var errRPMNoDistance = errors.New("rpm estimator needs the distance to the target")
+
+// RPMWarning is emitted by an RPMComparator when the firmware's rate and the
+// estimate have disagreed for longer than its After.
+type RPMWarning struct {
+	Time         time.Time // time of the frame that raised the warning
+	Since        time.Time // time the disagreement started
+	FirmwareRPM  uint32
+	EstimatedRPM float64
+	Confidence   float64
+}
+
+// RPMComparator compares the RPM of Respiration frames with the latest
+// estimate from an RPMEstimator and warns when they differ by more than
+// Threshold breaths per minute for After. Estimates with a Confidence below
+// MinConfidence, and invalid frames, are not compared. A warning is emitted
+// once per disagreement, the comparator re-arms once they agree again.
+type RPMComparator struct {
+	Threshold     float64
+	After         time.Duration
+	MinConfidence float64
+
+	est    EstimatedRPM
+	have   bool
+	since  time.Time
+	warned bool
+}
+
+// NewRPMComparator creates an RPMComparator with a MinConfidence of 0.3.
+func NewRPMComparator(threshold float64, after time.Duration) *RPMComparator {
+	return &RPMComparator{Threshold: threshold, After: after, MinConfidence: 0.3}
+}
+
+// AddEstimate sets the estimate compared with later Respiration frames.
+func (c *RPMComparator) AddEstimate(est EstimatedRPM) {
+	c.est = est
+	c.have = true
+}
+
+// AddRespiration compares r with the latest estimate and returns true with
+// a warning if they have disagreed for After.
+func (c *RPMComparator) AddRespiration(r Respiration) (RPMWarning, bool) {
+	if !c.have || !r.Valid || c.est.Confidence < c.MinConfidence {
+		return RPMWarning{}, false
+	}
+	now := time.Unix(0, r.Time)
+	if math.Abs(float64(r.RPM)-c.est.RPM) <= c.Threshold {
+		c.since = time.Time{}
+		c.warned = false
+		return RPMWarning{}, false
+	}
+	if c.since.IsZero() {
+		c.since = now
+	}
+	if c.warned || now.Sub(c.since) < c.After {
+		return RPMWarning{}, false
+	}
+	c.warned = true
+	return RPMWarning{
+		Time:         now,
+		Since:        c.since,
+		FirmwareRPM:  r.RPM,
+		EstimatedRPM: c.est.RPM,
+		Confidence:   c.est.Confidence,
+	}, true
+}
@@ -0,0 +1,160 @@
+package xethru
+
+import (
+	"math"
+	"math/cmplx"
+	"testing"
+	"time"
+)
+
+// breathingFrame returns frame n of a target at bin 6, 0.5m, breathing at
+// rpm, sampled at rate frames per second, as IQ or amplitude/phase.
+func breathingFrame(n int, rpm, rate float64, ap bool) interface{} {
+	data := make([]complex128, 8)
+	for i := range data {
+		data[i] = cmplx.Rect(0.01, float64(i*n))
+	}
+	phase := 0.8*math.Sin(2*math.Pi*rpm/60*float64(n)/rate) + 2.5
+	data[6] = cmplx.Rect(1, phase)
+	iq := BaseBandIQFromComplex(uint32(n), 0.05, 0, 0, 0.2, data)
+	iq.Time = int64(float64(n) / rate * 1e9)
+	if ap {
+		h := iq.BaseBandHeader
+		h.Status = basebandAP
+		return BaseBandAmpPhase{BaseBandHeader: h, Amplitude: iq.Magnitude(), Phase: iq.PhaseSlice()}
+	}
+	return iq
+}
+
+func TestRPMEstimator(t *testing.T) {
+	const rate = 17.0
+	tests := []struct {
+		rpm float64
+		ap  bool
+	}{
+		{15, false},
+		{15, true},
+		{9, false},
+		{27.5, true},
+	}
+	for n, test := range tests {
+		e := NewRPMEstimator(512, 32, 0)
+		e.AddFrame(Respiration{Distance: 0.5})
+		var estimates []EstimatedRPM
+		for i := 0; i < 700; i++ {
+			est, ok, err := e.AddFrame(breathingFrame(i, test.rpm, rate, test.ap))
+			if err != nil {
+				t.Fatalf("test %d %v\n", n, err)
+			}
+			if ok {
+				estimates = append(estimates, est)
+			}
+		}
+		if len(estimates) != (700-512)/32+1 {
+			t.Fatalf("test %d Expected: %d estimates, got %d\n", n, (700-512)/32+1, len(estimates))
+		}
+		for _, est := range estimates {
+			if math.Abs(est.RPM-test.rpm) > 0.5 || est.Confidence < 0.8 || est.Bin != 6 {
+				t.Errorf("test %d Expected: %v rpm at bin 6 with high confidence, got %+v\n", n, test.rpm, est)
+			}
+		}
+	}
+}
+
+func TestRPMEstimatorDistance(t *testing.T) {
+	e := NewRPMEstimator(64, 8, 20)
+	if _, _, err := e.AddFrame(breathingFrame(0, 15, 20, false)); err != errRPMNoDistance {
+		t.Errorf("Expected: %v, got %v\n", errRPMNoDistance, err)
+	}
+	e.SetDistance(5)
+	if _, _, err := e.AddFrame(breathingFrame(0, 15, 20, false)); err != errRangeOutOfBounds {
+		t.Errorf("Expected: %v, got %v\n", errRangeOutOfBounds, err)
+	}
+	e.SetDistance(0.5)
+	first := -1
+	for i := 0; i < 200; i++ {
+		if i == 100 {
+			// the target moves a bin, the window starts again
+			e.SetDistance(0.45)
+		}
+		_, ok, err := e.AddFrame(breathingFrame(i, 15, 20, false))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok && i >= 100 && first < 0 {
+			first = i
+		}
+	}
+	if first != 100+63 {
+		t.Errorf("Expected: first estimate after the move at frame %d, got %d\n", 100+63, first)
+	}
+	if _, ok, err := e.AddFrame(Sleep{}); ok || err != nil {
+		t.Errorf("Expected: other frames ignored, got %v %v\n", ok, err)
+	}
+}
+
+func TestRPMComparator(t *testing.T) {
+	c := NewRPMComparator(3, 10*time.Second)
+	at := func(s int) int64 { return int64(s) * int64(time.Second) }
+	resp := func(s int, rpm uint32) Respiration {
+		return Respiration{Time: at(s), RPM: rpm, Valid: true}
+	}
+	if _, ok := c.AddRespiration(resp(0, 15)); ok {
+		t.Error("Expected: no warning without an estimate")
+	}
+	c.AddEstimate(EstimatedRPM{RPM: 15.5, Confidence: 0.9})
+	var warnings []RPMWarning
+	for s := 0; s < 60; s++ {
+		rpm := uint32(15)
+		if s >= 20 && s < 40 {
+			// stuck firmware
+			rpm = 22
+		}
+		if s == 45 {
+			c.AddEstimate(EstimatedRPM{RPM: 30, Confidence: 0.1})
+		}
+		if w, ok := c.AddRespiration(resp(s, rpm)); ok {
+			warnings = append(warnings, w)
+		}
+	}
+	if len(warnings) != 1 {
+		t.Fatalf("Expected: 1 warning, got %d %+v\n", len(warnings), warnings)
+	}
+	w := warnings[0]
+	if w.Since != time.Unix(0, at(20)) || w.Time != time.Unix(0, at(30)) || w.FirmwareRPM != 22 || w.EstimatedRPM != 15.5 {
+		t.Errorf("Expected: warning at 30s for a disagreement since 20s, got %+v\n", w)
+	}
+
+	// agreeing again re-arms the comparator
+	for s := 60; s < 80; s++ {
+		c.AddEstimate(EstimatedRPM{RPM: 15, Confidence: 0.9})
+		if _, ok := c.AddRespiration(resp(s, 22)); ok && s != 70 {
+			t.Errorf("Expected: warning at 70s, got one at %ds\n", s)
+		}
+	}
+}
+
+func TestRPMEstimatorWithComparator(t *testing.T) {
+	const rate = 20.0
+	e := NewRPMEstimator(256, 20, rate)
+	e.SetDistance(0.5)
+	c := NewRPMComparator(3, 5*time.Second)
+	var warned bool
+	for i := 0; i < 1200; i++ {
+		frame := breathingFrame(i, 12, rate, false).(BaseBandIQ)
+		if est, ok, err := e.AddFrame(frame); err != nil {
+			t.Fatal(err)
+		} else if ok {
+			c.AddEstimate(est)
+		}
+		if i%20 == 0 {
+			// the firmware's rate sticks at 20
+			if _, ok := c.AddRespiration(Respiration{Time: frame.Time, RPM: 20, Distance: 0.5, Valid: true}); ok {
+				warned = true
+			}
+		}
+	}
+	if !warned {
+		t.Error("Expected: a warning for the stuck firmware rate")
+	}
+}
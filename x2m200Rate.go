@@ -0,0 +1,142 @@
+package xethru
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// ErrFrameRateDrift is wrapped by the DriftError a Module's DriftAlarm
+// reports.
+var ErrFrameRateDrift = errors.New("frame rate drift")
+
+// defaultRateAlpha is the weight of each new interval in a RateMeter.
+const defaultRateAlpha = 0.05
+
+// RateMeter measures the rate frames arrive at as an exponentially weighted
+// mean of the intervals between them, so bursts of frames delivered
+// together by USB scheduling average out rather than spike the rate. Alpha
+// is the weight given to each new interval, zero is 0.05. It is safe to use
+// from several goroutines.
+type RateMeter struct {
+	Alpha float64
+
+	mu       sync.Mutex
+	last     time.Time
+	interval float64 // seconds
+}
+
+// Observe records a frame arriving at t.
+func (m *RateMeter) Observe(t time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.last.IsZero() {
+		m.last = t
+		return
+	}
+	dt := t.Sub(m.last).Seconds()
+	m.last = t
+	if dt < 0 {
+		return
+	}
+	if m.interval == 0 {
+		m.interval = dt
+		return
+	}
+	alpha := m.Alpha
+	if alpha <= 0 || alpha > 1 {
+		alpha = defaultRateAlpha
+	}
+	m.interval += alpha * (dt - m.interval)
+}
+
+// Rate returns the measured rate in frames per second, zero until two
+// frames have been observed.
+func (m *RateMeter) Rate() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.interval <= 0 {
+		return 0
+	}
+	return 1 / m.interval
+}
+
+// Reset forgets the frames observed.
+func (m *RateMeter) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.last = time.Time{}
+	m.interval = 0
+}
+
+// DriftAlarm makes a Module report a DriftError to its OnError handlers
+// when the measured respiration frame rate is more than Tolerance percent
+// away from Nominal frames per second for After. It is reported once per
+// drift, and again if the rate drifts after recovering. The rate is only
+// checked as frames arrive, a sensor that stops sending is not a drift.
+type DriftAlarm struct {
+	Nominal   float64       // frames per second
+	Tolerance float64       // percent
+	After     time.Duration // how long the drift must last
+
+	since  time.Time
+	raised bool
+}
+
+// DriftError is reported when the frame rate has drifted.
+type DriftError struct {
+	Nominal  float64   // frames per second expected
+	Measured float64   // frames per second measured
+	Since    time.Time // when the drift started
+}
+
+func (e *DriftError) Error() string {
+	return fmt.Sprintf("%v: %.2f frames per second, nominal %.2f, since %s",
+		ErrFrameRateDrift, e.Measured, e.Nominal, e.Since.Format(time.RFC3339))
+}
+
+// Unwrap returns ErrFrameRateDrift.
+func (e *DriftError) Unwrap() error {
+	return ErrFrameRateDrift
+}
+
+// check returns a DriftError the first time rate, measured at now, has
+// drifted for After.
+func (a *DriftAlarm) check(now time.Time, rate float64) error {
+	if rate <= 0 || a.Nominal <= 0 {
+		return nil
+	}
+	if math.Abs(rate-a.Nominal)/a.Nominal*100 <= a.Tolerance {
+		a.since = time.Time{}
+		a.raised = false
+		return nil
+	}
+	if a.since.IsZero() {
+		a.since = now
+	}
+	if a.raised || now.Sub(a.since) < a.After {
+		return nil
+	}
+	a.raised = true
+	return &DriftError{Nominal: a.Nominal, Measured: rate, Since: a.since}
+}
+
+// observeRate records the arrival of a respiration frame and checks the
+// DriftAlarm.
+func (r *Module) observeRate() {
+	now := clock().Now()
+	r.rate.Observe(now)
+	rate := r.rate.Rate()
+	if rate > 0 {
+		r.metrics().Gauge(MetricFrameRate, rate)
+	}
+	if r.DriftAlarm == nil {
+		return
+	}
+	if err := r.DriftAlarm.check(now, rate); err != nil {
+		r.log().Warnf("%v", err)
+		r.handleError(err)
+	}
+}
@@ -0,0 +1,156 @@
+package xethru
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateMeter(t *testing.T) {
+	const interval = time.Second / 17
+	testCases := []struct {
+		name      string
+		intervals func(i int) time.Duration
+		want      float64
+	}{
+		{"steady", func(int) time.Duration { return interval }, 17},
+		// pairs of frames delivered together by a USB transfer
+		{"bursty", func(i int) time.Duration {
+			if i%2 == 0 {
+				return time.Millisecond
+			}
+			return 2*interval - time.Millisecond
+		}, 17},
+		{"jitter", func(i int) time.Duration {
+			if i%3 == 0 {
+				return interval + 20*time.Millisecond
+			}
+			return interval - 10*time.Millisecond
+		}, 17},
+		{"slow", func(int) time.Duration { return time.Second / 12 }, 12},
+	}
+	for n, tc := range testCases {
+		var m RateMeter
+		now := time.Unix(0, fakeClockTime)
+		m.Observe(now)
+		if got := m.Rate(); got != 0 {
+			t.Errorf("test %d %s Expected: 0 after one frame, got %v\n", n, tc.name, got)
+		}
+		for i := 0; i < 400; i++ {
+			now = now.Add(tc.intervals(i))
+			m.Observe(now)
+		}
+		if got := m.Rate(); math.Abs(got-tc.want) > 0.5 {
+			t.Errorf("test %d %s Expected: %v, got %v\n", n, tc.name, tc.want, got)
+		}
+		m.Reset()
+		if got := m.Rate(); got != 0 {
+			t.Errorf("test %d %s Expected: 0 after Reset, got %v\n", n, tc.name, got)
+		}
+	}
+}
+
+func TestDriftAlarm(t *testing.T) {
+	a := &DriftAlarm{Nominal: 17, Tolerance: 10, After: 5 * time.Second}
+	start := time.Unix(0, fakeClockTime)
+	testCases := []struct {
+		at    time.Duration
+		rate  float64
+		raise bool
+	}{
+		{0, 17, false},
+		{time.Second, 16, false}, // within 10%
+		{2 * time.Second, 12, false},
+		{6 * time.Second, 12, false},
+		{7 * time.Second, 12, true},
+		{8 * time.Second, 11, false}, // already raised
+		{9 * time.Second, 17, false},
+		{10 * time.Second, 22, false},
+		{15 * time.Second, 22, true}, // re-armed by the recovery
+	}
+	for n, tc := range testCases {
+		err := a.check(start.Add(tc.at), tc.rate)
+		if (err != nil) != tc.raise {
+			t.Errorf("test %d Expected: raised %v, got %v\n", n, tc.raise, err)
+		}
+		if err == nil {
+			continue
+		}
+		var drift *DriftError
+		if !errors.Is(err, ErrFrameRateDrift) || !errors.As(err, &drift) {
+			t.Errorf("test %d Expected: %v, got %v\n", n, ErrFrameRateDrift, err)
+			continue
+		}
+		if drift.Measured != tc.rate || drift.Nominal != 17 {
+			t.Errorf("test %d Expected: %v measured, got %v\n", n, tc.rate, drift)
+		}
+	}
+}
+
+func TestModuleFrameRate(t *testing.T) {
+	c := useFakeClock(t)
+	f, sensor := newFakeSensor(0)
+	m := NewModule(f, "respiration")
+	m.Timeout = 10 * time.Millisecond
+	m.DriftAlarm = &DriftAlarm{Nominal: 17, Tolerance: 10, After: 5 * time.Second}
+
+	var mu sync.Mutex
+	var errs []error
+	if err := m.OnError(func(err error) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+	}); err != nil {
+		t.Fatal(err)
+	}
+	frame := make(chan struct{})
+	if err := m.OnRespiration(func(Respiration) { frame <- struct{}{} }); err != nil {
+		t.Fatal(err)
+	}
+	stream := make(chan interface{}, 1000)
+	done := make(chan struct{})
+	go func() {
+		m.Run(stream)
+		close(done)
+	}()
+
+	send := func(frames int, interval time.Duration) {
+		for i := 0; i < frames; i++ {
+			c.Advance(interval)
+			sensor.send(respirationPayload)
+			<-frame
+		}
+	}
+	// steady at the nominal rate
+	send(200, time.Second/17)
+	if got := m.Stats().FrameRate; math.Abs(got-17) > 0.1 {
+		t.Errorf("Expected: 17 frames per second, got %v\n", got)
+	}
+	mu.Lock()
+	if len(errs) != 0 {
+		t.Errorf("Expected: no errors, got %v\n", errs)
+	}
+	mu.Unlock()
+
+	// the sensor slows to 12 frames per second for 20s
+	send(240, time.Second/12)
+	if got := m.Stats().FrameRate; math.Abs(got-12) > 0.1 {
+		t.Errorf("Expected: 12 frames per second, got %v\n", got)
+	}
+	sensor.Close()
+	<-done
+
+	mu.Lock()
+	defer mu.Unlock()
+	var drifts int
+	for _, err := range errs {
+		if errors.Is(err, ErrFrameRateDrift) {
+			drifts++
+		}
+	}
+	if drifts != 1 {
+		t.Errorf("Expected: one %v, got %v\n", ErrFrameRateDrift, errs)
+	}
+}
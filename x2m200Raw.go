@@ -0,0 +1,19 @@
+package xethru
+
+// withRaw returns data with a copy of payload as its Raw field, if it has
+// one. The copy does not share memory with the read buffers or with the
+// payload delivered to other Dispatcher subscribers.
+func withRaw(data interface{}, payload []byte) interface{} {
+	switch v := data.(type) {
+	case Respiration:
+		v.Raw = append([]byte(nil), payload...)
+		return v
+	case BaseBandIQ:
+		v.Raw = append([]byte(nil), payload...)
+		return v
+	case BaseBandAmpPhase:
+		v.Raw = append([]byte(nil), payload...)
+		return v
+	}
+	return data
+}
@@ -0,0 +1,79 @@
+package xethru
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrEmptyCommand is returned by RawCommand and RawSend for an empty payload.
+var ErrEmptyCommand = errors.New("empty command")
+
+// RawCommand sends payload to the sensor, framed, and returns the payload of
+// its reply, the next frame that is not app data, without interpreting it.
+// It takes its turn with the commands of the device's modules so it can be
+// used while they are streaming. An error reply is returned as a
+// *SensorError, and a payload whose frame would be larger than the sensor's
+// maximum frame size as ErrFrameTooLarge. It waits until ctx is done or, if
+// ctx has no deadline, for the device's command timeout. The reset command
+// is known, the device's modules do not take the restart it causes for a
+// reboot.
+func (dev *Device) RawCommand(ctx context.Context, payload []byte) ([]byte, error) {
+	if err := checkRawPayload(payload); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if isResetCommand(payload) {
+		dev.d.markReset()
+	}
+	timeout := dev.timeout
+	deadline, hasDeadline := ctx.Deadline()
+	if hasDeadline {
+		timeout = time.Until(deadline)
+	}
+	resp, err := dev.d.exchangeFunc(ctx, func() error {
+		_, err := dev.f.Write(payload)
+		return err
+	}, timeout, func(p []byte) bool {
+		return !isAppData(frameType(p))
+	})
+	// the timeout is ctx's deadline, which can pass before ctx is done,
+	// report it as ctx does
+	if errors.Is(err, ErrCommandTimeout) && hasDeadline && !time.Now().Before(deadline) {
+		return nil, context.DeadlineExceeded
+	}
+	return resp, err
+}
+
+// RawSend sends payload to the sensor, framed, without waiting for a reply.
+// It waits for any command in progress to finish first. A reply is
+// dispatched like any other frame, so if it may still be coming when the next
+// command is sent that command can take it for its own response, wait for it
+// with a Dispatcher subscription or use RawCommand. Like RawCommand it knows
+// the reset command.
+func (dev *Device) RawSend(payload []byte) error {
+	if err := checkRawPayload(payload); err != nil {
+		return err
+	}
+	dev.d.callMu.Lock()
+	defer dev.d.callMu.Unlock()
+	if isResetCommand(payload) {
+		dev.d.markReset()
+	}
+	_, err := dev.f.Write(payload)
+	return err
+}
+
+// checkRawPayload checks payload is a command that fits in a frame.
+func checkRawPayload(payload []byte) error {
+	if len(payload) == 0 {
+		return ErrEmptyCommand
+	}
+	if n := len(EncodeFrame(payload)); n > defaultMaxFrameSize {
+		return fmt.Errorf("%w: %d bytes framed, the maximum is %d", ErrFrameTooLarge, n, defaultMaxFrameSize)
+	}
+	return nil
+}
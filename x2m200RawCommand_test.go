@@ -0,0 +1,113 @@
+package xethru
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRawCommandStreaming(t *testing.T) {
+	dev := openSimulated(t)
+	defer dev.Close()
+	resp := dev.Respiration()
+	if err := resp.Load(); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream := make(chan interface{}, 16)
+	go resp.RunContext(ctx, stream)
+	waitFor(t, stream, isRespiration)
+
+	getSensitivity := append([]byte{x2m200AppCommand, x2m200Get}, x2m200Sensitivity[:]...)
+	cases := []struct {
+		payload []byte
+		prefix  []byte
+		err     error
+	}{
+		{pingCommand(), []byte{x2m200PingCommand}, nil},
+		{getSensitivity, []byte{x2m200Reply, x2m200AppCommand, x2m200Get}, nil},
+		{[]byte{x2m200SetLEDControl, 0x02, 0x00}, []byte{ack}, nil},
+		{[]byte{0x99}, nil, ErrProtocolNotRecognised},
+		{nil, nil, ErrEmptyCommand},
+		{bytes.Repeat([]byte{startByte}, defaultMaxFrameSize/2), nil, ErrFrameTooLarge},
+	}
+	for n, c := range cases {
+		got, err := dev.RawCommand(context.Background(), c.payload)
+		if !errors.Is(err, c.err) {
+			t.Errorf("test %d Expected: %v, got %v\n", n, c.err, err)
+		}
+		if !bytes.HasPrefix(got, c.prefix) || (c.err != nil && got != nil) {
+			t.Errorf("test %d Expected: reply starting %x, got %x\n", n, c.prefix, got)
+		}
+		// the stream carries on around each command
+		waitFor(t, stream, isRespiration)
+	}
+
+	if err := dev.RawSend([]byte{x2m200SetLEDControl, 0x02, 0x00}); err != nil {
+		t.Errorf("Expected: <nil>, got %v\n", err)
+	}
+	if err := dev.RawSend(nil); !errors.Is(err, ErrEmptyCommand) {
+		t.Errorf("Expected: %v, got %v\n", ErrEmptyCommand, err)
+	}
+	waitFor(t, stream, isRespiration)
+
+	done, stop := context.WithCancel(context.Background())
+	stop()
+	if _, err := dev.RawCommand(done, pingCommand()); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected: %v, got %v\n", context.Canceled, err)
+	}
+}
+
+func TestRawCommandDeadline(t *testing.T) {
+	sensor := NewSimulatedSensor()
+	dev, err := Open(simConn(sensor, false), WithResetTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dev.Close()
+	sensor.AckDelay = 200 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := dev.RawCommand(ctx, pingCommand()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected: %v, got %v\n", context.DeadlineExceeded, err)
+	}
+	if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+		t.Errorf("Expected: to return at the deadline, took %v\n", elapsed)
+	}
+}
+
+func TestRawResetNotReboot(t *testing.T) {
+	dev := openSimulated(t)
+	defer dev.Close()
+	resp := dev.Respiration()
+	resp.ResetTimeout = 200 * time.Millisecond
+	if err := resp.Load(); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream := make(chan interface{}, 100)
+	go resp.RunContext(ctx, stream)
+	waitFor(t, stream, isRespiration)
+	// long enough after the reset by Open to tell a reboot from a reset
+	time.Sleep(2 * resp.ResetTimeout)
+
+	if err := dev.RawSend([]byte{resetCmd}); err != nil {
+		t.Fatal(err)
+	}
+	timeout := time.After(300 * time.Millisecond)
+	for {
+		select {
+		case data := <-stream:
+			if _, ok := data.(ModuleRebooted); ok {
+				t.Fatalf("Expected: no reboot after a raw reset, got %+v\n", data)
+			}
+		case <-timeout:
+			return
+		}
+	}
+}
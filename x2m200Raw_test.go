@@ -0,0 +1,88 @@
+package xethru
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestKeepRaw(t *testing.T) {
+	useFakeClock(t)
+	iq := buildIQPayload(7, 16)
+	ap := append([]byte(nil), iq...)
+	ap[1] = basebandPhaseAmpltudeStartByte
+	payloads := [][]byte{respirationPayload, iq, ap}
+
+	for _, keep := range []bool{false, true} {
+		f, sensor := newFakeSensor(0)
+		m := NewModule(f, "respiration")
+		m.KeepRaw = keep
+		m.startReader()
+		// a second subscriber gets the same payloads
+		other := m.dispatcher.Subscribe(10, AppDataFrames...)
+		for _, p := range payloads {
+			sensor.send(p)
+		}
+
+		stream := make(chan interface{}, len(payloads))
+		finished := make(chan struct{})
+		go func() {
+			m.Run(stream)
+			close(finished)
+		}()
+
+		for n, p := range payloads {
+			var data interface{}
+			select {
+			case data = <-stream:
+			case <-time.After(time.Second):
+				t.Fatalf("test %d Expected: frame, got none\n", n)
+			}
+			raw := reflect.ValueOf(data).FieldByName("Raw").Bytes()
+			if !keep {
+				if raw != nil {
+					t.Errorf("test %d Expected: no raw payload, got %x\n", n, raw)
+				}
+				continue
+			}
+			if !bytes.Equal(raw, p) {
+				t.Errorf("test %d Expected: %x, got %x\n", n, p, raw)
+			}
+
+			// the raw payload reframed parses to the same values
+			decoded, err := DecodeFrame(EncodeFrame(raw))
+			if err != nil {
+				t.Fatalf("test %d %v", n, err)
+			}
+			again, err := parse(decoded)
+			if err != nil {
+				t.Fatalf("test %d %v", n, err)
+			}
+			if again = withRaw(again, raw); !reflect.DeepEqual(again, data) {
+				t.Errorf("test %d Expected: %+v, got %+v\n", n, data, again)
+			}
+
+			// the copy is not shared with other subscribers
+			raw[len(raw)-1] ^= 0xff
+			if f := <-other; !bytes.Equal(f.Payload, p) {
+				t.Errorf("test %d Expected: %x, got %x\n", n, p, f.Payload)
+			}
+		}
+		sensor.Close()
+		<-finished
+	}
+}
+
+func TestBaseBandModuleKeepRaw(t *testing.T) {
+	payload := buildIQPayload(3, 8)
+	d := NewDispatcher(NewFramer(bytes.NewBuffer(encodeFrame(payload))))
+	b := NewBaseBandModule(d)
+	b.KeepRaw = true
+	stream := make(chan interface{}, 1)
+	go b.Run(stream)
+	iq := (<-stream).(BaseBandIQ)
+	if !bytes.Equal(iq.Raw, payload) {
+		t.Errorf("Expected: %x, got %x\n", payload, iq.Raw)
+	}
+}
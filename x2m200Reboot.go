@@ -0,0 +1,105 @@
+package xethru
+
+import (
+	"fmt"
+)
+
+// x2m200StartApp starts the loaded app streaming.
+var x2m200StartApp = []byte{0x20, 0x01}
+
+// ModuleRebooted is sent on Run's stream when the sensor reboots by itself
+// while streaming, after a brown-out for instance. A reboot loses the app and
+// its settings, so before the event is sent they are restored by the
+// OnReconfigure handler and the app is started again.
+type ModuleRebooted struct {
+	Time int64 // when the ready message was received
+	Err  error // error restoring the app, nil if it is streaming again
+}
+
+// OnReconfigure registers h to be called by Run when the sensor has rebooted,
+// to send the settings lost by the reboot, usually Setup. Only the last
+// handler registered is called. Like OnRespiration it returns
+// ErrModuleRunning while Run is running.
+func (r *Module) OnReconfigure(h func() error) error {
+	r.handlersMu.Lock()
+	defer r.handlersMu.Unlock()
+	if r.running {
+		return ErrModuleRunning
+	}
+	r.reconfigure = h
+	return nil
+}
+
+// systemMessage handles a system message read by Run and returns the
+// ModuleRebooted event it causes, or nil. A reboot is the booting message
+// followed by the ready message. After a reset the ready message goes to the
+// command waiting for it instead, so it only reaches Run when the sensor has
+// rebooted by itself. The messages that follow a reset sent through the
+// module's Dispatcher, whose ready message no command waits for, are not a
+// reboot either.
+func (r *Module) systemMessage(p []byte) interface{} {
+	if len(p) < 2 {
+		return nil
+	}
+	if r.commandedReset() {
+		r.booting = false
+		return nil
+	}
+	switch p[1] {
+	case systemBooting:
+		r.log().Debugf("sensor is booting")
+		r.booting = true
+		return nil
+	case systemReady:
+		if !r.booting {
+			return nil
+		}
+		r.booting = false
+	default:
+		return nil
+	}
+	r.log().Warnf("sensor rebooted while streaming, reconfiguring")
+	r.metrics().Counter(MetricReboots, 1)
+	event := ModuleRebooted{Time: clock().Now().UnixNano()}
+	// the reboot woke the sensor and unloaded its app, the gap in the
+	// frames is not their rate
+	r.setAsleep(false)
+	r.profileMu.Lock()
+	r.profileLoaded = false
+	r.profileMu.Unlock()
+	r.rate.Reset()
+	r.restartStates()
+
+	var err error
+	if r.reconfigure != nil {
+		err = r.reconfigure()
+	}
+	if err == nil {
+		_, err = r.Execute(x2m200StartApp, x2m200Ack, r.Timeout)
+	}
+	if err != nil {
+		event.Err = fmt.Errorf("reconfiguring after reboot: %w", err)
+		r.log().Errorf("%v", event.Err)
+		r.handleError(event.Err)
+	}
+	return event
+}
+
+// isResetCommand reports whether cmd is the protocol reset command.
+func isResetCommand(cmd []byte) bool {
+	return len(cmd) == 1 && cmd[0] == resetCmd
+}
+
+// markReset records that the sensor is being reset through d, by a module,
+// the Device or a raw command, so the system messages it sends while it
+// restarts are not taken for a reboot by any module sharing d.
+func (d *Dispatcher) markReset() {
+	d.resetAt.Store(clock().Now().UnixNano())
+}
+
+// commandedReset reports whether the sensor was reset through the module's
+// Dispatcher within the last ResetTimeout.
+func (r *Module) commandedReset() bool {
+	at := r.dispatcher.resetAt.Load()
+	return at != 0 && clock().Now().UnixNano()-at < int64(r.resetTimeout())
+}
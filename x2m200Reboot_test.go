@@ -0,0 +1,169 @@
+package xethru
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// recordingSensor is a SimulatedSensor that records the commands written.
+type recordingSensor struct {
+	*SimulatedSensor
+	mu   sync.Mutex
+	cmds [][]byte
+}
+
+func (s *recordingSensor) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	s.cmds = append(s.cmds, append([]byte(nil), p...))
+	s.mu.Unlock()
+	return s.SimulatedSensor.Write(p)
+}
+
+func (s *recordingSensor) commands() [][]byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([][]byte(nil), s.cmds...)
+}
+
+// waitFor reads stream until it finds a value that want accepts.
+func waitFor(t *testing.T, stream chan interface{}, want func(interface{}) bool) interface{} {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case data := <-stream:
+			if want(data) {
+				return data
+			}
+		case <-timeout:
+			t.Fatal("timeout waiting for frame")
+		}
+	}
+}
+
+func isRespiration(data interface{}) bool {
+	_, ok := data.(Respiration)
+	return ok
+}
+
+func TestRunReboot(t *testing.T) {
+	sim := NewSimulatedSensor()
+	sim.Interval = time.Millisecond
+	sensor := &recordingSensor{SimulatedSensor: sim}
+	m := NewModule(sensor, "respiration")
+	m.Timeout = 100 * time.Millisecond
+	m.DetectionZoneStart, m.DetectionZoneEnd = 0.5, 1.5
+	m.Sensitivity = 7
+	if err := m.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.OnReconfigure(m.Setup); err != nil {
+		t.Fatal(err)
+	}
+	var errs atomic.Int32
+	if err := m.OnError(func(error) { errs.Add(1) }); err != nil {
+		t.Fatal(err)
+	}
+
+	stream := make(chan interface{}, 100)
+	done := make(chan struct{})
+	go func() {
+		m.Run(stream)
+		close(done)
+	}()
+	for i := 0; i < 50; i++ {
+		waitFor(t, stream, isRespiration)
+	}
+
+	before := len(sensor.commands())
+	sim.Reboot()
+	event := waitFor(t, stream, func(data interface{}) bool {
+		_, ok := data.(ModuleRebooted)
+		return ok
+	}).(ModuleRebooted)
+	if event.Err != nil {
+		t.Errorf("Expected: reconfigured, got %v\n", event.Err)
+	}
+	// streaming resumes
+	for i := 0; i < 10; i++ {
+		waitFor(t, stream, isRespiration)
+	}
+	sim.Close()
+	<-done
+
+	expected := [][]byte{
+		append([]byte{x2m200LoadModule}, m.AppID[:]...),
+		m.ledModeCmd(),
+		m.detectionZoneCmd(),
+		m.sensitivityCmd(),
+		x2m200StartApp,
+	}
+	resent := sensor.commands()[before:]
+	if len(resent) < len(expected) {
+		t.Fatalf("Expected: %x, got %x\n", expected, resent)
+	}
+	for n, cmd := range expected {
+		if !bytes.Equal(resent[n], cmd) {
+			t.Errorf("test %d Expected: %x, got %x\n", n, cmd, resent[n])
+		}
+	}
+	if _, ok := m.Profile(); !ok {
+		t.Errorf("Expected: profile loaded again\n")
+	}
+	if n := errs.Load(); n != 0 {
+		t.Errorf("Expected: no errors, got %d\n", n)
+	}
+}
+
+func TestRunRebootReconfigureFails(t *testing.T) {
+	var reject atomic.Bool
+	sim := NewSimulatedSensor()
+	sim.Interval = time.Millisecond
+	sim.Reject = func(cmd []byte) bool {
+		return reject.Load() && cmd[0] == x2m200LoadModule
+	}
+	m := NewModule(sim, "respiration")
+	m.Timeout = 100 * time.Millisecond
+	if err := m.OnReconfigure(func() error { return m.Load() }); err != nil {
+		t.Fatal(err)
+	}
+	errs := make(chan error, 10)
+	if err := m.OnError(func(err error) { errs <- err }); err != nil {
+		t.Fatal(err)
+	}
+
+	stream := make(chan interface{}, 100)
+	done := make(chan struct{})
+	go func() {
+		m.Run(stream)
+		close(done)
+	}()
+	waitFor(t, stream, isRespiration)
+	reject.Store(true)
+	sim.Reboot()
+	event := waitFor(t, stream, func(data interface{}) bool {
+		_, ok := data.(ModuleRebooted)
+		return ok
+	}).(ModuleRebooted)
+	sim.Close()
+	<-done
+
+	if !errors.Is(event.Err, ErrProtocolNotRecognised) {
+		t.Errorf("Expected: %v, got %v\n", ErrProtocolNotRecognised, event.Err)
+	}
+	select {
+	case err := <-errs:
+		if err != event.Err {
+			t.Errorf("Expected: %v, got %v\n", event.Err, err)
+		}
+	default:
+		t.Errorf("Expected: %v reported to OnError\n", event.Err)
+	}
+	if err := m.OnReconfigure(nil); err != nil {
+		t.Errorf("Expected: handler can be changed after Run, got %v\n", err)
+	}
+}
@@ -0,0 +1,288 @@
+package xethru
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// ConnState is the state of a ReconnectingFramer's transport.
+type ConnState int
+
+// Connection states sent on ReconnectingFramer.States
+const (
+	StateDisconnected ConnState = iota
+	StateConnected
+	StateClosed
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case StateDisconnected:
+		return "disconnected"
+	case StateConnected:
+		return "connected"
+	case StateClosed:
+		return "closed"
+	}
+	return "unknown"
+}
+
+// ReconnectingFramer is a Framer that dials its transport on first use and
+// re-dials, with backoff, whenever a read or write fails. After every dial the
+// sensor is reset and the framer waits for it to report ready before any
+// other frames are read or written. Framing and sensor errors are returned as
+// normal, transport errors are not returned at all.
+type ReconnectingFramer struct {
+	Dial func() (io.ReadWriteCloser, error)
+
+	// OnReconnect, if set, is called in its own goroutine after each
+	// reconnection, but not the first connection, so the sensor can be
+	// configured again. It may use Module commands on this Framer.
+	OnReconnect func() error
+
+	MinBackoff   time.Duration // delay after the first failed dial
+	MaxBackoff   time.Duration // longest delay between dials
+	ResetTimeout time.Duration // how long to wait for the sensor to be ready
+	Logger       Logger
+
+	mu     sync.Mutex // held while connecting
+	cur    Framer
+	gen    int // incremented on every connection
+	states chan ConnState
+	closed chan struct{}
+	once   sync.Once
+}
+
+// NewReconnectingFramer creates a ReconnectingFramer that uses dial to open
+// its transport.
+func NewReconnectingFramer(dial func() (io.ReadWriteCloser, error)) *ReconnectingFramer {
+	return &ReconnectingFramer{
+		Dial:         dial,
+		MinBackoff:   100 * time.Millisecond,
+		MaxBackoff:   10 * time.Second,
+		ResetTimeout: resetTimeout,
+		states:       make(chan ConnState, 16),
+		closed:       make(chan struct{}),
+	}
+}
+
+// States returns a channel that receives every change of connection state.
+// States are dropped if the channel is not kept empty.
+func (r *ReconnectingFramer) States() <-chan ConnState {
+	return r.states
+}
+
+// Read reads the next frame, reconnecting as many times as needed. It returns
+// io.EOF once the framer is closed.
+func (r *ReconnectingFramer) Read(b []byte) (int, error) {
+	for {
+		f, gen, err := r.conn(-1)
+		if err != nil {
+			return 0, err
+		}
+		n, err := f.Read(b)
+		if err == nil || !isTransportErr(err) {
+			return n, err
+		}
+		r.log().Warnf("read failed, reconnecting: %v", err)
+		if _, _, err := r.conn(gen); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// ReadPayload is Read that returns the whole payload of the next frame.
+func (r *ReconnectingFramer) ReadPayload() ([]byte, error) {
+	for {
+		f, gen, err := r.conn(-1)
+		if err != nil {
+			return nil, err
+		}
+		p, err := readPayload(f)
+		if err == nil || !isTransportErr(err) {
+			return p, err
+		}
+		r.log().Warnf("read failed, reconnecting: %v", err)
+		if _, _, err := r.conn(gen); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Write writes a frame, reconnecting and retrying as needed. It returns
+// io.ErrClosedPipe once the framer is closed.
+func (r *ReconnectingFramer) Write(p []byte) (int, error) {
+	for {
+		f, gen, err := r.conn(-1)
+		if err != nil {
+			return 0, io.ErrClosedPipe
+		}
+		n, err := f.Write(p)
+		if err == nil {
+			return n, nil
+		}
+		r.log().Warnf("write failed, reconnecting: %v", err)
+		if _, _, err := r.conn(gen); err != nil {
+			return 0, io.ErrClosedPipe
+		}
+	}
+}
+
+// Reset resets the current connection.
+func (r *ReconnectingFramer) Reset() (bool, error) {
+	f, _, err := r.conn(-1)
+	if err != nil {
+		return false, err
+	}
+	return f.Reset()
+}
+
+// Close closes the transport and stops any reconnection.
+func (r *ReconnectingFramer) Close() error {
+	var err error
+	r.once.Do(func() {
+		close(r.closed)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.cur != nil {
+			err = r.cur.Close()
+			r.cur = nil
+		}
+		r.setState(StateClosed)
+	})
+	return err
+}
+
+// conn returns the current connection. If failed is the generation of the
+// current connection it is closed and a new one made, if the connection has
+// already been replaced the new one is returned.
+func (r *ReconnectingFramer) conn(failed int) (Framer, int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.isClosed() {
+		return nil, 0, io.EOF
+	}
+	if r.cur != nil && r.gen != failed {
+		return r.cur, r.gen, nil
+	}
+	if r.cur != nil {
+		r.cur.Close()
+		r.cur = nil
+		r.setState(StateDisconnected)
+	}
+
+	backoff := r.MinBackoff
+	for {
+		f, err := r.dial()
+		if err == nil {
+			r.cur = f
+			r.gen++
+			r.setState(StateConnected)
+			if r.gen > 1 && r.OnReconnect != nil {
+				go func() {
+					if err := r.OnReconnect(); err != nil {
+						r.log().Errorf("reconfigure after reconnect failed: %v", err)
+					}
+				}()
+			}
+			return r.cur, r.gen, nil
+		}
+		r.log().Warnf("connect failed, retrying in %v: %v", backoff, err)
+		select {
+		case <-r.closed:
+			return nil, 0, io.EOF
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > r.MaxBackoff {
+			backoff = r.MaxBackoff
+		}
+	}
+}
+
+// dial opens the transport and waits for the sensor to be ready.
+func (r *ReconnectingFramer) dial() (Framer, error) {
+	rwc, err := r.Dial()
+	if err != nil {
+		return nil, err
+	}
+	f := NewFramer(rwc)
+	if err := waitReady(f, r.ResetTimeout, r.closed); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func (r *ReconnectingFramer) isClosed() bool {
+	select {
+	case <-r.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func (r *ReconnectingFramer) setState(s ConnState) {
+	select {
+	case r.states <- s:
+	default:
+	}
+}
+
+func (r *ReconnectingFramer) log() Logger {
+	if r.Logger != nil {
+		return r.Logger
+	}
+	return nopLogger{}
+}
+
+// waitReady resets the sensor on f and reads frames until the sensor sends
+// the system ready message. If it does not arrive within timeout, or cancel
+// is closed first, f is closed.
+func waitReady(f Framer, timeout time.Duration, cancel <-chan struct{}) error {
+	if _, err := f.Write([]byte{resetCmd}); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		b := make([]byte, readBufferSize)
+		for {
+			n, err := f.Read(b)
+			if err != nil {
+				if isTransportErr(err) {
+					done <- err
+					return
+				}
+				continue
+			}
+			if n > 1 && b[0] == systemMesg && b[1] == systemReady {
+				done <- nil
+				return
+			}
+		}
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(timeout):
+		f.Close()
+		<-done
+		return ErrCommandTimeout
+	case <-cancel:
+		f.Close()
+		<-done
+		return io.EOF
+	}
+}
+
+// isTransportErr reports whether err came from the transport rather than
+// from a bad frame, a frame too long for the read buffer or an error reply
+// from the sensor.
+func isTransportErr(err error) bool {
+	var crcErr *CRCError
+	var framingErr *FramingError
+	return !errors.As(err, &crcErr) && !errors.As(err, &framingErr) && !errors.Is(err, ErrProtocol) && !errors.Is(err, io.ErrShortBuffer)
+}
@@ -0,0 +1,119 @@
+package xethru
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+var errUnplugged = errors.New("unplugged")
+
+// flakyConn fails every read once left bytes have been read.
+type flakyConn struct {
+	io.ReadWriteCloser
+	mu   sync.Mutex
+	left int
+}
+
+func (c *flakyConn) Read(b []byte) (int, error) {
+	c.mu.Lock()
+	left := c.left
+	c.mu.Unlock()
+	if left <= 0 {
+		return 0, errUnplugged
+	}
+	if len(b) > left {
+		b = b[:left]
+	}
+	n, err := c.ReadWriteCloser.Read(b)
+	c.mu.Lock()
+	c.left -= n
+	c.mu.Unlock()
+	return n, err
+}
+
+func TestReconnectingFramer(t *testing.T) {
+	var mu sync.Mutex
+	var sensors []*fakeSensor
+	dials := 0
+	rf := NewReconnectingFramer(func() (io.ReadWriteCloser, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		dials++
+		if dials == 2 {
+			return nil, errUnplugged
+		}
+		conn, s := newFakeSensorConn(time.Millisecond)
+		s.setReplies([]byte{x2m200Ack}, []byte{systemMesg, systemReady})
+		sensors = append(sensors, s)
+		return &flakyConn{ReadWriteCloser: conn, left: 2000}, nil
+	})
+	rf.MinBackoff = time.Millisecond
+	reconfigured := make(chan struct{}, 10)
+	m := NewModule(rf, "respiration")
+	rf.OnReconnect = func() error {
+		reconfigured <- struct{}{}
+		return m.Load()
+	}
+
+	stream := make(chan interface{})
+	finished := make(chan struct{})
+	go func() {
+		m.Run(stream)
+		close(finished)
+	}()
+
+	// 2000 bytes is about 50 respiration frames per connection
+	n := 0
+	for n < 200 {
+		if _, ok := (<-stream).(Respiration); ok {
+			n++
+		}
+	}
+	rf.Close()
+	go func() {
+		for range stream {
+		}
+	}()
+	select {
+	case <-finished:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after Close")
+	}
+	mu.Lock()
+	for _, s := range sensors {
+		s.Close()
+	}
+	if len(sensors) < 4 {
+		t.Errorf("Expected: at least %d connections, got %d\n", 4, len(sensors))
+	}
+	mu.Unlock()
+	if len(reconfigured) < 3 {
+		t.Errorf("Expected: at least %d reconfigurations, got %d\n", 3, len(reconfigured))
+	}
+
+	var states []ConnState
+	for len(rf.States()) > 0 {
+		states = append(states, <-rf.States())
+	}
+	want := []ConnState{StateConnected, StateDisconnected, StateConnected}
+	if len(states) < len(want)+1 || states[len(states)-1] != StateClosed {
+		t.Fatalf("Expected: states ending in %v, got %v\n", StateClosed, states)
+	}
+	for i, s := range want {
+		if states[i] != s {
+			t.Errorf("test %d Expected: %v, got %v\n", i, s, states[i])
+		}
+	}
+}
+
+func TestWaitReadyTimeout(t *testing.T) {
+	f, sensor := newFakeSensor(0)
+	defer sensor.Close()
+	err := waitReady(f, 20*time.Millisecond, nil)
+	if err != ErrCommandTimeout {
+		t.Errorf("Expected: %v, got %v\n", ErrCommandTimeout, err)
+	}
+}
@@ -0,0 +1,144 @@
+package xethru
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Recording file format
+// magic "XETH" + version byte, followed by records of
+// timestamp(int64 unix nano) + length(uint32) + [payload], all little endian.
+const (
+	recordMagic      = "XETH"
+	recordVersion    = 0x01
+	recordHeaderSize = 12
+
+	// maxRecordSize bounds the frame size read by a Player
+	maxRecordSize = 1 << 24
+)
+
+// Recorder wraps a Framer and writes every frame read from it to w, so a
+// session can be replayed later with a Player.
+type Recorder struct {
+	Framer
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewRecorder writes the recording header to w and returns a Recorder
+// wrapping f.
+func NewRecorder(f Framer, w io.Writer) (*Recorder, error) {
+	if _, err := w.Write(append([]byte(recordMagic), recordVersion)); err != nil {
+		return nil, err
+	}
+	return &Recorder{Framer: f, w: w}, nil
+}
+
+// Read reads a frame from the wrapped Framer and records it.
+func (r *Recorder) Read(b []byte) (int, error) {
+	n, err := r.Framer.Read(b)
+	if n > 0 {
+		if werr := r.record(time.Now(), b[:n]); werr != nil && err == nil {
+			err = werr
+		}
+	}
+	return n, err
+}
+
+func (r *Recorder) record(t time.Time, p []byte) error {
+	header := make([]byte, recordHeaderSize)
+	binary.LittleEndian.PutUint64(header[0:8], uint64(t.UnixNano()))
+	binary.LittleEndian.PutUint32(header[8:12], uint32(len(p)))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err := r.w.Write(header); err != nil {
+		return err
+	}
+	_, err := r.w.Write(p)
+	return err
+}
+
+// Player implements Framer by replaying a recording made with a Recorder.
+// Frames are returned with their original spacing divided by Speed, a Speed
+// of zero or less replays as fast as possible. Writes are discarded.
+type Player struct {
+	Speed float64
+	r     io.Reader
+	last  int64
+	at    time.Time
+}
+
+// NewPlayer checks the recording header of r and returns a Player.
+func NewPlayer(r io.Reader, speed float64) (*Player, error) {
+	header := make([]byte, len(recordMagic)+1)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if string(header[:len(recordMagic)]) != recordMagic {
+		return nil, errRecordBadMagic
+	}
+	if header[len(recordMagic)] != recordVersion {
+		return nil, errRecordBadVersion
+	}
+	return &Player{Speed: speed, r: r}, nil
+}
+
+// Read returns the next recorded frame, waiting to preserve the recorded
+// timing. It returns io.EOF at the end of the recording.
+func (p *Player) Read(b []byte) (int, error) {
+	header := make([]byte, recordHeaderSize)
+	if _, err := io.ReadFull(p.r, header); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return 0, errRecordTruncated
+		}
+		return 0, err
+	}
+	ts := int64(binary.LittleEndian.Uint64(header[0:8]))
+	size := binary.LittleEndian.Uint32(header[8:12])
+	if size > maxRecordSize {
+		return 0, fmt.Errorf("%w: %d bytes", errRecordTooLarge, size)
+	}
+	frame := make([]byte, size)
+	if _, err := io.ReadFull(p.r, frame); err != nil {
+		return 0, errRecordTruncated
+	}
+
+	if p.Speed > 0 && !p.at.IsZero() {
+		wait := time.Duration(float64(ts-p.last) / p.Speed)
+		time.Sleep(time.Until(p.at.Add(wait)))
+	}
+	p.last = ts
+	p.at = time.Now()
+
+	return copyPayload(b, frame)
+}
+
+// Write discards p, there is no sensor to send commands to.
+func (p *Player) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+// Reset always succeeds.
+func (p *Player) Reset() (bool, error) {
+	return true, nil
+}
+
+// Close closes the underlying reader if it is an io.Closer.
+func (p *Player) Close() error {
+	if c, ok := p.r.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+var (
+	errRecordBadMagic   = errors.New("not a xethru recording")
+	errRecordBadVersion = errors.New("unsupported xethru recording version")
+	errRecordTruncated  = errors.New("xethru recording is truncated")
+	errRecordTooLarge   = errors.New("xethru recording frame too large")
+)
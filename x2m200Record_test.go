@@ -0,0 +1,117 @@
+package xethru
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRecordReplay(t *testing.T) {
+	var wire []byte
+	for i := 0; i < 5; i++ {
+		wire = append(wire, encodeFrame(buildIQPayload(uint32(i), 32))...)
+	}
+	sensor := CreateSplitReadWriter(io.Discard, bytes.NewReader(wire))
+
+	var file bytes.Buffer
+	rec, err := NewRecorder(sensor, &file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var recorded []BaseBandIQ
+	for {
+		b := make([]byte, 1024)
+		n, err := rec.Read(b)
+		if err != nil {
+			break
+		}
+		iq, err := parseBaseBandIQ(b[:n])
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorded = append(recorded, iq)
+	}
+	if len(recorded) != 5 {
+		t.Fatalf("Expected: 5 frames recorded, got %d\n", len(recorded))
+	}
+
+	player, err := NewPlayer(&file, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; ; i++ {
+		b := make([]byte, 1024)
+		n, err := player.Read(b)
+		if err == io.EOF {
+			if i != len(recorded) {
+				t.Errorf("Expected: %d frames replayed, got %d\n", len(recorded), i)
+			}
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		iq, err := parseBaseBandIQ(b[:n])
+		if err != nil {
+			t.Fatal(err)
+		}
+		iq.Time = recorded[i].Time
+		if !reflect.DeepEqual(iq, recorded[i]) {
+			t.Errorf("frame %d does not match\n", i)
+		}
+	}
+}
+
+func TestPlayerTiming(t *testing.T) {
+	var file bytes.Buffer
+	rec, _ := NewRecorder(nil, &file)
+	start := time.Now()
+	rec.record(start, []byte{0x10})
+	rec.record(start.Add(200*time.Millisecond), []byte{0x10})
+
+	player, err := NewPlayer(&file, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 16)
+	player.Read(b)
+	before := time.Now()
+	player.Read(b)
+	if elapsed := time.Since(before); elapsed < 15*time.Millisecond || elapsed > 150*time.Millisecond {
+		t.Errorf("Expected: about 20ms between frames, got %v\n", elapsed)
+	}
+}
+
+func TestPlayerBadHeader(t *testing.T) {
+	cases := []struct {
+		b   []byte
+		err error
+	}{
+		{[]byte("XETX\x01"), errRecordBadMagic},
+		{[]byte("XETH\x02"), errRecordBadVersion},
+		{[]byte("XE"), io.ErrUnexpectedEOF},
+	}
+	for n, c := range cases {
+		_, err := NewPlayer(bytes.NewReader(c.b), 0)
+		if err != c.err {
+			t.Errorf("test %d Expected: %v, got %v\n", n, c.err, err)
+		}
+	}
+}
+
+func TestPlayerFrameTooLarge(t *testing.T) {
+	recording := []byte("XETH\x01")
+	recording = append(recording, make([]byte, 8)...)
+	recording = append(recording, 0xff, 0xff, 0xff, 0xff)
+	player, err := NewPlayer(bytes.NewReader(recording), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 64)
+	if _, err := player.Read(b); !errors.Is(err, errRecordTooLarge) {
+		t.Errorf("Expected: %v, got %v\n", errRecordTooLarge, err)
+	}
+}
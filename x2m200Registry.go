@@ -0,0 +1,286 @@
+package xethru
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Registry errors
+var (
+	ErrDeviceExists    = errors.New("device name already registered")
+	ErrRegistryStarted = errors.New("registry already started")
+)
+
+// DeviceError is the error that stopped a registered device's Run loop.
+type DeviceError struct {
+	Name string
+	Err  error
+}
+
+func (e *DeviceError) Error() string {
+	return fmt.Sprintf("device %s: %v", e.Name, e.Err)
+}
+
+// Unwrap returns Err.
+func (e *DeviceError) Unwrap() error {
+	return e.Err
+}
+
+// NamedRespiration is a Respiration frame from the registered device Name.
+type NamedRespiration struct {
+	Name string
+	Respiration
+}
+
+// Registry manages many Devices from one process. Each device runs the
+// respiration module returned by Module in its own Run loop, so a device
+// that fails stops only its own loop, and its frames are merged onto one
+// stream tagged with the name it was added under.
+//
+// Buffer and Policy configure each device's subscription to the merged
+// stream and must be set before Start.
+type Registry struct {
+	Buffer int
+	Policy DeliveryPolicy
+
+	mu      sync.Mutex
+	devices map[string]*registryEntry
+	ctx     context.Context
+	out     chan NamedRespiration
+	wg      sync.WaitGroup
+	errs    map[string]error
+}
+
+type registryEntry struct {
+	name   string
+	dev    *Device
+	module *Module
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewRegistry creates an empty Registry whose merged stream buffers up to
+// 16 frames per device and drops the oldest when full.
+func NewRegistry() *Registry {
+	return &Registry{
+		Buffer:  16,
+		Policy:  DropOldest,
+		devices: make(map[string]*registryEntry),
+		errs:    make(map[string]error),
+	}
+}
+
+// Add registers dev under name. If the registry has been started the
+// device's Run loop starts straight away.
+func (r *Registry) Add(name string, dev *Device) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.devices[name]; ok {
+		return fmt.Errorf("%w: %s", ErrDeviceExists, name)
+	}
+	e := &registryEntry{name: name, dev: dev, module: dev.Respiration()}
+	r.devices[name] = e
+	delete(r.errs, name)
+	if r.ctx != nil {
+		r.start(e)
+	}
+	return nil
+}
+
+// Remove stops the Run loop of the device registered under name and
+// unregisters it, returning the device, which is not closed, or nil if
+// there is none.
+func (r *Registry) Remove(name string) *Device {
+	r.mu.Lock()
+	e, ok := r.devices[name]
+	if ok {
+		delete(r.devices, name)
+		delete(r.errs, name)
+	}
+	r.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	if e.cancel != nil {
+		e.cancel()
+		<-e.done
+	}
+	return e.dev
+}
+
+// Get returns the device registered under name, or nil.
+func (r *Registry) Get(name string) *Device {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if e, ok := r.devices[name]; ok {
+		return e.dev
+	}
+	return nil
+}
+
+// Module returns the respiration module run for the device registered
+// under name, or nil, so it can be configured before Start.
+func (r *Registry) Module(name string) *Module {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if e, ok := r.devices[name]; ok {
+		return e.module
+	}
+	return nil
+}
+
+// Names returns the names of the registered devices in order.
+func (r *Registry) Names() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	names := make([]string, 0, len(r.devices))
+	for name := range r.devices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Start starts the Run loop of every registered device, they run until ctx
+// is done or their connection is lost. Respiration frames from all of them
+// are sent on the stream returned by Respiration. Use Wait to wait for the
+// loops to stop and collect their errors.
+func (r *Registry) Start(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.ctx != nil {
+		return ErrRegistryStarted
+	}
+	r.ctx = ctx
+	r.out = make(chan NamedRespiration, r.Buffer)
+	for _, e := range r.devices {
+		r.start(e)
+	}
+	return nil
+}
+
+// Respiration returns the merged stream of Respiration frames of the
+// devices started by Start. It is closed by Wait.
+func (r *Registry) Respiration() <-chan NamedRespiration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.out
+}
+
+// start runs e's module until ctx is done or its connection is lost,
+// r.mu must be held.
+func (r *Registry) start(e *registryEntry) {
+	ctx, cancel := context.WithCancel(r.ctx)
+	e.cancel = cancel
+	e.done = make(chan struct{})
+	sub, unsubscribe := e.module.Subscribe(r.Buffer, r.Policy)
+	out := r.out
+
+	r.wg.Add(2)
+	go func() {
+		defer r.wg.Done()
+		for resp := range sub {
+			select {
+			case out <- NamedRespiration{Name: e.name, Respiration: resp}:
+			case <-ctx.Done():
+				unsubscribe()
+				return
+			}
+		}
+	}()
+	go func() {
+		defer r.wg.Done()
+		defer close(e.done)
+		defer cancel()
+		err := e.module.RunContext(ctx, nil)
+		switch {
+		case err == nil:
+			// the dispatcher stopped, the device is gone
+			err = ErrConnectionClosed
+			if derr := e.dev.d.Err(); derr != nil {
+				err = fmt.Errorf("%w: %v", ErrConnectionClosed, derr)
+			}
+		case ctx.Err() != nil && err == ctx.Err():
+			err = nil
+		}
+		if err != nil {
+			e.module.log().Errorf("device %s stopped: %v", e.name, err)
+		}
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.devices[e.name] == e {
+			r.errs[e.name] = err
+		}
+	}()
+}
+
+// Err returns the error that stopped the Run loop of the device registered
+// under name, nil if it is still running or stopped because its context
+// was done.
+func (r *Registry) Err(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.errs[name]
+}
+
+// Wait waits for the Run loops started by Start to stop, closes the merged
+// stream and returns a DeviceError for each device that failed, joined.
+// The merged stream must be read until it is closed, or the registry's
+// context be done, for Wait to return. The registry may then be started
+// again.
+func (r *Registry) Wait() error {
+	r.wg.Wait()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var errs []error
+	for _, name := range r.sortedErrs() {
+		errs = append(errs, &DeviceError{Name: name, Err: r.errs[name]})
+	}
+	if r.out != nil {
+		close(r.out)
+	}
+	r.ctx = nil
+	return errors.Join(errs...)
+}
+
+func (r *Registry) sortedErrs() []string {
+	var names []string
+	for name, err := range r.errs {
+		if err != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Stats returns the sum of the Stats of every registered device, FrameRate
+// is the combined rate of all of them.
+func (r *Registry) Stats() Stats {
+	var total Stats
+	for _, s := range r.DeviceStats() {
+		total.FramesOK += s.FramesOK
+		total.CRCErrors += s.CRCErrors
+		total.FramingErrors += s.FramingErrors
+		total.BytesRead += s.BytesRead
+		total.BytesWritten += s.BytesWritten
+		total.DiscardedBytes += s.DiscardedBytes
+		total.DroppedFrames += s.DroppedFrames
+		total.FrameRate += s.FrameRate
+	}
+	return total
+}
+
+// DeviceStats returns the Stats of each registered device by name.
+func (r *Registry) DeviceStats() map[string]Stats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stats := make(map[string]Stats, len(r.devices))
+	for name, e := range r.devices {
+		stats[name] = e.module.Stats()
+	}
+	return stats
+}
@@ -0,0 +1,138 @@
+package xethru
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func openSimulated(t *testing.T) *Device {
+	t.Helper()
+	sensor := NewSimulatedSensor()
+	sensor.Interval = time.Millisecond
+	dev, err := Open(simConn(sensor, false), WithResetTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dev
+}
+
+func TestRegistry(t *testing.T) {
+	reg := NewRegistry()
+	names := []string{"bedroom", "hall", "kitchen"}
+	for _, name := range names {
+		dev := openSimulated(t)
+		defer dev.Close()
+		if err := reg.Add(name, dev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := reg.Add("hall", reg.Get("hall")); !errors.Is(err, ErrDeviceExists) {
+		t.Errorf("Expected: %v, got %v\n", ErrDeviceExists, err)
+	}
+	if got := reg.Names(); len(got) != 3 || got[0] != "bedroom" || got[2] != "kitchen" {
+		t.Errorf("Expected: %v, got %v\n", names, got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := reg.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.Start(ctx); err != ErrRegistryStarted {
+		t.Errorf("Expected: %v, got %v\n", ErrRegistryStarted, err)
+	}
+	stream := reg.Respiration()
+
+	// wait for frames from every device, then kill hall
+	seen := func(want ...string) {
+		t.Helper()
+		got := make(map[string]bool)
+		timeout := time.After(2 * time.Second)
+		for len(got) < len(want) {
+			select {
+			case resp := <-stream:
+				for _, name := range want {
+					if resp.Name == name {
+						got[name] = true
+					}
+				}
+			case <-timeout:
+				t.Fatalf("Expected: frames from %v, got %v\n", want, got)
+			}
+		}
+	}
+	seen(names...)
+	reg.Get("hall").Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for reg.Err("hall") == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected: hall to fail")
+		}
+		select {
+		case <-stream:
+		case <-time.After(time.Millisecond):
+		}
+	}
+	if err := reg.Err("hall"); !errors.Is(err, ErrConnectionClosed) {
+		t.Errorf("Expected: %v, got %v\n", ErrConnectionClosed, err)
+	}
+	// the others carry on
+	seen("bedroom", "kitchen")
+	if err := reg.Err("bedroom"); err != nil {
+		t.Errorf("Expected: bedroom running, got %v\n", err)
+	}
+	if s := reg.DeviceStats(); s["kitchen"].FramesOK == 0 || reg.Stats().FramesOK < s["kitchen"].FramesOK+s["bedroom"].FramesOK {
+		t.Errorf("Expected: frames counted per device and in total, got %+v %+v\n", s, reg.Stats())
+	}
+
+	cancel()
+	go func() {
+		for range stream {
+		}
+	}()
+	err := reg.Wait()
+	var derr *DeviceError
+	if !errors.As(err, &derr) || derr.Name != "hall" || !errors.Is(err, ErrConnectionClosed) {
+		t.Errorf("Expected: DeviceError for hall, got %v\n", err)
+	}
+	for _, name := range []string{"bedroom", "kitchen"} {
+		if err := reg.Err(name); err != nil {
+			t.Errorf("Expected: %s stopped by its context, got %v\n", name, err)
+		}
+	}
+}
+
+func TestRegistryAddRemoveRunning(t *testing.T) {
+	reg := NewRegistry()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := reg.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	dev := openSimulated(t)
+	defer dev.Close()
+	if err := reg.Add("late", dev); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case resp := <-reg.Respiration():
+		if resp.Name != "late" {
+			t.Errorf("Expected: late, got %s\n", resp.Name)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected: a frame from a device added while running")
+	}
+	if got := reg.Remove("late"); got != dev {
+		t.Errorf("Expected: the removed device, got %v\n", got)
+	}
+	if reg.Get("late") != nil || reg.Remove("late") != nil {
+		t.Error("Expected: late removed")
+	}
+	cancel()
+	if err := reg.Wait(); err != nil {
+		t.Errorf("Expected: no errors, got %v\n", err)
+	}
+}
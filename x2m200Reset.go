@@ -20,9 +20,11 @@
 package xethru
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"io"
-	"log"
+	"time"
 )
 
 const (
@@ -30,7 +32,7 @@ const (
 )
 
 // Reset should be the first to be called when connecting to the X2M200 sensor
-func (x x2m200Frame) Reset() (bool, error) {
+func (x *x2m200Frame) Reset() (bool, error) {
 	last := "disableBaseBand"
 
 disableBaseBand:
@@ -82,7 +84,7 @@ reRead:
 	switch state.(type) {
 	case SystemMessage:
 		s := state.(SystemMessage)
-		if s.Message == "Command Ack'ed" {
+		if s.Message == messageAck {
 			if last == "reset" {
 				// log.Println("Yay we got there")
 				return true, nil
@@ -98,7 +100,7 @@ reRead:
 	// case Sleep:
 	// 	// TODO DISABLE Sleep
 	default:
-		log.Printf("\n\n%#+v\n\n", state)
+		frameLogger(x).Debugf("reset: unexpected state %#+v", state)
 		goto reRead
 
 	}
@@ -108,3 +110,59 @@ reRead:
 
 var errResetNotEnoughBytes = errors.New("reset not enough bytes in response")
 var errResetResponseError = errors.New("reset did not contain a correct response")
+
+// defaultResetHold is how long HardReset holds the reset line by default.
+const defaultResetHold = 100 * time.Millisecond
+
+// resetTimeout returns ResetTimeout, or 5 seconds if it is not set.
+func (r *Module) resetTimeout() time.Duration {
+	if r.ResetTimeout > 0 {
+		return r.ResetTimeout
+	}
+	return resetTimeout
+}
+
+// SoftReset sends the protocol reset command and waits ResetTimeout for the
+// sensor to be ready. Some carrier boards do not pass the command on
+// reliably, see HardReset.
+func (r *Module) SoftReset() error {
+	if _, err := r.exchange([]byte{resetCmd}, r.resetTimeout(), isReady); err != nil {
+		return fmt.Errorf("soft reset failed: %w", err)
+	}
+	r.setAsleep(false)
+	r.restartStates()
+	return nil
+}
+
+// HardReset resets the sensor with its reset line, such as DTR or RTS of the
+// serial port, which the package can not drive itself. toggle(true) asserts
+// the line, holding the sensor in reset, and toggle(false) releases it, they
+// are held apart by hold, 100ms if it is zero. It then waits ResetTimeout for the
+// sensor to be ready. Unlike the other commands it works while the module is
+// asleep.
+func (r *Module) HardReset(toggle func(assert bool) error, hold time.Duration) error {
+	if hold <= 0 {
+		hold = defaultResetHold
+	}
+	if err := toggle(true); err != nil {
+		return fmt.Errorf("hard reset failed: asserting reset line: %w", err)
+	}
+	timer := clock().NewTimer(hold)
+	<-timer.C()
+	r.startReader()
+	r.dispatcher.markReset()
+	// the ready message is not the late response to a soft reset
+	r.dispatcher.forgetAbandoned()
+	_, err := r.dispatcher.exchangeFunc(context.Background(), func() error {
+		if err := toggle(false); err != nil {
+			return fmt.Errorf("releasing reset line: %w", err)
+		}
+		return nil
+	}, r.resetTimeout(), isReady)
+	if err != nil {
+		return fmt.Errorf("hard reset failed: %w", err)
+	}
+	r.setAsleep(false)
+	r.restartStates()
+	return nil
+}
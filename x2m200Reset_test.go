@@ -0,0 +1,120 @@
+package xethru
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// resetLineSensor is a SimulatedSensor with a reset line, it may ignore the
+// reset command as a sensor behind some carrier boards does.
+type resetLineSensor struct {
+	*SimulatedSensor
+	ignoreSoft bool
+	dead       bool // does not boot after a hardware reset
+
+	mu       sync.Mutex
+	line     []bool
+	asserted time.Time
+	held     time.Duration
+}
+
+func (s *resetLineSensor) Write(p []byte) (int, error) {
+	if s.ignoreSoft && len(p) == 1 && p[0] == resetCmd {
+		return len(p), nil
+	}
+	return s.SimulatedSensor.Write(p)
+}
+
+func (s *resetLineSensor) toggle(assert bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.line = append(s.line, assert)
+	if assert {
+		s.asserted = time.Now()
+		return nil
+	}
+	s.held = time.Since(s.asserted)
+	if !s.dead {
+		s.Reboot()
+	}
+	return nil
+}
+
+func TestReset(t *testing.T) {
+	errLine := errors.New("no such line")
+	cases := []struct {
+		ignoreSoft bool
+		dead       bool
+		withLine   bool
+		toggleErr  error
+		line       []bool
+		err        []error
+	}{
+		{false, false, true, nil, nil, nil},
+		{true, false, true, nil, []bool{true, false}, nil},
+		{true, false, false, nil, nil, []error{ErrCommandTimeout}},
+		{true, true, true, nil, []bool{true, false}, []error{ErrCommandTimeout}},
+		{true, false, true, errLine, nil, []error{ErrCommandTimeout, errLine}},
+	}
+	for n, c := range cases {
+		sim := NewSimulatedSensor()
+		sensor := &resetLineSensor{SimulatedSensor: sim, ignoreSoft: c.ignoreSoft, dead: c.dead}
+		m := NewModule(sensor, "respiration")
+		m.ResetTimeout = 50 * time.Millisecond
+		m.ResetHold = 10 * time.Millisecond
+		if c.withLine {
+			m.ResetLine = sensor.toggle
+			if c.toggleErr != nil {
+				m.ResetLine = func(bool) error { return c.toggleErr }
+			}
+		}
+		err := m.Reset()
+		if len(c.err) == 0 && err != nil {
+			t.Errorf("test %d Expected: <nil>, got %v\n", n, err)
+		}
+		for _, want := range c.err {
+			if !errors.Is(err, want) {
+				t.Errorf("test %d Expected: %v, got %v\n", n, want, err)
+			}
+		}
+		sensor.mu.Lock()
+		if len(sensor.line) != len(c.line) {
+			t.Errorf("test %d Expected: line %v, got %v\n", n, c.line, sensor.line)
+		}
+		if len(c.line) > 0 && sensor.held < m.ResetHold {
+			t.Errorf("test %d Expected: line held for %v, got %v\n", n, m.ResetHold, sensor.held)
+		}
+		sensor.mu.Unlock()
+		sim.Close()
+	}
+}
+
+func TestHardResetAsleep(t *testing.T) {
+	sim := NewSimulatedSensor()
+	sensor := &resetLineSensor{SimulatedSensor: sim}
+	defer sim.Close()
+	m := NewModule(sensor, "respiration")
+	m.Timeout = 100 * time.Millisecond
+	m.ResetTimeout = 100 * time.Millisecond
+	if err := m.enterSleep(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Load(); !errors.Is(err, errModuleAsleep) {
+		t.Fatalf("Expected: %v, got %v\n", errModuleAsleep, err)
+	}
+	// zero hold is the default
+	if err := m.HardReset(sensor.toggle, 0); err != nil {
+		t.Fatal(err)
+	}
+	if m.isAsleep() {
+		t.Errorf("Expected: awake after a hard reset\n")
+	}
+	if sensor.held < defaultResetHold {
+		t.Errorf("Expected: line held for %v, got %v\n", defaultResetHold, sensor.held)
+	}
+	if err := m.Load(); err != nil {
+		t.Errorf("Expected: <nil>, got %v\n", err)
+	}
+}
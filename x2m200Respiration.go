@@ -1,9 +1,10 @@
 package xethru
 
 import (
+	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
-	"log"
 	"math"
 	"time"
 )
@@ -34,22 +35,30 @@ const (
 	someotherState respirationState = 7
 )
 
+// NewModuleDispatcher creates a module that shares d with other modules
+// instead of reading from the Framer directly.
+func NewModuleDispatcher(d *Dispatcher, mode string) *Module {
+	m := NewModule(d.f, mode)
+	m.dispatcher = d
+	return m
+}
+
 // NewModule creates
 func NewModule(f Framer, mode string) *Module {
-	var appID [4]byte
+	var appID AppID
 	// parser := parse
 	switch mode {
 	case "respiration":
-		appID = [4]byte{0xd6, 0xa2, 0x23, 0x14}
+		appID = AppRespiration
 		// parser = parse
 	case "sleep":
-		log.Println("Loading Sleep Module")
-		appID = [4]byte{0x17, 0x7b, 0xf1, 0x00}
+		frameLogger(f).Debugf("loading sleep module")
+		appID = AppSleep
 		// parser = parse
-	case "basebandiq":
-		appID = [4]byte{0x14, 0x23, 0xa2, 0xd6}
-	case "basebandampphase":
-		appID = [4]byte{0x14, 0x23, 0xa2, 0xd6}
+	case "basebandiq", "basebandampphase":
+		// baseband is streamed alongside the respiration app, whose ID
+		// was written big endian here unlike every other AppID
+		appID = AppRespiration
 	}
 	module := &Module{
 		f:       f,
@@ -61,11 +70,47 @@ func NewModule(f Framer, mode string) *Module {
 	return module
 }
 
-// Reset is
-// func (r *Module) Reset() (bool, error) {
-// 	log.Println("Called Reset")
-// 	return r.f.Reset()
-// }
+// resetTimeout is how long Reset waits for the sensor to boot.
+const resetTimeout = 5 * time.Second
+
+// Reset resets the sensor with SoftReset. If the sensor does not come back
+// and ResetLine is set it falls back to HardReset, holding the line for
+// ResetHold, and only fails if that fails too.
+func (r *Module) Reset() error {
+	err := r.SoftReset()
+	if err == nil || r.ResetLine == nil {
+		return err
+	}
+	r.log().Warnf("%v, trying a hardware reset", err)
+	if hardErr := r.HardReset(r.ResetLine, r.ResetHold); hardErr != nil {
+		return errors.Join(err, hardErr)
+	}
+	return nil
+}
+
+// ResetAndWait sends the reset command then waits up to timeout for the
+// sensor to send the system ready message. The booting message, acks and
+// any other frames received before it are discarded.
+// Example: <Start> + <XTS_SPC_MOD_RESET> + <CRC> + <End>
+// Response: <Start> + <XTS_SPR_SYSTEM> + <XTS_SPRS_READY> + <CRC> + <End>
+func (r *Module) ResetAndWait(timeout time.Duration) error {
+	if _, err := r.exchange([]byte{resetCmd}, timeout, isReady); err != nil {
+		return fmt.Errorf("reset failed: %w", err)
+	}
+	r.restartStates()
+	return nil
+}
+
+// loadAttempts is how many times Load sends the load command to a sensor
+// that is still booting.
+const loadAttempts = 2
+
+var errLoadBooting = errors.New("sensor still booting")
+
+// isReady reports whether p is the system ready message.
+func isReady(p []byte) bool {
+	return len(p) > 1 && p[0] == systemMesg && p[1] == systemReady
+}
 
 type ledMode byte
 
@@ -86,126 +131,59 @@ const x2m200SetLEDControl = 0x24
 // Example: <Start> + <XTS_SPC_MOD_SETLEDCONTROL> + <Mode> + <Reserved> + <CRC> + <End>
 // Response: <Start> + <XTS_SPR_ACK> + <CRC> + <End>
 func (r *Module) SetLEDMode() error {
-	// if r.LEDMode == nil {
-	// 	r.LEDMode == LEDOff
-	// }
-	log.Println("Setting LED MODE")
-	n, err := r.f.Write([]byte{x2m200SetLEDControl, byte(r.LEDMode), 0x00})
+	r.log().Debugf("setting led mode %d", r.LEDMode)
+	_, err := r.Execute(r.ledModeCmd(), x2m200Ack, r.Timeout)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to set led mode: %w", err)
 	}
+	return nil
+}
 
-	attempts := 0
-reRead:
-	b := make([]byte, 2048)
-	n, err = r.f.Read(b)
-	if err != nil {
-		log.Printf("Reset read Error %v, number of bytes %d\n", err, n)
-		return err
-	}
-	state, err := parse(b[:n])
-	if err != nil {
-		log.Printf("Parse read Error %v, state %#+v \n", err, state)
-		return err
-	}
-	// log.Printf("Debug state %#+v \n", state)
-	switch state.(type) {
-	case SystemMessage:
-		s := state.(SystemMessage)
-		if s.Message == "Command Ack'ed" {
-			return nil
-		}
-	default:
-		if attempts < 20 {
-			attempts++
-			goto reRead
-		}
-
-	}
-	return fmt.Errorf("failed to set led mode\n")
-
-	// b := make([]byte, 1024)
-	// n, err = r.f.Read(b)
-	// if err != nil {
-	// 	log.Println(err, n)
-	// }
-	// if b[0] != x2m200Ack {
-	// 	log.Println("Not Ack")
-	// }
+func (r *Module) ledModeCmd() []byte {
+	return []byte{x2m200SetLEDControl, byte(r.LEDMode), 0x00}
 }
 
 const (
 	x2m200AppCommand = 0x10
 	x2m200Set        = 0x10
+	x2m200Get        = 0x11
 )
 
-var x2m200DetectionZone = [4]byte{0x96, 0xa1, 0x0a, 0x1c}
-
-// var x2m200DetectionZone = [4]byte{0x1c, 0x0a, 0xa1, 0x96}
+// x2m200DetectionZone is XTS_ID_DETECTION_ZONE, sent little endian like the
+// start and end floats.
+const x2m200DetectionZone uint32 = 0x96a10a1c
 
 // SetDetectionZone is
 // Example: <Start> + <XTS_SPC_APPCOMMAND> + <XTS_SPCA_SET> + [XTS_ID_DETECTION_ZONE(i)] + [Start(f)] + [End(f)] + <CRC> + <End>
 // Response: <Start> + <XTS_SPR_ACK> + <CRC> + <End>
-func (r Module) SetDetectionZone(start, end float64) error {
-	log.Printf("Setting Detection zone starting at %2.2fm ending at %2.2fm\n", start, end)
+// If VerifyZone is set the zone is read back with GetDetectionZone, see
+// verifyDetectionZone.
+func (r *Module) SetDetectionZone(start, end float64) error {
+	r.log().Debugf("setting detection zone starting at %2.2fm ending at %2.2fm", start, end)
+	if math.IsNaN(start) || math.IsNaN(end) || start < 0 || end <= start {
+		return fmt.Errorf("%w: %2.2f %2.2f", ErrInvalidDetectionZone, start, end)
+	}
 
 	r.DetectionZoneStart = float32(start)
 	r.DetectionZoneEnd = float32(end)
 
-	startbytes := make([]byte, 4)
-	endbytes := make([]byte, 4)
-
-	binary.LittleEndian.PutUint32(startbytes, math.Float32bits(r.DetectionZoneStart))
-	binary.LittleEndian.PutUint32(endbytes, math.Float32bits(r.DetectionZoneEnd))
-
-	// n, err := r.f.Write([]byte{x2m200AppCommand, x2m200Set, x2m200DetectionZone[0], x2m200DetectionZone[1], x2m200DetectionZone[2], x2m200DetectionZone[3], startbytes[0], startbytes[1], startbytes[2], startbytes[3], endbytes[0], endbytes[1], endbytes[2], endbytes[3]})
-
-	n, err := r.f.Write([]byte{0x10, 0x10, 0x1c, 0x0a, 0xa1, 0x96, startbytes[0], startbytes[1], startbytes[2], startbytes[3], endbytes[0], endbytes[1], endbytes[2], endbytes[3]})
-	if err != nil {
-		return err
-		// log.Println(err, n)
-	}
-
-	attempts := 0
-reRead:
-	b := make([]byte, 2048)
-	n, err = r.f.Read(b)
-	if err != nil {
-		log.Printf("Reset read Error %v, number of bytes %d\n", err, n)
-		return err
+	if _, err := r.Execute(r.detectionZoneCmd(), x2m200Ack, r.Timeout); err != nil {
+		return fmt.Errorf("failed to set detection zone %2.2f %2.2f: %w", start, end, err)
 	}
-	state, err := parse(b[:n])
-	if err != nil {
-		log.Printf("Parse read Error %v, state %#+v \n", err, state)
-		return err
+	r.startSettling()
+	r.restartStates()
+	if r.VerifyZone {
+		return r.verifyDetectionZone(start, end)
 	}
-	// log.Printf("Debug state %#+v \n", state)
-	switch state.(type) {
-	case SystemMessage:
-		s := state.(SystemMessage)
-		if s.Message == "Command Ack'ed" {
-			return nil
-		}
-	default:
-		if attempts < 20 {
-			attempts++
-			goto reRead
-		}
-
-	}
-	return fmt.Errorf("failed to set detection zone %2.2f %2.2f\n", start, end)
+	return nil
 }
 
-// b := make([]byte, 1024)
-// n, err = r.f.Read(b)
-// if err != nil {
-// 	log.Println(err, n)
-// }
-// if b[0] != x2m200Ack {
-// 	log.Printf("%#02x\n", b[0:n])
-// 	log.Println("Not Ack")
-// }
-// }
+func (r *Module) detectionZoneCmd() []byte {
+	cmd := []byte{x2m200AppCommand, x2m200Set}
+	cmd = binary.LittleEndian.AppendUint32(cmd, x2m200DetectionZone)
+	cmd = binary.LittleEndian.AppendUint32(cmd, math.Float32bits(r.DetectionZoneStart))
+	return binary.LittleEndian.AppendUint32(cmd, math.Float32bits(r.DetectionZoneEnd))
+}
 
 // var x2m200Sensitivity = [4]byte{0x10, 0xa5, 0x11, 0x2b}
 var x2m200Sensitivity = [4]byte{0x2b, 0x11, 0xa5, 0x10}
@@ -213,7 +191,7 @@ var x2m200Sensitivity = [4]byte{0x2b, 0x11, 0xa5, 0x10}
 // SetSensitivity is
 // Example: <Start> + <XTS_SPC_APPCOMMAND> + <XTS_SPCA_SET> + [XTS_ID_SENSITIVITY(i)] + [Sensitivity(i)]+ <CRC> + <End>
 // Response: <Start> + <XTS_SPR_ACK> + <CRC> + <End>
-func (r Module) SetSensitivity(sensitivity int) error {
+func (r *Module) SetSensitivity(sensitivity int) error {
 
 	if sensitivity > 9 {
 		sensitivity = 9
@@ -223,41 +201,18 @@ func (r Module) SetSensitivity(sensitivity int) error {
 	}
 
 	r.Sensitivity = uint32(sensitivity)
-	sensitivitybytes := make([]byte, 4)
-	binary.LittleEndian.PutUint32(sensitivitybytes, r.Sensitivity)
-
-	n, err := r.f.Write([]byte{x2m200AppCommand, x2m200Set, x2m200Sensitivity[0], x2m200Sensitivity[1], x2m200Sensitivity[2], x2m200Sensitivity[3], sensitivitybytes[0], sensitivitybytes[1], sensitivitybytes[2], sensitivitybytes[3]})
-	if err != nil {
-		log.Println(err, n)
-	}
-	attempts := 0
-reRead:
-	b := make([]byte, 2048)
-	n, err = r.f.Read(b)
+	_, err := r.Execute(r.sensitivityCmd(), x2m200Ack, r.Timeout)
 	if err != nil {
-		log.Printf("Reset read Error %v, number of bytes %d\n", err, n)
-		return err
+		return fmt.Errorf("failed to set sensitivity %d: %w", sensitivity, err)
 	}
-	state, err := parse(b[:n])
-	if err != nil {
-		log.Printf("Parse read Error %v, state %#+v \n", err, state)
-		return err
-	}
-	// log.Printf("Debug state %#+v \n", state)
-	switch state.(type) {
-	case SystemMessage:
-		s := state.(SystemMessage)
-		if s.Message == "Command Ack'ed" {
-			return nil
-		}
-	default:
-		if attempts < 20 {
-			attempts++
-			goto reRead
-		}
+	r.startSettling()
+	r.restartStates()
+	return nil
+}
 
-	}
-	return fmt.Errorf("failed to set sensitivity %d\n", sensitivity)
+func (r *Module) sensitivityCmd() []byte {
+	cmd := []byte{x2m200AppCommand, x2m200Set, x2m200Sensitivity[0], x2m200Sensitivity[1], x2m200Sensitivity[2], x2m200Sensitivity[3]}
+	return binary.LittleEndian.AppendUint32(cmd, r.Sensitivity)
 }
 
 const (
@@ -268,159 +223,235 @@ const (
 // Load is
 // Example: <Start> + <XTS_SPC_MOD_LOADAPP> + [AppID(i)] + <CRC> + <End>
 // Response: <Start> + <XTS_SPR_ACK> + <CRC> + <End>
-func (r Module) Load() error {
-load:
-	n, err := r.f.Write([]byte{x2m200LoadModule, r.AppID[0], r.AppID[1], r.AppID[2], r.AppID[3]})
-	if err != nil {
-		log.Println(err, n)
-		return err
-	}
-	attempts := 0
-reRead:
-	b := make([]byte, 2048)
-	n, err = r.f.Read(b)
-	if err != nil {
-		log.Printf("Reset read Error %v, number of bytes %d\n", err, n)
-		return err
+// The module's AppID is loaded unless an id is given, which becomes the
+// AppID. An all zero AppID is an ErrInvalidAppID. A sensor that is still
+// booting answers with the ready message instead of an ack, the load is then
+// sent once more.
+func (r *Module) Load(id ...AppID) error {
+	if len(id) > 0 {
+		r.AppID = id[0]
 	}
-	state, err := parse(b[:n])
-	if err != nil {
-		log.Printf("Parse read Error %v, state %#+v \n", err, state)
-		return err
+	if r.AppID == (AppID{}) {
+		return fmt.Errorf("did not load module: %w", ErrInvalidAppID)
 	}
-	// log.Printf("Debug state %#+v \n", state)
-	switch state.(type) {
-	case SystemMessage:
-		s := state.(SystemMessage)
-		if s.Message == "Command Ack'ed" {
-			return nil
-		}
-		if s.Message == "System Still booting" {
-			if attempts < 20 {
-				goto reRead
-			}
+	r.log().Debugf("loading %v", r.AppID)
+	cmd := []byte{x2m200LoadModule, r.AppID[0], r.AppID[1], r.AppID[2], r.AppID[3]}
+	for attempt := 1; ; attempt++ {
+		resp, err := r.exchange(cmd, r.Timeout, func(p []byte) bool {
+			return len(p) > 0 && p[0] == x2m200Ack || isReady(p)
+		})
+		if err != nil {
+			return fmt.Errorf("did not recive ack for load module: %w", err)
 		}
-		if s.Message == "System Ready" {
-			if attempts < 20 {
-				goto load
-			}
+		if !isReady(resp) {
+			break
 		}
-		// return x.Reset()
-	default:
-		if attempts < 20 {
-			goto reRead
+		// a load sent while the sensor is still booting is lost, the
+		// sensor says it is ready instead, so it is sent once more
+		if attempt == loadAttempts {
+			return fmt.Errorf("did not recive ack for load module: %w", errLoadBooting)
 		}
-
+		r.log().Debugf("sensor was booting, loading %v again", r.AppID)
 	}
-
-	return fmt.Errorf("did not recive ack for load module\n")
+	r.setProfile(r.AppID)
+	r.restartStates()
+	return nil
 }
 
+// Enable is
 // <Start> + <XTS_SPC_DIR_COMMAND> + <XTS_SDC_APP_SETINT> + [XTS_SACR_OUTPUTBASEBAND(i)] + [Length(i)] + [EnableCode(i)] + <CRC> + <End> Response: <Start> + <XTS_SPR_ACK> + <CRC> + <End>
-func (r Module) Enable(mode string) error {
+func (r *Module) Enable(mode string) error {
+	var cmd []byte
 	switch mode {
 	case "phase":
-		log.Println("Enable Phase Amp Baseband")
-		n, err := r.f.Write([]byte{0x90, 0x71, 0x10, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00})
-
-		if err != nil {
-			log.Println(err, n)
-			return err
-		}
+		r.log().Debugf("enable amplitude/phase baseband")
+		cmd = []byte{0x90, 0x71, 0x10, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00}
 	case "iq":
-		log.Println("Enable IQ Baseband")
-
-		n, err := r.f.Write([]byte{0x90, 0x71, 0x02, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00})
-
-		if err != nil {
-			log.Println(err, n)
-			return err
-		}
+		r.log().Debugf("enable IQ baseband")
+		cmd = []byte{0x90, 0x71, 0x02, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00}
 	default:
-		log.Println("Disable Baseband")
-
-		n, err := r.f.Write([]byte{0x90, 0x71, 0x02, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00})
-
-		if err != nil {
-			log.Println(err, n)
-			return err
-		}
+		r.log().Debugf("disable baseband")
+		cmd = []byte{0x90, 0x71, 0x02, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
 	}
 
-	attempts := 0
-reRead:
-	b := make([]byte, 2048)
-	n, err := r.f.Read(b)
-	if err != nil {
-		log.Printf("Reset read Error %v, number of bytes %d\n", err, n)
-		return err
-	}
-	state, err := parse(b[:n])
+	_, err := r.Execute(cmd, x2m200Ack, r.Timeout)
 	if err != nil {
-		log.Printf("Parse read Error %v, state %#+v \n", err, state)
-		return err
+		return fmt.Errorf("failed to set Enable %s mode: %w", mode, err)
 	}
-	// log.Printf("Debug state %#+v \n", state)
-	switch state.(type) {
-	case SystemMessage:
-		s := state.(SystemMessage)
-		if s.Message == "Command Ack'ed" {
-			return nil
-		}
-	default:
-		if attempts < 20 {
-			attempts++
-			goto reRead
-		}
+	return nil
+}
 
+// Run start app, data frames are parsed and sent on stream until the
+// connection to the sensor is lost. Respiration frames are also passed to
+// the handlers and subscribers, stream may be nil if only they are used.
+// Frames that fail to parse are not sent, their errors go to OnError. If the
+// sensor reboots by itself Run restores it, see ModuleRebooted. After a
+// settings change frames may be Settling, see SettleTime and Settled, and
+// with Transitions set illegal state transitions are reported, see
+// AnomalousTransition. Frames are also written to the sink attached by
+// AttachSink.
+// Only one Run may be running at a time, a second returns straight away.
+// Once Run has returned it may be called again.
+func (r *Module) Run(stream chan interface{}) {
+	if err := r.RunContext(context.Background(), stream); err == ErrModuleRunning {
+		r.log().Errorf("%v", err)
 	}
-	return fmt.Errorf("failed to set Enable %s mode", mode)
 }
 
-// 	b := make([]byte, 1024)
-// 	n, err := r.f.Read(b)
-// 	if err != nil {
-// 		log.Println(err, n)
-// 		return err
-// 	}
-// 	if b[0] != x2m200Ack {
-// 		log.Printf("%#02x\n", b[0:n])
-// 		log.Println("Not Ack")
-// 		return errors.New("error enable Phase Amp Baseband was not ack'ed")
-// 	}
-// 	return nil
-// }
-
-// Run start app
-func (r Module) Run(stream chan interface{}) {
-	defer r.f.Write([]byte{0x20, 0x11})
-
-	n, err := r.f.Write([]byte{0x20, 0x01})
-	if err != nil {
-		log.Println(err, n)
+// RunContext is Run that also returns when ctx is done, returning ctx.Err().
+// A frame waiting for the stream consumer is dropped when ctx is done or the
+// connection is lost, so a consumer that stops reading does not hold up Run.
+// Run does not close stream. If Run is already running it returns
+// ErrModuleRunning.
+//
+// If StreamBuffer is set frames are queued for stream in a ring of that many
+// frames, and StreamPolicy says what happens when it is full. Frames still
+// queued when the connection is lost are delivered before RunContext
+// returns, unless ctx is done or the consumer does not take one within
+// Timeout, when the rest are dropped.
+func (r *Module) RunContext(ctx context.Context, stream chan interface{}) error {
+	if err := r.startRun(); err != nil {
+		return err
+	}
+	defer r.stopRun()
+	defer r.startSink(ctx)()
+	defer r.Execute([]byte{0x20, 0x11}, x2m200Ack, r.Timeout)
+	defer r.broadcast.close()
+	defer r.closeMovingList()
+
+	var ring *frameRing
+	if stream != nil && r.StreamBuffer > 0 {
+		ring = newFrameRing(r.StreamBuffer, r.StreamPolicy)
+		stop, drained := make(chan struct{}), make(chan struct{})
+		go func() {
+			if n := ring.drain(ctx, stream, stop, r.Timeout); n > 0 {
+				r.drop(n)
+			}
+			close(drained)
+		}()
+		defer func() {
+			close(stop)
+			<-drained
+		}()
 	}
 
-	output := make(chan []byte, 1000)
+	r.startReader()
+	if _, err := r.Execute(x2m200StartApp, x2m200Ack, r.Timeout); err != nil {
+		r.log().Errorf("failed to start app: %v", err)
+		r.handleError(err)
+	}
+	r.restartStates()
 
-	go func(out chan []byte) {
-		for {
-			b := make([]byte, 2048)
-			n, err := r.f.Read(b)
-			if err != nil {
-				log.Println(err)
+	for {
+		var out Frame
+		select {
+		case f, ok := <-r.frames:
+			if !ok {
+				return nil
+			}
+			out = f
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		data, err := out.Data, out.ParseErr
+		if out.Type == FrameSystem {
+			if data = r.systemMessage(out.Payload); data == nil {
+				continue
+			}
+		} else if data == nil && err == nil {
+			data, err = r.parseFrame(out)
+		}
+		if chunk, ok := data.(pulseDopplerChunk); ok {
+			// the layout is unverified, see pulseDopplerFloatID
+			if err = r.assemblePulseDoppler(chunk); err == nil {
+				continue
+			}
+		}
+		if err == nil {
+			err = r.limits().Check(data)
+		}
+		if r.KeepRaw && err == nil {
+			data = withRaw(data, out.Payload)
+		}
+		if err != nil {
+			r.log().Warnf("%v", err)
+			r.metrics().Counter(MetricParseErrors, 1)
+			r.handleError(err)
+			continue
+		}
+		if r.DropDuplicates && r.duplicate(out.Type, data) {
+			continue
+		}
+		if resp, ok := data.(Respiration); ok {
+			m := r.metrics()
+			m.Counter(MetricRespirationFrames, 1)
+			r.observeRate()
+			valid := resp.Valid
+			if !r.gate(&resp) {
+				continue
+			}
+			if settled := r.settle(&resp); settled != nil {
+				if ok, err := r.deliver(ctx, stream, ring, *settled); !ok {
+					return err
+				}
+			}
+			if anomaly := r.checkTransition(resp); anomaly != nil {
+				if ok, err := r.deliver(ctx, stream, ring, *anomaly); !ok {
+					return err
+				}
 			}
-			out <- b[:n]
+			if resp.Valid && !resp.Settling {
+				m.Gauge(MetricRespirationRPM, float64(resp.RPM))
+				m.Gauge(MetricRespirationDistance, resp.Distance)
+			}
+			if resp.Valid != valid || resp.Settling {
+				// only box the frame again when the gate or settling changed it
+				data = resp
+			}
+			r.setLatest(resp)
+			r.handleRespiration(resp)
+			r.broadcast.publish(resp)
+		} else if list, ok := data.(movingList); ok {
+			// the layout is unverified, see movingListID
+			r.publishMovingList(list)
+			continue
+		}
+		if err := r.teeSink(ctx, data); err != nil {
+			return err
 		}
-	}(output)
+		if ok, err := r.deliver(ctx, stream, ring, data); !ok {
+			return err
+		}
+	}
+}
 
-	for {
+// deliver sends data on Run's stream, or queues it in ring if there is one.
+// It reports false, with the error for Run to return, when Run should stop.
+func (r *Module) deliver(ctx context.Context, stream chan interface{}, ring *frameRing, data interface{}) (bool, error) {
+	switch {
+	case stream == nil:
+	case ring != nil:
+		dropped, err := ring.push(ctx, data, r.dispatcher.Done())
+		if err != nil {
+			return false, err
+		}
+		if dropped {
+			r.drop(1)
+		}
+	default:
+		// prefer delivery, only give up on a consumer that is not reading
 		select {
-		case out := <-output:
-			data, err := parse(out)
-			if err != nil {
-				log.Println(err)
-			}
-			stream <- data
+		case stream <- data:
+			return true, nil
+		default:
+		}
+		select {
+		case stream <- data:
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-r.dispatcher.Done():
+			return false, nil
 		}
 	}
+	return true, nil
 }
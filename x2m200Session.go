@@ -0,0 +1,186 @@
+package xethru
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+// Respiration session file format
+// magic "XRSP" + version byte, followed by records of
+// offset(int64 nanoseconds since the first frame) + a frame written by
+// WriteFrameTo, all little endian.
+const (
+	sessionMagic   = "XRSP"
+	sessionVersion = 0x01
+)
+
+// RespirationRecorder writes respiration frames and their timing to a
+// session file that a RespirationPlayer can replay. The timing is taken from
+// each frame's Time.
+type RespirationRecorder struct {
+	w     io.Writer
+	first int64
+	n     int
+	err   error // first error recording in Tee
+}
+
+// NewRespirationRecorder writes the session header to w and returns a
+// RespirationRecorder writing to it.
+func NewRespirationRecorder(w io.Writer) (*RespirationRecorder, error) {
+	if _, err := w.Write(append([]byte(sessionMagic), sessionVersion)); err != nil {
+		return nil, err
+	}
+	return &RespirationRecorder{w: w}, nil
+}
+
+// Record writes r to the session.
+func (rec *RespirationRecorder) Record(r Respiration) error {
+	if rec.n == 0 {
+		rec.first = r.Time
+	}
+	rec.n++
+	var offset [8]byte
+	binary.LittleEndian.PutUint64(offset[:], uint64(r.Time-rec.first))
+	if _, err := rec.w.Write(offset[:]); err != nil {
+		return err
+	}
+	return WriteFrameTo(rec.w, r)
+}
+
+// Tee records every Respiration received on in and passes everything on to
+// the returned channel, which is closed when in is closed. Recording stops at
+// the first write error, which is returned by Err.
+func (rec *RespirationRecorder) Tee(in <-chan interface{}) <-chan interface{} {
+	out := make(chan interface{})
+	go func() {
+		defer close(out)
+		for v := range in {
+			if r, ok := v.(Respiration); ok && rec.err == nil {
+				rec.err = rec.Record(r)
+			}
+			out <- v
+		}
+	}()
+	return out
+}
+
+// Err returns the error that stopped Tee recording, it is safe to call once
+// the channel returned by Tee is closed.
+func (rec *RespirationRecorder) Err() error {
+	return rec.err
+}
+
+type sessionFrame struct {
+	offset time.Duration
+	r      Respiration
+}
+
+// RespirationPlayer replays a session recorded by a RespirationRecorder,
+// sending the frames on a stream like Module.Run with their original spacing
+// divided by Speed. A Speed of zero or less replays as fast as possible.
+type RespirationPlayer struct {
+	Speed   float64
+	Loop    bool // start again at the end of the session
+	Restamp bool // set Time to when the frame is replayed instead of when it was recorded
+	Data    chan interface{}
+
+	frames []sessionFrame
+}
+
+// NewRespirationPlayer reads the session from r and returns a player for it.
+func NewRespirationPlayer(r io.Reader) (*RespirationPlayer, error) {
+	header := make([]byte, len(sessionMagic)+1)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if string(header[:len(sessionMagic)]) != sessionMagic {
+		return nil, errSessionBadMagic
+	}
+	if header[len(sessionMagic)] != sessionVersion {
+		return nil, errSessionBadVersion
+	}
+	p := &RespirationPlayer{Speed: 1}
+	for {
+		var offset [8]byte
+		if _, err := io.ReadFull(r, offset[:]); err == io.EOF {
+			return p, nil
+		} else if err != nil {
+			return nil, errSessionTruncated
+		}
+		v, err := ReadFrameFrom(r)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, errSessionTruncated
+		} else if err != nil {
+			return nil, err
+		}
+		resp, ok := v.(Respiration)
+		if !ok {
+			return nil, errSessionFrame
+		}
+		p.frames = append(p.frames, sessionFrame{
+			offset: time.Duration(binary.LittleEndian.Uint64(offset[:])),
+			r:      resp,
+		})
+	}
+}
+
+// Frames returns the number of frames in the session.
+func (p *RespirationPlayer) Frames() int {
+	return len(p.frames)
+}
+
+// Run sends the session's frames on stream, or on Data if stream is nil,
+// until the end of the session or, if Loop is set, until ctx is done. It
+// returns ctx.Err() if ctx ended the replay.
+func (p *RespirationPlayer) Run(ctx context.Context, stream chan interface{}) error {
+	if stream == nil {
+		stream = p.Data
+	}
+	if len(p.frames) == 0 {
+		return nil
+	}
+	var t *time.Timer // reused to pace every frame
+	for {
+		start := time.Now()
+		for _, f := range p.frames {
+			if p.Speed > 0 {
+				wait := time.Until(start.Add(time.Duration(float64(f.offset) / p.Speed)))
+				if wait > 0 {
+					if t == nil {
+						t = time.NewTimer(wait)
+						defer t.Stop()
+					} else {
+						t.Reset(wait)
+					}
+					select {
+					case <-t.C:
+					case <-ctx.Done():
+						return ctx.Err()
+					}
+				}
+			}
+			r := f.r
+			if p.Restamp {
+				r.Time = time.Now().UnixNano()
+			}
+			select {
+			case stream <- r:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if !p.Loop {
+			return nil
+		}
+	}
+}
+
+var (
+	errSessionBadMagic   = errors.New("not a respiration session")
+	errSessionBadVersion = errors.New("unsupported respiration session version")
+	errSessionTruncated  = errors.New("respiration session is truncated")
+	errSessionFrame      = errors.New("respiration session contains a frame that is not respiration")
+)
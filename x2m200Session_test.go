@@ -0,0 +1,136 @@
+package xethru
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var sessionFrames = []Respiration{
+	{Time: 1480000000000000000, Status: respApp, Counter: 1, State: initializing, RPM: 0, Distance: 0, SignalQuality: 0, Movement: 0},
+	{Time: 1480000000010000000, Status: respApp, Counter: 2, State: breathing, RPM: 14, Distance: 0.7123456789, SignalQuality: 9, Movement: 0.1, Valid: true},
+	{Time: 1480000000020000000, Status: respApp, Counter: 3, State: breathing, RPM: 15, Distance: 0.71, SignalQuality: 9, Movement: -0.25, Valid: true},
+	{Time: 1480000000030000000, Status: respApp, Counter: 4, State: movement, RPM: 15, Distance: 0.8, SignalQuality: 7, Movement: 3.5, Valid: true},
+}
+
+func TestRespirationRecorder(t *testing.T) {
+	var b bytes.Buffer
+	rec, err := NewRespirationRecorder(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := make(chan interface{})
+	out := rec.Tee(in)
+	go func() {
+		for _, r := range sessionFrames {
+			in <- r
+			in <- BaseBandIQ{}
+		}
+		close(in)
+	}()
+	n := 0
+	for range out {
+		n++
+	}
+	if err := rec.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if n != 2*len(sessionFrames) {
+		t.Errorf("Expected: %d frames passed on, got %d\n", 2*len(sessionFrames), n)
+	}
+	compareGolden(t, "respiration.session", b.Bytes())
+}
+
+func TestRespirationPlayer(t *testing.T) {
+	f, err := os.Open("testdata/respiration.session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	p, err := NewRespirationPlayer(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Frames() != len(sessionFrames) {
+		t.Fatalf("Expected: %d frames, got %d\n", len(sessionFrames), p.Frames())
+	}
+
+	tests := []struct {
+		speed   float64
+		restamp bool
+		min     time.Duration
+	}{
+		{speed: 0},
+		{speed: 1, min: 30 * time.Millisecond},
+		{speed: 3, min: 10 * time.Millisecond, restamp: true},
+	}
+	for n, test := range tests {
+		p.Speed = test.speed
+		p.Restamp = test.restamp
+		p.Data = make(chan interface{}, len(sessionFrames))
+		start := time.Now()
+		before := start.UnixNano()
+		if err := p.Run(context.Background(), nil); err != nil {
+			t.Fatal(err)
+		}
+		if took := time.Since(start); took < test.min {
+			t.Errorf("test %d Expected: at least %v, got %v\n", n, test.min, took)
+		}
+		close(p.Data)
+		i := 0
+		for v := range p.Data {
+			got := v.(Respiration)
+			want := sessionFrames[i]
+			if test.restamp {
+				if got.Time < before {
+					t.Errorf("test %d Expected: time after %d, got %d\n", n, before, got.Time)
+				}
+				got.Time = want.Time
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("test %d Expected: %v, got %v\n", n, want, got)
+			}
+			i++
+		}
+		if i != len(sessionFrames) {
+			t.Errorf("test %d Expected: %d frames, got %d\n", n, len(sessionFrames), i)
+		}
+	}
+}
+
+func TestRespirationPlayerLoop(t *testing.T) {
+	b, err := os.ReadFile("testdata/respiration.session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewRespirationPlayer(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Speed = 0
+	p.Loop = true
+	stream := make(chan interface{})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- p.Run(ctx, stream) }()
+	for n := 0; n < 3*len(sessionFrames); n++ {
+		r := (<-stream).(Respiration)
+		if want := sessionFrames[n%len(sessionFrames)].Counter; r.Counter != want {
+			t.Errorf("test %d Expected: %d, got %d\n", n, want, r.Counter)
+		}
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Expected: %v, got %v\n", context.Canceled, err)
+	}
+
+	if _, err := NewRespirationPlayer(bytes.NewReader(b[:len(b)-3])); err != errSessionTruncated {
+		t.Errorf("Expected: %v, got %v\n", errSessionTruncated, err)
+	}
+	if _, err := NewRespirationPlayer(bytes.NewReader([]byte("XETH\x01"))); err != errSessionBadMagic {
+		t.Errorf("Expected: %v, got %v\n", errSessionBadMagic, err)
+	}
+}
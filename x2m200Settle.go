@@ -0,0 +1,48 @@
+package xethru
+
+// Settled is sent on Run's stream when the settling window that follows a
+// detection zone or sensitivity change closes, before the first frame that
+// is no longer Settling.
+type Settled struct {
+	Time       int64 // when the window closed
+	Reacquired bool  // the sensor reported breathing or movement again, false if SettleTime ran out
+}
+
+// settleWindow is a settling window, each change opens a new one.
+type settleWindow struct {
+	until int64 // clock nanoseconds it closes
+}
+
+// startSettling opens a settling window, after a change the firmware takes a
+// few seconds to re-acquire during which its RPM and Distance are junk.
+func (r *Module) startSettling() {
+	if r.SettleTime <= 0 {
+		return
+	}
+	r.settling.Store(&settleWindow{until: clock().Now().Add(r.SettleTime).UnixNano()})
+}
+
+// settle marks resp Settling while a settling window is open. The window
+// closes when SettleTime has passed or the state machine reports breathing
+// or movement after having left them, settle then returns the Settled event
+// for the stream, otherwise nil.
+func (r *Module) settle(resp *Respiration) *Settled {
+	w := r.settling.Load()
+	if w == nil {
+		return nil
+	}
+	if w != r.settleWindow {
+		r.settleWindow = w
+		r.settleLost = false
+	}
+	acquired := resp.State == breathing || resp.State == movement
+	reacquired := acquired && r.settleLost
+	r.settleLost = r.settleLost || !acquired
+	now := clock().Now().UnixNano()
+	// a change made while closing the window opens a new one
+	if !reacquired && now < w.until || !r.settling.CompareAndSwap(w, nil) {
+		resp.Settling = true
+		return nil
+	}
+	return &Settled{Time: now, Reacquired: reacquired}
+}
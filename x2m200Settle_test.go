@@ -0,0 +1,101 @@
+package xethru
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRunSettling(t *testing.T) {
+	c := useFakeClock(t)
+	f, sensor := newFakeSensor(0)
+	defer sensor.Close()
+	m := NewModule(f, "respiration")
+	m.Timeout = time.Second
+	m.SettleTime = 5 * time.Second
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream := make(chan interface{}, 16)
+	go m.RunContext(ctx, stream)
+
+	var counter uint32
+	next := func() interface{} {
+		t.Helper()
+		select {
+		case data := <-stream:
+			return data
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for frame")
+		}
+		return nil
+	}
+	// send sends a frame in state and checks what Run makes of it
+	send := func(state respirationState, settling bool, settled *Settled) {
+		t.Helper()
+		counter++
+		p, err := MarshalPayload(Respiration{Status: respApp, Counter: counter, State: state, RPM: 12, SignalQuality: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sensor.send(p)
+		data := next()
+		if settled != nil {
+			got, ok := data.(Settled)
+			if !ok || got.Reacquired != settled.Reacquired || got.Time != clock().Now().UnixNano() {
+				t.Errorf("frame %d Expected: %+v, got %+v\n", counter, *settled, data)
+			}
+			data = next()
+		}
+		resp, ok := data.(Respiration)
+		if !ok || resp.Counter != counter || resp.Settling != settling {
+			t.Errorf("frame %d Expected: settling %v, got %+v\n", counter, settling, data)
+		}
+	}
+
+	send(breathing, false, nil)
+	if err := m.SetSensitivity(3); err != nil {
+		t.Fatal(err)
+	}
+	// the old state is reported until the firmware re-acquires
+	send(breathing, true, nil)
+	send(initializing, true, nil)
+	send(noMovement, true, nil)
+	send(breathing, false, &Settled{Reacquired: true})
+	send(breathing, false, nil)
+
+	if err := m.SetDetectionZone(0.5, 1.5); err != nil {
+		t.Fatal(err)
+	}
+	send(movement, true, nil)
+	c.Advance(m.SettleTime - time.Millisecond)
+	send(initializing, true, nil)
+	c.Advance(time.Millisecond)
+	send(initializing, false, &Settled{})
+	send(breathing, false, nil)
+
+	m.SettleTime = 0
+	if err := m.SetSensitivity(4); err != nil {
+		t.Fatal(err)
+	}
+	send(initializing, false, nil)
+}
+
+func TestSettlingEncoding(t *testing.T) {
+	resp := Respiration{Time: fakeClockTime, Status: respApp, Counter: 3, State: initializing, Valid: true, Settling: true}
+	b, err := resp.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Respiration
+	if err := got.UnmarshalBinary(b); err != nil || got.Settling != true || got.Valid != true {
+		t.Errorf("Expected: %+v, got %+v %v\n", resp, got, err)
+	}
+	j, err := resp.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = Respiration{}
+	if err := got.UnmarshalJSON(j); err != nil || got.Settling != true {
+		t.Errorf("Expected: %+v, got %+v %v\n", resp, got, err)
+	}
+}
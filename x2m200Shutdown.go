@@ -0,0 +1,95 @@
+package xethru
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// drainQuiet is how long Shutdown waits without a data frame before it takes
+// the sensor to have stopped streaming.
+const drainQuiet = 100 * time.Millisecond
+
+// Shutdown stops the sensor app so it is not left streaming, waits for the
+// frames it had already sent to arrive, resets the sensor if ResetOnShutdown
+// is set and then closes the transport. A command in progress is allowed to
+// finish first. If ctx is done before then the remaining steps are skipped,
+// the transport is closed, which fails any command in progress, and ctx.Err()
+// is returned.
+func (r *Module) Shutdown(ctx context.Context) error {
+	r.startReader()
+	drain := r.dispatcher.Subscribe(100, AppDataFrames...)
+	err := r.shutdown(ctx, drain)
+	if cerr := r.f.Close(); err == nil {
+		err = cerr
+	}
+	select {
+	case <-r.dispatcher.Done():
+	case <-ctx.Done():
+		if err == nil {
+			err = ctx.Err()
+		}
+	}
+	return err
+}
+
+func (r *Module) shutdown(ctx context.Context, drain <-chan Frame) error {
+	// an asleep sensor is not streaming and only answers a reset
+	if !r.isAsleep() {
+		if err := r.stopAndDrain(ctx, drain); err != nil {
+			return err
+		}
+	}
+
+	if r.ResetOnShutdown {
+		if err := r.executeContext(ctx, []byte{resetCmd}, x2m200Ack); err != nil {
+			return fmt.Errorf("failed to reset: %w", err)
+		}
+		r.setAsleep(false)
+	}
+	return nil
+}
+
+// stopAndDrain stops the sensor app and waits for the frames already sent.
+func (r *Module) stopAndDrain(ctx context.Context, drain <-chan Frame) error {
+	if err := r.executeContext(ctx, []byte{0x20, 0x11}, x2m200Ack); err != nil {
+		return fmt.Errorf("failed to stop app: %w", err)
+	}
+	return drainFrames(ctx, drain, drainQuiet)
+}
+
+// drainFrames discards frames from drain until none arrive for quiet. A
+// single timer is restarted after each frame rather than one made per frame.
+func drainFrames(ctx context.Context, drain <-chan Frame, quiet time.Duration) error {
+	t := clock().NewTimer(quiet)
+	defer t.Stop()
+	for {
+		select {
+		case _, ok := <-drain:
+			if !ok {
+				return ErrConnectionClosed
+			}
+			restartTimer(t, quiet)
+		case <-t.C():
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// executeContext is Execute that stops waiting when ctx is done. The command
+// carries on until it completes, times out or the transport is closed.
+func (r *Module) executeContext(ctx context.Context, cmd []byte, want byte) error {
+	done := make(chan error, 1)
+	go func() {
+		_, err := r.Execute(cmd, want, r.Timeout)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
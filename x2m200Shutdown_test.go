@@ -0,0 +1,191 @@
+package xethru
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingFramer records the commands written to, and the closing of, a
+// Framer.
+type recordingFramer struct {
+	Framer
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *recordingFramer) Write(p []byte) (int, error) {
+	r.record(fmt.Sprintf("%x", p))
+	return r.Framer.Write(p)
+}
+
+func (r *recordingFramer) Close() error {
+	r.record("close")
+	return r.Framer.Close()
+}
+
+func (r *recordingFramer) record(e string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+}
+
+// beforeClose returns the last n events up to the first close.
+func (r *recordingFramer) beforeClose(n int) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	end := len(r.events)
+	for i, e := range r.events {
+		if e == "close" {
+			end = i + 1
+			break
+		}
+	}
+	if end < n {
+		n = end
+	}
+	return append([]string(nil), r.events[end-n:end]...)
+}
+
+func TestShutdown(t *testing.T) {
+	cases := []struct {
+		reset bool
+		last  []string
+	}{
+		{false, []string{"2011", "close"}},
+		{true, []string{"2011", "22", "close"}},
+	}
+	for n, c := range cases {
+		sensor := NewSimulatedSensor()
+		sensor.Interval = time.Millisecond
+		f := &recordingFramer{Framer: sensor}
+		m := NewModule(f, "respiration")
+		m.ResetOnShutdown = c.reset
+
+		stream := make(chan interface{})
+		finished := make(chan struct{})
+		go func() {
+			m.Run(stream)
+			close(finished)
+		}()
+		go func() {
+			for range stream {
+			}
+		}()
+		time.Sleep(20 * time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		if err := m.Shutdown(ctx); err != nil {
+			t.Errorf("test %d Expected: %v, got %v\n", n, nil, err)
+		}
+		cancel()
+		<-finished
+		close(stream)
+
+		got := f.beforeClose(len(c.last))
+		if fmt.Sprint(got) != fmt.Sprint(c.last) {
+			t.Errorf("test %d Expected: %v, got %v\n", n, c.last, got)
+		}
+	}
+}
+
+func TestShutdownContext(t *testing.T) {
+	sensor := NewSimulatedSensor()
+	sensor.AckDelay = 5 * time.Second
+	f := &recordingFramer{Framer: sensor}
+	m := NewModule(f, "respiration")
+	m.Timeout = 10 * time.Second
+
+	// a command in progress when Shutdown is called
+	inProgress := make(chan error, 1)
+	go func() {
+		inProgress <- m.SetLEDMode()
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := m.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected: %v, got %v\n", context.DeadlineExceeded, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected: Shutdown to return when ctx is done, took %v\n", elapsed)
+	}
+	if got := f.beforeClose(1); len(got) != 1 || got[0] != "close" {
+		t.Errorf("Expected: transport to be closed, got %v\n", got)
+	}
+	select {
+	case err := <-inProgress:
+		if err == nil {
+			t.Errorf("Expected: command in progress to fail\n")
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Expected: command in progress to return once the transport closed\n")
+	}
+}
+
+func TestDrainFrames(t *testing.T) {
+	c := useFakeClock(t)
+	const quiet = 100 * time.Millisecond
+	drain := make(chan Frame)
+	done := make(chan error, 1)
+	go func() {
+		done <- drainFrames(context.Background(), drain, quiet)
+	}()
+	c.waitTimers(t, 1)
+
+	// each frame restarts the wait
+	for i := 0; i < 5; i++ {
+		drain <- Frame{Type: FrameRespiration}
+		c.Advance(quiet - time.Millisecond)
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("Expected: drain to wait while frames arrive, got %v\n", err)
+	default:
+	}
+
+	// then it returns once quiet passes without one
+	deadline := time.After(2 * time.Second)
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("Expected: <nil>, got %v\n", err)
+			}
+			return
+		case <-deadline:
+			t.Fatalf("Expected: drain to return after %v quiet\n", quiet)
+		case <-time.After(time.Millisecond):
+			c.Advance(quiet)
+		}
+	}
+}
+
+// drainFrames10k drains 10k frames from a closed channel.
+func drainFrames10k() {
+	drain := make(chan Frame, 10000)
+	for i := 0; i < cap(drain); i++ {
+		drain <- Frame{Type: FrameRespiration}
+	}
+	close(drain)
+	drainFrames(context.Background(), drain, time.Second)
+}
+
+func TestDrainFramesAllocs(t *testing.T) {
+	// one timer for every frame, not one each
+	if allocs := testing.AllocsPerRun(5, drainFrames10k); allocs > 10 {
+		t.Errorf("Expected: at most 10 allocs per 10k frames, got %v\n", allocs)
+	}
+}
+
+func BenchmarkDrainFrames10k(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		drainFrames10k()
+	}
+}
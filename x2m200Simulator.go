@@ -0,0 +1,357 @@
+package xethru
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// SimulatedSensor is a Framer that behaves like an X2M200 so the package can
+// be used without hardware. It answers ping, acks the module commands and,
+// once the app is started, streams synthetic respiration or sleep frames
+// and, if enabled, baseband frames.
+//
+// The fields configure the simulation and must be set before the sensor is
+// first read or written.
+type SimulatedSensor struct {
+	Interval time.Duration // time between data frames, default 50ms
+	RPM      float64       // breaths per minute reported
+	Distance float64       // distance to the target in meters
+	Noise    float64       // standard deviation of noise added to distance and movement
+	States   []uint32      // respiration state of each frame in turn, repeated, default breathing
+	Bins     int           // baseband bins, default 32
+	Seed     int64         // seed for noise and faults
+
+	DropRate    float64       // fraction of data frames dropped
+	CorruptRate float64       // fraction of data frames read as a CRCError
+	AckDelay    time.Duration // delay before each reply to a command
+
+	// Reject, if set, is called with each command and those it returns
+	// true for are answered with the command not recognised error.
+	Reject func(cmd []byte) bool
+
+	once     sync.Once
+	out      chan simFrame
+	done     chan struct{}
+	closing  sync.Once
+	mu       sync.Mutex
+	running  bool
+	sleep    bool
+	asleep   bool // in the low power mode, only a reset is answered
+	baseband byte // 0 off, 1 iq, 2 amplitude/phase
+	files    map[uint32][]byte
+	zone     []byte // detection zone start and end floats, nil is simZone
+	sens     []byte // sensitivity, nil is simSensitivity
+	counter  uint32
+	rand     *rand.Rand
+}
+
+// simZone and simSensitivity are the settings of a SimulatedSensor before
+// they are set, 0.4 to 2 meters and 5.
+var (
+	simZone        = []byte{0xcd, 0xcc, 0xcc, 0x3e, 0x00, 0x00, 0x00, 0x40}
+	simSensitivity = []byte{0x05, 0x00, 0x00, 0x00}
+)
+
+// simSystemInfo are the system info items of a SimulatedSensor.
+var simSystemInfo = map[byte]string{
+	systemInfoFirmware: "X2M200-SIM",
+	systemInfoVersion:  "1.0.0",
+	systemInfoSerial:   "000000",
+}
+
+type simFrame struct {
+	p   []byte
+	err error
+}
+
+// NewSimulatedSensor creates a SimulatedSensor breathing at 14 rpm at 1m.
+func NewSimulatedSensor() *SimulatedSensor {
+	return &SimulatedSensor{
+		Interval: 50 * time.Millisecond,
+		RPM:      14,
+		Distance: 1,
+		Bins:     32,
+	}
+}
+
+func (s *SimulatedSensor) start() {
+	s.once.Do(func() {
+		s.out = make(chan simFrame, 64)
+		s.done = make(chan struct{})
+		s.rand = rand.New(rand.NewSource(s.Seed))
+		if s.Interval <= 0 {
+			s.Interval = 50 * time.Millisecond
+		}
+		if s.Bins <= 0 {
+			s.Bins = 32
+		}
+		go s.stream()
+	})
+}
+
+// Write handles a command from the host.
+func (s *SimulatedSensor) Write(p []byte) (int, error) {
+	s.start()
+	select {
+	case <-s.done:
+		return 0, io.ErrClosedPipe
+	default:
+	}
+	replies := s.command(p)
+	if s.AckDelay > 0 {
+		time.AfterFunc(s.AckDelay, func() { s.send(replies...) })
+	} else {
+		s.send(replies...)
+	}
+	return len(p), nil
+}
+
+// Read returns the next reply or data frame, it returns io.EOF once the
+// sensor is closed.
+func (s *SimulatedSensor) Read(b []byte) (int, error) {
+	s.start()
+	select {
+	case f := <-s.out:
+		if f.err != nil {
+			return 0, f.err
+		}
+		return copyPayload(b, f.p)
+	case <-s.done:
+		return 0, io.EOF
+	}
+}
+
+// Close stops the simulation.
+func (s *SimulatedSensor) Close() error {
+	s.start()
+	s.closing.Do(func() { close(s.done) })
+	return nil
+}
+
+// Reset stops any running app as a reset would.
+func (s *SimulatedSensor) Reset() (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running = false
+	s.asleep = false
+	s.baseband = 0
+	return true, nil
+}
+
+// Reboot simulates the sensor rebooting by itself, as it does after a
+// brown-out. The app stops, the detection zone and sensitivity are lost and
+// the booting and ready system messages are sent.
+func (s *SimulatedSensor) Reboot() {
+	s.start()
+	s.mu.Lock()
+	s.running = false
+	s.asleep = false
+	s.baseband = 0
+	s.zone = nil
+	s.sens = nil
+	s.mu.Unlock()
+	s.send([]byte{systemMesg, systemBooting}, []byte{systemMesg, systemReady})
+}
+
+// command updates the state for cmd and returns the replies.
+func (s *SimulatedSensor) command(cmd []byte) [][]byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ackReply := [][]byte{{x2m200Ack}}
+	if s.asleep && !isResetCommand(cmd) {
+		return nil
+	}
+	if s.Reject != nil && s.Reject(cmd) {
+		return [][]byte{{errorByte, notReconsied}}
+	}
+	switch {
+	case len(cmd) == 5 && cmd[0] == x2m200PingCommand:
+		pong := make([]byte, 5)
+		pong[0] = x2m200PingCommand
+		binary.BigEndian.PutUint32(pong[1:], x2m200PingResponseReady)
+		return [][]byte{pong}
+	case len(cmd) == 1 && cmd[0] == resetCmd:
+		s.running = false
+		s.asleep = false
+		s.baseband = 0
+		return [][]byte{{x2m200Ack}, {systemMesg, systemBooting}, {systemMesg, systemReady}}
+	case len(cmd) == 5 && cmd[0] == x2m200LoadModule:
+		s.sleep = cmd[1] == 0x17 && cmd[2] == 0x7b && cmd[3] == 0xf1 && cmd[4] == 0x00
+		return ackReply
+	case len(cmd) == 2 && cmd[0] == x2m200SetMode && cmd[1] == modeSleep:
+		s.running = false
+		s.asleep = true
+		return ackReply
+	case len(cmd) == 2 && cmd[0] == 0x20 && cmd[1] == 0x01:
+		s.running = true
+		return ackReply
+	case len(cmd) == 2 && cmd[0] == 0x20:
+		s.running = false
+		return ackReply
+	case len(cmd) >= 10 && cmd[0] == x2m200ParameterFile && cmd[1] == parameterFileSet:
+		if s.files == nil {
+			s.files = make(map[uint32][]byte)
+		}
+		s.files[binary.LittleEndian.Uint32(cmd[2:6])] = append([]byte(nil), cmd[10:]...)
+		return ackReply
+	case len(cmd) == 6 && cmd[0] == x2m200ParameterFile && cmd[1] == parameterFileGet:
+		data, ok := s.files[binary.LittleEndian.Uint32(cmd[2:6])]
+		if !ok {
+			return [][]byte{{errorByte, notReconsied}}
+		}
+		reply := append([]byte{x2m200Reply}, cmd...)
+		reply = binary.LittleEndian.AppendUint32(reply, uint32(len(data)))
+		return [][]byte{append(reply, data...)}
+	case len(cmd) == 14 && cmd[0] == x2m200AppCommand && cmd[1] == x2m200Set && binary.LittleEndian.Uint32(cmd[2:6]) == x2m200DetectionZone:
+		s.zone = append([]byte(nil), cmd[6:]...)
+		return ackReply
+	case len(cmd) == 6 && cmd[0] == x2m200AppCommand && cmd[1] == x2m200Get && binary.LittleEndian.Uint32(cmd[2:6]) == x2m200DetectionZone:
+		zone := s.zone
+		if zone == nil {
+			zone = simZone
+		}
+		return [][]byte{append([]byte{x2m200Reply, x2m200AppCommand, x2m200Get}, zone...)}
+	case len(cmd) == 10 && cmd[0] == x2m200AppCommand && cmd[1] == x2m200Set && bytes.Equal(cmd[2:6], x2m200Sensitivity[:]):
+		s.sens = append([]byte(nil), cmd[6:]...)
+		return ackReply
+	case len(cmd) == 6 && cmd[0] == x2m200AppCommand && cmd[1] == x2m200Get && bytes.Equal(cmd[2:6], x2m200Sensitivity[:]):
+		sens := s.sens
+		if sens == nil {
+			sens = simSensitivity
+		}
+		return [][]byte{append([]byte{x2m200Reply, x2m200AppCommand, x2m200Get}, sens...)}
+	case len(cmd) == 2 && cmd[0] == x2m200GetSystemInfo:
+		return [][]byte{append([]byte{systemMesg, cmd[1]}, simSystemInfo[cmd[1]]...)}
+	case len(cmd) == 14 && cmd[0] == x2m200DirCommand && cmd[1] == 0x71:
+		s.baseband = cmd[10]
+		return ackReply
+	case len(cmd) > 0 && (cmd[0] == x2m200SetLEDControl || cmd[0] == x2m200AppCommand || cmd[0] == x2m200DirCommand):
+		return ackReply
+	}
+	return [][]byte{{errorByte, notReconsied}}
+}
+
+func (s *SimulatedSensor) send(frames ...[]byte) {
+	for _, p := range frames {
+		f := simFrame{p: p}
+		if p[0] == errorByte {
+			f.err = protocolErr(p)
+		}
+		s.emit(f)
+	}
+}
+
+func (s *SimulatedSensor) emit(f simFrame) {
+	select {
+	case s.out <- f:
+	case <-s.done:
+	}
+}
+
+func (s *SimulatedSensor) stream() {
+	t := time.NewTicker(s.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-t.C:
+		}
+		s.mu.Lock()
+		running, sleep, baseband := s.running, s.sleep, s.baseband
+		s.mu.Unlock()
+		if !running {
+			continue
+		}
+		s.counter++
+		frames := [][]byte{s.appFrame(sleep)}
+		switch baseband {
+		case 1:
+			frames = append(frames, s.basebandFrame(basebandIQStartByte))
+		case 2:
+			frames = append(frames, s.basebandFrame(basebandPhaseAmpltudeStartByte))
+		}
+		for _, p := range frames {
+			switch r := s.rand.Float64(); {
+			case r < s.DropRate:
+				continue
+			case r < s.DropRate+s.CorruptRate:
+				s.emit(simFrame{err: &CRCError{Expected: checksum(&p), Got: ^checksum(&p)}})
+			default:
+				s.send(p)
+			}
+		}
+	}
+}
+
+func (s *SimulatedSensor) state() uint32 {
+	if len(s.States) == 0 {
+		return uint32(breathing)
+	}
+	return s.States[int(s.counter-1)%len(s.States)]
+}
+
+func (s *SimulatedSensor) appFrame(sleep bool) []byte {
+	distance := s.Distance + s.rand.NormFloat64()*s.Noise
+	movement := math.Abs(s.rand.NormFloat64() * s.Noise)
+	var frame interface{} = Respiration{
+		Status:        respApp,
+		Counter:       s.counter,
+		State:         respirationState(s.state()),
+		RPM:           uint32(math.Round(s.RPM)),
+		Distance:      distance,
+		Movement:      movement,
+		SignalQuality: 10,
+	}
+	if sleep {
+		frame = Sleep{
+			Status:        sleepApp,
+			Counter:       s.counter,
+			State:         respirationState(s.state()),
+			RPM:           s.RPM,
+			Distance:      distance,
+			SignalQuality: 10,
+			MovementSlow:  movement,
+			MovementFast:  movement,
+		}
+	}
+	p, _ := MarshalPayload(frame)
+	return p
+}
+
+// basebandFrame simulates a target at Distance moving with the breathing.
+func (s *SimulatedSensor) basebandFrame(kind byte) []byte {
+	const binLength, samplingFreq, carrierFreq, rangeOffset = 0.0514, 39e9, 7.29e9, 0.2
+	h := BaseBandHeader{
+		Status:       status(kind),
+		Counter:      s.counter,
+		Bins:         uint32(s.Bins),
+		BinLength:    binLength,
+		SamplingFreq: samplingFreq,
+		CarrierFreq:  carrierFreq,
+		RangeOffset:  rangeOffset,
+	}
+	t := float64(s.counter) * s.Interval.Seconds()
+	phase := math.Sin(2*math.Pi*s.RPM/60*t) + s.rand.NormFloat64()*s.Noise
+	target := (s.Distance - rangeOffset) / binLength
+	a, b := make([]float64, s.Bins), make([]float64, s.Bins)
+	for i := range a {
+		amp := math.Exp(-(float64(i) - target) * (float64(i) - target) / 2)
+		a[i], b[i] = amp, phase
+		if kind == basebandIQStartByte {
+			a[i], b[i] = amp*math.Cos(phase), amp*math.Sin(phase)
+		}
+	}
+	var p []byte
+	if kind == basebandIQStartByte {
+		p, _ = MarshalPayload(BaseBandIQ{BaseBandHeader: h, SigI: a, SigQ: b})
+	} else {
+		p, _ = MarshalPayload(BaseBandAmpPhase{BaseBandHeader: h, Amplitude: a, Phase: b})
+	}
+	return p
+}
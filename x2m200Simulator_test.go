@@ -0,0 +1,129 @@
+package xethru
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSimulatedSensor(t *testing.T) {
+	sensor := NewSimulatedSensor()
+	sensor.Interval = time.Millisecond
+	sensor.RPM = 17
+	sensor.States = []uint32{uint32(initializing), uint32(breathing)}
+	sensor.Bins = 16
+	m := NewModule(sensor, "respiration")
+
+	if err := m.ping(); err != nil {
+		t.Error(err)
+	}
+	if err := m.Load(); err != nil {
+		t.Error(err)
+	}
+	if err := m.SetDetectionZone(0.5, 2); err != nil {
+		t.Error(err)
+	}
+	if err := m.SetLEDMode(); err != nil {
+		t.Error(err)
+	}
+	if err := m.Enable("iq"); err != nil {
+		t.Error(err)
+	}
+	if _, err := m.Execute([]byte{0x42}, x2m200Ack, m.Timeout); !errors.Is(err, ErrProtocolNotRecognised) {
+		t.Errorf("Expected: %v, got %v\n", ErrProtocolNotRecognised, err)
+	}
+
+	stream := make(chan interface{})
+	finished := make(chan struct{})
+	go func() {
+		m.Run(stream)
+		close(finished)
+	}()
+	var resp []Respiration
+	var iq []BaseBandIQ
+	for len(resp) < 4 || len(iq) < 4 {
+		switch d := (<-stream).(type) {
+		case Respiration:
+			resp = append(resp, d)
+		case BaseBandIQ:
+			iq = append(iq, d)
+		}
+	}
+	sensor.Close()
+	go func() {
+		for range stream {
+		}
+	}()
+	<-finished
+
+	for n, r := range resp {
+		if r.RPM != 17 || r.Counter != uint32(n+1) {
+			t.Errorf("test %d Expected: rpm 17 counter %d, got %d %d\n", n, n+1, r.RPM, r.Counter)
+		}
+		if want := sensor.States[n%2]; uint32(r.State) != want {
+			t.Errorf("test %d Expected: %v, got %v\n", n, respirationState(want), r.State)
+		}
+	}
+	for n, f := range iq {
+		if f.Bins != 16 || len(f.SigI) != 16 || len(f.SigQ) != 16 {
+			t.Errorf("test %d Expected: %d bins, got %d %d %d\n", n, 16, f.Bins, len(f.SigI), len(f.SigQ))
+		}
+		// target at 1m is bin 15
+		mag := f.Magnitude()
+		if mag[15] < mag[5] {
+			t.Errorf("test %d Expected: peak near target, got %v\n", n, mag)
+		}
+	}
+}
+
+func TestSimulatedSensorFaults(t *testing.T) {
+	sensor := NewSimulatedSensor()
+	sensor.Interval = time.Millisecond
+	sensor.DropRate = 0.3
+	sensor.CorruptRate = 0.3
+	sensor.Seed = 2
+	sensor.Write([]byte{0x20, 0x01})
+
+	var ok, bad int
+	var last uint32
+	gaps := false
+	b := make([]byte, 64)
+	for ok < 50 {
+		n, err := sensor.Read(b)
+		var crcErr *CRCError
+		switch {
+		case errors.As(err, &crcErr):
+			bad++
+		case err != nil:
+			t.Fatal(err)
+		default:
+			r, err := parseRespiration(b[:n])
+			if err != nil {
+				continue
+			}
+			if r.Counter != last+1 {
+				gaps = true
+			}
+			last = r.Counter
+			ok++
+		}
+	}
+	sensor.Close()
+	if bad == 0 || !gaps {
+		t.Errorf("Expected: corrupt and dropped frames, got %d corrupt gaps %v\n", bad, gaps)
+	}
+
+	// acks later than the module timeout
+	sensor = NewSimulatedSensor()
+	defer sensor.Close()
+	sensor.AckDelay = 50 * time.Millisecond
+	m := NewModule(sensor, "respiration")
+	m.Timeout = 10 * time.Millisecond
+	if err := m.Load(); !errors.Is(err, ErrCommandTimeout) {
+		t.Errorf("Expected: %v, got %v\n", ErrCommandTimeout, err)
+	}
+	m.Timeout = 200 * time.Millisecond
+	if err := m.Load(); err != nil {
+		t.Errorf("Expected: %v, got %v\n", nil, err)
+	}
+}
@@ -0,0 +1,155 @@
+package xethru
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Sink stores the frames a Module reads, see AttachSink and FileSink.
+type Sink interface {
+	WriteRespiration(Respiration) error
+	// WriteBaseBand writes a BaseBandIQ or BaseBandAmpPhase.
+	WriteBaseBand(v interface{}) error
+	// Flush writes buffered frames to storage.
+	Flush() error
+	Close() error
+}
+
+// sinkTee queues the frames Run reads for a Sink written by its own
+// goroutine, so a slow sink does not hold up Run.
+type sinkTee struct {
+	sink    Sink
+	buffer  int
+	policy  DeliveryPolicy
+	dropped atomic.Uint64
+
+	ring *frameRing // only used by Run
+}
+
+// AttachSink tees the Respiration and baseband frames Run reads into s. The
+// frames are queued, up to buffer of them, and written by a goroutine of
+// their own, policy says what happens when the queue is full: with
+// DropOldest or DropNewest a slow sink loses frames, counted by
+// Stats.SinkDropped, but never holds up Run, with Block it does. Write
+// errors go to OnError, called from the sink's goroutine. Queued frames are
+// written and the sink flushed before Run returns, unless its ctx is done or
+// the sink is stuck on a write for 5 seconds, when the rest are dropped and
+// Run returns without waiting for the write, so s may still be writing when
+// it is closed. Closing s is up to the caller. Only the last sink attached is used, a nil s
+// detaches it. Like OnRespiration it returns ErrModuleRunning while Run is
+// running.
+func (r *Module) AttachSink(s Sink, buffer int, policy DeliveryPolicy) error {
+	r.handlersMu.Lock()
+	defer r.handlersMu.Unlock()
+	if r.running {
+		return ErrModuleRunning
+	}
+	if buffer < 1 {
+		buffer = 1
+	}
+	r.sink = nil
+	if s != nil {
+		r.sink = &sinkTee{sink: s, buffer: buffer, policy: policy}
+	}
+	return nil
+}
+
+// sinkLinger is how long Run waits for the sink to take each frame still
+// queued when it returns, or to finish a write, before giving up on it, so a
+// wedged sink can not hold it up.
+const sinkLinger = 5 * time.Second
+
+// startSink starts writing to the attached sink, it returns a function that
+// waits for the queued frames to be written and the sink flushed. The wait
+// ends early when ctx is done or a write takes longer than sinkLinger, the
+// sink's goroutine is then left to finish the write on its own.
+func (r *Module) startSink(ctx context.Context) func() {
+	t := r.sink
+	if t == nil {
+		return func() {}
+	}
+	ring := newFrameRing(t.buffer, t.policy)
+	t.ring = ring
+	frames := make(chan interface{})
+	stop, written := make(chan struct{}), make(chan struct{})
+	progress := make(chan struct{}, 1)
+	go func() {
+		if n := ring.drain(ctx, frames, stop, sinkLinger); n > 0 {
+			t.dropped.Add(uint64(n))
+			r.metrics().Counter(MetricSinkDropped, float64(n))
+		}
+		close(frames)
+	}()
+	go func() {
+		defer close(written)
+		for v := range frames {
+			var err error
+			if resp, ok := v.(Respiration); ok {
+				err = t.sink.WriteRespiration(resp)
+			} else {
+				err = t.sink.WriteBaseBand(v)
+			}
+			if err != nil {
+				r.sinkError(err)
+			}
+			select {
+			case progress <- struct{}{}:
+			default:
+			}
+		}
+		if err := t.sink.Flush(); err != nil {
+			r.sinkError(err)
+		}
+	}()
+	return func() {
+		close(stop)
+		t.ring = nil
+		timer := time.NewTimer(sinkLinger)
+		defer timer.Stop()
+		for {
+			select {
+			case <-written:
+				return
+			case <-progress:
+				if !timer.Stop() {
+					<-timer.C
+				}
+				timer.Reset(sinkLinger)
+			case <-ctx.Done():
+				r.log().Warnf("sink is still writing, leaving it behind")
+				return
+			case <-timer.C:
+				r.log().Warnf("sink is stuck on a write, leaving it behind")
+				return
+			}
+		}
+	}
+}
+
+// teeSink queues data for the sink if it is a frame the sink stores.
+func (r *Module) teeSink(ctx context.Context, data interface{}) error {
+	t := r.sink
+	if t == nil || t.ring == nil {
+		return nil
+	}
+	switch data.(type) {
+	case Respiration, BaseBandIQ, BaseBandAmpPhase:
+	default:
+		return nil
+	}
+	dropped, err := t.ring.push(ctx, data, r.dispatcher.Done())
+	if dropped {
+		t.dropped.Add(1)
+		r.metrics().Counter(MetricSinkDropped, 1)
+	}
+	return err
+}
+
+func (r *Module) sinkError(err error) {
+	err = fmt.Errorf("writing to sink: %w", err)
+	r.log().Warnf("%v", err)
+	r.metrics().Counter(MetricSinkErrors, 1)
+	r.handleError(err)
+}
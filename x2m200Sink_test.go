@@ -0,0 +1,181 @@
+package xethru
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// slowSink is a Sink that blocks writes until it is released.
+type slowSink struct {
+	release chan struct{}
+	writing chan struct{} // if set, told of each write before it blocks
+	err     error
+
+	mu       sync.Mutex
+	counters []uint32
+	flushed  bool
+}
+
+func (s *slowSink) WriteRespiration(r Respiration) error {
+	if s.writing != nil {
+		s.writing <- struct{}{}
+	}
+	<-s.release
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counters = append(s.counters, r.Counter)
+	return s.err
+}
+
+func (s *slowSink) WriteBaseBand(v interface{}) error { return nil }
+
+func (s *slowSink) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flushed = true
+	return nil
+}
+
+func (s *slowSink) Close() error { return nil }
+
+// runWithSink streams frames to a module with sink attached, calling release
+// once they are all on the stream, and returns once Run has returned.
+func runWithSink(t *testing.T, m *Module, sensor *fakeSensor, sink Sink, buffer int, policy DeliveryPolicy, frames int, release func()) {
+	t.Helper()
+	m.Timeout = 100 * time.Millisecond
+	if err := m.AttachSink(sink, buffer, policy); err != nil {
+		t.Fatal(err)
+	}
+	stream := make(chan interface{}, frames)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.Run(stream)
+	}()
+	for n := 1; n <= frames; n++ {
+		p, err := MarshalPayload(Respiration{Status: respApp, Counter: uint32(n), State: breathing, SignalQuality: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sensor.send(p)
+	}
+	// the stream gets every frame while the sink is stuck
+	for n := 1; n <= frames; n++ {
+		select {
+		case <-stream:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Expected: %d frames on the stream, got %d\n", frames, n-1)
+		}
+	}
+	if err := m.AttachSink(nil, 0, DropOldest); !errors.Is(err, ErrModuleRunning) {
+		t.Errorf("Expected: %v, got %v\n", ErrModuleRunning, err)
+	}
+	release()
+	sensor.Close()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected: Run to return")
+	}
+}
+
+func TestAttachSinkDrops(t *testing.T) {
+	const frames = 20
+	for _, policy := range []DeliveryPolicy{DropNewest, DropOldest} {
+		sink := &slowSink{release: make(chan struct{})}
+		f, sensor := newFakeSensor(0)
+		m := NewModule(f, "respiration")
+		runWithSink(t, m, sensor, sink, 4, policy, frames, func() { close(sink.release) })
+
+		dropped := m.Stats().SinkDropped
+		if dropped == 0 || int(dropped)+len(sink.counters) != frames {
+			t.Errorf("policy %v Expected: %d frames written or dropped, got %d and %d\n", policy, frames, len(sink.counters), dropped)
+		}
+		for n := 1; n < len(sink.counters); n++ {
+			if sink.counters[n] <= sink.counters[n-1] {
+				t.Errorf("policy %v Expected: frames in order, got %v\n", policy, sink.counters)
+				break
+			}
+		}
+		last := sink.counters[len(sink.counters)-1]
+		if (policy == DropOldest) != (last == frames) {
+			t.Errorf("policy %v Expected: newest frame written %v, got %v\n", policy, policy == DropOldest, sink.counters)
+		}
+		if !sink.flushed {
+			t.Errorf("policy %v Expected: sink flushed when Run returns\n", policy)
+		}
+	}
+}
+
+func TestAttachSinkErrors(t *testing.T) {
+	errDisk := errors.New("disk full")
+	sink := &slowSink{release: make(chan struct{}), err: errDisk}
+	close(sink.release)
+	f, sensor := newFakeSensor(0)
+	m := NewModule(f, "respiration")
+	var mu sync.Mutex
+	var errs []error
+	m.OnError(func(err error) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+	})
+	runWithSink(t, m, sensor, sink, 16, Block, 3, func() {})
+
+	if got := m.Stats().SinkDropped; got != 0 {
+		t.Errorf("Expected: no frames dropped with Block, got %d\n", got)
+	}
+	if len(sink.counters) != 3 {
+		t.Errorf("Expected: 3 frames written, got %v\n", sink.counters)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	var sinkErrs int
+	for _, err := range errs {
+		if errors.Is(err, errDisk) {
+			sinkErrs++
+		}
+	}
+	if sinkErrs != 3 {
+		t.Errorf("Expected: 3 sink errors, got %v\n", errs)
+	}
+}
+
+func TestAttachSinkStuckWrite(t *testing.T) {
+	f, sensor := newFakeSensor(0)
+	defer sensor.Close()
+	m := NewRespiration(f)
+	sink := &slowSink{release: make(chan struct{}), writing: make(chan struct{}, 1)}
+	// the write never returns while Run is running, it is let go at the end
+	defer close(sink.release)
+	if err := m.AttachSink(sink, 4, DropOldest); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := make(chan interface{}, 1)
+	done := make(chan error)
+	go func() { done <- m.RunContext(ctx, stream) }()
+
+	p, err := MarshalPayload(Respiration{Status: respApp, Counter: 1, State: breathing, SignalQuality: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sensor.send(p)
+	select {
+	case <-sink.writing:
+	case <-time.After(time.Second):
+		t.Fatal("Expected: a write to the sink, got none")
+	}
+	cancel()
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("Expected: %v, got %v\n", context.Canceled, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected: Run to return with the sink stuck, still running")
+	}
+}
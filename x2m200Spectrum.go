@@ -0,0 +1,155 @@
+package xethru
+
+import (
+	"errors"
+	"math"
+	"math/cmplx"
+)
+
+// Spectrum is the one sided magnitude spectrum of the phase of a range bin.
+type Spectrum struct {
+	Frequencies []float64 // Hz
+	Magnitudes  []float64
+}
+
+// SpectralEstimator computes the spectrum of the phase of a single range bin
+// over a sliding window of baseband IQ frames, a new Spectrum is produced
+// every Hop frames once Window frames have been added. If Range is set it is
+// used to pick the bin, otherwise Bin is used. If FrameRate is zero it is
+// estimated from the frame timestamps.
+type SpectralEstimator struct {
+	Window    int
+	Hop       int
+	Bin       int
+	Range     float64
+	FrameRate float64
+
+	phase []float64
+	times []int64
+	since int
+}
+
+// NewSpectralEstimator creates a SpectralEstimator over bin.
+func NewSpectralEstimator(window, hop, bin int, frameRate float64) *SpectralEstimator {
+	return &SpectralEstimator{Window: window, Hop: hop, Bin: bin, FrameRate: frameRate}
+}
+
+// AddFrame adds iq to the window and returns true with a new Spectrum every
+// Hop frames.
+func (s *SpectralEstimator) AddFrame(iq BaseBandIQ) (Spectrum, bool, error) {
+	if s.Window < 2 || s.Hop < 1 {
+		return Spectrum{}, false, errSpectrumConfig
+	}
+	bin := s.Bin
+	if s.Range > 0 {
+		var err error
+		if bin, err = iq.BinAtRange(s.Range); err != nil {
+			return Spectrum{}, false, err
+		}
+	}
+	if bin < 0 || bin >= len(iq.SigI) || bin >= len(iq.SigQ) {
+		return Spectrum{}, false, errRangeOutOfBounds
+	}
+
+	return s.addPhase(math.Atan2(iq.SigQ[bin], iq.SigI[bin]), iq.Time)
+}
+
+// addPhase adds the phase of the chosen bin of a frame received at t.
+func (s *SpectralEstimator) addPhase(phase float64, t int64) (Spectrum, bool, error) {
+	s.phase = append(s.phase, phase)
+	s.times = append(s.times, t)
+	if len(s.phase) > s.Window {
+		s.phase = s.phase[len(s.phase)-s.Window:]
+		s.times = s.times[len(s.times)-s.Window:]
+	}
+	s.since++
+	if len(s.phase) < s.Window || s.since < s.Hop {
+		return Spectrum{}, false, nil
+	}
+	s.since = 0
+
+	rate := s.FrameRate
+	if rate <= 0 {
+		span := float64(s.times[len(s.times)-1]-s.times[0]) / 1e9
+		if span <= 0 {
+			return Spectrum{}, false, errSpectrumFrameRate
+		}
+		rate = float64(len(s.times)-1) / span
+	}
+	return phaseSpectrum(s.phase, rate), true, nil
+}
+
+// Reset discards all frames in the window.
+func (s *SpectralEstimator) Reset() {
+	s.phase = s.phase[:0]
+	s.times = s.times[:0]
+	s.since = 0
+}
+
+// phaseSpectrum unwraps and removes the mean from phase, applies a hann
+// window and zero pads to a power of two before transforming.
+func phaseSpectrum(phase []float64, rate float64) Spectrum {
+	n := 1
+	for n < len(phase) {
+		n <<= 1
+	}
+	x := make([]complex128, n)
+	unwrapped := make([]float64, len(phase))
+	var mean float64
+	for i, p := range phase {
+		if i > 0 {
+			d := p - phase[i-1]
+			d -= 2 * math.Pi * math.Round(d/(2*math.Pi))
+			p = unwrapped[i-1] + d
+		}
+		unwrapped[i] = p
+		mean += p
+	}
+	mean /= float64(len(phase))
+	for i, p := range unwrapped {
+		w := 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(len(phase)-1))
+		x[i] = complex((p-mean)*w, 0)
+	}
+	fft(x)
+
+	spec := Spectrum{
+		Frequencies: make([]float64, n/2+1),
+		Magnitudes:  make([]float64, n/2+1),
+	}
+	for k := range spec.Frequencies {
+		spec.Frequencies[k] = float64(k) * rate / float64(n)
+		spec.Magnitudes[k] = cmplx.Abs(x[k])
+	}
+	return spec
+}
+
+// fft is an in place iterative radix-2 fft, len(x) must be a power of two.
+func fft(x []complex128) {
+	n := len(x)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		w := cmplx.Rect(1, -2*math.Pi/float64(size))
+		for start := 0; start < n; start += size {
+			wk := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				a, b := x[start+k], x[start+k+size/2]*wk
+				x[start+k], x[start+k+size/2] = a+b, a-b
+				wk *= w
+			}
+		}
+	}
+}
+
+var (
+	errSpectrumConfig    = errors.New("spectral estimator needs a window of at least 2 and a hop of at least 1")
+	errSpectrumFrameRate = errors.New("spectral estimator can not determine the frame rate")
+)
@@ -0,0 +1,76 @@
+package xethru
+
+import (
+	"math"
+	"math/cmplx"
+	"testing"
+)
+
+func TestFFT(t *testing.T) {
+	x := []complex128{1, 2, 3, 4, 0, 0, 0, 0}
+	expected := make([]complex128, len(x))
+	for k := range expected {
+		for n, v := range x {
+			expected[k] += v * cmplx.Rect(1, -2*math.Pi*float64(k*n)/float64(len(x)))
+		}
+	}
+	fft(x)
+	for k := range x {
+		if cmplx.Abs(x[k]-expected[k]) > 1e-9 {
+			t.Errorf("bin %d Expected: %v, got %v\n", k, expected[k], x[k])
+		}
+	}
+}
+
+func TestSpectralEstimator(t *testing.T) {
+	const (
+		rate   = 20.0
+		breath = 0.25
+	)
+	s := NewSpectralEstimator(512, 64, 2, 0)
+	var spectra []Spectrum
+	for n := 0; n < 700; n++ {
+		data := make([]complex128, 4)
+		phase := 1.5*math.Sin(2*math.Pi*breath*float64(n)/rate) + 3
+		for i := range data {
+			data[i] = cmplx.Rect(0.01, float64(i))
+		}
+		data[2] = cmplx.Rect(1, phase)
+		iq := BaseBandIQFromComplex(uint32(n), 0.05, 0, 0, 0, data)
+		iq.Time = int64(float64(n) / rate * 1e9)
+		spec, ok, err := s.AddFrame(iq)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok {
+			spectra = append(spectra, spec)
+		}
+	}
+	if len(spectra) != (700-512)/64+1 {
+		t.Fatalf("Expected: %d spectra, got %d\n", (700-512)/64+1, len(spectra))
+	}
+	for n, spec := range spectra {
+		peak := 0
+		for k := range spec.Magnitudes {
+			if spec.Magnitudes[k] > spec.Magnitudes[peak] {
+				peak = k
+			}
+		}
+		resolution := spec.Frequencies[1]
+		if math.Abs(spec.Frequencies[peak]-breath) > resolution {
+			t.Errorf("spectrum %d Expected: peak at %vHz, got %vHz\n", n, breath, spec.Frequencies[peak])
+		}
+	}
+}
+
+func TestSpectralEstimatorRange(t *testing.T) {
+	s := &SpectralEstimator{Window: 4, Hop: 1, Range: 5}
+	_, _, err := s.AddFrame(BaseBandIQFromComplex(0, 0.05, 0, 0, 0, []complex128{1, 1}))
+	if err != errRangeOutOfBounds {
+		t.Errorf("Expected: %v, got %v\n", errRangeOutOfBounds, err)
+	}
+	s = &SpectralEstimator{}
+	if _, _, err := s.AddFrame(BaseBandIQ{}); err != errSpectrumConfig {
+		t.Errorf("Expected: %v, got %v\n", errSpectrumConfig, err)
+	}
+}
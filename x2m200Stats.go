@@ -0,0 +1,70 @@
+package xethru
+
+import "sync/atomic"
+
+// Stats counts the frames and bytes that have passed through a Framer, they
+// give an indication of the quality of the link to the sensor.
+type Stats struct {
+	FramesOK       uint64  // frames received with a good crc
+	CRCErrors      uint64  // frames received with a bad crc
+	FramingErrors  uint64  // frames too short or too long, or bytes outside a frame
+	BytesRead      uint64  // raw bytes read from the transport
+	BytesWritten   uint64  // raw bytes written to the transport
+	DiscardedBytes uint64  // raw bytes skipped outside a frame
+	DroppedFrames  uint64  // frames a Module dropped from a full StreamBuffer, see Module.Stats
+	FrameRate      float64 // respiration frames per second measured by a Module, see Module.Stats
+	SinkDropped    uint64  // frames a Module dropped from a full sink queue, see Module.AttachSink
+}
+
+// StatsFramer is a Framer that keeps Stats, Framers created by Open and
+// NewFramer implement it.
+type StatsFramer interface {
+	Framer
+	Stats() Stats
+	ResetStats()
+}
+
+type frameCounters struct {
+	framesOK      uint64
+	crcErrors     uint64
+	framingErrors uint64
+	bytesRead     uint64
+	bytesWritten  uint64
+	discarded     uint64
+}
+
+func (c *frameCounters) countErr(err error) {
+	switch err.(type) {
+	case *CRCError:
+		atomic.AddUint64(&c.crcErrors, 1)
+	case *FramingError:
+		atomic.AddUint64(&c.framingErrors, 1)
+	}
+}
+
+// Stats returns a snapshot of the counters, it is safe to call while the
+// Framer is in use.
+func (x *x2m200Frame) Stats() Stats {
+	return Stats{
+		FramesOK:       atomic.LoadUint64(&x.stats.framesOK),
+		CRCErrors:      atomic.LoadUint64(&x.stats.crcErrors),
+		FramingErrors:  atomic.LoadUint64(&x.stats.framingErrors),
+		BytesRead:      atomic.LoadUint64(&x.stats.bytesRead),
+		BytesWritten:   atomic.LoadUint64(&x.stats.bytesWritten),
+		DiscardedBytes: atomic.LoadUint64(&x.stats.discarded),
+	}
+}
+
+func (x *x2m200Frame) countDiscard(n int) {
+	atomic.AddUint64(&x.stats.discarded, uint64(n))
+}
+
+// ResetStats sets all the counters to zero.
+func (x *x2m200Frame) ResetStats() {
+	atomic.StoreUint64(&x.stats.framesOK, 0)
+	atomic.StoreUint64(&x.stats.crcErrors, 0)
+	atomic.StoreUint64(&x.stats.framingErrors, 0)
+	atomic.StoreUint64(&x.stats.bytesRead, 0)
+	atomic.StoreUint64(&x.stats.bytesWritten, 0)
+	atomic.StoreUint64(&x.stats.discarded, 0)
+}
@@ -0,0 +1,130 @@
+package xethru
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	in := []byte{
+		0x7d, 0x10, 0x6d, 0x7e, // ack
+		0x00, 0x01, // noise
+		0x7d, 0x10, 0x00, 0x7e, // bad crc
+		0x7d, 0x7e, // too short
+		0x7d, 0x10, 0x6d, 0x7e, // ack
+	}
+	f := CreateSplitReadWriter(io.Discard, bytes.NewReader(in)).(StatsFramer)
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					f.Stats()
+					f.Write([]byte{0x20, 0x01})
+				}
+			}
+		}()
+	}
+
+	b := make([]byte, 16)
+	for {
+		if _, err := f.Read(b); err == io.EOF {
+			break
+		}
+	}
+	close(stop)
+	wg.Wait()
+
+	s := f.Stats()
+	if s.FramesOK != 2 {
+		t.Errorf("Expected: %d, got %d\n", 2, s.FramesOK)
+	}
+	if s.CRCErrors != 1 {
+		t.Errorf("Expected: %d, got %d\n", 1, s.CRCErrors)
+	}
+	if s.FramingErrors != 2 {
+		t.Errorf("Expected: %d, got %d\n", 2, s.FramingErrors)
+	}
+	if s.DiscardedBytes != 2 {
+		t.Errorf("Expected: %d, got %d\n", 2, s.DiscardedBytes)
+	}
+	if s.BytesRead != uint64(len(in)) {
+		t.Errorf("Expected: %d, got %d\n", len(in), s.BytesRead)
+	}
+	if s.BytesWritten%5 != 0 {
+		t.Errorf("Expected: multiple of %d, got %d\n", 5, s.BytesWritten)
+	}
+
+	f.ResetStats()
+	if s := f.Stats(); s != (Stats{}) {
+		t.Errorf("Expected: %+v, got %+v\n", Stats{}, s)
+	}
+}
+
+func TestResync(t *testing.T) {
+	ack := []byte{0x7d, 0x10, 0x6d, 0x7e}
+	garbage := []byte{0x00, 0x7e, 0x33, 0x10, 0x6d, 0x7e}
+	cat := func(parts ...[]byte) []byte { return bytes.Join(parts, nil) }
+
+	cases := []struct {
+		in        []byte
+		payloads  int
+		discarded uint64
+		err       error
+	}{
+		// attached mid-frame
+		{cat(garbage, ack), 1, 6, nil},
+		{cat(ack, garbage, ack), 2, 6, nil},
+		// a crc error inside a frame is still reported
+		{cat(garbage, []byte{0x7d, 0x10, 0x00, 0x7e}, ack), 1, 6, ErrPacketBadCRC},
+		// noise with no start byte is dropped as it arrives
+		{bytes.Repeat([]byte{0x55}, 3*defaultMaxFrameSize), 0, 3 * defaultMaxFrameSize, nil},
+		// a start byte followed by noise and no end byte is too large
+		{cat(garbage, []byte{0x7d}, bytes.Repeat([]byte{0x55}, 2*defaultMaxFrameSize)), 0, 0, ErrFrameTooLarge},
+	}
+	for n, c := range cases {
+		f := NewFramer(bytes.NewBuffer(c.in)).(StatsFramer)
+		var payloads int
+		var errs []error
+		for {
+			_, err := f.Read(make([]byte, 16))
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			payloads++
+		}
+		if payloads != c.payloads {
+			t.Errorf("test %d Expected: %d payloads, got %d\n", n, c.payloads, payloads)
+		}
+		if c.discarded > 0 && f.Stats().DiscardedBytes != c.discarded {
+			t.Errorf("test %d Expected: %d discarded, got %d\n", n, c.discarded, f.Stats().DiscardedBytes)
+		}
+		if c.err == nil && len(errs) > 0 || c.err != nil && (len(errs) == 0 || !errors.Is(errs[0], c.err)) {
+			t.Errorf("test %d Expected: %v, got %v\n", n, c.err, errs)
+		}
+	}
+
+	// the strict reader still reports the noise
+	f := NewFramer(bytes.NewBuffer(cat(garbage, ack)))
+	if err := SetResync(f, false); err != nil {
+		t.Fatal(err)
+	}
+	var frameErr *FramingError
+	if _, err := f.Read(make([]byte, 16)); !errors.As(err, &frameErr) || frameErr.Reason != ErrPacketNoStartByte {
+		t.Errorf("Expected: %v, got %v\n", ErrPacketNoStartByte, err)
+	}
+}
@@ -0,0 +1,83 @@
+package xethru
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// System test command. The command and test codes are unverified, see the
+// package documentation. The datasheet uses 0x71 as XTS_SDC_APP_SETINT, see
+// Enable, so the system test code is likely wrong.
+// Example: <Start> + <XTS_SPC_DIR_COMMAND> + <XTS_SDC_SYSTEM_TEST> + <TestCode> + <CRC> + <End>
+// Response: <Start> + <XTS_SPR_REPLY> + <XTS_SPC_DIR_COMMAND> + <XTS_SDC_SYSTEM_TEST> + <TestCode> + <Result> + <CRC> + <End>
+const (
+	x2m200SystemTest   = 0x71
+	systemTestReplyLen = 5
+
+	// defaultSystemTestTimeout is the time a system test may take, much
+	// longer than other commands.
+	defaultSystemTestTimeout = 5 * time.Second
+)
+
+// System test codes
+const (
+	systemTestFrameLength byte = 0x01
+	systemTestDACBias     byte = 0x02
+)
+
+// systemTests are the codes run by runAllSystemTests.
+var systemTests = []byte{systemTestFrameLength, systemTestDACBias}
+
+var errSystemTestReply = errors.New("system test reply is not long enough")
+
+// systemTestResult is the result of a system test.
+type systemTestResult struct {
+	Code   byte // the test
+	Result byte // the raw result, zero is a pass
+}
+
+// Passed reports whether the test passed.
+func (t systemTestResult) Passed() bool {
+	return t.Result == 0
+}
+
+func (t systemTestResult) String() string {
+	if t.Passed() {
+		return fmt.Sprintf("system test %#02x passed", t.Code)
+	}
+	return fmt.Sprintf("system test %#02x failed with %#02x", t.Code, t.Result)
+}
+
+// runSystemTest runs the system test code and returns its result. It waits
+// for systemTestTimeout, or 5 seconds if that is not set.
+func (r *Module) runSystemTest(code byte) (systemTestResult, error) {
+	timeout := r.systemTestTimeout
+	if timeout <= 0 {
+		timeout = defaultSystemTestTimeout
+	}
+	resp, err := r.exchange([]byte{x2m200DirCommand, x2m200SystemTest, code}, timeout, func(p []byte) bool {
+		return len(p) > 3 && p[0] == x2m200Reply && p[1] == x2m200DirCommand && p[2] == x2m200SystemTest && p[3] == code
+	})
+	if err != nil {
+		return systemTestResult{}, fmt.Errorf("failed to run system test %#02x: %w", code, err)
+	}
+	if len(resp) < systemTestReplyLen {
+		return systemTestResult{}, &LengthError{Err: errSystemTestReply, Want: systemTestReplyLen, Got: len(resp)}
+	}
+	return systemTestResult{Code: code, Result: resp[4]}, nil
+}
+
+// runAllSystemTests runs each of systemTests in turn and returns their
+// results, stopping at the first error.
+func (r *Module) runAllSystemTests() ([]systemTestResult, error) {
+	results := make([]systemTestResult, 0, len(systemTests))
+	for _, code := range systemTests {
+		res, err := r.runSystemTest(code)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
@@ -0,0 +1,61 @@
+package xethru
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRunSystemTest(t *testing.T) {
+	cases := []struct {
+		reply  []byte
+		err    error
+		result systemTestResult
+		passed bool
+	}{
+		{[]byte{x2m200Reply, 0x90, 0x71, 0x02, 0x00}, nil, systemTestResult{Code: 0x02, Result: 0x00}, true},
+		{[]byte{x2m200Reply, 0x90, 0x71, 0x02, 0x03}, nil, systemTestResult{Code: 0x02, Result: 0x03}, false},
+		{[]byte{x2m200Reply, 0x90, 0x71, 0x02}, errSystemTestReply, systemTestResult{}, true},
+		{[]byte{errorByte, notReconsied}, ErrProtocolNotRecognised, systemTestResult{}, true},
+		// a reply for another test is not the result
+		{[]byte{x2m200Reply, 0x90, 0x71, 0x01, 0x00}, ErrCommandTimeout, systemTestResult{}, true},
+		{nil, ErrCommandTimeout, systemTestResult{}, true},
+	}
+	for n, c := range cases {
+		f, sensor, stop := newScriptedSensor(func([]byte) []byte { return c.reply })
+		m := NewModule(f, "respiration")
+		m.systemTestTimeout = 50 * time.Millisecond
+		res, err := m.runSystemTest(systemTestDACBias)
+		if !errors.Is(err, c.err) {
+			t.Errorf("test %d Expected: %v, got %v\n", n, c.err, err)
+		}
+		if res != c.result || res.Passed() != c.passed {
+			t.Errorf("test %d Expected: %v, got %v\n", n, c.result, res)
+		}
+		if cmds := sensor.commands(); len(cmds) != 1 || !bytes.Equal(cmds[0], []byte{0x90, 0x71, 0x02}) {
+			t.Errorf("test %d Expected: 907102, got %x\n", n, cmds)
+		}
+		stop()
+	}
+}
+
+func TestRunAllSystemTests(t *testing.T) {
+	f, sensor, stop := newScriptedSensor(func(cmd []byte) []byte {
+		return []byte{x2m200Reply, cmd[0], cmd[1], cmd[2], cmd[2] - 1}
+	})
+	defer stop()
+	m := NewModule(f, "respiration")
+	results, err := m.runAllSystemTests()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(systemTests) || len(sensor.commands()) != len(systemTests) {
+		t.Fatalf("Expected: %d results, got %v\n", len(systemTests), results)
+	}
+	for n, res := range results {
+		if res.Code != systemTests[n] || res.Passed() != (n == 0) {
+			t.Errorf("test %d Expected: code %#02x passed %v, got %v\n", n, systemTests[n], n == 0, res)
+		}
+	}
+}
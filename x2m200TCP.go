@@ -0,0 +1,82 @@
+package xethru
+
+import (
+	"net"
+	"time"
+)
+
+type tcpConfig struct {
+	timeout      time.Duration
+	keepAlive    time.Duration
+	resetTimeout time.Duration
+}
+
+// TCPOption configures DialTCP.
+type TCPOption func(*tcpConfig)
+
+// TCPTimeout sets the dial timeout and the deadline applied to every read and
+// write. Zero disables the read and write deadlines. The default is 10s.
+func TCPTimeout(d time.Duration) TCPOption {
+	return func(c *tcpConfig) { c.timeout = d }
+}
+
+// TCPKeepAlive sets the TCP keep-alive period, a negative value disables
+// keep-alives. The default is 30s.
+func TCPKeepAlive(d time.Duration) TCPOption {
+	return func(c *tcpConfig) { c.keepAlive = d }
+}
+
+// TCPResetTimeout sets how long DialTCP waits for the sensor to be ready
+// after resetting it. The default is 5s.
+func TCPResetTimeout(d time.Duration) TCPOption {
+	return func(c *tcpConfig) { c.resetTimeout = d }
+}
+
+// DialTCP connects to a sensor behind a serial to TCP bridge such as ser2net
+// or socat, resets it and waits for it to be ready. Closing the returned
+// Framer closes the connection.
+func DialTCP(addr string, opts ...TCPOption) (Framer, error) {
+	c := tcpConfig{
+		timeout:      10 * time.Second,
+		keepAlive:    30 * time.Second,
+		resetTimeout: resetTimeout,
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	d := net.Dialer{Timeout: c.timeout, KeepAlive: c.keepAlive}
+	conn, err := d.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	f := NewFramer(&deadlineConn{Conn: conn, timeout: c.timeout})
+	if err := waitReady(f, c.resetTimeout, nil); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// deadlineConn sets a deadline before every read and write.
+type deadlineConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *deadlineConn) Read(b []byte) (int, error) {
+	if c.timeout > 0 {
+		if err := c.Conn.SetReadDeadline(time.Now().Add(c.timeout)); err != nil {
+			return 0, err
+		}
+	}
+	return c.Conn.Read(b)
+}
+
+func (c *deadlineConn) Write(b []byte) (int, error) {
+	if c.timeout > 0 {
+		if err := c.Conn.SetWriteDeadline(time.Now().Add(c.timeout)); err != nil {
+			return 0, err
+		}
+	}
+	return c.Conn.Write(b)
+}
@@ -0,0 +1,112 @@
+package xethru
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// serveSensor acts as a sensor on the first connection to l, it answers a
+// reset with booting and ready, acks every other command and streams
+// respiration frames once the app is started. Commands are read with an
+// Assembler as the host's start command looks like an error reply to a
+// Framer.
+func serveSensor(t *testing.T, l net.Listener) {
+	conn, err := l.Accept()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	f := NewFramer(conn)
+	defer f.Close()
+	a := NewAssembler()
+	b := make([]byte, 256)
+	for {
+		n, err := conn.Read(b)
+		if err != nil {
+			return
+		}
+		a.Write(b[:n])
+		for {
+			p, err := a.Next()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if p == nil {
+				break
+			}
+			f.Write([]byte{x2m200Ack})
+			switch {
+			case len(p) == 1 && p[0] == resetCmd:
+				f.Write([]byte{systemMesg, systemBooting})
+				f.Write([]byte{systemMesg, systemReady})
+			case len(p) == 2 && p[0] == 0x20 && p[1] == 0x01:
+				for i := 0; i < 3; i++ {
+					f.Write(respirationPayload)
+				}
+			}
+		}
+	}
+}
+
+func TestDialTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go serveSensor(t, l)
+
+	f, err := DialTCP(l.Addr().String(), TCPTimeout(time.Second), TCPResetTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewModule(f, "respiration")
+	if err := m.Load(); err != nil {
+		t.Error(err)
+	}
+
+	stream := make(chan interface{})
+	go m.Run(stream)
+	want, err := parse(respirationPayload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-stream:
+		resp, ok := got.(Respiration)
+		if !ok {
+			t.Fatalf("Expected: Respiration, got %T\n", got)
+		}
+		resp.Time = want.(Respiration).Time
+		if !reflect.DeepEqual(resp, want) {
+			t.Errorf("Expected: %+v, got %+v\n", want, got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected: respiration frame, got none")
+	}
+	if err := f.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDialTCPNotReady(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err == nil {
+			defer conn.Close()
+			time.Sleep(200 * time.Millisecond)
+		}
+	}()
+	_, err = DialTCP(l.Addr().String(), TCPResetTimeout(20*time.Millisecond))
+	if err != ErrCommandTimeout {
+		t.Errorf("Expected: %v, got %v\n", ErrCommandTimeout, err)
+	}
+}
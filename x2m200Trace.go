@@ -0,0 +1,75 @@
+package xethru
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Direction is the direction of a traced frame.
+type Direction int
+
+// Frame directions passed to a TraceFunc
+const (
+	DirectionWrite Direction = iota // host to sensor
+	DirectionRead                   // sensor to host
+)
+
+func (d Direction) String() string {
+	switch d {
+	case DirectionWrite:
+		return "write"
+	case DirectionRead:
+		return "read"
+	}
+	return fmt.Sprintf("Direction(%d)", int(d))
+}
+
+// TraceFunc is called with the raw bytes of every frame written to or read
+// from the sensor, including the start, crc, end and escape bytes. Frames
+// that fail their checksum are traced too. It is called synchronously from
+// Read and Write so it should be quick, and raw must not be retained.
+type TraceFunc func(dir Direction, raw []byte, t time.Time)
+
+var errTraceNotSupported = errors.New("framer does not support tracing")
+
+// SetTrace sets the trace hook of a Framer created by this package, a nil fn
+// disables tracing. It is safe to call while the Framer is in use.
+func SetTrace(f Framer, fn TraceFunc) error {
+	x, ok := f.(*x2m200Frame)
+	if !ok {
+		return errTraceNotSupported
+	}
+	x.trace.Store(fn)
+	return nil
+}
+
+// SetTrace sets the trace hook on the module's Framer.
+func (r *Module) SetTrace(fn TraceFunc) error {
+	return SetTrace(r.f, fn)
+}
+
+func (x *x2m200Frame) tracer() TraceFunc {
+	fn, _ := x.trace.Load().(TraceFunc)
+	return fn
+}
+
+func (x *x2m200Frame) traceRead(raw []byte) {
+	if trace := x.tracer(); trace != nil {
+		trace(DirectionRead, raw, time.Now())
+	}
+}
+
+// HexTrace returns a TraceFunc that writes a timestamped hex dump of each
+// frame to w. Write errors are ignored.
+func HexTrace(w io.Writer) TraceFunc {
+	var mu sync.Mutex
+	return func(dir Direction, raw []byte, t time.Time) {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintf(w, "%s %s %d bytes\n%s", t.Format("15:04:05.000000"), dir, len(raw), hex.Dump(raw))
+	}
+}
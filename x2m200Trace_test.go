@@ -0,0 +1,61 @@
+package xethru
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHexTrace(t *testing.T) {
+	var out, trace bytes.Buffer
+	in := bytes.NewReader([]byte{
+		0x7d, 0x10, 0x6d, 0x7e, // ack
+		0x7d, 0x10, 0x00, 0x7e, // bad crc
+	})
+	f := CreateSplitReadWriter(&out, in)
+
+	hook := HexTrace(&trace)
+	at := time.Date(2016, 1, 1, 10, 30, 0, 0, time.UTC)
+	if err := SetTrace(f, func(dir Direction, raw []byte, _ time.Time) {
+		hook(dir, raw, at)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.Write([]byte{0x20, 0x01}); err != nil {
+		t.Errorf("Expected: %v, got %v\n", nil, err)
+	}
+	b := make([]byte, 16)
+	if _, err := f.Read(b); err != nil {
+		t.Errorf("Expected: %v, got %v\n", nil, err)
+	}
+	if _, err := f.Read(b); !errors.Is(err, ErrPacketBadCRC) {
+		t.Errorf("Expected: %v, got %v\n", ErrPacketBadCRC, err)
+	}
+
+	want := "10:30:00.000000 write 5 bytes\n" +
+		"00000000  7d 20 01 5c 7e                                    |} .\\~|\n" +
+		"10:30:00.000000 read 4 bytes\n" +
+		"00000000  7d 10 6d 7e                                       |}.m~|\n" +
+		"10:30:00.000000 read 4 bytes\n" +
+		"00000000  7d 10 00 7e                                       |}..~|\n"
+	if trace.String() != want {
+		t.Errorf("Expected:\n%s\ngot:\n%s\n", want, trace.String())
+	}
+
+	// disabled
+	trace.Reset()
+	SetTrace(f, nil)
+	f.Write([]byte{0x20, 0x01})
+	if trace.Len() != 0 {
+		t.Errorf("Expected: %d, got %d\n", 0, trace.Len())
+	}
+}
+
+func TestSetTraceUnsupported(t *testing.T) {
+	var f struct{ Framer }
+	if err := SetTrace(f, nil); err != errTraceNotSupported {
+		t.Errorf("Expected: %v, got %v\n", errTraceNotSupported, err)
+	}
+}
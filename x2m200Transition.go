@@ -0,0 +1,104 @@
+package xethru
+
+// Transition is a change of the respiration app's state from one frame to
+// the next.
+type Transition struct {
+	From, To respirationState
+}
+
+// X2M200Transitions are the legal transitions of the X2M200 respiration
+// app's state machine. It initialises into no movement or movement, tracks
+// movement until it finds breathing and falls back to movement or no
+// movement when it loses it. Only a reset, a reboot or a settings change
+// sends it back to initializing. Staying in a state is always legal.
+// Change it, or give a TransitionValidator a table of its own, for firmware
+// that behaves differently.
+var X2M200Transitions = map[Transition]bool{
+	{initializing, noMovement}: true,
+	{initializing, movement}:   true,
+	{noMovement, movement}:     true,
+	{noMovement, tracking}:     true,
+	{movement, noMovement}:     true,
+	{movement, tracking}:       true,
+	{tracking, breathing}:      true,
+	{tracking, movement}:       true,
+	{tracking, noMovement}:     true,
+	{breathing, movement}:      true,
+	{breathing, tracking}:      true,
+	{breathing, noMovement}:    true,
+}
+
+// AnomalousTransition is sent on Run's stream, before the frame that made
+// it, when a Module's Transitions validator finds a transition that is not
+// legal, a sign of a firmware bug. The frame is still delivered.
+type AnomalousTransition struct {
+	Time     int64 // of the frame
+	From, To respirationState
+	Counter  uint32 // of the frame
+}
+
+// TransitionValidator checks the state transitions of consecutive
+// Respiration frames against a table of legal transitions. Frames whose
+// counters are not consecutive, because frames were lost or suppressed, are
+// not checked as the states in between are unknown. It is not safe for
+// concurrent use.
+type TransitionValidator struct {
+	Table map[Transition]bool // legal transitions, nil is X2M200Transitions
+
+	prev Respiration
+	have bool
+}
+
+// NewTransitionValidator returns a TransitionValidator checking against
+// X2M200Transitions.
+func NewTransitionValidator() *TransitionValidator {
+	return &TransitionValidator{Table: X2M200Transitions}
+}
+
+// Check checks the transition from the previous frame to r and returns true
+// with the anomaly if it is not legal.
+func (v *TransitionValidator) Check(r Respiration) (AnomalousTransition, bool) {
+	prev, have := v.prev, v.have
+	v.prev, v.have = r, true
+	if !have || r.Counter != prev.Counter+1 || r.State == prev.State {
+		return AnomalousTransition{}, false
+	}
+	table := v.Table
+	if table == nil {
+		table = X2M200Transitions
+	}
+	if table[Transition{prev.State, r.State}] {
+		return AnomalousTransition{}, false
+	}
+	return AnomalousTransition{Time: r.Time, From: prev.State, To: r.State, Counter: r.Counter}, true
+}
+
+// Reset forgets the previous frame, after the state machine was restarted.
+func (v *TransitionValidator) Reset() {
+	v.prev, v.have = Respiration{}, false
+}
+
+// restartStates tells Run the state machine is restarting, after a reset or
+// a settings change, so any state may follow.
+func (r *Module) restartStates() {
+	r.statesRestarted.Store(true)
+}
+
+// checkTransition checks resp with the Transitions validator and returns the
+// anomaly to send on the stream, or nil.
+func (r *Module) checkTransition(resp Respiration) *AnomalousTransition {
+	v := r.Transitions
+	if r.statesRestarted.Swap(false) && v != nil {
+		v.Reset()
+	}
+	if v == nil {
+		return nil
+	}
+	a, ok := v.Check(resp)
+	if !ok {
+		return nil
+	}
+	r.log().Warnf("anomalous state transition %v to %v at frame %d", a.From, a.To, a.Counter)
+	r.metrics().Counter(MetricAnomalousTransitions, 1)
+	return &a
+}
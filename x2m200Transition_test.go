@@ -0,0 +1,116 @@
+package xethru
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTransitionValidator(t *testing.T) {
+	check := func(v *TransitionValidator, from, to respirationState, counter uint32) (AnomalousTransition, bool) {
+		v.Reset()
+		v.Check(Respiration{Counter: counter, State: from})
+		return v.Check(Respiration{Time: 7, Counter: counter + 1, State: to})
+	}
+	v := NewTransitionValidator()
+	for tr := range X2M200Transitions {
+		if a, bad := check(v, tr.From, tr.To, 1); bad {
+			t.Errorf("Expected: %v to %v legal, got %+v\n", tr.From, tr.To, a)
+		}
+	}
+	for s := breathing; s <= someotherState; s++ {
+		if a, bad := check(v, s, s, 1); bad {
+			t.Errorf("Expected: staying in %v legal, got %+v\n", s, a)
+		}
+	}
+
+	illegal := []Transition{
+		{breathing, initializing},
+		{tracking, initializing},
+		{movement, initializing},
+		{noMovement, breathing},
+		{movement, breathing},
+		{initializing, breathing},
+		{initializing, tracking},
+		{breathing, stateUnknown},
+	}
+	for n, tr := range illegal {
+		a, bad := check(v, tr.From, tr.To, 41)
+		want := AnomalousTransition{Time: 7, From: tr.From, To: tr.To, Counter: 42}
+		if !bad || a != want {
+			t.Errorf("test %d Expected: %+v, got %+v %v\n", n, want, a, bad)
+		}
+	}
+
+	// lost frames hide the states in between
+	v.Reset()
+	v.Check(Respiration{Counter: 1, State: breathing})
+	if a, bad := v.Check(Respiration{Counter: 3, State: initializing}); bad {
+		t.Errorf("Expected: not checked across a gap, got %+v\n", a)
+	}
+	// the table can be customised
+	custom := &TransitionValidator{Table: map[Transition]bool{{breathing, initializing}: true}}
+	if a, bad := check(custom, breathing, initializing, 1); bad {
+		t.Errorf("Expected: legal in the custom table, got %+v\n", a)
+	}
+	if _, bad := check(custom, tracking, breathing, 1); !bad {
+		t.Errorf("Expected: illegal outside the custom table\n")
+	}
+}
+
+func TestRunTransitions(t *testing.T) {
+	f, sensor := newFakeSensor(0)
+	defer sensor.Close()
+	m := NewModule(f, "respiration")
+	m.Timeout = time.Second
+	m.Transitions = NewTransitionValidator()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream := make(chan interface{}, 16)
+	go m.RunContext(ctx, stream)
+
+	var counter uint32
+	next := func() interface{} {
+		t.Helper()
+		select {
+		case data := <-stream:
+			return data
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for frame")
+		}
+		return nil
+	}
+	send := func(state respirationState, anomaly bool) {
+		t.Helper()
+		counter++
+		p, err := MarshalPayload(Respiration{Status: respApp, Counter: counter, State: state, SignalQuality: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sensor.send(p)
+		data := next()
+		if a, ok := data.(AnomalousTransition); ok != anomaly || (ok && (a.To != state || a.Counter != counter)) {
+			t.Errorf("frame %d Expected: anomaly %v, got %+v\n", counter, anomaly, data)
+		}
+		if anomaly {
+			data = next()
+		}
+		// the frame is still delivered
+		if resp, ok := data.(Respiration); !ok || resp.Counter != counter {
+			t.Errorf("frame %d Expected: the frame, got %+v\n", counter, data)
+		}
+	}
+
+	send(initializing, false)
+	send(noMovement, false)
+	send(tracking, false)
+	send(breathing, false)
+	send(initializing, true)
+	send(breathing, true)
+	// a settings change restarts the state machine
+	if err := m.SetSensitivity(3); err != nil {
+		t.Fatal(err)
+	}
+	send(initializing, false)
+	send(movement, false)
+}
@@ -0,0 +1,110 @@
+package xethru
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidConfig is wrapped by a ConfigError.
+var ErrInvalidConfig = errors.New("invalid configuration")
+
+// ConfigError is returned by Validate, Field names the Module field at fault.
+type ConfigError struct {
+	Field  string
+	Reason string
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("%v: %s %s", ErrInvalidConfig, e.Field, e.Reason)
+}
+
+// Unwrap returns ErrInvalidConfig.
+func (e *ConfigError) Unwrap() error {
+	return ErrInvalidConfig
+}
+
+// maxSensitivity is the highest sensitivity the app accepts.
+const maxSensitivity = 9
+
+// Validate checks the configuration Setup sends to the sensor. A zero
+// detection zone is the zero value of a Module rather than a choice, so it
+// is rejected unless AllowDefaults is set, otherwise the sensor may accept a
+// zone it can detect nothing in.
+func (r *Module) Validate() error {
+	if r.AppID == (AppID{}) {
+		return &ConfigError{Field: "AppID", Reason: "is not set"}
+	}
+	if r.LEDMode > LEDInhalation {
+		return &ConfigError{Field: "LEDMode", Reason: fmt.Sprintf("%d is not a led mode", r.LEDMode)}
+	}
+	if r.Sensitivity > maxSensitivity {
+		return &ConfigError{Field: "Sensitivity", Reason: fmt.Sprintf("%d is above %d", r.Sensitivity, maxSensitivity)}
+	}
+	if r.zoneUnset() {
+		if r.AllowDefaults {
+			return nil
+		}
+		return &ConfigError{Field: "DetectionZoneEnd", Reason: "is not set"}
+	}
+	if r.DetectionZoneStart < 0 {
+		return &ConfigError{Field: "DetectionZoneStart", Reason: fmt.Sprintf("%2.2f is negative", r.DetectionZoneStart)}
+	}
+	if r.DetectionZoneEnd <= r.DetectionZoneStart {
+		return &ConfigError{Field: "DetectionZoneEnd", Reason: fmt.Sprintf("%2.2f is not after DetectionZoneStart %2.2f", r.DetectionZoneEnd, r.DetectionZoneStart)}
+	}
+	return nil
+}
+
+func (r *Module) zoneUnset() bool {
+	return r.DetectionZoneStart == 0 && r.DetectionZoneEnd == 0
+}
+
+// Setup validates the configuration then loads the app and sends the led
+// mode, detection zone and sensitivity, ready for Run.
+func (r *Module) Setup() error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+	if err := r.Load(); err != nil {
+		return err
+	}
+	if r.Pipeline {
+		return r.setupPipelined()
+	}
+	if err := r.SetLEDMode(); err != nil {
+		return err
+	}
+	if !r.zoneUnset() {
+		if err := r.SetDetectionZone(float64(r.DetectionZoneStart), float64(r.DetectionZoneEnd)); err != nil {
+			return err
+		}
+	}
+	return r.SetSensitivity(int(r.Sensitivity))
+}
+
+// setupPipelined sends the settings Setup makes after loading the app with
+// ExecuteAll, they are order independent so are written without waiting for
+// each ack.
+func (r *Module) setupPipelined() error {
+	cmds := [][]byte{r.ledModeCmd()}
+	steps := []string{"led mode"}
+	if !r.zoneUnset() {
+		cmds = append(cmds, r.detectionZoneCmd())
+		steps = append(steps, "detection zone")
+	}
+	cmds = append(cmds, r.sensitivityCmd())
+	steps = append(steps, "sensitivity")
+
+	r.log().Debugf("pipelining %d setup commands", len(cmds))
+	if _, err := r.ExecuteAll(cmds, x2m200Ack, r.Timeout); err != nil {
+		var be *BatchError
+		if errors.As(err, &be) {
+			return fmt.Errorf("failed to set %s: %w", steps[be.Index], err)
+		}
+		return err
+	}
+	if r.VerifyZone && !r.zoneUnset() {
+		return r.verifyDetectionZone(float64(r.DetectionZoneStart), float64(r.DetectionZoneEnd))
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package xethru
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		set   func(m *Module)
+		field string
+	}{
+		{func(m *Module) {}, ""},
+		{func(m *Module) { m.AppID = [4]byte{} }, "AppID"},
+		{func(m *Module) { m.LEDMode = 4 }, "LEDMode"},
+		{func(m *Module) { m.Sensitivity = 10 }, "Sensitivity"},
+		{func(m *Module) { m.DetectionZoneStart, m.DetectionZoneEnd = 0, 0 }, "DetectionZoneEnd"},
+		{func(m *Module) { m.DetectionZoneStart = -0.5 }, "DetectionZoneStart"},
+		{func(m *Module) { m.DetectionZoneEnd = m.DetectionZoneStart }, "DetectionZoneEnd"},
+		{func(m *Module) { m.DetectionZoneEnd = 0.2 }, "DetectionZoneEnd"},
+		{func(m *Module) { m.DetectionZoneStart, m.DetectionZoneEnd, m.AllowDefaults = 0, 0, true }, ""},
+		// AllowDefaults does not allow a zone that was set badly
+		{func(m *Module) { m.DetectionZoneEnd, m.AllowDefaults = 0.2, true }, "DetectionZoneEnd"},
+	}
+	for n, c := range cases {
+		m := NewRespiration(nil)
+		m.DetectionZoneStart, m.DetectionZoneEnd, m.Sensitivity = 0.5, 1.5, 5
+		c.set(m)
+		err := m.Validate()
+		var configErr *ConfigError
+		switch {
+		case c.field == "" && err != nil:
+			t.Errorf("test %d Expected: <nil>, got %v\n", n, err)
+		case c.field != "" && (!errors.As(err, &configErr) || configErr.Field != c.field || !errors.Is(err, ErrInvalidConfig)):
+			t.Errorf("test %d Expected: %s, got %v\n", n, c.field, err)
+		}
+	}
+}
+
+func TestSetup(t *testing.T) {
+	sensor := &recordingSensor{SimulatedSensor: NewSimulatedSensor()}
+	defer sensor.Close()
+	m := NewRespiration(sensor)
+	m.Timeout = 100 * time.Millisecond
+
+	// nothing is sent for an unset zone
+	if err := m.Setup(); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected: %v, got %v\n", ErrInvalidConfig, err)
+	}
+	if cmds := sensor.commands(); len(cmds) != 0 {
+		t.Errorf("Expected: no commands, got %x\n", cmds)
+	}
+
+	m.AllowDefaults = true
+	if err := m.Setup(); err != nil {
+		t.Error(err)
+	}
+	if cmds := sensor.commands(); len(cmds) != 3 {
+		t.Errorf("Expected: load, led and sensitivity, got %x\n", cmds)
+	}
+
+	m.DetectionZoneStart, m.DetectionZoneEnd = 0.5, 1.5
+	if err := m.Setup(); err != nil {
+		t.Error(err)
+	}
+	if cmds := sensor.commands(); len(cmds) != 7 || cmds[5][0] != x2m200AppCommand {
+		t.Errorf("Expected: load, led, zone and sensitivity, got %x\n", cmds)
+	}
+}
@@ -0,0 +1,190 @@
+package xethru
+
+import (
+	"context"
+	"time"
+)
+
+// Condition is a predicate on a respiration frame used by a Watchdog.
+type Condition func(Respiration) bool
+
+// Conditions for the respiration states
+var (
+	Breathing  Condition = func(r Respiration) bool { return r.State == breathing }
+	Movement   Condition = func(r Respiration) bool { return r.State == movement }
+	NoMovement Condition = func(r Respiration) bool { return r.State == noMovement }
+)
+
+// Not returns a Condition that holds when c does not.
+func Not(c Condition) Condition {
+	return func(r Respiration) bool { return !c(r) }
+}
+
+// Or returns a Condition that holds when c or any of cs holds.
+func (c Condition) Or(cs ...Condition) Condition {
+	return func(r Respiration) bool {
+		if c(r) {
+			return true
+		}
+		for _, d := range cs {
+			if d(r) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// WatchdogEventKind says whether an alarm was raised or cleared.
+type WatchdogEventKind int
+
+// Watchdog event kinds
+const (
+	Alarm WatchdogEventKind = iota
+	AlarmCleared
+)
+
+// AlarmCause says why an alarm was raised.
+type AlarmCause int
+
+// Alarm causes
+const (
+	CauseCondition AlarmCause = iota // the condition held for the trigger duration
+	CauseNoData                      // no frames arrived for NoData
+)
+
+// WatchdogEvent is sent by a Watchdog when an alarm is raised or cleared.
+type WatchdogEvent struct {
+	Kind  WatchdogEventKind
+	Cause AlarmCause
+	Time  time.Time // when the event happened
+	Since time.Time // when the condition started to hold or the last frame arrived
+}
+
+// Watchdog raises an alarm when a condition holds for a duration, for
+// example no breathing for 30 seconds, or when frames stop arriving. Frames in
+// the initializing state are a grace period, they restart the duration but do
+// not clear an alarm.
+type Watchdog struct {
+	// NoData raises an alarm when no frame arrives for this long, zero
+	// disables it. NewWatchdog sets it to 10 seconds.
+	NoData time.Duration
+	// ClearAfter is how long the condition must not hold before an alarm is
+	// cleared, to stop an alarm flapping around the threshold.
+	ClearAfter time.Duration
+
+	cond  Condition
+	after time.Duration
+
+	alarm   bool
+	cause   AlarmCause
+	since   time.Time // condition has held since, zero if it does not hold
+	clear   time.Time // condition has not held since, zero if it holds
+	last    time.Time // last frame, or when the watchdog started
+	pending []WatchdogEvent
+}
+
+// NewWatchdog returns a Watchdog that raises an alarm when cond holds for
+// after.
+func NewWatchdog(cond Condition, after time.Duration) *Watchdog {
+	return &Watchdog{
+		NoData: 10 * time.Second,
+		cond:   cond,
+		after:  after,
+	}
+}
+
+// Run watches the Respiration frames received on in, other values are
+// ignored, and sends events on the returned channel. The channel is closed
+// when in is closed or ctx is done.
+func (w *Watchdog) Run(ctx context.Context, in <-chan interface{}) <-chan WatchdogEvent {
+	out := make(chan WatchdogEvent)
+	go func() {
+		defer close(out)
+		w.last = time.Now()
+		var tick <-chan time.Time
+		if w.NoData > 0 {
+			interval := w.NoData / 10
+			if interval < 10*time.Millisecond {
+				interval = 10 * time.Millisecond
+			}
+			t := time.NewTicker(interval)
+			defer t.Stop()
+			tick = t.C
+		}
+		for {
+			select {
+			case v, ok := <-in:
+				if !ok {
+					return
+				}
+				if r, ok := v.(Respiration); ok {
+					w.frame(time.Now(), r)
+				}
+			case now := <-tick:
+				w.tick(now)
+			case <-ctx.Done():
+				return
+			}
+			for _, e := range w.pending {
+				select {
+				case out <- e:
+				case <-ctx.Done():
+					return
+				}
+			}
+			w.pending = w.pending[:0]
+		}
+	}()
+	return out
+}
+
+// frame updates the watchdog with a frame received at now.
+func (w *Watchdog) frame(now time.Time, r Respiration) {
+	w.last = now
+	if w.alarm && w.cause == CauseNoData {
+		w.emit(AlarmCleared, now, w.since)
+		w.since = time.Time{}
+	}
+	if r.State == initializing {
+		w.since = time.Time{}
+		return
+	}
+	if w.cond(r) {
+		w.clear = time.Time{}
+		if w.since.IsZero() {
+			w.since = now
+		}
+		if !w.alarm && now.Sub(w.since) >= w.after {
+			w.cause = CauseCondition
+			w.emit(Alarm, now, w.since)
+		}
+		return
+	}
+	w.since = time.Time{}
+	if w.clear.IsZero() {
+		w.clear = now
+	}
+	if w.alarm && now.Sub(w.clear) >= w.ClearAfter {
+		w.emit(AlarmCleared, now, w.clear)
+	}
+}
+
+// tick raises a no data alarm if no frame has arrived for NoData.
+func (w *Watchdog) tick(now time.Time) {
+	if w.NoData <= 0 || now.Sub(w.last) < w.NoData || (w.alarm && w.cause == CauseNoData) {
+		return
+	}
+	if w.alarm {
+		w.emit(AlarmCleared, now, w.since)
+	}
+	w.since = time.Time{}
+	w.clear = time.Time{}
+	w.cause = CauseNoData
+	w.emit(Alarm, now, w.last)
+}
+
+func (w *Watchdog) emit(kind WatchdogEventKind, now, since time.Time) {
+	w.alarm = kind == Alarm
+	w.pending = append(w.pending, WatchdogEvent{Kind: kind, Cause: w.cause, Time: now, Since: since})
+}
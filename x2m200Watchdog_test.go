@@ -0,0 +1,107 @@
+package xethru
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWatchdogTimeline(t *testing.T) {
+	type step struct {
+		at    int // seconds
+		state respirationState
+		tick  bool // no frame, just check for no data
+	}
+	// kinds of the events expected, c for a condition alarm, n for no data,
+	// - for cleared
+	tests := []struct {
+		clearAfter time.Duration
+		steps      []step
+		want       string
+	}{
+		// breathing never alarms
+		{steps: []step{{0, breathing, false}, {20, breathing, false}, {40, breathing, false}}, want: ""},
+		// no movement for 30s alarms once, breathing clears it
+		{steps: []step{{0, noMovement, false}, {29, noMovement, false}, {30, noMovement, false}, {35, noMovement, false}, {36, breathing, false}}, want: "c-"},
+		// flapping just under the threshold never alarms
+		{steps: []step{{0, noMovement, false}, {29, noMovement, false}, {29, breathing, false}, {30, noMovement, false}, {59, noMovement, false}, {59, breathing, false}}, want: ""},
+		// initializing is a grace period that restarts the duration
+		{steps: []step{{0, noMovement, false}, {20, initializing, false}, {25, noMovement, false}, {50, noMovement, false}, {55, noMovement, false}}, want: "c"},
+		// an alarm flapping around the threshold is only cleared after clearAfter
+		{clearAfter: 5 * time.Second, steps: []step{{0, noMovement, false}, {30, noMovement, false}, {31, breathing, false}, {32, noMovement, false}, {33, breathing, false}, {37, breathing, false}, {38, breathing, false}}, want: "c-"},
+		// frames stopping alarms, frames starting again clears it
+		{steps: []step{{0, breathing, false}, {5, breathing, true}, {10, breathing, true}, {15, breathing, true}, {16, breathing, false}}, want: "n-"},
+		// no data replaces a condition alarm and restarts the duration
+		{steps: []step{{0, noMovement, false}, {30, noMovement, false}, {40, noMovement, true}, {41, noMovement, false}, {70, noMovement, false}, {71, noMovement, false}}, want: "c-n-c"},
+	}
+	start := time.Unix(0, 0)
+	for n, test := range tests {
+		w := NewWatchdog(NoMovement, 30*time.Second)
+		w.ClearAfter = test.clearAfter
+		w.last = start
+		var got string
+		for _, s := range test.steps {
+			now := start.Add(time.Duration(s.at) * time.Second)
+			if s.tick {
+				w.tick(now)
+			} else {
+				w.frame(now, Respiration{State: s.state})
+			}
+			for _, e := range w.pending {
+				switch {
+				case e.Kind == AlarmCleared:
+					got += "-"
+				case e.Cause == CauseNoData:
+					got += "n"
+				default:
+					got += "c"
+				}
+			}
+			w.pending = w.pending[:0]
+		}
+		if got != test.want {
+			t.Errorf("test %d Expected: %q, got %q\n", n, test.want, got)
+		}
+	}
+}
+
+func TestWatchdogRun(t *testing.T) {
+	w := NewWatchdog(Not(Breathing), 20*time.Millisecond)
+	w.NoData = 100 * time.Millisecond
+	in := make(chan interface{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := w.Run(ctx, in)
+
+	stop := make(chan struct{})
+	fed := make(chan struct{})
+	go func() {
+		defer close(fed)
+		for {
+			select {
+			case in <- Respiration{State: movement}:
+			case <-stop:
+				return
+			}
+			in <- BaseBandIQ{}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}()
+	e := <-events
+	close(stop)
+	<-fed
+	if e.Kind != Alarm || e.Cause != CauseCondition {
+		t.Errorf("Expected: condition alarm, got %+v\n", e)
+	}
+	in <- Respiration{State: breathing}
+	if e := <-events; e.Kind != AlarmCleared {
+		t.Errorf("Expected: cleared, got %+v\n", e)
+	}
+	// then nothing
+	if e := <-events; e.Kind != Alarm || e.Cause != CauseNoData {
+		t.Errorf("Expected: no data alarm, got %+v\n", e)
+	}
+	close(in)
+	for range events {
+	}
+}
@@ -0,0 +1,175 @@
+package xethru
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/NeuralSpaz/xethru/protocol"
+)
+
+// Protocol is the module communication protocol spoken by a sensor.
+type Protocol int
+
+// Protocols
+const (
+	// ProtocolX2M200 is the protocol of the X2M200 respiration module.
+	ProtocolX2M200 Protocol = iota
+	// ProtocolX4 is the protocol of the X4 based modules such as the X4M200
+	// and X4M300. The framing is the same as the X2M200, the messages are
+	// identified by their full content ID and there are presence messages
+	// and data responses.
+	ProtocolX4
+)
+
+const (
+	presenceSingleStartByte     = protocol.PresenceSingleID & 0xff
+	presenceMovingListStartByte = protocol.PresenceMovingListID & 0xff
+	dataResponse                = protocol.DataResponse
+)
+
+// PresenceState is the state reported in presence messages.
+type PresenceState uint32
+
+// Presence states
+const (
+	NoPresence           PresenceState = 0
+	Presence             PresenceState = 1
+	PresenceInitializing PresenceState = 2
+	PresenceUnknown      PresenceState = 3
+)
+
+func (s PresenceState) String() string {
+	switch s {
+	case NoPresence:
+		return "NoPresence"
+	case Presence:
+		return "Presence"
+	case PresenceInitializing:
+		return "PresenceInitializing"
+	case PresenceUnknown:
+		return "PresenceUnknown"
+	}
+	return fmt.Sprintf("PresenceState(%d)", uint32(s))
+}
+
+// PresenceSingle is an X4M300 presence message with the nearest target.
+type PresenceSingle struct {
+	Time          int64         `json:"time"`
+	Counter       uint32        `json:"counter"`
+	State         PresenceState `json:"state"`
+	Distance      float64       `json:"distance"`
+	Direction     byte          `json:"direction"`
+	SignalQuality uint32        `json:"signalquality"`
+}
+
+// PresenceMovingList is an X4M300 presence message with the movement in each
+// range interval and the targets detected.
+type PresenceMovingList struct {
+	Time         int64         `json:"time"`
+	Counter      uint32        `json:"counter"`
+	State        PresenceState `json:"state"`
+	MovementSlow []float64     `json:"movementslow"`
+	MovementFast []float64     `json:"movementfast"`
+	Distance     []float64     `json:"distance"`
+	RCS          []float64     `json:"rcs"`
+	Velocity     []float64     `json:"velocity"`
+}
+
+// DataFloat is an X4 data response carrying floats.
+type DataFloat struct {
+	Time      int64     `json:"time"`
+	ContentID uint32    `json:"contentid"`
+	Info      uint32    `json:"info"`
+	Data      []float64 `json:"data"`
+}
+
+// DataByte is an X4 data response carrying bytes.
+type DataByte struct {
+	Time      int64  `json:"time"`
+	ContentID uint32 `json:"contentid"`
+	Info      uint32 `json:"info"`
+	Data      []byte `json:"data"`
+}
+
+// parseProtocol parses b as a message of the protocol p.
+func parseProtocol(b []byte, format BasebandFormat, p Protocol) (interface{}, error) {
+	if p == ProtocolX4 {
+		return parseX4(b, format)
+	}
+	return parseWithFormat(b, format)
+}
+
+// parseX4 parses an X4 message, app data is identified by its full content
+// ID rather than its first byte.
+func parseX4(b []byte, format BasebandFormat) (interface{}, error) {
+	if len(b) > 0 && b[0] == dataResponse {
+		return parseData(b)
+	}
+	if len(b) < 5 || b[0] != appDataByte {
+		return parseWithFormat(b, format)
+	}
+	switch binary.LittleEndian.Uint32(b[1:5]) {
+	case uint32(respApp):
+		return parseRespiration(b)
+	case uint32(sleepApp):
+		return parseSleep(b)
+	case uint32(basebandAP):
+		return parseBaseBandAPFormat(b, format)
+	case uint32(basebandIQ):
+		return parseBaseBandIQFormat(b, format)
+	case movingListID:
+		return parseMovingList(b)
+	case protocol.PresenceSingleID:
+		return parsePresenceSingle(b)
+	case protocol.PresenceMovingListID:
+		return parsePresenceMovingList(b)
+	case pulseDopplerFloatID, noiseMapFloatID:
+		return parsePulseDopplerChunk(b)
+	}
+	return b, ErrParseNotImplemented
+}
+
+func parsePresenceSingle(b []byte) (PresenceSingle, error) {
+	p, err := protocol.ParsePresenceSingle(b)
+	if err != nil {
+		return PresenceSingle{}, err
+	}
+	return PresenceSingle{
+		Time:          clock().Now().UnixNano(),
+		Counter:       p.Counter,
+		State:         PresenceState(p.State),
+		Distance:      p.Distance,
+		Direction:     p.Direction,
+		SignalQuality: p.SignalQuality,
+	}, nil
+}
+
+func parsePresenceMovingList(b []byte) (PresenceMovingList, error) {
+	p, err := protocol.ParsePresenceMovingList(b)
+	if err != nil {
+		return PresenceMovingList{}, err
+	}
+	return PresenceMovingList{
+		Time:         clock().Now().UnixNano(),
+		Counter:      p.Counter,
+		State:        PresenceState(p.State),
+		MovementSlow: p.MovementSlow,
+		MovementFast: p.MovementFast,
+		Distance:     p.Distance,
+		RCS:          p.RCS,
+		Velocity:     p.Velocity,
+	}, nil
+}
+
+// parseData parses a data response as a DataFloat or DataByte.
+func parseData(b []byte) (interface{}, error) {
+	d, err := protocol.ParseData(b)
+	if err != nil {
+		return nil, err
+	}
+	t := clock().Now().UnixNano()
+	if d.Type == protocol.DataFloat {
+		return DataFloat{Time: t, ContentID: d.ContentID, Info: d.Info, Data: d.Float}, nil
+	}
+	return DataByte{Time: t, ContentID: d.ContentID, Info: d.Info, Data: d.Bytes}, nil
+}
@@ -0,0 +1,46 @@
+package xethru
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseX4(t *testing.T) {
+	useFakeClock(t)
+	resp := []byte{appDataByte, 0x26, 0xfe, 0x75, 0x23, 0x03, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x0e, 0x00, 0x00, 0x00, 0x00, 0x00, 0xc0, 0x3f, 0x00, 0x00, 0x00, 0x00, 0x05, 0x00, 0x00, 0x00}
+	presence := []byte{appDataByte, 0x1e, 0xfa, 0x3b, 0x72, 0x0a, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0xc0, 0x3f, 0x01, 0x05, 0x00, 0x00, 0x00}
+	list := []byte{appDataByte, 0x1f, 0xfa, 0x3b, 0x72, 0x02, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x3f, 0x00, 0x00, 0x80, 0x3f, 0x00, 0x00, 0x00, 0x00}
+	data := []byte{dataResponse, 0x01, 0x05, 0x00, 0x00, 0x00, 0x07, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x80, 0x3f}
+	bytes := []byte{dataResponse, 0x00, 0x05, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0xff}
+	// an X2M200 parser only looks at the first byte of the content id
+	unknown := []byte{appDataByte, 0x26, 0x00, 0x00, 0x00}
+
+	cases := []struct {
+		b     []byte
+		err   error
+		data  interface{}
+		frame FrameType
+	}{
+		{resp, nil, Respiration{Time: fakeClockTime, Status: respApp, Counter: 3, RPM: 14, Distance: 1.5, SignalQuality: 5, Valid: true}, FrameRespiration},
+		{presence, nil, PresenceSingle{Time: fakeClockTime, Counter: 10, State: Presence, Distance: 1.5, Direction: 1, SignalQuality: 5}, FramePresence},
+		{list, nil, PresenceMovingList{Time: fakeClockTime, Counter: 2, State: PresenceInitializing, MovementSlow: []float64{0.5}, MovementFast: []float64{1}}, FramePresence},
+		{data, nil, DataFloat{Time: fakeClockTime, ContentID: 5, Info: 7, Data: []float64{1}}, FrameData},
+		{bytes, nil, DataByte{Time: fakeClockTime, ContentID: 5, Data: []byte{0xff}}, FrameData},
+		{presence[:20], ErrParse, PresenceSingle{}, FramePresence},
+		{unknown, ErrParseNotImplemented, unknown, FrameRespiration},
+		{[]byte{ack}, nil, SystemMessage{Message: "Command Ack'ed"}, FrameAck},
+	}
+	for n, c := range cases {
+		data, err := parseProtocol(c.b, BasebandFloat, ProtocolX4)
+		if !errors.Is(err, c.err) {
+			t.Errorf("test %d Expected: %v, got %v\n", n, c.err, err)
+		}
+		if !reflect.DeepEqual(data, c.data) {
+			t.Errorf("test %d Expected: %#v, got %#v\n", n, c.data, data)
+		}
+		if got := frameType(c.b); got != c.frame {
+			t.Errorf("test %d Expected: frame type %d, got %d\n", n, c.frame, got)
+		}
+	}
+}
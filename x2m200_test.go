@@ -21,8 +21,10 @@ package xethru
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"io"
 	"io/ioutil"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -61,32 +63,34 @@ func x2m200ProtocolwithTransit(in []byte) ([]byte, []byte, error) {
 	return readback, transit, err
 }
 
-func TestX2M200Write(t *testing.T) {
+// writeVectors are payloads and the frames written for them.
+var writeVectors = []struct {
+	b      []byte
+	n      int
+	err    error
+	writen []byte
+}{
+	{[]byte{0x01, 0x02, 0x00}, 3, nil, []byte{0x7d, 0x01, 0x02, 0x00, 0x7f, 0x7e, 0x7e}},
+	{[]byte{0x00, 0x7c, 0x7f}, 3, nil, []byte{0x7d, 0x00, 0x7c, 0x7f, 0x7f, 0x7f, 0x7e, 0x7e}},
+	{[]byte{0x01, 0x02, 0x03}, 3, nil, []byte{0x7d, 0x01, 0x02, 0x03, 0x7f, 0x7d, 0x7e}},
+	{[]byte{0x00, 0x01, 0x02, 0x03}, 4, nil, []byte{0x7d, 0x00, 0x01, 0x02, 0x03, 0x7f, 0x7d, 0x7e}},
+	{[]byte{0x00, 0x01, 0x02, 0x7e}, 4, nil, []byte{0x7d, 0x00, 0x01, 0x02, 0x7f, 0x7e, 0x00, 0x7e}},
+	{[]byte{0x7e, 0x01, 0x02, 0x7e}, 4, nil, []byte{0x7d, 0x7f, 0x7e, 0x01, 0x02, 0x7f, 0x7e, 0x7f, 0x7e, 0x7e}},
+	{[]byte{0x7e, 0x7e, 0x02, 0x7e}, 4, nil, []byte{0x7d, 0x7f, 0x7e, 0x7f, 0x7e, 0x02, 0x7f, 0x7e, 0x01, 0x7e}},
+	{[]byte{0x7e, 0x7e, 0x7e, 0x7e}, 4, nil, []byte{0x7d, 0x7f, 0x7e, 0x7f, 0x7e, 0x7f, 0x7e, 0x7f, 0x7e, 0x7f, 0x7d, 0x7e}},
+	{[]byte{0x7d, 0x7d, 0x7f}, 3, nil, []byte{0x7d, 0x7f, 0x7d, 0x7f, 0x7d, 0x7f, 0x7f, 0x02, 0x7e}},
+	{[]byte{0x01, 0xee, 0xaa, 0xea, 0xae}, 5, nil, []byte{0x7d, 0x01, 0xee, 0xaa, 0xea, 0xae, 0x7c, 0x7e}},
+}
 
-	cases := []struct {
-		b      []byte
-		n      int
-		err    error
-		writen []byte
-	}{
-		{[]byte{0x01, 0x02, 0x00}, 6, nil, []byte{0x7d, 0x01, 0x02, 0x00, 0x7e, 0x7e}},
-		{[]byte{0x00, 0x7c, 0x7f}, 6, nil, []byte{0x7d, 0x00, 0x7c, 0x7f, 0x7e, 0x7e}},
-		{[]byte{0x01, 0x02, 0x03}, 6, nil, []byte{0x7d, 0x01, 0x02, 0x03, 0x7d, 0x7e}},
-		{[]byte{0x00, 0x01, 0x02, 0x03}, 7, nil, []byte{0x7d, 0x00, 0x01, 0x02, 0x03, 0x7d, 0x7e}},
-		{[]byte{0x00, 0x01, 0x02, 0x7e}, 8, nil, []byte{0x7d, 0x00, 0x01, 0x02, 0x7f, 0x7e, 0x00, 0x7e}},
-		{[]byte{0x7e, 0x01, 0x02, 0x7e}, 9, nil, []byte{0x7d, 0x7f, 0x7e, 0x01, 0x02, 0x7f, 0x7e, 0x7e, 0x7e}},
-		{[]byte{0x7e, 0x7e, 0x02, 0x7e}, 10, nil, []byte{0x7d, 0x7f, 0x7e, 0x7f, 0x7e, 0x02, 0x7f, 0x7e, 0x01, 0x7e}},
-		{[]byte{0x7e, 0x7e, 0x7e, 0x7e}, 11, nil, []byte{0x7d, 0x7f, 0x7e, 0x7f, 0x7e, 0x7f, 0x7e, 0x7f, 0x7e, 0x7d, 0x7e}},
-		{[]byte{0x01, 0xee, 0xaa, 0xea, 0xae}, 8, nil, []byte{0x7d, 0x01, 0xee, 0xaa, 0xea, 0xae, 0x7c, 0x7e}},
-	}
-	for _, c := range cases {
+func TestX2M200Write(t *testing.T) {
+	for _, c := range writeVectors {
 		var b bytes.Buffer
 		w := bufio.NewWriter(&b)
 		x := NewXethruWriter(w)
 		n, err := x.Write(c.b)
 		w.Flush()
 
-		if err != c.err {
+		if !errors.Is(err, c.err) {
 			t.Errorf("Expected: %v, got %v\n", c.err, err)
 		}
 		if n != c.n {
@@ -113,13 +117,13 @@ func TestX2M200Read(t *testing.T) {
 		{[]byte{0x7e, 0x01, 0x02, 0x7e}, nil, []byte{0x7d, 0x7f, 0x7e, 0x01, 0x02, 0x7f, 0x7e, 0x7e, 0x7e}},
 		{[]byte{0x7e, 0x7e, 0x02, 0x7e}, nil, []byte{0x7d, 0x7f, 0x7e, 0x7f, 0x7e, 0x02, 0x7f, 0x7e, 0x01, 0x7e}},
 		{[]byte{0x7e, 0x7e, 0x7e, 0x7e}, nil, []byte{0x7d, 0x7f, 0x7e, 0x7f, 0x7e, 0x7f, 0x7e, 0x7f, 0x7e, 0x7d, 0x7e}},
-		{[]byte{0x01, 0x02, 0x03}, errPacketNoStartByte, []byte{0x1d, 0x01, 0x02, 0x03, 0x7d, 0x7e}},
+		{[]byte{0x01, 0x02, 0x03}, ErrPacketNoStartByte, []byte{0x1d, 0x01, 0x02, 0x03, 0x7d, 0x7e}},
 		{[]byte{}, io.EOF, []byte{}},
 		{[]byte{}, io.EOF, []byte{0x7d}},
-		{[]byte{0x01, 0x02, 0x03}, errPacketBadCRC, []byte{0x7d, 0x01, 0x02, 0x03, 0x71, 0x7e}},
-		{[]byte{0x01, 0x02, 0x03}, errProtocolErrorNotReconsied, []byte{0x7d, 0x20, 0x01, 0x5c, 0x7e}},
-		{[]byte{0x01, 0x02, 0x03}, errProtocolErrorCRCfailed, []byte{0x7d, 0x20, 0x02, 0x5f, 0x7e}},
-		{[]byte{0x01, 0x02, 0x03}, errProtocolErrorInvaidAppID, []byte{0x7d, 0x20, 0x03, 0x5e, 0x7e}},
+		{[]byte{0x01, 0x02, 0x03}, ErrPacketBadCRC, []byte{0x7d, 0x01, 0x02, 0x03, 0x71, 0x7e}},
+		{[]byte{0x01, 0x02, 0x03}, ErrProtocolNotRecognised, []byte{0x7d, 0x20, 0x01, 0x5c, 0x7e}},
+		{[]byte{0x01, 0x02, 0x03}, ErrProtocolCRCFailed, []byte{0x7d, 0x20, 0x02, 0x5f, 0x7e}},
+		{[]byte{0x01, 0x02, 0x03}, ErrProtocolInvalidAppID, []byte{0x7d, 0x20, 0x03, 0x5e, 0x7e}},
 		{[]byte{}, nil, []byte{0x7d, 0x7d, 0x7e}},
 	}
 
@@ -131,7 +135,7 @@ func TestX2M200Read(t *testing.T) {
 		n, err := x.Read(b)
 		readback := b[:n]
 
-		if err != c.err {
+		if !errors.Is(err, c.err) {
 			t.Errorf("Expected: %s, got %s\n", c.err, err)
 		}
 
@@ -181,3 +185,230 @@ func newLoopBackXethru() (Framer, chan []byte, chan []byte) {
 
 	return client, sensorSend, sensorRecive
 }
+
+// chunkReader returns one chunk per Read
+type chunkReader struct {
+	chunks [][]byte
+}
+
+func (c *chunkReader) Read(b []byte) (int, error) {
+	if len(c.chunks) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(b, c.chunks[0])
+	c.chunks[0] = c.chunks[0][n:]
+	if len(c.chunks[0]) == 0 {
+		c.chunks = c.chunks[1:]
+	}
+	return n, nil
+}
+
+func TestX2M200ReadSplitFrames(t *testing.T) {
+	cases := []struct {
+		readback []byte
+		writeout []byte
+	}{
+		{[]byte{0x01, 0x02, 0x00}, []byte{0x7d, 0x01, 0x02, 0x00, 0x7f, 0x7e, 0x7e}},
+		{[]byte{0x7e, 0x7e, 0x02, 0x7e}, []byte{0x7d, 0x7f, 0x7e, 0x7f, 0x7e, 0x02, 0x7f, 0x7e, 0x01, 0x7e}},
+		{[]byte{0x00, 0x7c, 0x7f}, []byte{0x7d, 0x00, 0x7c, 0x7f, 0x7f, 0x7e, 0x7e}},
+		{respirationPayload, encodeFrame(respirationPayload)},
+	}
+	for n, c := range cases {
+		for split := 1; split < len(c.writeout); split++ {
+			r := &chunkReader{chunks: [][]byte{
+				append([]byte{}, c.writeout[:split]...),
+				append([]byte{}, c.writeout[split:]...),
+			}}
+			x := NewXethruReader(r)
+			b := make([]byte, 1024)
+			m, err := x.Read(b)
+			if err != nil {
+				t.Errorf("test %d split %d unexpected error %v\n", n, split, err)
+				continue
+			}
+			if !bytes.Equal(b[:m], c.readback) {
+				t.Errorf("test %d split %d Expected: %x, got %x\n", n, split, c.readback, b[:m])
+			}
+		}
+	}
+}
+
+func TestX2M200ReadManyFramesPerRead(t *testing.T) {
+	payloads := [][]byte{respirationPayload, {x2m200Ack}, {0x7e, 0x7d, 0x7f}}
+	var wire []byte
+	for _, p := range payloads {
+		wire = append(wire, encodeFrame(p)...)
+	}
+	x := NewXethruReader(&chunkReader{chunks: [][]byte{wire}})
+	for n, p := range payloads {
+		b := make([]byte, 1024)
+		m, err := x.Read(b)
+		if err != nil || !bytes.Equal(b[:m], p) {
+			t.Errorf("frame %d Expected: %x, got %x %v\n", n, p, b[:m], err)
+		}
+	}
+	if _, err := x.Read(make([]byte, 1024)); err != io.EOF {
+		t.Errorf("Expected: %v, got %v\n", io.EOF, err)
+	}
+}
+
+func TestX2M200ReadErrorDetails(t *testing.T) {
+	x := NewXethruReader(bytes.NewReader([]byte{0x1d, 0x01, 0x7d, 0x7e, 0x7d, 0x01, 0x02, 0x03, 0x71, 0x7e, 0x7d, 0x20, 0x03, 0x5e, 0x7e}))
+	b := make([]byte, 1024)
+
+	var frameErr *FramingError
+	_, err := x.Read(b)
+	if !errors.As(err, &frameErr) || frameErr.Reason != ErrPacketNoStartByte || frameErr.Offset != 0 {
+		t.Errorf("Expected: no start byte at offset 0, got %v\n", err)
+	}
+	_, err = x.Read(b)
+	if !errors.As(err, &frameErr) || frameErr.Reason != ErrPacketNotLongEnough || frameErr.Offset != 3 {
+		t.Errorf("Expected: not long enough at offset 3, got %v\n", err)
+	}
+
+	var crcErr *CRCError
+	_, err = x.Read(b)
+	if !errors.As(err, &crcErr) || crcErr.Expected != 0x7d || crcErr.Got != 0x71 {
+		t.Errorf("Expected: crc expected 0x7d got 0x71, got %v\n", err)
+	}
+
+	_, err = x.Read(b)
+	if !errors.Is(err, ErrProtocol) || !errors.Is(err, ErrProtocolInvalidAppID) {
+		t.Errorf("Expected: %v, got %v\n", ErrProtocolInvalidAppID, err)
+	}
+}
+
+func TestX2M200WriteMultiWriter(t *testing.T) {
+	in := []byte{0x7e, 0x01, 0x02, 0x7e}
+	orig := append([]byte(nil), in...)
+
+	var framed, copied bytes.Buffer
+	w := io.MultiWriter(NewXethruWriter(&framed), &copied)
+	n, err := w.Write(in)
+	if err != nil {
+		t.Errorf("Expected: %v, got %v\n", nil, err)
+	}
+	if n != len(in) {
+		t.Errorf("Expected: %d, got %d\n", len(in), n)
+	}
+	if !bytes.Equal(in, orig) {
+		t.Errorf("Expected: %x, got %x\n", orig, in)
+	}
+	if !bytes.Equal(copied.Bytes(), orig) {
+		t.Errorf("Expected: %x, got %x\n", orig, copied.Bytes())
+	}
+	want := []byte{0x7d, 0x7f, 0x7e, 0x01, 0x02, 0x7f, 0x7e, 0x7f, 0x7e, 0x7e}
+	if !bytes.Equal(framed.Bytes(), want) {
+		t.Errorf("Expected: %x, got %x\n", want, framed.Bytes())
+	}
+}
+
+// flakyWriter fails its first write.
+type flakyWriter struct {
+	io.Writer
+	failed bool
+}
+
+func (w *flakyWriter) Write(p []byte) (int, error) {
+	if !w.failed {
+		w.failed = true
+		return 0, errors.New("write timed out")
+	}
+	return w.Writer.Write(p)
+}
+
+func TestFramerWriteBuffer(t *testing.T) {
+	payloads := [][]byte{respirationPayload, {resetCmd}, bytes.Repeat([]byte{escByte, 0x01}, 100)}
+	cases := []struct {
+		opts []FramerOption
+	}{
+		{},
+		{opts: []FramerOption{WithWriteBuffer(0)}},
+		// frames larger than the buffer
+		{opts: []FramerOption{WithWriteBuffer(16)}},
+	}
+	for n, c := range cases {
+		var wire bytes.Buffer
+		var writes atomic.Int64
+		f := NewFramer(struct {
+			io.Reader
+			io.Writer
+		}{&wire, countingWriter{&wire, &writes}}, c.opts...)
+		for _, p := range payloads {
+			if _, err := f.Write(p); err != nil {
+				t.Errorf("test %d Expected: <nil>, got %v\n", n, err)
+			}
+		}
+		if w := writes.Load(); w != int64(len(payloads)) {
+			t.Errorf("test %d Expected: one write per frame, got %d for %d frames\n", n, w, len(payloads))
+		}
+		for _, p := range payloads {
+			got, err := f.(*x2m200Frame).ReadPayload()
+			if err != nil || !bytes.Equal(got, p) {
+				t.Errorf("test %d Expected: %x, got %x %v\n", n, p, got, err)
+			}
+		}
+	}
+}
+
+func TestFramerWriteBufferRecovers(t *testing.T) {
+	var wire bytes.Buffer
+	f := NewFramer(struct {
+		io.Reader
+		io.Writer
+	}{&wire, &flakyWriter{Writer: &wire}})
+	if _, err := f.Write([]byte{resetCmd}); err == nil {
+		t.Errorf("Expected: the write to fail\n")
+	}
+	// nothing from the failed write is left buffered
+	if _, err := f.Write(respirationPayload); err != nil {
+		t.Errorf("Expected: <nil>, got %v\n", err)
+	}
+	if !bytes.Equal(wire.Bytes(), EncodeFrame(respirationPayload)) {
+		t.Errorf("Expected: %x, got %x\n", EncodeFrame(respirationPayload), wire.Bytes())
+	}
+}
+
+func TestFramerResetBuffered(t *testing.T) {
+	for _, size := range []int{0, 16, defaultIOBufferSize} {
+		// a respiration frame and both acks are all read into the buffer at
+		// once, the handshake still sees them one at a time
+		var in bytes.Buffer
+		in.Write(EncodeFrame(respirationPayload))
+		in.Write(EncodeFrame([]byte{x2m200Ack}))
+		in.Write(EncodeFrame([]byte{x2m200Ack}))
+		var out bytes.Buffer
+		f := NewFramer(struct {
+			io.Reader
+			io.Writer
+		}{&in, &out}, WithReadBuffer(size))
+		ok, err := f.Reset()
+		if !ok || err != nil {
+			t.Errorf("buffer %d Expected: reset, got %v %v\n", size, ok, err)
+		}
+		if !bytes.HasSuffix(out.Bytes(), EncodeFrame([]byte{resetCmd})) {
+			t.Errorf("buffer %d Expected: the reset command written last, got %x\n", size, out.Bytes())
+		}
+	}
+}
+
+// emptyReader returns nothing and no error from every read.
+type emptyReader struct{}
+
+func (emptyReader) Read([]byte) (int, error) { return 0, nil }
+
+func TestX2M200ReadNoProgress(t *testing.T) {
+	x := NewXethruReader(emptyReader{})
+	if _, err := x.Read(make([]byte, 1024)); err != io.ErrNoProgress {
+		t.Errorf("Expected: %v, got %v\n", io.ErrNoProgress, err)
+	}
+}
+
+func TestX2M200ReadShortBuffer(t *testing.T) {
+	x := NewXethruReader(bytes.NewReader(encodeFrame(respirationPayload)))
+	b := make([]byte, 4)
+	n, err := x.Read(b)
+	if !errors.Is(err, io.ErrShortBuffer) || n != len(b) || !bytes.Equal(b, respirationPayload[:4]) {
+		t.Errorf("Expected: %x and %v, got %x %v\n", respirationPayload[:4], io.ErrShortBuffer, b[:n], err)
+	}
+}
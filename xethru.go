@@ -20,29 +20,98 @@
 // Package xethru: An open source implementation driver for xethru sensor modules.
 // The current state of the api is still unstable and under active development.
 // Contributions are welcome.
+//
+// Commands whose codes are not given by the X2M200 datasheet examples this
+// package was written from are unexported until they have been checked
+// against the module's protocol documentation. A wrong code can write the
+// wrong flash file, strand the module at an unknown baud rate or in a mode
+// the host does not know about, or leave it unable to boot, so they are not
+// part of the api until then. The files defining them say which values are
+// unverified.
 package xethru
 
 import (
 	"bufio"
 	"io"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
-// Open Creates a x2m200 xethu serial protocol from a io.ReadWriter
-// it implements io.Reader and io.Writer
-func Open(device string, port io.ReadWriteCloser) Framer {
-	// fmt.Println("New instance of Xethru")
-	// if device == "x2m200" {
+// NewFramer creates a Framer for the xethru serial protocol on rw. If rw is
+// also an io.Closer, Close will close it. If rw has SetReadDeadline and
+// SetWriteDeadline methods, as a net.Conn does, they are used to bound
+// command reads and writes. Reads and writes are buffered, each frame is
+// flushed as soon as it is written, see WithReadBuffer and WithWriteBuffer.
+func NewFramer(rw io.ReadWriter, opts ...FramerOption) Framer {
+	c := framerConfig{readBuffer: defaultIOBufferSize, writeBuffer: defaultIOBufferSize}
+	for _, opt := range opts {
+		opt(&c)
+	}
 	x := &x2m200Frame{
-		w: port,
-		r: bufio.NewReader(port),
-		c: port,
+		w:      rw,
+		r:      rw,
+		c:      nopCloser{},
+		resync: true,
+	}
+	if c.readBuffer > 0 {
+		x.r = bufio.NewReaderSize(rw, c.readBuffer)
+	}
+	if c.writeBuffer > 0 {
+		x.bw = bufio.NewWriterSize(rw, c.writeBuffer)
+	}
+	if c, ok := rw.(io.Closer); ok {
+		x.c = c
 	}
-	// TODO: disable all feeds
+	x.d, _ = rw.(deadliner)
 	return x
 }
 
+// defaultIOBufferSize is the size of the read and write buffers of a Framer.
+const defaultIOBufferSize = 4096
+
+type framerConfig struct {
+	readBuffer  int
+	writeBuffer int
+}
+
+// FramerOption configures NewFramer.
+type FramerOption func(*framerConfig)
+
+// WithReadBuffer sets the size of the buffer reads from the transport go
+// through, zero or less reads from it directly.
+func WithReadBuffer(n int) FramerOption {
+	return func(c *framerConfig) { c.readBuffer = n }
+}
+
+// WithWriteBuffer sets the size of the buffer frames are written to before
+// being flushed to the transport, zero or less writes to it directly. A frame
+// larger than the buffer is still written with a single write.
+func WithWriteBuffer(n int) FramerOption {
+	return func(c *framerConfig) { c.writeBuffer = n }
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
 // Framer is a wrapper for a serial protocol. it inserts the start, crc and end bytes for you
+//
+// Implementations must follow this contract:
+//
+// Write takes a single unframed payload, adds the start byte, escapes the
+// payload, appends the crc and end byte and writes the frame to the device.
+//
+// Read returns exactly one de-framed payload per call, with the start, crc
+// and end bytes removed and escapes undone. Frames with a bad crc or that
+// contain a protocol error return an error.
+//
+// Close closes the underlying transport.
+//
+// Reset performs the device reset handshake, it returns true once the device
+// has acknowledged the reset.
+//
+// The xethrutest package contains a conformance test for implementations.
 type Framer interface {
 	io.Writer
 	io.Reader
@@ -52,12 +121,80 @@ type Framer interface {
 
 type Module struct {
 	f                  Framer
-	AppID              [4]byte
+	AppID              AppID
 	LEDMode            ledMode
 	DetectionZoneStart float32
 	DetectionZoneEnd   float32
+	VerifyZone         bool    // SetDetectionZone reads back the zone the module applied
+	ZoneTolerance      float64 // meters the applied zone may move before it is an error, zero is 0.01
 	Sensitivity        uint32
+	AllowDefaults      bool           // Setup leaves an unset detection zone at the firmware default
+	Pipeline           bool           // Setup writes its settings without waiting for each ack, see ExecuteAll
+	MinSignalQuality   float64        // respiration frames below it are gated, zero disables the gate
+	QualityGate        GateMode       // what happens to gated frames
+	KeepRaw            bool           // attach a copy of each payload to the frames parsed from it
+	DropDuplicates     bool           // drop a frame with the same Counter as the previous one of its type
+	StreamBuffer       int            // frames Run queues for a slow stream consumer, zero sends directly
+	StreamPolicy       DeliveryPolicy // what Run does when StreamBuffer is full
+	Limits             *Limits        // sanity checks on parsed frames, nil uses DefaultLimits
 	Timeout            time.Duration
+	ResetTimeout       time.Duration           // how long a reset waits for the sensor to be ready, zero is 5 seconds
+	ResetLine          func(assert bool) error // drives the sensor's reset line, Reset falls back to HardReset with it when set
+	ResetHold          time.Duration           // how long Reset holds ResetLine asserted, zero is 100ms
+	BasebandFormat     BasebandFormat
+	Protocol           Protocol // message protocol, the default is ProtocolX2M200
 	Data               chan interface{}
+	Logger             Logger               // nil uses the Framer's Logger
+	Metrics            MetricsSink          // nil uses the Framer's MetricsSink
+	ResetOnShutdown    bool                 // Shutdown resets the sensor before closing the transport
+	ParsePool          *ParsePool           // parse app data frames on a shared pool, unless given a Dispatcher
+	DriftAlarm         *DriftAlarm          // report respiration frame rate drift to OnError, nil disables it
+	Transitions        *TransitionValidator // check respiration state transitions in Run, see AnomalousTransition, nil disables it
+	SettleTime         time.Duration        // frames after a detection zone or sensitivity change are Settling for up to this long, zero disables it
 	// parser             func(b []byte) (interface{}, error)
+
+	readerOnce sync.Once
+	dispatcher *Dispatcher
+	frames     <-chan Frame
+	broadcast  respirationBroadcast
+
+	movingListMu sync.Mutex // guards movingList, which is replaced after each Run
+	movingList   chan movingList
+
+	pulseDoppler pulseDopplerAssembler // only used by Run
+
+	handlersMu    sync.Mutex // guards running and the handlers until Run starts
+	running       bool
+	onRespiration []func(Respiration)
+	onError       []func(error)
+	reconfigure   func() error
+	sink          *sinkTee
+
+	gated atomic.Uint64 // frames gated by MinSignalQuality
+
+	lastCounter       map[FrameType]uint32 // only used by Run
+	booting           bool                 // only used by Run, the sensor said it is booting
+	baudRate          int                  // current uart rate set by setBaudRate, zero is the default 115200
+	flashTimeout      time.Duration        // timeout of storeParameterFile, zero is 2 seconds
+	systemTestTimeout time.Duration        // timeout of runSystemTest, zero is 5 seconds
+	duplicates        atomic.Uint64
+	dropped           atomic.Uint64 // frames dropped by the Delivery policy
+	rate              RateMeter     // respiration frame rate, see Stats
+
+	statesRestarted atomic.Bool // the state machine restarted since Run last checked a transition
+
+	settling     atomic.Pointer[settleWindow] // the open settling window, nil when closed
+	settleWindow *settleWindow                // only used by Run, the settling window being tracked
+	settleLost   bool                         // only used by Run, the state machine left breathing or movement in the window
+
+	sleepMu sync.Mutex
+	asleep  bool
+
+	profileMu     sync.Mutex
+	profile       Profile
+	profileLoaded bool
+
+	latestMu sync.RWMutex
+	latest   Respiration
+	latestAt time.Time
 }
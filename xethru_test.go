@@ -0,0 +1,35 @@
+package xethru_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/NeuralSpaz/xethru"
+	"github.com/NeuralSpaz/xethru/xethrutest"
+)
+
+func TestNewFramer(t *testing.T) {
+	var loopback bytes.Buffer
+	xethrutest.TestFramer(t, xethru.NewFramer(&loopback))
+}
+
+func ExampleSimulatedSensor() {
+	sensor := xethru.NewSimulatedSensor()
+	defer sensor.Close()
+
+	m := xethru.NewModule(sensor, "respiration")
+	if err := m.Load(); err != nil {
+		fmt.Println(err)
+		return
+	}
+	stream := make(chan interface{})
+	go m.Run(stream)
+	for d := range stream {
+		if r, ok := d.(xethru.Respiration); ok {
+			fmt.Println("rpm", r.RPM)
+			return
+		}
+	}
+	// Output: rpm 14
+}
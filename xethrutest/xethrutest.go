@@ -0,0 +1,63 @@
+// Package xethrutest provides utilities for testing xethru Framer
+// implementations.
+package xethrutest
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/NeuralSpaz/xethru"
+)
+
+// Payloads is the set of payloads written by TestFramer, they include the
+// protocol's control bytes so escaping is exercised.
+var Payloads = [][]byte{
+	{0x01},
+	{0x01, 0x02, 0x03},
+	{0x50, 0x26, 0x7e, 0x00, 0x7e},
+	{0x7e, 0x7e, 0x7e, 0x7e},
+	{0x01, 0xee, 0xaa, 0xea, 0xae},
+}
+
+// TestFramer checks that f follows the Framer contract. f must be connected to
+// a loopback transport, so that every frame it writes is read back.
+//
+// Each payload is written as a single frame and must be read back exactly
+// once, unchanged, by a single Read.
+func TestFramer(t *testing.T, f xethru.Framer) {
+	for n, p := range Payloads {
+		sent := append([]byte(nil), p...)
+		if _, err := f.Write(sent); err != nil {
+			t.Fatalf("payload %d Write error %v\n", n, err)
+		}
+		b := make([]byte, 1024)
+		m, err := f.Read(b)
+		if err != nil {
+			t.Fatalf("payload %d Read error %v\n", n, err)
+		}
+		if !bytes.Equal(b[:m], p) {
+			t.Errorf("payload %d Expected: %x, got %x\n", n, p, b[:m])
+		}
+	}
+
+	// many frames written before reading must come back in order
+	for _, p := range Payloads {
+		if _, err := f.Write(append([]byte(nil), p...)); err != nil {
+			t.Fatalf("Write error %v\n", err)
+		}
+	}
+	for n, p := range Payloads {
+		b := make([]byte, 1024)
+		m, err := f.Read(b)
+		if err != nil {
+			t.Fatalf("payload %d Read error %v\n", n, err)
+		}
+		if !bytes.Equal(b[:m], p) {
+			t.Errorf("payload %d Expected: %x, got %x\n", n, p, b[:m])
+		}
+	}
+
+	if err := f.Close(); err != nil {
+		t.Errorf("Close error %v\n", err)
+	}
+}